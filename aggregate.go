@@ -0,0 +1,167 @@
+package runner
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	"pkg.goda.sh/tasks"
+)
+
+const (
+	// ResultsChannel is the subject results are published on
+	ResultsChannel = "runner:results"
+	// MergedChannel is the subject merged results of broadcast tasks are published on
+	MergedChannel = "runner:merged"
+)
+
+// Report is a task result as published to other runners
+type Report struct {
+	Machine   string          `json:"machine"`
+	Location  string          `json:"location"`
+	Key       string          `json:"key"`
+	Task      tasks.CleanTask `json:"task"`
+	Error     string          `json:"error,omitempty"`
+	Quorum    int             `json:"quorum,omitempty"`
+	Broadcast bool            `json:"broadcast,omitempty"`
+	Received  int64           `json:"received,omitempty"` // Set by the aggregating runner, in ms
+}
+
+// staleIntervals is how many intervals of its task a report stays in its aggregate for,
+// machines that stopped reporting no longer count
+const staleIntervals = 3
+
+// Failed reports whether the result is a failure
+func (rep Report) Failed() bool {
+	return rep.Task.Warn || rep.Error != ""
+}
+
+// Aggregate is the merged view of a task across every machine reporting it
+type Aggregate struct {
+	Key       string            `json:"key"`
+	Label     string            `json:"label"`
+	Task      string            `json:"task"`
+	Results   map[string]Report `json:"results"` // Keyed by MachineID
+	Updated   int64             `json:"updated"`
+	Quorum    int               `json:"quorum,omitempty"`
+	Broadcast bool              `json:"broadcast,omitempty"`
+	Failing   int               `json:"failing"` // Number of machines currently reporting a failure
+	Down      bool              `json:"down"`
+}
+
+// publish sends a result to other runners when a Transport is configured
+func (r *Runner) publish(t tasks.Task, result tasks.Result) {
+	if r.transport == nil {
+		return
+	}
+	r.mu.RLock()
+	key := r.keys[t.ID]
+	r.mu.RUnlock()
+	report := Report{
+		Machine:  r.Identity.MachineID,
+		Location: result.Location,
+		Key:      key,
+		Task:     tasks.CleanTask(t),
+	}
+	if spec := r.spec(t.ID); spec.Quorum > 0 || spec.Broadcast {
+		report.Quorum, report.Broadcast = spec.Quorum, spec.Broadcast
+	}
+	if result.Error != nil {
+		report.Error = result.Error.Error()
+	}
+	payload, err := json.Marshal(report)
+	if err != nil {
+		r.logf(slog.LevelError, "Could not encode result for %q (%s/%s): %v\n", t.Label, t.Task, t.ID, err)
+		return
+	}
+	if err := r.transport.Publish(context.Background(), r.ns(ResultsChannel), payload); err != nil {
+		r.logf(slog.LevelError, "Could not publish result for %q (%s/%s): %v\n", t.Label, t.Task, t.ID, err)
+	}
+}
+
+// Aggregate subscribes to results published by every runner and merges them per task,
+// calling onMerge (if set) with the updated view each time a report arrives. The merged
+// results of broadcast tasks are also published on MergedChannel, so a fleet should
+// only have one aggregating runner.
+func (r *Runner) Aggregate(ctx context.Context, onMerge func(Aggregate)) error {
+	if r.transport == nil {
+		return ErrNoTransport
+	}
+	return r.transport.Subscribe(ctx, func(_ string, payload []byte) {
+		var report Report
+		if err := json.Unmarshal(payload, &report); err != nil {
+			r.logf(slog.LevelWarn, "Skipping malformed result report: %v\n", err)
+			return
+		}
+		merged := r.merge(report)
+		if merged.Broadcast {
+			if payload, err := json.Marshal(merged); err == nil {
+				if err := r.transport.Publish(ctx, r.ns(MergedChannel), payload); err != nil {
+					r.logf(slog.LevelError, "Could not publish merged result for %q: %v\n", merged.Label, err)
+				}
+			}
+		}
+		if onMerge != nil {
+			onMerge(merged)
+		}
+	}, r.ns(ResultsChannel))
+}
+
+// merge folds a report into its aggregate and returns a copy of the result
+func (r *Runner) merge(report Report) Aggregate {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	agg, ok := r.aggregates[report.Key]
+	if !ok {
+		agg = &Aggregate{
+			Key:     report.Key,
+			Label:   report.Task.Label,
+			Task:    report.Task.Task,
+			Results: make(map[string]Report),
+		}
+		r.aggregates[report.Key] = agg
+	}
+	now := time.Now()
+	report.Received = now.UnixMilli()
+	agg.Results[report.Machine] = report
+	agg.Updated = report.Received
+	agg.Quorum, agg.Broadcast = report.Quorum, report.Broadcast
+	agg.Failing = 0
+	for machine, rep := range agg.Results {
+		stale := time.Duration(staleIntervals) * r.interval(tasks.Task(rep.Task))
+		if stale > 0 && now.Sub(time.UnixMilli(rep.Received)) > stale {
+			delete(agg.Results, machine)
+			continue
+		}
+		if rep.Failed() {
+			agg.Failing++
+		}
+	}
+	// Critical tasks need a quorum of failing machines before going down
+	if agg.Quorum > 0 {
+		agg.Down = agg.Failing >= agg.Quorum
+	} else {
+		agg.Down = agg.Failing > 0
+	}
+	return agg.copy()
+}
+
+func (a *Aggregate) copy() Aggregate {
+	out := *a
+	out.Results = make(map[string]Report, len(a.Results))
+	for k, v := range a.Results {
+		out.Results[k] = v
+	}
+	return out
+}
+
+// Aggregates gets the merged results of every task seen by Aggregate
+func (r *Runner) Aggregates() (out []Aggregate) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, agg := range r.aggregates {
+		out = append(out, agg.copy())
+	}
+	return out
+}
@@ -0,0 +1,427 @@
+// Package boltstore provides a runner.Store backed by an embedded bbolt database,
+// for nodes that have neither Redis nor a SQL database
+package boltstore
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	"pkg.goda.sh/runner/v2"
+)
+
+var (
+	tasksBucket     = []byte("tasks")
+	schedulesBucket = []byte("schedules")
+	resultsBucket   = []byte("results") // Holds one nested bucket per task, keyed by date + sequence
+	deadBucket      = []byte("dead")
+	locksBucket     = []byte("locks")
+	seenBucket      = []byte("heartbeats")
+	metaBucket      = []byte("meta")
+	countsBucket    = []byte("counts") // Number of results stored per task
+)
+
+var (
+	_ runner.Store           = (*Store)(nil)
+	_ runner.DeadLetterStore = (*Store)(nil)
+	_ runner.MachineStore    = (*Store)(nil)
+	_ runner.ResultCompactor = (*Store)(nil)
+	_ runner.SchemaStore     = (*Store)(nil)
+)
+
+// Store is a runner.Store in a bbolt file
+type Store struct {
+	db *bolt.DB
+}
+
+// Open opens or creates a bbolt database at path
+func Open(path string) (*Store, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{tasksBucket, schedulesBucket, resultsBucket, deadBucket, locksBucket, seenBucket, metaBucket, countsBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Store{db: db}, nil
+}
+
+// Close closes the database
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// SaveTask stores a task definition
+func (s *Store) SaveTask(ctx context.Context, t runner.StoredTask) error {
+	raw, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(tasksBucket).Put([]byte(t.ID), raw)
+	})
+}
+
+// DeleteTask removes a task definition along with its schedule and results
+func (s *Store) DeleteTask(ctx context.Context, id string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.Bucket(tasksBucket).Delete([]byte(id)); err != nil {
+			return err
+		}
+		if err := tx.Bucket(schedulesBucket).Delete([]byte(id)); err != nil {
+			return err
+		}
+		if err := tx.Bucket(countsBucket).Delete([]byte(id)); err != nil {
+			return err
+		}
+		if results := tx.Bucket(resultsBucket); results.Bucket([]byte(id)) != nil {
+			return results.DeleteBucket([]byte(id))
+		}
+		return nil
+	})
+}
+
+// LoadTasks gets every task definition stored for a MachineID
+func (s *Store) LoadTasks(ctx context.Context, machine string) (out []runner.StoredTask, err error) {
+	err = s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(tasksBucket).ForEach(func(_, v []byte) error {
+			var t runner.StoredTask
+			if err := json.Unmarshal(v, &t); err != nil {
+				return err
+			}
+			if t.Machine == machine {
+				out = append(out, t)
+			}
+			return nil
+		})
+	})
+	return out, err
+}
+
+// SaveSchedule stores the schedule state of a task
+func (s *Store) SaveSchedule(ctx context.Context, id string, sc runner.Schedule) error {
+	raw, err := json.Marshal(sc)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(schedulesBucket).Put([]byte(id), raw)
+	})
+}
+
+// LoadSchedules gets the schedule state of the given tasks
+func (s *Store) LoadSchedules(ctx context.Context, ids []string) (map[string]runner.Schedule, error) {
+	out := make(map[string]runner.Schedule, len(ids))
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(schedulesBucket)
+		for _, id := range ids {
+			if raw := b.Get([]byte(id)); raw != nil {
+				var sc runner.Schedule
+				if err := json.Unmarshal(raw, &sc); err != nil {
+					return err
+				}
+				out[id] = sc
+			}
+		}
+		return nil
+	})
+	return out, err
+}
+
+// SaveResult stores a result and drops the ones older than the most recent keep
+func (s *Store) SaveResult(ctx context.Context, id string, rec runner.Record, keep int) error {
+	raw, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.Bucket(resultsBucket).CreateBucketIfNotExists([]byte(id))
+		if err != nil {
+			return err
+		}
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		key := make([]byte, 16)
+		binary.BigEndian.PutUint64(key, uint64(rec.Date))
+		binary.BigEndian.PutUint64(key[8:], seq)
+		n := count(tx, id, b) + 1
+		if err := b.Put(key, raw); err != nil {
+			return err
+		}
+		// Trimmed from the oldest, along with the expired results before the first one that isn't
+		now := time.Now()
+		for k, v := b.Cursor().First(); k != nil; k, v = b.Cursor().First() {
+			var old runner.Record
+			if n <= keep && (json.Unmarshal(v, &old) != nil || !old.Expired(now)) {
+				break
+			}
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+			n--
+		}
+		return setCount(tx, id, n)
+	})
+}
+
+// count gets the number of results stored for a task, counting them the first time for
+// databases written before counts were kept
+func count(tx *bolt.Tx, id string, b *bolt.Bucket) int {
+	if raw := tx.Bucket(countsBucket).Get([]byte(id)); raw != nil {
+		return int(binary.BigEndian.Uint64(raw))
+	}
+	n := 0
+	b.ForEach(func(_, _ []byte) error {
+		n++
+		return nil
+	})
+	return n
+}
+
+func setCount(tx *bolt.Tx, id string, n int) error {
+	raw := make([]byte, 8)
+	binary.BigEndian.PutUint64(raw, uint64(n))
+	return tx.Bucket(countsBucket).Put([]byte(id), raw)
+}
+
+// Results gets the most recent results of a task, oldest first
+func (s *Store) Results(ctx context.Context, id string, limit int) (out []runner.Record, err error) {
+	err = s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(resultsBucket).Bucket([]byte(id))
+		if b == nil {
+			return nil
+		}
+		c := b.Cursor()
+		now := time.Now()
+		for k, v := c.Last(); k != nil && len(out) < limit; k, v = c.Prev() {
+			var rec runner.Record
+			if err := json.Unmarshal(v, &rec); err != nil {
+				return err
+			}
+			if !rec.Expired(now) {
+				out = append([]runner.Record{rec}, out...)
+			}
+		}
+		return nil
+	})
+	return out, err
+}
+
+// SaveDeadLetter stores a dead letter
+func (s *Store) SaveDeadLetter(ctx context.Context, d runner.DeadLetter) error {
+	raw, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(deadBucket).Put([]byte(d.ID), raw)
+	})
+}
+
+// DeleteDeadLetter removes a dead letter
+func (s *Store) DeleteDeadLetter(ctx context.Context, id string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(deadBucket).Delete([]byte(id))
+	})
+}
+
+// LoadDeadLetters gets every dead letter
+func (s *Store) LoadDeadLetters(ctx context.Context) (out []runner.DeadLetter, err error) {
+	err = s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(deadBucket).ForEach(func(_, v []byte) error {
+			var d runner.DeadLetter
+			if err := json.Unmarshal(v, &d); err != nil {
+				return err
+			}
+			out = append(out, d)
+			return nil
+		})
+	})
+	return out, err
+}
+
+type lock struct {
+	Value   string `json:"value"`
+	Expires int64  `json:"expires"`
+}
+
+// Lock claims a key unless it is held and not expired
+func (s *Store) Lock(ctx context.Context, key, value string, ttl time.Duration) (holder string, ok bool, err error) {
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(locksBucket)
+		now := time.Now()
+		if raw := b.Get([]byte(key)); raw != nil {
+			var l lock
+			if err := json.Unmarshal(raw, &l); err != nil {
+				return err
+			}
+			if now.UnixNano() < l.Expires {
+				holder = l.Value
+				return nil
+			}
+		}
+		raw, err := json.Marshal(lock{Value: value, Expires: now.Add(ttl).UnixNano()})
+		if err != nil {
+			return err
+		}
+		holder, ok = value, true
+		return b.Put([]byte(key), raw)
+	})
+	return holder, ok, err
+}
+
+// Unlock releases a key
+func (s *Store) Unlock(ctx context.Context, key string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(locksBucket).Delete([]byte(key))
+	})
+}
+
+// SaveHeartbeat stores when a machine was last seen
+func (s *Store) SaveHeartbeat(ctx context.Context, machine string, seen int64) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(seenBucket).Put([]byte(machine), []byte(strconv.FormatInt(seen, 10)))
+	})
+}
+
+// Machines gets every machine with stored tasks and when it was last active
+func (s *Store) Machines(ctx context.Context) (map[string]int64, error) {
+	out := make(map[string]int64)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		seen := tx.Bucket(seenBucket)
+		return tx.Bucket(tasksBucket).ForEach(func(_, v []byte) error {
+			var t runner.StoredTask
+			if err := json.Unmarshal(v, &t); err != nil {
+				return err
+			}
+			active := t.Updated
+			if hb, err := strconv.ParseInt(string(seen.Get([]byte(t.Machine))), 10, 64); err == nil && hb > active {
+				active = hb
+			}
+			if active > out[t.Machine] {
+				out[t.Machine] = active
+			}
+			return nil
+		})
+	})
+	return out, err
+}
+
+// DeleteMachine removes the state of a machine
+func (s *Store) DeleteMachine(ctx context.Context, machine string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		var ids [][]byte
+		if err := tx.Bucket(tasksBucket).ForEach(func(k, v []byte) error {
+			var t runner.StoredTask
+			if err := json.Unmarshal(v, &t); err != nil {
+				return err
+			}
+			if t.Machine == machine {
+				ids = append(ids, append([]byte(nil), k...))
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+		results := tx.Bucket(resultsBucket)
+		for _, id := range ids {
+			if err := tx.Bucket(tasksBucket).Delete(id); err != nil {
+				return err
+			}
+			if err := tx.Bucket(schedulesBucket).Delete(id); err != nil {
+				return err
+			}
+			if err := tx.Bucket(countsBucket).Delete(id); err != nil {
+				return err
+			}
+			if results.Bucket(id) != nil {
+				if err := results.DeleteBucket(id); err != nil {
+					return err
+				}
+			}
+		}
+		return tx.Bucket(seenBucket).Delete([]byte(machine))
+	})
+}
+
+// CompactResults rewrites the stored results of a task in a single transaction
+func (s *Store) CompactResults(ctx context.Context, id string, limit int, fn func([]runner.Record) ([]runner.Record, bool)) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		results := tx.Bucket(resultsBucket)
+		var recs []runner.Record
+		b := results.Bucket([]byte(id))
+		if b != nil {
+			c := b.Cursor()
+			now := time.Now()
+			for k, v := c.Last(); k != nil && len(recs) < limit; k, v = c.Prev() {
+				var rec runner.Record
+				if err := json.Unmarshal(v, &rec); err != nil {
+					return err
+				}
+				if !rec.Expired(now) {
+					recs = append([]runner.Record{rec}, recs...)
+				}
+			}
+		}
+		recs, changed := fn(recs)
+		if !changed {
+			return nil
+		}
+		if b != nil {
+			if err := results.DeleteBucket([]byte(id)); err != nil {
+				return err
+			}
+		}
+		b, err := results.CreateBucket([]byte(id))
+		if err != nil {
+			return err
+		}
+		for i, rec := range recs {
+			raw, err := json.Marshal(rec)
+			if err != nil {
+				return err
+			}
+			key := make([]byte, 16)
+			binary.BigEndian.PutUint64(key, uint64(rec.Date))
+			binary.BigEndian.PutUint64(key[8:], uint64(i))
+			if err := b.Put(key, raw); err != nil {
+				return err
+			}
+		}
+		if err := b.SetSequence(uint64(len(recs))); err != nil {
+			return err
+		}
+		return setCount(tx, id, len(recs))
+	})
+}
+
+// SchemaVersion gets the version of the stored state
+func (s *Store) SchemaVersion(ctx context.Context) (v int, err error) {
+	err = s.db.View(func(tx *bolt.Tx) error {
+		if raw := tx.Bucket(metaBucket).Get([]byte("schema")); raw != nil {
+			v, err = strconv.Atoi(string(raw))
+		}
+		return err
+	})
+	return v, err
+}
+
+// SetSchemaVersion records the version of the stored state
+func (s *Store) SetSchemaVersion(ctx context.Context, v int) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(metaBucket).Put([]byte("schema"), []byte(strconv.Itoa(v)))
+	})
+}
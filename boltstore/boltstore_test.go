@@ -0,0 +1,61 @@
+package boltstore
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"pkg.goda.sh/runner/v2"
+	"pkg.goda.sh/runner/v2/storetest"
+)
+
+func TestStore(t *testing.T) {
+	s, err := Open(filepath.Join(t.TempDir(), "runner.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	storetest.Run(t, s)
+}
+
+func TestSaveResultKeepsTheMostRecent(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "runner.db")
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	save := func(from, to int64) {
+		for date := from; date < to; date++ {
+			if err := s.SaveResult(ctx, "task", runner.Record{Date: date}, 5); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	save(now, now+20)
+	s.Close()
+	if s, err = Open(path); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	save(now+20, now+22)
+
+	recs, err := s.Results(ctx, "task", 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != 5 || recs[0].Date != now+17 || recs[4].Date != now+21 {
+		t.Fatalf("kept %v, want the 5 most recent results", recs)
+	}
+	if err := s.CompactResults(ctx, "task", 100, func(recs []runner.Record) ([]runner.Record, bool) {
+		return recs[3:], true
+	}); err != nil {
+		t.Fatal(err)
+	}
+	save(now+22, now+26)
+	if recs, _ = s.Results(ctx, "task", 100); len(recs) != 5 || recs[0].Date != now+21 {
+		t.Fatalf("kept %v after compacting, want the 5 most recent results", recs)
+	}
+}
@@ -0,0 +1,157 @@
+package runner
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"pkg.goda.sh/tasks"
+)
+
+// TaskBuilder builds a Spec, collecting validation errors until Build
+type TaskBuilder struct {
+	spec Spec
+	errs []error
+}
+
+// NewTask starts building a task of the given type. Types are checked against
+// tasks.TaskRunners, use Runner.NewTask for types registered on a Runner.
+func NewTask(typ string) *TaskBuilder {
+	b := &TaskBuilder{}
+	b.spec.CleanTask.Task = typ
+	if _, ok := tasks.TaskRunners[strings.ToLower(typ)]; !ok {
+		b.fail("unknown task type %q", typ)
+	}
+	return b
+}
+
+// NewTask starts building a task of a type known to r
+func (r *Runner) NewTask(typ string) *TaskBuilder {
+	b := &TaskBuilder{}
+	b.spec.CleanTask.Task = typ
+	if _, ok := r.lookup(typ); !ok {
+		b.fail("unknown task type %q", typ)
+	}
+	return b
+}
+
+// Label sets the label of the task
+func (b *TaskBuilder) Label(label string) *TaskBuilder {
+	b.spec.Label = label
+	return b
+}
+
+// Interval sets the interval of the task as ISO8601 (ex. PT30S), a Go duration or a
+// phrase, see Runner.ParseDuration
+func (b *TaskBuilder) Interval(interval string) *TaskBuilder {
+	if parseDuration(interval) <= 0 {
+		b.fail("bad interval %q", interval)
+	}
+	b.spec.Interval = interval
+	return b
+}
+
+// Every sets the interval of the task from a time.Duration
+func (b *TaskBuilder) Every(d time.Duration) *TaskBuilder {
+	if d < time.Second {
+		b.fail("interval %s is shorter than a second", d)
+		return b
+	}
+	b.spec.Interval = fmt.Sprintf("PT%dS", int64(d/time.Second))
+	return b
+}
+
+// Once runs the task a single time
+func (b *TaskBuilder) Once() *TaskBuilder {
+	b.spec.CleanTask.Once = true
+	return b
+}
+
+// Param sets a parameter handed to the TaskRunner, see ParamsFrom
+func (b *TaskBuilder) Param(name string, value interface{}) *TaskBuilder {
+	if b.spec.Params == nil {
+		b.spec.Params = make(map[string]interface{})
+	}
+	b.spec.Params[name] = value
+	return b
+}
+
+// Params sets every parameter from a struct or map, encoded like Params decodes them
+func (b *TaskBuilder) Params(v interface{}) *TaskBuilder {
+	raw, err := json.Marshal(v)
+	if err == nil {
+		err = json.Unmarshal(raw, &b.spec.Params)
+	}
+	if err != nil {
+		b.fail("bad params: %v", err)
+	}
+	return b
+}
+
+// Constraints limits which runners the task may be placed on
+func (b *TaskBuilder) Constraints(c Constraints) *TaskBuilder {
+	b.spec.Constraints = &c
+	return b
+}
+
+// Quorum sets how many machines must fail before the aggregated result goes down
+func (b *TaskBuilder) Quorum(n int) *TaskBuilder {
+	if n < 0 {
+		b.fail("negative quorum")
+	}
+	b.spec.Quorum = n
+	return b
+}
+
+// Broadcast runs the task on every matching runner
+func (b *TaskBuilder) Broadcast() *TaskBuilder {
+	b.spec.Broadcast = true
+	return b
+}
+
+// Tags adds tags to the task
+func (b *TaskBuilder) Tags(tags ...string) *TaskBuilder {
+	b.spec.Tags = append(b.spec.Tags, tags...)
+	return b
+}
+
+// Group puts the task in a group
+func (b *TaskBuilder) Group(name string) *TaskBuilder {
+	b.spec.Group = name
+	return b
+}
+
+// IdempotencyKey deduplicates remote submissions of the task
+func (b *TaskBuilder) IdempotencyKey(key string) *TaskBuilder {
+	b.spec.IdempotencyKey = key
+	return b
+}
+
+// Build validates the task and returns its Spec, ready for AddSpec, Submit or Enqueue
+func (b *TaskBuilder) Build() (Spec, error) {
+	if b.spec.Label == "" {
+		b.fail("missing label")
+	}
+	if len(b.errs) > 0 {
+		msgs := make([]string, len(b.errs))
+		for i, err := range b.errs {
+			msgs[i] = err.Error()
+		}
+		return b.spec, fmt.Errorf("%w: %s", ErrInvalidTask, strings.Join(msgs, ", "))
+	}
+	return b.spec, nil
+}
+
+// MustBuild is like Build but panics if the task is invalid, for static task lists
+func (b *TaskBuilder) MustBuild() Spec {
+	spec, err := b.Build()
+	if err != nil {
+		panic(err)
+	}
+	return spec
+}
+
+func (b *TaskBuilder) fail(format string, args ...interface{}) {
+	b.errs = append(b.errs, fmt.Errorf(format, args...))
+}
@@ -0,0 +1,81 @@
+package runner
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// CatchUp is the policy for tasks found overdue in the persisted schedules after a restart
+type CatchUp int
+
+const (
+	// CatchUpNone schedules restored tasks as if they were new
+	CatchUpNone CatchUp = iota
+	// CatchUpOnce runs overdue tasks once, immediately
+	CatchUpOnce
+	// CatchUpAll runs overdue tasks once for every missed interval, up to MaxCatchUpRuns
+	CatchUpAll
+)
+
+// MaxCatchUpRuns caps the number of runs CatchUpAll makes up for per task
+const MaxCatchUpRuns = 24
+
+// WithCatchUp sets what happens to tasks that became overdue while the Runner was down.
+// It requires a Store holding checkpointed schedules, see WithCheckpoint.
+func WithCatchUp(policy CatchUp) Option {
+	return func(r *Runner) {
+		r.catchUpPolicy = policy
+	}
+}
+
+// catchUp runs the tasks that missed their persisted due time according to the policy
+func (r *Runner) catchUp() {
+	if r.store == nil || r.catchUpPolicy == CatchUpNone {
+		return
+	}
+	var ids []string
+	for _, t := range r.Tasks("") {
+		ids = append(ids, t.ID)
+	}
+	schedules, err := r.store.LoadSchedules(context.Background(), ids)
+	if err != nil {
+		r.logf(slog.LevelError, "Could not load schedules to catch up on: %v\n", err)
+		return
+	}
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	for id, sc := range schedules {
+		if sc.NextDue == 0 || sc.NextDue > now {
+			continue
+		}
+		runs := 1
+		if r.catchUpPolicy == CatchUpAll {
+			interval := int64(r.interval(r.spec(id).Task()) / time.Millisecond)
+			if interval > 0 {
+				runs += int((now - sc.NextDue) / interval)
+			}
+			if runs > MaxCatchUpRuns {
+				runs = MaxCatchUpRuns
+			}
+		}
+		r.logf(slog.LevelInfo, "Catching up on %s with %d run(s)\n", id, runs)
+		r.mu.Lock()
+		r.backlog[id] = runs - 1
+		r.mu.Unlock()
+		if err := r.RunNow(r.ctx, id); err != nil {
+			r.logf(slog.LevelError, "Could not catch up on %s: %v\n", id, err)
+		}
+	}
+}
+
+// takeBacklog consumes one pending catch-up run of a task, reporting whether there was one
+func (r *Runner) takeBacklog(id string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.backlog[id] <= 0 {
+		delete(r.backlog, id)
+		return false
+	}
+	r.backlog[id]--
+	return true
+}
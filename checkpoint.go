@@ -0,0 +1,78 @@
+package runner
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// WithCheckpoint saves the last run and next due time of every task to the Store at the
+// given cadence (and once more on Stop), so a restarted Runner knows which tasks are overdue.
+// A CompactingWAL is compacted at the same cadence.
+func WithCheckpoint(every time.Duration) Option {
+	return func(r *Runner) {
+		r.checkpointEvery = every
+	}
+}
+
+// scheduled records when a task last ran and when it runs next, 0 keeps the current value
+func (r *Runner) scheduled(id string, lastRun, nextDue time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	sc := r.schedules[id]
+	if !lastRun.IsZero() {
+		sc.LastRun = lastRun.UnixNano() / int64(time.Millisecond)
+	}
+	if !nextDue.IsZero() {
+		sc.NextDue = nextDue.UnixNano() / int64(time.Millisecond)
+	}
+	r.schedules[id] = sc
+}
+
+// Schedules gets the last run and next due time of every scheduled task
+func (r *Runner) Schedules() map[string]Schedule {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make(map[string]Schedule, len(r.schedules))
+	for id, sc := range r.schedules {
+		out[id] = sc
+	}
+	return out
+}
+
+// checkpoint saves the schedule state of every task to the Store and compacts the WAL
+func (r *Runner) checkpoint(ctx context.Context) {
+	r.compactWAL()
+	if r.store == nil {
+		return
+	}
+	for id, sc := range r.Schedules() {
+		if err := r.store.SaveSchedule(ctx, id, sc); err != nil {
+			r.logf(slog.LevelError, "Could not checkpoint schedule of %s: %v\n", id, err)
+		}
+	}
+}
+
+// startCheckpoints runs checkpoint at the configured cadence until the Runner is stopped
+func (r *Runner) startCheckpoints() {
+	if (r.store == nil && r.wal == nil) || r.checkpointEvery <= 0 {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	r.mu.Lock()
+	r.cancellations = append(r.cancellations, cancel)
+	r.mu.Unlock()
+	go func() {
+		ticker := time.NewTicker(r.checkpointEvery)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				r.checkpoint(ctx)
+			case <-ctx.Done():
+				r.checkpoint(context.Background())
+				return
+			}
+		}
+	}()
+}
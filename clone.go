@@ -0,0 +1,66 @@
+package runner
+
+import (
+	"log/slog"
+	"maps"
+
+	"pkg.goda.sh/tasks"
+)
+
+// CloneWhere moves the tasks matching pred into a new Runner, keeping their IDs, last
+// results, history and versions. The clone has the identity, task types, hashing, history,
+// rate limit and context of r but none of its storage, transport or groups: pass opts for
+// those, so both runners don't restore each other's tasks.
+func (r *Runner) CloneWhere(pred func(tasks.Task) bool, opts ...Option) *Runner {
+	r.types.RLock()
+	types := []Option{func(c *Runner) {
+		c.funcs, c.schemas = maps.Clone(r.funcs), maps.Clone(r.schemas)
+		c.intervals, c.timerless = maps.Clone(r.intervals), maps.Clone(r.timerless)
+	}}
+	r.types.RUnlock()
+	r.mu.RLock()
+	base := []Option{
+		WithContext(r.ctx),
+		WithNamespace(r.namespace),
+		WithHistory(r.historySize),
+		WithTaskRedis(r.RedisControl),
+		func(c *Runner) {
+			c.hashVersion, c.hashFrom = r.hashVersion, r.hashFrom
+			c.hashAlg, c.hashFields = r.hashAlg, r.hashFields
+			c.limiter, c.limitKey = r.limiter, r.limitKey
+		},
+	}
+	r.mu.RUnlock()
+	c := NewRunner(r.Identity, nil, r.OnResult, r.Paused(), append(append(types, base...), opts...)...)
+	var ids []string
+	for id := range r.Where(pred) {
+		ids = append(ids, id)
+	}
+	for _, id := range ids {
+		t, ok := r.find(id)
+		if !ok {
+			continue // Removed meanwhile
+		}
+		r.mu.RLock()
+		spec, history, versions := r.specs[id], r.history[id], r.versions[id]
+		r.mu.RUnlock()
+		r.remove(id)
+		if err := c.AddSpec(c.ctx, spec); err != nil {
+			r.logf(slog.LevelError, "Could not move %q (%s/%s) to the clone: %v\n", t.Label, t.Task, id, err)
+			continue
+		}
+		moved, ok := c.TaskList.Get(id)
+		if !ok {
+			continue
+		}
+		moved.Last, moved.Warn, moved.Spark, moved.Date = t.Last, t.Warn, t.Spark, t.Date
+		c.TaskList.Update(id, moved)
+		c.mu.Lock()
+		c.history[id] = history
+		if versions != nil {
+			c.versions[id] = versions
+		}
+		c.mu.Unlock()
+	}
+	return c
+}
@@ -0,0 +1,257 @@
+package runner
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"time"
+)
+
+const (
+	// HeartbeatChannel is the subject runners announce themselves on
+	HeartbeatChannel = "runner:heartbeat"
+	// ControlChannel is the prefix of the per-node subject control messages are sent to
+	ControlChannel = "runner:control:"
+	// FleetControlChannel is the subject for control messages addressed to every node
+	FleetControlChannel = "runner:control"
+	// AckChannel is the prefix of the subjects control acknowledgements are sent to
+	AckChannel = "runner:ack:"
+)
+
+var (
+	// ErrNoMatchingNode is returned by Submit when no live runner satisfies a Spec's constraints
+	ErrNoMatchingNode = errors.New("runner: no live node matches the task constraints")
+	// ErrNoAck is returned when no runner acknowledged a control message in time
+	ErrNoAck = errors.New("runner: control message was not acknowledged")
+)
+
+// Node is a runner seen through its heartbeats
+type Node struct {
+	Identity Identity `json:"identity"`
+	Tasks    int      `json:"tasks"`
+	Seen     int64    `json:"seen"`
+	Every    int64    `json:"every"` // Heartbeat interval in milliseconds
+}
+
+// Alive reports whether the node has sent a heartbeat recently
+func (n Node) Alive() bool {
+	return time.Now().UnixNano()/int64(time.Millisecond)-n.Seen <= 3*n.Every
+}
+
+// Control is a message sent to a runner's control channel
+type Control struct {
+	Type  string `json:"type"`
+	Spec  *Spec  `json:"spec,omitempty"`
+	ID    string `json:"id,omitempty"`
+	Reply string `json:"reply,omitempty"` // Subject to acknowledge the message on
+}
+
+// Ack acknowledges a control message
+type Ack struct {
+	ID      string `json:"id"`
+	Machine string `json:"machine"`
+}
+
+// Join announces the runner to the fleet every interval, tracks the other nodes and
+// accepts tasks placed on it through Submit until ctx is done
+func (r *Runner) Join(ctx context.Context, every time.Duration) error {
+	if r.transport == nil {
+		return ErrNoTransport
+	}
+	if err := r.transport.Subscribe(ctx, func(subject string, payload []byte) {
+		if subject == r.ns(HeartbeatChannel) {
+			r.observe(payload)
+		} else {
+			r.control(payload)
+		}
+	}, r.ns(HeartbeatChannel), r.ns(FleetControlChannel), r.ns(ControlChannel+r.Identity.MachineID)); err != nil {
+		return err
+	}
+	go func() {
+		ticker := time.NewTicker(every)
+		defer ticker.Stop()
+		r.heartbeat(ctx, every)
+		for {
+			select {
+			case <-ticker.C:
+				r.heartbeat(ctx, every)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+func (r *Runner) heartbeat(ctx context.Context, every time.Duration) {
+	payload, _ := json.Marshal(Node{
+		Identity: r.Identity,
+		Tasks:    r.TaskList.Count(),
+		Seen:     time.Now().UnixNano() / int64(time.Millisecond),
+		Every:    int64(every / time.Millisecond),
+	})
+	if err := r.transport.Publish(ctx, r.ns(HeartbeatChannel), payload); err != nil {
+		r.logf(slog.LevelError, "Could not publish heartbeat: %v\n", err)
+	}
+	r.touch(ctx)
+}
+
+func (r *Runner) observe(payload []byte) {
+	var node Node
+	if err := json.Unmarshal(payload, &node); err != nil {
+		r.logf(slog.LevelWarn, "Skipping malformed heartbeat: %v\n", err)
+		return
+	}
+	r.mu.Lock()
+	r.nodes[node.Identity.MachineID] = node
+	r.mu.Unlock()
+}
+
+func (r *Runner) control(payload []byte) {
+	var msg Control
+	if err := json.Unmarshal(payload, &msg); err != nil {
+		r.logf(slog.LevelWarn, "Skipping malformed control message: %v\n", err)
+		return
+	}
+	switch msg.Type {
+	case "add":
+		if msg.Spec == nil || !msg.Spec.Constraints.Allows(r.Identity) {
+			r.logf(slog.LevelWarn, "Rejecting task placed on %s: constraints not satisfied\n", r.Identity.MachineID)
+			return
+		}
+		if err := r.AddSpec(r.ctx, *msg.Spec); err != nil {
+			r.logf(slog.LevelError, "Could not add remote task: %v\n", err)
+		}
+	case "cancel":
+		if !r.remove(msg.ID) || msg.Reply == "" {
+			return // Not running here
+		}
+		r.logf(slog.LevelInfo, "Cancelled %s on request of the fleet\n", msg.ID)
+		payload, _ := json.Marshal(Ack{ID: msg.ID, Machine: r.Identity.MachineID})
+		if err := r.transport.Publish(context.Background(), msg.Reply, payload); err != nil {
+			r.logf(slog.LevelError, "Could not acknowledge cancellation of %s: %v\n", msg.ID, err)
+		}
+	default:
+		r.logf(slog.LevelWarn, "Skipping unknown control message: %q\n", msg.Type)
+	}
+}
+
+// CancelRemote cancels a task on whichever runner is running it, waiting for that runner's
+// acknowledgement until ctx is done
+func (r *Runner) CancelRemote(ctx context.Context, id string) (Ack, error) {
+	if r.transport == nil {
+		return Ack{}, ErrNoTransport
+	}
+	reply := r.ns(AckChannel) + newUUID()
+	acks := make(chan Ack, 1)
+	subCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	if err := r.transport.Subscribe(subCtx, func(_ string, payload []byte) {
+		var ack Ack
+		if json.Unmarshal(payload, &ack) == nil {
+			select {
+			case acks <- ack:
+			default:
+			}
+		}
+	}, reply); err != nil {
+		return Ack{}, err
+	}
+	payload, _ := json.Marshal(Control{Type: "cancel", ID: id, Reply: reply})
+	if err := r.transport.Publish(ctx, r.ns(FleetControlChannel), payload); err != nil {
+		return Ack{}, err
+	}
+	select {
+	case ack := <-acks:
+		return ack, nil
+	case <-ctx.Done():
+		return Ack{}, ErrNoAck
+	}
+}
+
+// Nodes gets every runner currently known to be alive
+func (r *Runner) Nodes() (out []Node) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, node := range r.nodes {
+		if node.Alive() {
+			out = append(out, node)
+		}
+	}
+	return out
+}
+
+// Broadcast runs a task on every live runner that satisfies its constraints, returning the
+// MachineIDs it was sent to. Their results are merged per machine by the fleet's aggregator.
+// When it couldn't be sent to any runner, the IdempotencyKey of the Spec is released so the
+// broadcast can be retried.
+func (r *Runner) Broadcast(ctx context.Context, spec Spec) ([]string, error) {
+	if r.transport == nil {
+		return nil, ErrNoTransport
+	}
+	spec.Broadcast = true
+	var targets []string
+	for _, node := range r.Nodes() {
+		if spec.Constraints.Allows(node.Identity) {
+			targets = append(targets, node.Identity.MachineID)
+		}
+	}
+	if len(targets) == 0 {
+		return nil, ErrNoMatchingNode
+	}
+	if _, err := r.reserve(ctx, spec.IdempotencyKey, "broadcast"); err != nil {
+		return nil, err
+	}
+	payload, err := json.Marshal(Control{Type: "add", Spec: &spec})
+	if err != nil {
+		r.release(ctx, spec.IdempotencyKey)
+		return nil, err
+	}
+	sent := make([]string, 0, len(targets))
+	var errs []error
+	for _, machine := range targets {
+		if err := r.transport.Publish(ctx, r.ns(ControlChannel+machine), payload); err != nil {
+			r.logf(slog.LevelError, "Could not broadcast %q to %s: %v\n", spec.Label, machine, err)
+			errs = append(errs, err)
+			continue
+		}
+		sent = append(sent, machine)
+	}
+	if len(sent) == 0 {
+		r.release(ctx, spec.IdempotencyKey)
+		return nil, errors.Join(errs...)
+	}
+	return sent, nil
+}
+
+// Submit places a task on the least loaded live runner that satisfies its constraints
+// and returns the MachineID it was sent to. Specs with an IdempotencyKey require a Store and
+// are only placed once, later submissions return the original MachineID and ErrDuplicateSubmission.
+func (r *Runner) Submit(ctx context.Context, spec Spec) (string, error) {
+	if r.transport == nil {
+		return "", ErrNoTransport
+	}
+	var target *Node
+	for _, node := range r.Nodes() {
+		node := node
+		if spec.Constraints.Allows(node.Identity) && (target == nil || node.Tasks < target.Tasks) {
+			target = &node
+		}
+	}
+	if target == nil {
+		return "", ErrNoMatchingNode
+	}
+	if machine, err := r.reserve(ctx, spec.IdempotencyKey, target.Identity.MachineID); err != nil {
+		return machine, err
+	}
+	payload, err := json.Marshal(Control{Type: "add", Spec: &spec})
+	if err == nil {
+		err = r.transport.Publish(ctx, r.ns(ControlChannel+target.Identity.MachineID), payload)
+	}
+	if err != nil {
+		r.release(ctx, spec.IdempotencyKey)
+		return "", err
+	}
+	return target.Identity.MachineID, nil
+}
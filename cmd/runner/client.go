@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"pkg.goda.sh/tasks"
+)
+
+// client talks to the admin API of a running instance
+type client struct {
+	addr  string
+	token string
+	http  *http.Client
+}
+
+// dial adds the -addr and -token flags to flags and parses args
+func dial(flags *flag.FlagSet, args []string) *client {
+	addr := os.Getenv("RUNNER_ADDR")
+	if addr == "" {
+		addr = "http://localhost:8080"
+	}
+	flags.StringVar(&addr, "addr", addr, "address of the admin API of the instance")
+	token := flags.String("token", os.Getenv("RUNNER_TOKEN"), "bearer token of the admin API, RUNNER_TOKEN by default")
+	flags.Parse(args)
+	return &client{addr: strings.TrimSuffix(addr, "/"), token: *token, http: &http.Client{Timeout: 30 * time.Second}}
+}
+
+// do sends a request and decodes the JSON reply into out, unless it's nil
+func (c *client) do(method, path string, out interface{}) error {
+	req, err := http.NewRequest(method, c.addr+path, nil)
+	if err != nil {
+		return err
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	res, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	if res.StatusCode >= 300 {
+		var reply struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(body, &reply) == nil && reply.Error != "" {
+			return errors.New(reply.Error)
+		}
+		return fmt.Errorf("%s %s: %s", method, path, res.Status)
+	}
+	if out == nil {
+		return nil
+	}
+	if raw, ok := out.(*[]byte); ok {
+		*raw = body
+		return nil
+	}
+	return json.Unmarshal(body, out)
+}
+
+func list(args []string) error {
+	flags := flag.NewFlagSet("list", flag.ExitOnError)
+	typ := flags.String("task", "", "only list tasks of this type")
+	tag := flags.String("tag", "", "only list tasks carrying these tags, comma separated")
+	c := dial(flags, args)
+
+	q := url.Values{}
+	if *typ != "" {
+		q.Set("task", *typ)
+	}
+	if *tag != "" {
+		q.Set("tag", *tag)
+	}
+	var list []tasks.CleanTask
+	if err := c.do(http.MethodGet, "/tasks?"+q.Encode(), &list); err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tLABEL\tTASK\tINTERVAL\tLAST RUN\tWARN")
+	for _, t := range list {
+		last := "-"
+		if t.Date > 0 {
+			last = time.Unix(0, t.Date*int64(time.Millisecond)).Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%v\n", t.ID, t.Label, t.Task, t.Interval, last, t.Warn)
+	}
+	return w.Flush()
+}
+
+func pause(paused bool) func([]string) error {
+	action := "resume"
+	if paused {
+		action = "pause"
+	}
+	return func(args []string) error {
+		flags := flag.NewFlagSet(action, flag.ExitOnError)
+		group := flags.String("group", "", "only "+action+" the tasks of this group")
+		c := dial(flags, args)
+		if *group != "" {
+			return c.do(http.MethodPost, "/groups/"+url.PathEscape(*group)+"/"+action, nil)
+		}
+		return c.do(http.MethodPost, "/"+action, nil)
+	}
+}
+
+func runNow(args []string) error {
+	flags := flag.NewFlagSet("run-now", flag.ExitOnError)
+	c := dial(flags, args)
+	if flags.NArg() != 1 {
+		return errors.New("usage: runner run-now [-addr address] <id>")
+	}
+	return c.do(http.MethodPost, "/tasks/"+url.PathEscape(flags.Arg(0))+"/run", nil)
+}
+
+func export(args []string) error {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	c := dial(flags, args)
+	var data []byte
+	if err := c.do(http.MethodGet, "/export", &data); err != nil {
+		return err
+	}
+	_, err := os.Stdout.Write(append(data, '\n'))
+	return err
+}
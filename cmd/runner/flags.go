@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"pkg.goda.sh/runner/v2"
+	"pkg.goda.sh/runner/v2/config"
+	"pkg.goda.sh/runner/v2/taskplugin"
+	"pkg.goda.sh/runner/v2/tasktypes"
+	"pkg.goda.sh/tasks"
+)
+
+// configFlags are the flags of the commands reading a config
+type configFlags struct {
+	path     *string
+	machine  *string
+	location *string
+	profile  *string
+	vars     templateVars
+	plugins  paths
+	wasm     *string
+	scripts  *bool
+	exec     *bool
+	allow    paths
+	allowEnv paths
+	hosts    paths
+}
+
+func addConfigFlags(flags *flag.FlagSet) *configFlags {
+	c := &configFlags{
+		path:     flags.String("config", "tasks.yaml", "config file or directory"),
+		machine:  flags.String("machine", hostname(), "machine ID"),
+		location: flags.String("location", "", "location reported with results"),
+		profile:  flags.String("profile", os.Getenv(config.ProfileEnv), "profile of the config to apply"),
+		vars:     templateVars{},
+		wasm:     flags.String("wasm", "", "directory of the modules wasm tasks run"),
+		scripts:  flags.Bool("scripts", false, "enable script tasks"),
+		exec:     flags.Bool("exec", false, "enable exec and supervise tasks"),
+	}
+	flags.Var(c.vars, "var", "name=value var of config templates, repeatable")
+	flags.Var(&c.plugins, "plugin", "plugin binary adding task types, repeatable")
+	flags.Var(&c.allow, "allow-exec", "command exec and supervise tasks may run, repeatable, any when not given")
+	flags.Var(&c.allowEnv, "allow-env", "env variable exec and supervise tasks may set with -allow-exec, repeatable")
+	flags.Var(&c.hosts, "allow-host", "host script tasks may call, *.domain for its subdomains and * for any, repeatable, none when not given")
+	return c
+}
+
+func (c *configFlags) identity() runner.Identity {
+	return runner.Identity{MachineID: *c.machine, Location: *c.location}
+}
+
+// options gets the options loading the config
+func (c *configFlags) options() []config.LoadOption {
+	return []config.LoadOption{config.WithProfile(*c.profile), config.WithIdentity(c.identity()), config.WithVars(c.vars)}
+}
+
+// runner creates the Runner of the config with the task types of the plugins, stop stops both
+func (c *configFlags) runner(ctx context.Context, paused bool, opts ...runner.Option) (r *runner.Runner, stop func(), err error) {
+	var plugins []*taskplugin.Plugin
+	stop = func() {
+		if r != nil {
+			r.Stop()
+		}
+		for _, p := range plugins {
+			p.Close()
+		}
+	}
+	for _, path := range c.plugins {
+		p, err := taskplugin.Start(ctx, path)
+		if err != nil {
+			stop()
+			return nil, nil, err
+		}
+		plugins = append(plugins, p)
+	}
+	r = runner.NewRunner(c.identity(), nil, func(tasks.Task, tasks.Result) {}, paused, opts...)
+	types := []interface{ Register(*runner.Runner) error }{
+		tasktypes.HTTP{}, tasktypes.Port{}, tasktypes.Ping{}, tasktypes.DNS{}, tasktypes.Cert{}, tasktypes.GRPC{},
+		tasktypes.System{}, tasktypes.Docker{}, tasktypes.Watch{}, tasktypes.Composite{}, tasktypes.Pipeline{},
+		tasktypes.Transform{}, tasktypes.MQTT{}, tasktypes.Kafka{},
+	}
+	if *c.wasm != "" {
+		types = append(types, tasktypes.Wasm{Dir: *c.wasm})
+	}
+	if *c.scripts {
+		types = append(types, tasktypes.Script{AllowHosts: c.hosts})
+	}
+	if *c.exec {
+		types = append(types, tasktypes.Exec{Allow: c.allow, AllowEnv: c.allowEnv},
+			tasktypes.Supervise{Allow: c.allow, AllowEnv: c.allowEnv})
+	}
+	for _, t := range types {
+		if err := t.Register(r); err != nil {
+			stop()
+			return nil, nil, err
+		}
+	}
+	for _, p := range plugins {
+		if err := p.Register(r); err != nil {
+			stop()
+			return nil, nil, err
+		}
+	}
+	return r, stop, nil
+}
+
+// templateVars collects the -var flags
+type templateVars map[string]interface{}
+
+func (v templateVars) String() string {
+	return fmt.Sprint(map[string]interface{}(v))
+}
+
+func (v templateVars) Set(s string) error {
+	name, value, ok := strings.Cut(s, "=")
+	if !ok || name == "" {
+		return errors.New("want name=value")
+	}
+	v[name] = value
+	return nil
+}
+
+// paths collects repeated path flags
+type paths []string
+
+func (l *paths) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *paths) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
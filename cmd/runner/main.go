@@ -0,0 +1,287 @@
+// Command runner runs the tasks of a config file and controls running instances through
+// their admin API, see pkg.goda.sh/runner/v2/config and pkg.goda.sh/runner/v2/httpapi.
+//
+// Usage:
+//
+//	runner serve -config tasks.yaml [-listen addr]    run the tasks, reloading the config on change
+//	runner serve -remote url -config tasks.yaml       same, pulling the config from a controller
+//	runner validate -config tasks.yaml                check a config without running it
+//	runner lint -config tasks.yaml [-json]            report suspicious settings of a config
+//	runner list [-task type] [-tag tag]               list the tasks of a running instance
+//	runner pause [-group name]                        pause all tasks, or those of a group
+//	runner resume [-group name]                       resume all tasks, or those of a group
+//	runner run-now <id>                               run a task immediately
+//	runner export                                     print the task definitions as JSON
+//
+// serve, validate and lint apply the profile of the config named by -profile or RUNNER_PROFILE,
+// see config.WithProfile. serve reads the parameters of the form secret://name from
+// RUNNER_SECRET_NAME or /run/secrets/name when tasks run. With -remote, it fetches the config
+// every -refresh and checks its signature when given a -pubkey, see config.Remote. With
+// -hooks, it serves the webhooks of a JSON file under /hooks/, see pkg.goda.sh/runner/v2/webhook.
+// Config templates see the -machine and -location of the runner and the vars set with -var.
+// Each -plugin binary adds its task types, see pkg.goda.sh/runner/v2/taskplugin, and -wasm enables
+// wasm tasks running the modules of a directory, see tasktypes.Wasm, -scripts script tasks,
+// see tasktypes.Script, and -exec exec and supervise tasks running the -allow-exec commands
+// with the -allow-env variables, see tasktypes.Exec and tasktypes.Supervise. The probes of
+// tasktypes are always available: http, port, ping, dns, cert, grpc, system, docker, watch,
+// composite, pipeline, transform, mqtt and kafka.
+//
+// serve listens on 127.0.0.1:8080 by default. With -token or RUNNER_TOKEN, the admin API
+// requires it as a bearer token, see httpapi.RequireToken, and serve refuses to listen on
+// other addresses than loopback ones without it. Commands talking to a running instance use
+// its address from -addr or RUNNER_ADDR, http://localhost:8080 by default, and send the token
+// of -token or RUNNER_TOKEN.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"pkg.goda.sh/runner/v2"
+	"pkg.goda.sh/runner/v2/config"
+	"pkg.goda.sh/runner/v2/httpapi"
+	"pkg.goda.sh/runner/v2/webhook"
+)
+
+const usage = `usage: runner <command> [flags]
+
+commands:
+  serve      run the tasks of a config file
+  validate   check a config file
+  lint       report suspicious settings of a config file
+  list       list the tasks of a running instance
+  pause      pause a running instance or one of its groups
+  resume     resume a running instance or one of its groups
+  run-now    run a task of a running instance immediately
+  export     print the task definitions of a running instance
+
+run 'runner <command> -h' for the flags of a command
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	commands := map[string]func([]string) error{
+		"serve":    serve,
+		"validate": validate,
+		"lint":     lint,
+		"list":     list,
+		"pause":    pause(true),
+		"resume":   pause(false),
+		"run-now":  runNow,
+		"export":   export,
+	}
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	if err := cmd(os.Args[2:]); err != nil {
+		fmt.Fprintf(os.Stderr, "runner %s: %v\n", os.Args[1], err)
+		os.Exit(1)
+	}
+}
+
+// loopback reports whether a listen address only accepts local connections
+func loopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func serve(args []string) error {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	cfg := addConfigFlags(flags)
+	listen := flags.String("listen", "127.0.0.1:8080", "address of the admin API")
+	token := flags.String("token", os.Getenv("RUNNER_TOKEN"), "bearer token the admin API requires, RUNNER_TOKEN by default")
+	remote := flags.String("remote", "", "HTTPS URL the config is fetched from and stored at -config")
+	pubkey := flags.String("pubkey", "", "file with the base64 Ed25519 key remote configs must be signed with")
+	refresh := flags.Duration("refresh", time.Minute, "how often the remote config is fetched")
+	hooks := flags.String("hooks", "", "JSON file of the webhooks served under /hooks/, by name")
+	flags.Parse(args)
+	path := *cfg.path
+	if *token == "" && !loopback(*listen) {
+		return fmt.Errorf("-listen %s isn't a loopback address, the admin API needs a -token there", *listen)
+	}
+
+	var fetcher *config.Remote
+	if *remote != "" {
+		fetcher = &config.Remote{URL: *remote, Path: path}
+		if *pubkey != "" {
+			data, err := os.ReadFile(*pubkey)
+			if err != nil {
+				return err
+			}
+			if fetcher.PublicKey, err = config.ParsePublicKey(string(data)); err != nil {
+				return err
+			}
+		}
+		if _, err := fetcher.Fetch(context.Background()); err != nil {
+			if _, statErr := os.Stat(path); statErr != nil {
+				return err
+			}
+			log.Printf("Could not fetch %s, using the copy at %s: %v\n", *remote, path, err)
+		}
+	}
+	load := cfg.options()
+	opts, err := config.LoadOptions(path, load...)
+	if err != nil {
+		return err
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	r, stopRunner, err := cfg.runner(ctx, false, append(opts, runner.WithContext(ctx), runner.WithSecrets(
+		runner.EnvSecrets{Prefix: "RUNNER_SECRET_"},
+		runner.FileSecrets{Dir: "/run/secrets"},
+	))...)
+	if err != nil {
+		return err
+	}
+	defer stopRunner()
+	reloader := &config.Reloader{
+		Runner:  r,
+		Path:    path,
+		Options: load,
+		OnReload: func(d config.Diff, err error) {
+			if err != nil {
+				log.Printf("Could not reload %s: %v\n", path, err)
+			}
+			if !d.Empty() {
+				log.Printf("Reloaded %s: %d added, %d updated, %d removed\n", path, len(d.Added), len(d.Updated), len(d.Removed))
+			}
+		},
+	}
+	if _, err := reloader.Reload(ctx); err != nil {
+		return err
+	}
+	go func() {
+		if err := reloader.Watch(ctx); err != nil && !errors.Is(err, context.Canceled) {
+			log.Printf("Not watching %s: %v\n", path, err)
+		}
+	}()
+	if fetcher != nil {
+		go fetcher.Poll(ctx, *refresh, func(_ bool, err error) {
+			if err != nil {
+				log.Printf("Could not fetch %s: %v\n", *remote, err)
+			}
+		})
+	}
+
+	handler := httpapi.Handler(r)
+	if *token != "" {
+		handler = httpapi.RequireToken(*token, handler)
+	}
+	if *hooks != "" {
+		data, err := os.ReadFile(*hooks)
+		if err != nil {
+			return err
+		}
+		var list map[string]webhook.Hook
+		if err := json.Unmarshal(data, &list); err != nil {
+			return fmt.Errorf("%s: %w", *hooks, err)
+		}
+		mux := http.NewServeMux()
+		mux.Handle("/", handler)
+		mux.Handle("/hooks/", http.StripPrefix("/hooks", webhook.Handler(r, list)))
+		handler = mux
+	}
+	srv := &http.Server{Addr: *listen, Handler: handler}
+	go func() {
+		<-ctx.Done()
+		srv.Shutdown(context.Background())
+	}()
+	log.Printf("Serving the admin API on %s\n", *listen)
+	if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+func validate(args []string) error {
+	flags := flag.NewFlagSet("validate", flag.ExitOnError)
+	cfg := addConfigFlags(flags)
+	flags.Parse(args)
+
+	r, stop, err := cfg.runner(context.Background(), true)
+	if err != nil {
+		return err
+	}
+	defer stop()
+	defs, err := config.LoadDefinitions(*cfg.path, r, cfg.options()...)
+	if err != nil {
+		return err
+	}
+	opts, err := config.LoadOptions(*cfg.path, cfg.options()...)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s: %d task(s), %d setting(s)\n", *cfg.path, len(defs), len(opts))
+	return nil
+}
+
+func lint(args []string) error {
+	flags := flag.NewFlagSet("lint", flag.ExitOnError)
+	cfg := addConfigFlags(flags)
+	asJSON := flags.Bool("json", false, "print the diagnostics as JSON")
+	strict := flags.Bool("strict", false, "fail on warnings too")
+	flags.Parse(args)
+
+	r, stop, err := cfg.runner(context.Background(), true)
+	if err != nil {
+		return err
+	}
+	defer stop()
+	diags, err := config.Lint(*cfg.path, r, cfg.options()...)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		if diags == nil {
+			diags = []config.Diagnostic{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(diags); err != nil {
+			return err
+		}
+	}
+	failed := 0
+	for _, d := range diags {
+		if !*asJSON {
+			fmt.Println(d)
+		}
+		if d.Severity == config.SeverityError || (*strict && d.Severity == config.SeverityWarning) {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d problem(s) in %s", failed, *cfg.path)
+	}
+	return nil
+}
+
+func hostname() string {
+	name, err := os.Hostname()
+	if err != nil {
+		return "runner"
+	}
+	return name
+}
@@ -0,0 +1,206 @@
+package runner
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// MaxCompactedResults caps the results stored per task between compactions
+const MaxCompactedResults = 100000
+
+// DefaultCompaction keeps raw results for a day and hourly rollups for 30 days
+var DefaultCompaction = Compaction{Raw: 24 * time.Hour, Rollups: 30 * 24 * time.Hour}
+
+// Compaction decides how long stored results are kept. Raw results older than Raw are
+// replaced by hourly rollups, which are dropped once older than Rollups.
+type Compaction struct {
+	Raw     time.Duration `json:"raw"`
+	Rollups time.Duration `json:"rollups"`
+}
+
+// Rollup summarizes the results of a task over an hour
+type Rollup struct {
+	From     int64   `json:"from"`
+	To       int64   `json:"to"`
+	Runs     int     `json:"runs"`
+	Failures int     `json:"failures"`
+	Warnings int     `json:"warnings"`
+	Numeric  int     `json:"numeric,omitempty"` // Runs with a numeric Update, which Min, Max and Mean cover
+	Min      float64 `json:"min,omitempty"`
+	Max      float64 `json:"max,omitempty"`
+	Mean     float64 `json:"mean,omitempty"`
+}
+
+// ResultCompactor is implemented by Stores that can rewrite the stored results of a task
+type ResultCompactor interface {
+	// CompactResults reads up to limit of the most recent results of a task, oldest first, and
+	// replaces the stored results by the ones fn returns in the same transaction, unless fn
+	// returns false. Results saved meanwhile are either read or kept.
+	CompactResults(ctx context.Context, id string, limit int, fn func([]Record) ([]Record, bool)) error
+}
+
+// WithCompaction keeps stored results by age instead of count, compacting them at the given
+// cadence with policy, or the policy of their task type in byType. The Store must implement
+// ResultCompactor.
+func WithCompaction(every time.Duration, policy Compaction, byType map[string]Compaction) Option {
+	return func(r *Runner) {
+		r.compactEvery = every
+		r.compaction = make(map[string]Compaction, len(byType)+1)
+		r.compaction[""] = policy
+		for typ, p := range byType {
+			r.compaction[strings.ToLower(typ)] = p
+		}
+	}
+}
+
+// Compact rolls up and drops the stored results of every task according to its policy
+func (r *Runner) Compact(ctx context.Context) error {
+	store, ok := r.store.(ResultCompactor)
+	if !ok || r.compaction == nil {
+		return ErrNoStore
+	}
+	r.mu.RLock()
+	policies := make(map[string]Compaction, len(r.specs))
+	for id, spec := range r.specs {
+		p, ok := r.compaction[strings.ToLower(spec.CleanTask.Task)]
+		if !ok {
+			p = r.compaction[""]
+		}
+		policies[id] = p
+	}
+	r.mu.RUnlock()
+	now := time.Now()
+	for id, p := range policies {
+		if err := store.CompactResults(ctx, id, MaxCompactedResults, func(recs []Record) ([]Record, bool) {
+			return compact(recs, p, now)
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compact rolls raw records of the hours before the policy's Raw age up by hour, merging them
+// into the rollups of the same hour, and drops the ones past its Rollups age. Records must be
+// oldest first.
+func compact(recs []Record, p Compaction, now time.Time) ([]Record, bool) {
+	ms := func(d time.Duration) int64 { return now.Add(-d).UnixNano() / int64(time.Millisecond) }
+	hour := int64(time.Hour / time.Millisecond)
+	rawCutoff, rollupCutoff := ms(p.Raw), ms(p.Rollups)
+	rawCutoff -= rawCutoff % hour // The hour being cut stays raw until it's over
+	var (
+		out     []Record
+		changed bool
+		hours   = make(map[int64]int) // Index in out of the rollup of an hour
+	)
+	for _, rec := range recs {
+		switch {
+		case rec.Date < rollupCutoff:
+			changed = true
+			continue
+		case rec.Rollup != nil:
+			if i, ok := hours[rec.Rollup.From]; ok {
+				changed = true
+				out[i].Rollup.merge(*rec.Rollup)
+				out[i].Warn = out[i].Warn || rec.Warn
+				continue
+			}
+			roll := *rec.Rollup
+			rec.Rollup = &roll
+			hours[roll.From] = len(out)
+			out = append(out, rec)
+			continue
+		case p.Raw <= 0 || rec.Date >= rawCutoff:
+			out = append(out, rec)
+			continue
+		}
+		changed = true
+		from := rec.Date - rec.Date%hour
+		i, ok := hours[from]
+		if !ok {
+			i = len(out)
+			hours[from] = i
+			out = append(out, Record{Date: from, Location: rec.Location, Rollup: &Rollup{From: from, To: from + hour}})
+		}
+		roll := Rollup{From: from, To: from + hour, Runs: 1}
+		if rec.Error != "" {
+			roll.Failures = 1
+		}
+		if rec.Warn {
+			roll.Warnings = 1
+			out[i].Warn = true
+		}
+		if v, ok := numeric(rec.Update); ok {
+			roll.Numeric, roll.Min, roll.Max, roll.Mean = 1, v, v, v
+		}
+		out[i].Rollup.merge(roll)
+	}
+	return out, changed
+}
+
+// merge adds the runs of another rollup of the same hour
+func (roll *Rollup) merge(o Rollup) {
+	roll.From, roll.To = min(roll.From, o.From), max(roll.To, o.To)
+	roll.Runs += o.Runs
+	roll.Failures += o.Failures
+	roll.Warnings += o.Warnings
+	if o.Numeric == 0 {
+		return
+	}
+	if roll.Numeric == 0 || o.Min < roll.Min {
+		roll.Min = o.Min
+	}
+	if roll.Numeric == 0 || o.Max > roll.Max {
+		roll.Max = o.Max
+	}
+	roll.Mean += (o.Mean - roll.Mean) * float64(o.Numeric) / float64(roll.Numeric+o.Numeric)
+	roll.Numeric += o.Numeric
+}
+
+// numeric converts the Update of a result to a number when it is one
+func numeric(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case uint32:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+// startCompaction runs Compact at the configured cadence until the Runner is stopped
+func (r *Runner) startCompaction() {
+	if r.store == nil || r.compaction == nil || r.compactEvery <= 0 {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	r.mu.Lock()
+	r.cancellations = append(r.cancellations, cancel)
+	r.mu.Unlock()
+	go func() {
+		ticker := time.NewTicker(r.compactEvery)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := r.Compact(ctx); err != nil {
+					r.logf(slog.LevelError, "Could not compact results: %v\n", err)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
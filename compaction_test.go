@@ -0,0 +1,116 @@
+package runner_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"pkg.goda.sh/runner/v2"
+	"pkg.goda.sh/runner/v2/runnertest"
+)
+
+// compacted creates a Runner storing the results of a single task in store, compacted with a
+// day of raw results
+func compacted(t *testing.T, store runner.Store) (*runner.Runner, string) {
+	t.Helper()
+	r, _ := runnertest.New(t, map[string]*runnertest.Script{"probe": runnertest.NewScript()},
+		runner.WithStore(store), runner.WithCompaction(time.Hour, runner.DefaultCompaction, nil))
+	if err := r.AddSpec(context.Background(), r.NewTask("probe").Label("gateway").Interval("PT1M").MustBuild()); err != nil {
+		t.Fatal(err)
+	}
+	return r, r.Tasks("probe")[0].ID
+}
+
+func TestCompactMergesHoursAndKeepsTheCutoffHourRaw(t *testing.T) {
+	ctx := context.Background()
+	store := runner.NewMemoryStore()
+	r, id := compacted(t, store)
+	hour := int64(time.Hour / time.Millisecond)
+	cutoff := time.Now().Add(-runner.DefaultCompaction.Raw).UnixNano() / int64(time.Millisecond)
+	old := cutoff - cutoff%hour - 2*hour
+	save := func(dates ...int64) {
+		for _, date := range dates {
+			if err := store.SaveResult(ctx, id, runner.Record{Date: date, Update: float64(date - old)}, runner.MaxCompactedResults); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	save(old, old+10)
+	if cutoff%hour > 0 {
+		save(cutoff - cutoff%hour) // Before the cutoff, in the hour it cuts
+	}
+	if err := r.Compact(ctx); err != nil {
+		t.Fatal(err)
+	}
+	save(old + 20) // Saved late, in an hour rolled up already
+	if err := r.Compact(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	recs, err := store.Results(ctx, id, runner.MaxCompactedResults)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rollups []runner.Rollup
+	for _, rec := range recs {
+		switch {
+		case rec.Rollup != nil:
+			rollups = append(rollups, *rec.Rollup)
+		case rec.Date < cutoff-cutoff%hour:
+			t.Errorf("raw result of %d left before the cutoff hour", rec.Date)
+		}
+	}
+	if len(rollups) != 1 {
+		t.Fatalf("%d rollups, want the 3 results of the hour merged: %+v", len(rollups), rollups)
+	}
+	if roll := rollups[0]; roll.Runs != 3 || roll.Numeric != 3 || roll.Min != 0 || roll.Max != 20 || roll.Mean != 10 {
+		t.Errorf("rollup %+v, want 3 runs from 0 to 20 averaging 10", roll)
+	}
+	if want := 1 + min(1, cutoff%hour); int64(len(recs)) != want {
+		t.Errorf("%d results, want the rollup and the raw result of the cutoff hour", len(recs))
+	}
+}
+
+func TestCompactKeepsResultsSavedMeanwhile(t *testing.T) {
+	ctx := context.Background()
+	store := runner.NewMemoryStore()
+	r, id := compacted(t, store)
+	old := time.Now().Add(-2*runner.DefaultCompaction.Raw).UnixNano() / int64(time.Millisecond)
+	for i := int64(0); i < 1000; i++ {
+		if err := store.SaveResult(ctx, id, runner.Record{Date: old + i}, runner.MaxCompactedResults); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 500; i++ {
+			if err := store.SaveResult(ctx, id, runner.Record{Date: time.Now().UnixNano() / int64(time.Millisecond)}, runner.MaxCompactedResults); err != nil {
+				t.Error(err)
+			}
+		}
+	}()
+	for i := 0; i < 20; i++ {
+		if err := r.Compact(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wg.Wait()
+
+	recs, err := store.Results(ctx, id, runner.MaxCompactedResults)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw := 0
+	for _, rec := range recs {
+		if rec.Rollup == nil {
+			raw++
+		}
+	}
+	if raw != 500 {
+		t.Errorf("%d recent results left, want the 500 saved while compacting", raw)
+	}
+}
@@ -0,0 +1,330 @@
+// Package config loads task definitions from YAML, JSON or TOML files, so task sets can be
+// managed declaratively instead of in Go code. A file lists its tasks under the tasks key,
+// with the fields of runner.Spec:
+//
+//	tasks:
+//	  - label: Homepage
+//	    task: http
+//	    interval: 5m
+//	    tags: [web]
+//	    params:
+//	      url: https://example.com
+//	      token: ${HOMEPAGE_TOKEN:?needed to log in}
+//
+// or, in TOML:
+//
+//	[[tasks]]
+//	label = "Homepage"
+//	task = "http"
+//	interval = "5m"
+//	params.url = "https://example.com"
+//
+// Files may include others, ex. common checks shared by every environment, and set defaults
+// for the tasks of a type, see loader. They may also declare where results are sent, see
+// SinkConfig, and override settings per environment in profiles, see WithProfile.
+// Templates render variants of a file per runner, see TemplateExt, and configs can be
+// pulled from a controller, see Remote.
+//
+// String values may refer to environment variables, see expand, so secrets and endpoints
+// that differ per environment stay out of the files. Expanded values stay strings.
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+
+	"gopkg.in/yaml.v2"
+	"pkg.goda.sh/runner/v2"
+	"pkg.goda.sh/tasks"
+)
+
+// Error is a problem with a single task definition
+type Error struct {
+	File    string
+	Profile string // Set when the task is defined by a profile of the file
+	Index   int    // Position of the task in the file or profile, starting at 1
+	Label   string
+	Err     error
+}
+
+func (e *Error) Error() string {
+	file := e.File
+	if e.Profile != "" {
+		file += ": profile " + e.Profile
+	}
+	if e.Label == "" {
+		return fmt.Sprintf("%s: task %d: %v", file, e.Index, e.Err)
+	}
+	return fmt.Sprintf("%s: task %d (%q): %v", file, e.Index, e.Label, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Definition is a loaded task along with where it was defined
+type Definition struct {
+	runner.Spec
+	File    string
+	Profile string // Set when the profile defined the task rather than overriding it
+	Index   int
+}
+
+// errorf gets an Error about the definition
+func (d Definition) errorf(err error) error {
+	return &Error{File: d.File, Profile: d.Profile, Index: d.Index, Label: d.Label, Err: err}
+}
+
+// Load parses a config file, or every .yaml, .yml, .json and .toml file of a directory in
+// name order, templates of those among them, see TemplateExt, into task definitions. Includes are read first, see loader, and profiles
+// applied, see WithProfile. When r isn't nil, files are validated against its schema, see
+// SchemaFor, and definitions are checked the same way AddSpec does, see
+// Runner.ValidateSpec, tasks already in its task list aside. Every problem found is
+// returned, joined.
+func Load(path string, r *runner.Runner, opts ...LoadOption) ([]tasks.Task, error) {
+	defs, err := LoadDefinitions(path, r, opts...)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]tasks.Task, len(defs))
+	for i, d := range defs {
+		list[i] = d.Task()
+	}
+	return list, nil
+}
+
+// LoadDefinitions is Load keeping the runner-level settings and positions of the tasks
+func LoadDefinitions(path string, r *runner.Runner, opts ...LoadOption) ([]Definition, error) {
+	defs, _, err := load(path, r, opts)
+	return defs, err
+}
+
+// load reads the config at path, also getting every file read, includes among them
+func load(path string, r *runner.Runner, opts []LoadOption) ([]Definition, []string, error) {
+	l := newLoader(opts)
+	if l.identity == nil && r != nil {
+		l.identity = &r.Identity
+	}
+	d, err := l.load(path)
+	errs := []error{err}
+	defs, e := definitions(d.entries(), r)
+	errs = append(errs, e...)
+	if r != nil {
+		errs = append(errs, Check(r, defs)...)
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, l.seen, err
+	}
+	return defs, l.seen, nil
+}
+
+// Parse decodes the task definitions of a config file in the format of its extension: TOML
+// for .toml, YAML otherwise, which covers JSON. The name is also used in errors and to find
+// includes.
+func Parse(name string, data []byte, opts ...LoadOption) ([]Definition, error) {
+	d, err := newLoader(opts).parse(name, data)
+	defs, errs := definitions(d.entries(), nil)
+	return defs, errors.Join(append([]error{err}, errs...)...)
+}
+
+// definitions decodes entries, checking them against the schema of r when it isn't nil
+func definitions(entries []entry, r *runner.Runner) (defs []Definition, errs []error) {
+	var schema *Schema
+	if r != nil {
+		schema = SchemaFor(r).Properties["tasks"].Items
+	}
+	for _, e := range entries {
+		if schema != nil {
+			if problems := schema.check(e.pointer("tasks"), e.raw); len(problems) > 0 {
+				for _, p := range problems {
+					p.File = e.file
+					errs = append(errs, p)
+				}
+				continue
+			}
+		}
+		d := Definition{File: e.file, Profile: e.profile, Index: e.index}
+		if err := decode(e.raw, &d.Spec); err != nil {
+			errs = append(errs, &Error{File: e.file, Profile: e.profile, Index: e.index, Label: e.label(), Err: err})
+			continue
+		}
+		if err := required(d.Spec); err != nil {
+			errs = append(errs, d.errorf(err))
+			continue
+		}
+		defs = append(defs, d)
+	}
+	return defs, errs
+}
+
+// Check gets every reason the definitions can't be added to r, including tasks defined twice
+func Check(r *runner.Runner, defs []Definition) (errs []error) {
+	seen := make(map[string]Definition, len(defs))
+	for _, d := range defs {
+		for _, err := range r.ValidateSpec(d.Spec) {
+			if !errors.Is(err, runner.ErrDuplicateTask) {
+				errs = append(errs, d.errorf(err))
+			}
+		}
+		id := r.Hash(d.Task())
+		if first, ok := seen[id]; ok {
+			by := first.File
+			if first.Profile != "" {
+				by += " profile " + first.Profile
+			}
+			err := fmt.Errorf("%w: already defined by %s task %d", runner.ErrDuplicateTask, by, first.Index)
+			errs = append(errs, d.errorf(err))
+			continue
+		}
+		seen[id] = d
+	}
+	return errs
+}
+
+// files lists the config files at path
+func files(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() && isConfig(e.Name()) {
+			names = append(names, filepath.Join(path, e.Name()))
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// isConfig reports whether a file in a config directory is loaded
+func isConfig(name string) bool {
+	switch ext(name) {
+	case ".yaml", ".yml", ".json", ".toml":
+		return true
+	}
+	return false
+}
+
+// unmarshal decodes a config file, see Parse
+func unmarshal(name string, data []byte) (doc interface{}, err error) {
+	if ext(name) == ".toml" {
+		doc, err = parseTOML(data)
+	} else {
+		err = yaml.UnmarshalStrict(data, &doc)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return doc, nil
+}
+
+// fieldsOf gets the fields of a decoded mapping, nil has none
+func fieldsOf(v interface{}) (map[string]interface{}, error) {
+	fields := make(map[string]interface{})
+	switch v := v.(type) {
+	case nil:
+	case map[interface{}]interface{}:
+		for key, value := range v {
+			name, ok := key.(string)
+			if !ok {
+				return nil, fmt.Errorf("key %v isn't a string", key)
+			}
+			fields[name] = value
+		}
+	case map[string]interface{}:
+		fields = v
+	default:
+		return nil, errors.New("not a mapping")
+	}
+	return fields, nil
+}
+
+// known rejects the fields that aren't listed
+func known(fields map[string]interface{}, names ...string) error {
+	for name := range fields {
+		if !slices.Contains(names, name) {
+			return fmt.Errorf("unknown field %s", name)
+		}
+	}
+	return nil
+}
+
+// decode fills v from an entry through its JSON encoding, rejecting unknown fields
+func decode(raw map[string]interface{}, v interface{}) error {
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
+
+// plain converts the maps decoded by yaml to maps keyed by string and expands the
+// environment variables of strings
+func plain(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for name, value := range v {
+			value, err := plain(value)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+			out[name] = value
+		}
+		return out, nil
+	case map[interface{}]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			name, ok := key.(string)
+			if !ok {
+				return nil, fmt.Errorf("key %v isn't a string", key)
+			}
+			value, err := plain(value)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+			out[name] = value
+		}
+		return out, nil
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, value := range v {
+			value, err := plain(value)
+			if err != nil {
+				return nil, fmt.Errorf("%d: %w", i, err)
+			}
+			out[i] = value
+		}
+		return out, nil
+	case string:
+		return expand(v)
+	}
+	return v, nil
+}
+
+// required checks the fields every definition needs
+func required(s runner.Spec) error {
+	switch {
+	case s.Label == "":
+		return fmt.Errorf("%w: missing label", runner.ErrInvalidTask)
+	case s.CleanTask.Task == "":
+		return fmt.Errorf("%w: missing task type", runner.ErrInvalidTask)
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+var (
+	// ErrUnsetVariable is returned for a required environment variable that isn't set
+	ErrUnsetVariable = errors.New("config: required variable is not set")
+)
+
+// expand replaces the environment variable references in a config value:
+//
+//	${NAME}          the variable, empty when unset
+//	${NAME:-default} default when unset or empty, ${NAME-default} only when unset
+//	${NAME:?reason}  ErrUnsetVariable when unset or empty, ${NAME?reason} only when unset
+//	$$               a literal $
+func expand(s string) (string, error) {
+	var b strings.Builder
+	for {
+		i := strings.IndexByte(s, '$')
+		if i < 0 {
+			b.WriteString(s)
+			return b.String(), nil
+		}
+		b.WriteString(s[:i])
+		s = s[i:]
+		switch {
+		case strings.HasPrefix(s, "$$"):
+			b.WriteByte('$')
+			s = s[2:]
+		case strings.HasPrefix(s, "${"):
+			end := strings.IndexByte(s, '}')
+			if end < 0 {
+				return "", fmt.Errorf("unterminated variable reference %q", s)
+			}
+			v, err := variable(s[2:end])
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(v)
+			s = s[end+1:]
+		default:
+			b.WriteByte('$')
+			s = s[1:]
+		}
+	}
+}
+
+// variable resolves a single reference, without its ${ and }
+func variable(ref string) (string, error) {
+	name, op, arg := ref, "", ""
+	if i := strings.IndexAny(ref, ":-?"); i >= 0 {
+		name = ref[:i]
+		for _, o := range []string{":-", ":?", "-", "?"} {
+			if strings.HasPrefix(ref[i:], o) {
+				op, arg = o, ref[i+len(o):]
+				break
+			}
+		}
+	}
+	if !validName(name) || (op == "" && name != ref) {
+		return "", fmt.Errorf("bad variable reference ${%s}", ref)
+	}
+	v, set := os.LookupEnv(name)
+	switch {
+	case op == ":-" && v == "", op == "-" && !set:
+		return arg, nil
+	case op == ":?" && v == "", op == "?" && !set:
+		if arg == "" {
+			return "", fmt.Errorf("%w: %s", ErrUnsetVariable, name)
+		}
+		return "", fmt.Errorf("%w: %s: %s", ErrUnsetVariable, name, arg)
+	}
+	return v, nil
+}
+
+func validName(name string) bool {
+	for i, c := range name {
+		if c != '_' && (c < 'A' || c > 'Z') && (c < 'a' || c > 'z') && (i == 0 || c < '0' || c > '9') {
+			return false
+		}
+	}
+	return name != ""
+}
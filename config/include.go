@@ -0,0 +1,335 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"pkg.goda.sh/runner/v2"
+)
+
+// entry is a task definition of a config file before it's decoded
+type entry struct {
+	raw     map[string]interface{}
+	file    string
+	profile string // Profile of the file defining it, if any
+	index   int
+}
+
+func (e entry) label() string {
+	return e.key("label")
+}
+
+func (e entry) key(field string) string {
+	v, _ := e.raw[field].(string)
+	return v
+}
+
+// pointer gets the JSON Pointer of the entry in its file, list is tasks or sinks
+func (e entry) pointer(list string) string {
+	if e.profile != "" {
+		return fmt.Sprintf("/profiles/%s/%s/%d", e.profile, list, e.index-1)
+	}
+	return fmt.Sprintf("/%s/%d", list, e.index-1)
+}
+
+// document is a config file merged with the files it includes
+type document struct {
+	tasks       []entry
+	sinks       []entry
+	concurrency map[string]interface{}
+	defaults    map[string]interface{} // Task fields by task type
+}
+
+// entries gets the tasks of a document with the defaults of their type, see loader
+func (d document) entries() []entry {
+	entries := make([]entry, len(d.tasks))
+	for i, e := range d.tasks {
+		if defaults, ok := d.defaults[strings.ToLower(e.key("task"))].(map[string]interface{}); ok {
+			e.raw = overlay(defaults, e.raw)
+		}
+		entries[i] = e
+	}
+	return entries
+}
+
+// loader reads config files along with the files they include:
+//
+//	include: [common/*.yaml, checks.toml]
+//
+// Paths are relative to the including file and may be glob patterns, matches are read in
+// name order. The tasks of a file come after those it includes, with these merge rules:
+//
+//   - a task with the label of an included task is merged into it instead, keeping its
+//     position: mappings such as params are merged key by key, other values are replaced
+//   - a task with remove: true drops the included task with its label
+//   - tasks sharing a label within the same file are kept apart
+//
+// Sinks are merged the same way by name, concurrency limits and defaults key by key. The
+// profile of the loader is applied to each file right after its own tasks, see WithProfile.
+//
+// Defaults hold the fields shared by the tasks of a type, set on those that don't have
+// their own once every file is merged, mappings key by key:
+//
+//	defaults:
+//	  http:
+//	    interval: 5m
+//	    tags: [web]
+//	    params: {timeout: 10s, retries: 2}
+type loader struct {
+	profile  string
+	found    bool // Whether a file has the profile
+	identity *runner.Identity
+	vars     map[string]interface{}
+	seen     []string // Every file read
+	stack    []string // Files being read, to catch include cycles
+
+	sinkTypes map[string]SinkFunc // See WithSinkType
+}
+
+// newLoader gets a loader using the profile named by ProfileEnv unless opts select another
+func newLoader(opts []LoadOption) *loader {
+	l := &loader{profile: os.Getenv(ProfileEnv)}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
+}
+
+// load reads every config file at path, see files
+func (l *loader) load(path string) (d document, err error) {
+	names, err := files(path)
+	if err != nil {
+		return d, err
+	}
+	var errs []error
+	for _, name := range names {
+		fd, err := l.read(name)
+		d.include(fd)
+		errs = append(errs, err)
+	}
+	if l.profile != "" && !l.found {
+		errs = append(errs, fmt.Errorf("%s: %w %q", path, ErrUnknownProfile, l.profile))
+	}
+	return d, errors.Join(errs...)
+}
+
+// read reads a config file with its includes
+func (l *loader) read(name string) (document, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return document{}, err
+	}
+	return l.parse(name, data)
+}
+
+// parse decodes a config file with its includes
+func (l *loader) parse(name string, data []byte) (d document, err error) {
+	abs, err := filepath.Abs(name)
+	if err != nil {
+		return d, err
+	}
+	if slices.Contains(l.stack, abs) {
+		return d, fmt.Errorf("%s: include cycle", name)
+	}
+	l.seen = append(l.seen, abs)
+	l.stack = append(l.stack, abs)
+	defer func() { l.stack = l.stack[:len(l.stack)-1] }()
+	if data, err = l.render(name, data); err != nil {
+		return d, fmt.Errorf("%s: %w", name, err)
+	}
+	raw, err := unmarshal(name, data)
+	if err != nil {
+		return d, err
+	}
+	fields, err := fieldsOf(raw)
+	if err == nil {
+		err = known(fields, "include", "tasks", "sinks", "concurrency", "defaults", "profiles")
+	}
+	if err != nil {
+		return d, fmt.Errorf("%s: %w", name, err)
+	}
+	includes, err := paths(fields["include"])
+	if err != nil {
+		return d, fmt.Errorf("%s: include: %w", name, err)
+	}
+	var errs []error
+	for _, pattern := range includes {
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(filepath.Dir(name), pattern)
+		}
+		matches, err := filepath.Glob(pattern)
+		if err == nil && len(matches) == 0 {
+			err = os.ErrNotExist
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: include %s: %w", name, pattern, err))
+			continue
+		}
+		sort.Strings(matches)
+		for _, match := range matches {
+			included, err := l.read(match)
+			d.include(included)
+			errs = append(errs, err)
+		}
+	}
+	errs = append(errs, d.apply(name, "", fields)...)
+	profiles, err := fieldsOf(fields["profiles"])
+	if err != nil {
+		return d, fmt.Errorf("%s: profiles: %w", name, err)
+	}
+	if p, ok := profiles[l.profile]; ok && l.profile != "" {
+		l.found = true
+		overrides, err := fieldsOf(p)
+		if err == nil {
+			err = known(overrides, "tasks", "sinks", "concurrency", "defaults")
+		}
+		if err != nil {
+			return d, fmt.Errorf("%s: profile %s: %w", name, l.profile, err)
+		}
+		errs = append(errs, d.apply(name, l.profile, overrides)...)
+	}
+	return d, errors.Join(errs...)
+}
+
+// include adds the entries of an included file
+func (d *document) include(included document) {
+	d.tasks = append(d.tasks, included.tasks...)
+	d.sinks = append(d.sinks, included.sinks...)
+	if included.concurrency != nil {
+		d.concurrency = overlay(d.concurrency, included.concurrency)
+	}
+	if included.defaults != nil {
+		d.defaults = overlay(d.defaults, included.defaults)
+	}
+}
+
+// apply merges the tasks, sinks, concurrency limits and defaults of a file, or of one of its
+// profiles
+func (d *document) apply(name, profile string, fields map[string]interface{}) (errs []error) {
+	prefix := name
+	if profile != "" {
+		prefix += ": profile " + profile
+	}
+	var e []error
+	d.tasks, e = section(prefix, "tasks", fields["tasks"], d.tasks, entry{file: name, profile: profile}, "label", func(en entry, err error) error {
+		return &Error{File: name, Profile: profile, Index: en.index, Label: en.label(), Err: err}
+	})
+	errs = append(errs, e...)
+	d.sinks, e = section(prefix, "sinks", fields["sinks"], d.sinks, entry{file: name, profile: profile}, "name", func(en entry, err error) error {
+		return fmt.Errorf("%s: sink %d (%q): %w", prefix, en.index, en.key("name"), err)
+	})
+	errs = append(errs, e...)
+	if v := fields["concurrency"]; v != nil {
+		limits, err := plain(v)
+		m, ok := limits.(map[string]interface{})
+		if err != nil || !ok {
+			return append(errs, fmt.Errorf("%s: concurrency is not a mapping of group names to limits", prefix))
+		}
+		d.concurrency = overlay(d.concurrency, m)
+	}
+	if v := fields["defaults"]; v != nil {
+		defaults, err := plain(v)
+		m, ok := defaults.(map[string]interface{})
+		if err != nil || !ok {
+			return append(errs, fmt.Errorf("%s: defaults is not a mapping of task types to fields", prefix))
+		}
+		byType := make(map[string]interface{}, len(m))
+		for typ, fields := range m {
+			if _, ok := fields.(map[string]interface{}); !ok {
+				return append(errs, fmt.Errorf("%s: defaults of %s is not a mapping", prefix, typ))
+			}
+			byType[strings.ToLower(typ)] = fields
+		}
+		d.defaults = overlay(d.defaults, byType)
+	}
+	return errs
+}
+
+// section merges a list of a file with the entries it includes, keyed by the given field.
+// Entries of the list are copies of at with their position.
+func section(prefix, field string, v interface{}, included []entry, at entry, key string, wrap func(entry, error) error) ([]entry, []error) {
+	list, ok := v.([]interface{})
+	if v != nil && !ok {
+		return included, []error{fmt.Errorf("%s: %s is not a list", prefix, field)}
+	}
+	entries := included
+	var errs []error
+	for i, raw := range list {
+		e := at
+		e.index = i + 1
+		v, err := plain(raw)
+		if err != nil {
+			errs = append(errs, wrap(e, err))
+			continue
+		}
+		if e.raw, ok = v.(map[string]interface{}); !ok {
+			errs = append(errs, wrap(e, errors.New("not a mapping")))
+			continue
+		}
+		if entries, err = merge(entries, len(included), e, key); err != nil {
+			errs = append(errs, wrap(e, err))
+		}
+	}
+	return entries, errs
+}
+
+// merge adds an entry to those of a file, the first n of which are included
+func merge(entries []entry, n int, e entry, key string) ([]entry, error) {
+	remove, _ := e.raw["remove"].(bool)
+	delete(e.raw, "remove")
+	i := -1
+	if k := e.key(key); k != "" {
+		i = slices.IndexFunc(entries[:n], func(included entry) bool { return included.key(key) == k })
+	}
+	switch {
+	case remove && i < 0:
+		return entries, fmt.Errorf("nothing included with %s %q to remove", key, e.key(key))
+	case remove:
+		return slices.Delete(entries, i, i+1), nil
+	case i >= 0:
+		entries[i].raw = overlay(entries[i].raw, e.raw)
+		return entries, nil
+	}
+	return append(entries, e), nil
+}
+
+// overlay merges the keys of over into a copy of base
+func overlay(base, over map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(base)+len(over))
+	for k, v := range base {
+		out[k] = v
+	}
+	for k, v := range over {
+		b, ok := out[k].(map[string]interface{})
+		o, isMap := v.(map[string]interface{})
+		if ok && isMap {
+			v = overlay(b, o)
+		}
+		out[k] = v
+	}
+	return out
+}
+
+// paths gets a list of paths
+func paths(v interface{}) ([]string, error) {
+	switch v := v.(type) {
+	case nil:
+		return nil, nil
+	case []interface{}:
+		out := make([]string, len(v))
+		for i, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("%v is not a path", item)
+			}
+			out[i] = s
+		}
+		return out, nil
+	}
+	return nil, errors.New("not a list of paths")
+}
@@ -0,0 +1,259 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"pkg.goda.sh/runner/v2"
+)
+
+// Severity tells how much a Diagnostic matters
+type Severity string
+
+// Diagnostic severities
+const (
+	SeverityError   Severity = "error"   // The config can't be loaded
+	SeverityWarning Severity = "warning" // Loads, but is likely a mistake
+	SeverityInfo    Severity = "info"
+)
+
+// Lint checks, the Code of the diagnostics they report
+const (
+	LintInvalid       = "invalid"        // The config doesn't load, see Load
+	LintUnknownType   = "unknown-type"   // No task runner for the task type
+	LintShortInterval = "short-interval" // Runs more than once a second
+	LintDuplicate     = "duplicate-label"
+	LintNoSink        = "no-sink"      // No sink receives the results of the task
+	LintUnusedLimit   = "unused-limit" // A concurrency limit for a group without tasks
+)
+
+// MinInterval is the shortest interval Lint doesn't report
+const MinInterval = time.Second
+
+// Diagnostic is a problem Lint found in a config
+type Diagnostic struct {
+	Severity Severity `json:"severity"`
+	Code     string   `json:"code"`
+	File     string   `json:"file,omitempty"`
+	Profile  string   `json:"profile,omitempty"`
+	Index    int      `json:"index,omitempty"` // Position of the task, 0 for diagnostics about the whole config
+	Label    string   `json:"label,omitempty"`
+	Message  string   `json:"message"`
+	Hint     string   `json:"hint,omitempty"` // What to change
+}
+
+func (d Diagnostic) String() string {
+	var b strings.Builder
+	if d.File != "" {
+		b.WriteString(d.File + ": ")
+	}
+	if d.Profile != "" {
+		b.WriteString("profile " + d.Profile + ": ")
+	}
+	if d.Index > 0 {
+		fmt.Fprintf(&b, "task %d", d.Index)
+		if d.Label != "" {
+			fmt.Fprintf(&b, " (%q)", d.Label)
+		}
+		b.WriteString(": ")
+	}
+	fmt.Fprintf(&b, "%s: %s [%s]", d.Severity, d.Message, d.Code)
+	if d.Hint != "" {
+		b.WriteString(", " + d.Hint)
+	}
+	return b.String()
+}
+
+// Lint checks the config at path for settings that are valid but suspicious, on top of
+// what Load rejects: intervals under MinInterval, labels used by several tasks, tasks whose
+// results no sink receives and limits of groups without tasks. Task types r can't run are
+// reported with the closest one it can. The error is only set when the config can't be read.
+func Lint(path string, r *runner.Runner, opts ...LoadOption) ([]Diagnostic, error) {
+	if _, err := files(path); err != nil {
+		return nil, err
+	}
+	l := newLoader(opts)
+	if l.identity == nil {
+		l.identity = &r.Identity
+	}
+	d, err := l.load(path)
+	diags := diagnose(err)
+	schema := SchemaFor(r).Properties["tasks"].Items
+	types := r.TaskTypes()
+	var defs []Definition
+	seen := make(map[string]Definition)
+	for _, e := range d.entries() {
+		decoded, errs := definitions([]entry{e}, nil)
+		if len(errs) > 0 {
+			diags = append(diags, diagnose(errors.Join(errs...))...)
+			continue
+		}
+		def := decoded[0]
+		at := Diagnostic{File: def.File, Profile: def.Profile, Index: def.Index, Label: def.Label}
+		if typ := strings.ToLower(def.CleanTask.Task); !slices.Contains(types, typ) {
+			at.Severity, at.Code = SeverityError, LintUnknownType
+			at.Message = fmt.Sprintf("no task runner for task type %q", def.CleanTask.Task)
+			if closest := closest(typ, types); closest != "" {
+				at.Hint = fmt.Sprintf("did you mean %q?", closest)
+			}
+			diags = append(diags, at)
+			continue
+		}
+		var problems []error
+		for _, p := range schema.check(e.pointer("tasks"), e.raw) {
+			p.File = e.file
+			problems = append(problems, p)
+		}
+		for _, err := range r.ValidateSpec(def.Spec) {
+			if !errors.Is(err, runner.ErrDuplicateTask) {
+				problems = append(problems, def.errorf(err))
+			}
+		}
+		if len(problems) > 0 {
+			diags = append(diags, diagnose(errors.Join(problems...))...)
+			continue
+		}
+		id := r.Hash(def.Task())
+		if first, ok := seen[id]; ok {
+			at.Severity, at.Code = SeverityError, LintInvalid
+			at.Message = fmt.Sprintf("same task as %s task %d", first.File, first.Index)
+			at.Hint = "remove one of them or change its params"
+			diags = append(diags, at)
+			continue
+		}
+		seen[id] = def
+		defs = append(defs, def)
+	}
+	diags = append(diags, lintTasks(r, defs)...)
+	configs, err := sinks(d.sinks)
+	diags = append(diags, diagnose(err)...)
+	diags = append(diags, lintSinks(configs, defs)...)
+	limits, err := concurrency(d.concurrency)
+	diags = append(diags, diagnose(err)...)
+	for _, group := range slices.Sorted(maps.Keys(limits)) {
+		if !slices.ContainsFunc(defs, func(def Definition) bool { return strings.EqualFold(def.Group, group) }) {
+			diags = append(diags, Diagnostic{
+				Severity: SeverityInfo,
+				Code:     LintUnusedLimit,
+				Message:  fmt.Sprintf("concurrency limit for group %q, which has no tasks", group),
+				Hint:     "check the group names of tasks",
+			})
+		}
+	}
+	return diags, nil
+}
+
+// lintTasks checks the intervals and labels of tasks
+func lintTasks(r *runner.Runner, defs []Definition) (diags []Diagnostic) {
+	labels := make(map[string]Definition, len(defs))
+	for _, def := range defs {
+		at := Diagnostic{File: def.File, Profile: def.Profile, Index: def.Index, Label: def.Label}
+		if d := r.ParseDuration(def.Interval); !r.Timerless(def.CleanTask.Task) && d > 0 && d < MinInterval {
+			at := at
+			at.Severity, at.Code = SeverityWarning, LintShortInterval
+			at.Message = fmt.Sprintf("runs every %s", d)
+			at.Hint = fmt.Sprintf("use an interval of at least %s", MinInterval)
+			diags = append(diags, at)
+		}
+		if first, ok := labels[def.Label]; ok {
+			at.Severity, at.Code = SeverityWarning, LintDuplicate
+			at.Message = fmt.Sprintf("label already used by %s task %d", first.File, first.Index)
+			at.Hint = "labels tell tasks apart in results, give each task its own"
+			diags = append(diags, at)
+			continue
+		}
+		labels[def.Label] = def
+	}
+	return diags
+}
+
+// lintSinks reports the tasks whose results no sink receives
+func lintSinks(configs []SinkConfig, defs []Definition) (diags []Diagnostic) {
+	if len(configs) == 0 {
+		if len(defs) > 0 {
+			diags = append(diags, Diagnostic{
+				Severity: SeverityInfo,
+				Code:     LintNoSink,
+				Message:  "no sinks, results are only kept by the runner",
+				Hint:     "declare sinks to send them elsewhere, see SinkConfig",
+			})
+		}
+		return diags
+	}
+	for _, def := range defs {
+		if slices.ContainsFunc(configs, func(c SinkConfig) bool { return c.matches(def.CleanTask.Task, def.Tags) }) {
+			continue
+		}
+		diags = append(diags, Diagnostic{
+			Severity: SeverityWarning,
+			Code:     LintNoSink,
+			File:     def.File,
+			Profile:  def.Profile,
+			Index:    def.Index,
+			Label:    def.Label,
+			Message:  "no sink receives its results",
+			Hint:     "add its type or one of its tags to the tasks or tags of a sink",
+		})
+	}
+	return diags
+}
+
+// diagnose turns the errors of loading a config into diagnostics
+func diagnose(err error) (diags []Diagnostic) {
+	if err == nil {
+		return nil
+	}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		for _, err := range joined.Unwrap() {
+			diags = append(diags, diagnose(err)...)
+		}
+		return diags
+	}
+	d := Diagnostic{Severity: SeverityError, Code: LintInvalid, Message: err.Error()}
+	var taskErr *Error
+	var schemaErr *SchemaError
+	switch {
+	case errors.As(err, &taskErr):
+		d.File, d.Profile, d.Index, d.Label = taskErr.File, taskErr.Profile, taskErr.Index, taskErr.Label
+		d.Message = taskErr.Err.Error()
+	case errors.As(err, &schemaErr):
+		d.File, d.Message = schemaErr.File, schemaErr.Path+": "+schemaErr.Message
+	}
+	return append(diags, d)
+}
+
+// closest gets the name within an edit distance of 2 of name, if any
+func closest(name string, names []string) string {
+	best, bestDist := "", 3
+	for _, n := range names {
+		if d := distance(name, n); d < bestDist {
+			best, bestDist = n, d
+		}
+	}
+	return best
+}
+
+// distance is the Levenshtein distance of two strings
+func distance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
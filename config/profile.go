@@ -0,0 +1,38 @@
+package config
+
+import "errors"
+
+// ProfileEnv names the environment variable selecting the profile when no WithProfile
+// option is given
+const ProfileEnv = "RUNNER_PROFILE"
+
+// ErrUnknownProfile is returned when no config file has the selected profile
+var ErrUnknownProfile = errors.New("config: unknown profile")
+
+// LoadOption changes how config files are loaded
+type LoadOption func(*loader)
+
+// WithProfile selects the profile applied to every file, ex. dev, staging or prod. A profile
+// overrides the tasks, sinks, concurrency limits and defaults of the file declaring it:
+//
+//	tasks:
+//	  - label: Homepage
+//	    task: http
+//	    interval: 5m
+//	profiles:
+//	  prod:
+//	    tasks:
+//	      - label: Homepage
+//	        interval: 1m
+//	    concurrency: {crawlers: 8}
+//	    sinks:
+//	      - name: alerts
+//	        url: https://hooks.example.com/prod
+//
+// Its entries are merged into those of the file and its includes by label or name, see
+// loader, so it can change, add or remove any of them. The empty name selects no profile.
+func WithProfile(name string) LoadOption {
+	return func(l *loader) {
+		l.profile = name
+	}
+}
@@ -0,0 +1,216 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"pkg.goda.sh/runner/v2"
+)
+
+// mountData is the symlink Kubernetes swaps to update the files of a mounted ConfigMap or
+// Secret all at once, the files are symlinks through it
+const mountData = "..data"
+
+// ReloadDelay is how long Watch waits for changes to settle before reloading, editors often
+// write a file in several steps
+const ReloadDelay = 100 * time.Millisecond
+
+// Diff is the change between the tasks a Reloader manages and the config. Added and Updated
+// definitions carry the ID of their task.
+type Diff struct {
+	Added   []Definition
+	Updated []Definition // Same task ID, new runner-level settings
+	Removed []string     // Task IDs
+}
+
+// Empty reports whether the diff changes nothing
+func (d Diff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Updated) == 0 && len(d.Removed) == 0
+}
+
+// Reloader keeps the tasks of a Runner in line with config files. It manages the tasks of the
+// config and those already in the task list with the same ID, ex. restored from a Store;
+// tasks added by other means are left alone.
+type Reloader struct {
+	Runner  *runner.Runner
+	Path    string
+	Options []LoadOption // Ex. WithProfile, used by every reload
+	// OnReload is called after every reload triggered by Watch, with the applied changes or
+	// the reason they weren't all applied
+	OnReload func(Diff, error)
+
+	mu    sync.Mutex
+	owned map[string]bool
+	files []string // Read by the last reload, includes among them
+}
+
+// Reload loads the config and applies what changed since the last reload: tasks that are new
+// are added, tasks that are gone are removed and tasks with new runner-level settings are
+// updated, keeping their history. Unchanged tasks aren't touched. An invalid config is not
+// applied at all.
+func (l *Reloader) Reload(ctx context.Context) (Diff, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	defs, files, err := load(l.Path, l.Runner, l.Options)
+	if files != nil {
+		l.files = files
+	}
+	if err != nil {
+		return Diff{}, err
+	}
+	want := make(map[string]bool, len(defs))
+	d := l.diff(defs, want)
+	var errs []error
+	for _, id := range d.Removed {
+		if err := l.Runner.Remove(ctx, id); err != nil && !errors.Is(err, runner.ErrUnknownTask) { // Removed meanwhile
+			errs = append(errs, err)
+		}
+	}
+	for _, def := range d.Updated {
+		if _, err := l.Runner.UpdateSpec(ctx, def.ID, def.Spec); err != nil {
+			errs = append(errs, def.errorf(err))
+		}
+	}
+	for _, def := range d.Added {
+		if err := l.Runner.AddSpec(ctx, def.Spec); err != nil {
+			errs = append(errs, def.errorf(err))
+			delete(want, def.ID)
+		}
+	}
+	l.owned = want
+	return d, errors.Join(errs...)
+}
+
+// diff compares the definitions with the task list, filling want with their task IDs
+func (l *Reloader) diff(defs []Definition, want map[string]bool) (d Diff) {
+	for _, def := range defs {
+		def.ID = l.Runner.Hash(def.Task())
+		want[def.ID] = true
+		have, ok := l.Runner.Spec(def.ID)
+		switch {
+		case !ok:
+			d.Added = append(d.Added, def)
+		case l.changed(have, def.Spec):
+			d.Updated = append(d.Updated, def)
+		}
+	}
+	for id := range l.owned {
+		if !want[id] {
+			d.Removed = append(d.Removed, id)
+		}
+	}
+	sort.Strings(d.Removed)
+	return d
+}
+
+// changed reports whether a definition differs from the one a task was added with
+func (l *Reloader) changed(have, want runner.Spec) bool {
+	if have.Label != want.Label || have.CleanTask.Task != want.CleanTask.Task || have.Once != want.Once ||
+		l.Runner.ParseDuration(have.Interval) != l.Runner.ParseDuration(want.Interval) {
+		return true
+	}
+	want.CleanTask = have.CleanTask // The rest of the task only holds runtime state
+	a, err := json.Marshal(have)
+	if err != nil {
+		return true
+	}
+	b, err := json.Marshal(want)
+	return err != nil || !bytes.Equal(a, b)
+}
+
+// Watch reloads the config whenever it or a file it includes changes, until ctx is done.
+// Call Reload first to apply the config as it is.
+//
+// Configs may live in a ConfigMap or Secret mounted in a Kubernetes pod: the kubelet updates
+// those by swapping a symlink to a new copy of the files, which also triggers a reload, so
+// task changes are applied without restarting the pod. Mounts using subPath aren't updated.
+func (l *Reloader) Watch(ctx context.Context) error {
+	info, err := os.Stat(l.Path)
+	if err != nil {
+		return err
+	}
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+	watching := make(map[string]bool)
+	watch := func() error {
+		l.mu.Lock()
+		names := append([]string{l.Path}, l.files...)
+		l.mu.Unlock()
+		for _, name := range names {
+			dir := name
+			if name != l.Path || !info.IsDir() {
+				dir = filepath.Dir(name) // Editors replace files, which drops a watch on the file itself
+			}
+			if !watching[dir] {
+				if err := w.Add(dir); err != nil {
+					return err
+				}
+				watching[dir] = true
+			}
+		}
+		return nil
+	}
+	if err := watch(); err != nil {
+		return err
+	}
+	var settled <-chan time.Time
+	for {
+		select {
+		case e, ok := <-w.Events:
+			if !ok {
+				return nil
+			}
+			if l.watched(e.Name, info.IsDir()) {
+				settled = time.After(ReloadDelay)
+			}
+		case err, ok := <-w.Errors:
+			if !ok {
+				return nil
+			}
+			l.report(Diff{}, err)
+		case <-settled:
+			settled = nil
+			l.report(l.Reload(ctx))
+			if err := watch(); err != nil {
+				l.report(Diff{}, err)
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// watched reports whether a changed file is part of the config
+func (l *Reloader) watched(name string, dir bool) bool {
+	if dir && filepath.Dir(filepath.Clean(name)) == filepath.Clean(l.Path) && isConfig(name) {
+		return true // A file added to the config directory
+	}
+	if filepath.Base(name) == mountData {
+		return true // Only directories holding config files are watched
+	}
+	abs, err := filepath.Abs(name)
+	if err != nil {
+		return false
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return slices.Contains(l.files, abs) || filepath.Clean(name) == filepath.Clean(l.Path)
+}
+
+func (l *Reloader) report(d Diff, err error) {
+	if l.OnReload != nil {
+		l.OnReload(d, err)
+	}
+}
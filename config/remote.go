@@ -0,0 +1,157 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SignatureHeader carries the base64 Ed25519 signature of a remote config, see Remote
+const SignatureHeader = "X-Config-Signature"
+
+var (
+	// ErrInsecureURL is returned when fetching a remote config over plain HTTP
+	ErrInsecureURL = errors.New("config: remote config URL isn't HTTPS")
+	// ErrBadSignature is returned when a remote config isn't signed by the expected key
+	ErrBadSignature = errors.New("config: bad remote config signature")
+)
+
+// Remote keeps a local copy of a config served over HTTPS, so edge runners can pull their
+// task sets from a central controller: a Reloader watching Path applies every new version,
+// and the last one fetched is still there when the controller can't be reached at startup.
+// Requests are conditional, with the ETag and Last-Modified of the previous reply, so
+// unchanged configs aren't downloaded again.
+//
+// A remote config is a single file, the extension of Path tells its format. Includes are
+// read relative to Path.
+type Remote struct {
+	URL       string
+	Path      string
+	PublicKey ed25519.PublicKey // When set, configs must be signed with its key, see SignatureHeader
+	Header    http.Header       // Sent with every request, ex. Authorization
+	AllowHTTP bool              // Allows plain HTTP URLs, for development
+	Client    *http.Client
+
+	mu       sync.Mutex
+	etag     string
+	modified string
+}
+
+// Fetch downloads the config when it changed since the last fetch and writes it to Path,
+// reporting whether it did
+func (m *Remote) Fetch(ctx context.Context) (bool, error) {
+	u, err := url.Parse(m.URL)
+	if err != nil {
+		return false, err
+	}
+	if u.Scheme != "https" && !(m.AllowHTTP && u.Scheme == "http") {
+		return false, fmt.Errorf("%w: %s", ErrInsecureURL, m.URL)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, m.URL, nil)
+	if err != nil {
+		return false, err
+	}
+	for name, values := range m.Header {
+		req.Header[name] = values
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.etag != "" {
+		req.Header.Set("If-None-Match", m.etag)
+	}
+	if m.modified != "" {
+		req.Header.Set("If-Modified-Since", m.modified)
+	}
+	client := m.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer res.Body.Close()
+	switch {
+	case res.StatusCode == http.StatusNotModified:
+		return false, nil
+	case res.StatusCode >= 300:
+		return false, fmt.Errorf("%s replied %s", m.URL, res.Status)
+	}
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return false, err
+	}
+	if m.PublicKey != nil {
+		sig, err := base64.StdEncoding.DecodeString(res.Header.Get(SignatureHeader))
+		if err != nil || !ed25519.Verify(m.PublicKey, data, sig) {
+			return false, fmt.Errorf("%w: %s", ErrBadSignature, m.URL)
+		}
+	}
+	current, err := os.ReadFile(m.Path)
+	changed := err != nil || !bytes.Equal(current, data) // The same config after a restart
+	if changed {
+		if err := m.write(data); err != nil {
+			return false, err
+		}
+	}
+	m.etag, m.modified = res.Header.Get("ETag"), res.Header.Get("Last-Modified")
+	return changed, nil
+}
+
+// write replaces the file at Path, so the Reloader never reads a partial config
+func (m *Remote) write(data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(m.Path), "."+filepath.Base(m.Path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), m.Path)
+}
+
+// Poll fetches the config every interval until ctx is done, onFetch gets the outcome of
+// every fetch when it isn't nil
+func (m *Remote) Poll(ctx context.Context, every time.Duration, onFetch func(bool, error)) error {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			changed, err := m.Fetch(ctx)
+			if onFetch != nil && ctx.Err() == nil {
+				onFetch(changed, err)
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// ParsePublicKey decodes a base64 Ed25519 public key, ex. from a file
+func ParsePublicKey(s string) (ed25519.PublicKey, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, err
+	}
+	if len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("config: public key is %d bytes, not %d", len(key), ed25519.PublicKeySize)
+	}
+	return ed25519.PublicKey(key), nil
+}
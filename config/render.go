@@ -0,0 +1,105 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"pkg.goda.sh/runner/v2"
+)
+
+// TemplateExt marks the config files rendered as Go templates before they're decoded, ex.
+// tasks.yaml.tmpl. Templates see a TemplateData, so one file can define per-node variants:
+//
+//	tasks:
+//	{{- range split .Vars.regions "," }}{{ if ne . $.Identity.Location }}
+//	  - label: Probe {{ . }} from {{ $.Identity.Location }}
+//	    task: http
+//	    params: {url: "https://{{ . }}.example.com/health"}
+//	{{- end }}{{ end }}
+//
+// Besides the builtins of text/template, they may call env, default, split, join, lower,
+// upper and quote. Missing vars are errors, optional ones are read with index, ex.
+// {{ index .Vars "timeout" | default "10s" }}.
+const TemplateExt = ".tmpl"
+
+// TemplateData is what config templates are rendered with
+type TemplateData struct {
+	Identity runner.Identity // Of the runner loading the config, see WithIdentity
+	Vars     map[string]interface{}
+}
+
+// WithIdentity sets the identity templates see, Load uses that of its runner by default
+func WithIdentity(id runner.Identity) LoadOption {
+	return func(l *loader) {
+		l.identity = &id
+	}
+}
+
+// WithVars adds vars templates see as .Vars
+func WithVars(vars map[string]interface{}) LoadOption {
+	return func(l *loader) {
+		if l.vars == nil {
+			l.vars = make(map[string]interface{}, len(vars))
+		}
+		for name, v := range vars {
+			l.vars[name] = v
+		}
+	}
+}
+
+var templateFuncs = template.FuncMap{
+	"env": os.Getenv,
+	"default": func(def, v interface{}) interface{} {
+		if v == nil || v == "" {
+			return def
+		}
+		return v
+	},
+	"split": func(s, sep string) []string {
+		if s == "" {
+			return nil
+		}
+		return strings.Split(s, sep)
+	},
+	"join":  func(list []string, sep string) string { return strings.Join(list, sep) },
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+	"quote": strconv.Quote,
+}
+
+// render executes a config file that is a template, other files are returned as they are
+func (l *loader) render(name string, data []byte) ([]byte, error) {
+	if !strings.EqualFold(filepath.Ext(name), TemplateExt) {
+		return data, nil
+	}
+	t, err := template.New(filepath.Base(name)).Funcs(templateFuncs).Option("missingkey=error").Parse(string(data))
+	if err != nil {
+		return nil, err
+	}
+	view := TemplateData{Vars: l.vars}
+	if l.identity != nil {
+		view.Identity = *l.identity
+	}
+	if view.Vars == nil {
+		view.Vars = map[string]interface{}{}
+	}
+	var out bytes.Buffer
+	if err := t.Execute(&out, view); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// ext gets the extension telling the format of a config file, that of the file a template
+// renders
+func ext(name string) string {
+	e := strings.ToLower(filepath.Ext(name))
+	if e == TemplateExt {
+		e = strings.ToLower(filepath.Ext(strings.TrimSuffix(name, filepath.Ext(name))))
+	}
+	return e
+}
@@ -0,0 +1,318 @@
+package config
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+
+	"pkg.goda.sh/runner/v2"
+)
+
+// SchemaDraft is the JSON Schema dialect of generated schemas
+const SchemaDraft = "https://json-schema.org/draft/2020-12/schema"
+
+// Schema is the part of JSON Schema needed to describe task configs
+type Schema struct {
+	Schema               string             `json:"$schema,omitempty"`
+	Title                string             `json:"title,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Const                string             `json:"const,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"` // Properties not listed
+	Items                *Schema            `json:"items,omitempty"`
+	AllOf                []*Schema          `json:"allOf,omitempty"`
+	If                   *Schema            `json:"if,omitempty"`
+	Then                 *Schema            `json:"then,omitempty"`
+	Not                  *Schema            `json:"not,omitempty"`
+}
+
+// none is the schema nothing matches
+var none = &Schema{Not: &Schema{}}
+
+// SchemaError is a value of a config file that doesn't match its schema
+type SchemaError struct {
+	File    string
+	Path    string // JSON Pointer to the value, ex. /tasks/0/params/url
+	Message string
+}
+
+func (e *SchemaError) Error() string {
+	if e.Path == "" {
+		return fmt.Sprintf("%s: %s", e.File, e.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s", e.File, e.Path, e.Message)
+}
+
+// SchemaFor describes the config files r accepts: the task types it can run and the params
+// of those with a ParamSchema. Marshal it to JSON for editors and CI.
+func SchemaFor(r *runner.Runner) *Schema {
+	zero := 0.0
+	str := &Schema{Type: "string"}
+	strs := &Schema{Type: "array", Items: str}
+	task := &Schema{
+		Type: "object",
+		Properties: map[string]*Schema{
+			"label":           str,
+			"task":            {Type: "string", Enum: r.TaskTypes()},
+			"interval":        str,
+			"once":            {Type: "boolean"},
+			"tags":            strs,
+			"group":           str,
+			"params":          {Type: "object"},
+			"quorum":          {Type: "integer", Minimum: &zero},
+			"idempotency_key": str,
+			"broadcast":       {Type: "boolean"},
+			"template":        str,
+			"template_params": {Type: "object"},
+			"remove":          {Type: "boolean"},
+			"constraints": {
+				Type: "object",
+				Properties: map[string]*Schema{
+					"locations":         strs,
+					"exclude_locations": strs,
+					"tags":              strs,
+					"exclude_tags":      strs,
+				},
+				AdditionalProperties: none,
+			},
+		},
+		Required:             []string{"label"}, // Not task, which overlays may leave out
+		AdditionalProperties: none,
+	}
+	for _, typ := range r.TaskTypes() {
+		params, ok := r.ParamSchema(typ)
+		if !ok {
+			continue
+		}
+		task.AllOf = append(task.AllOf, &Schema{
+			If: &Schema{
+				Properties: map[string]*Schema{"task": {Const: typ}},
+				Required:   []string{"task"},
+			},
+			Then: &Schema{
+				Properties: map[string]*Schema{"params": paramsSchema(params)},
+				Required:   requiredParams(params),
+			},
+		})
+	}
+	sink := &Schema{
+		Type: "object",
+		Properties: map[string]*Schema{
+			"name":    str,
+			"type":    {Type: "string", Enum: []string{SinkJSONL, SinkWebhook, SinkRedisStream}},
+			"path":    str,
+			"url":     str,
+			"headers": {Type: "object"},
+			"stream":  str,
+			"max_len": {Type: "integer", Minimum: &zero},
+			"tasks":   strs,
+			"tags":    strs,
+			"remove":  {Type: "boolean"},
+			"retry": {
+				Type: "object",
+				Properties: map[string]*Schema{
+					"attempts":    {Type: "integer", Minimum: &zero},
+					"backoff":     str,
+					"max_backoff": str,
+				},
+				AdditionalProperties: none,
+			},
+		},
+		Required:             []string{"name"},
+		AdditionalProperties: none,
+	}
+	concurrency := &Schema{Type: "object", AdditionalProperties: &Schema{Type: "integer", Minimum: &zero}}
+	defaults := *task
+	defaults.Required = nil
+	byType := &Schema{Type: "object", AdditionalProperties: &defaults}
+	return &Schema{
+		Schema: SchemaDraft,
+		Title:  "Task definitions",
+		Type:   "object",
+		Properties: map[string]*Schema{
+			"tasks":       {Type: "array", Items: task},
+			"include":     {Type: "array", Items: str},
+			"sinks":       {Type: "array", Items: sink},
+			"concurrency": concurrency,
+			"defaults":    byType,
+			"profiles": {
+				Type: "object",
+				AdditionalProperties: &Schema{
+					Type: "object",
+					Properties: map[string]*Schema{
+						"tasks":       {Type: "array", Items: task},
+						"sinks":       {Type: "array", Items: sink},
+						"concurrency": concurrency,
+						"defaults":    byType,
+					},
+					AdditionalProperties: none,
+				},
+			},
+		},
+		AdditionalProperties: none,
+	}
+}
+
+// paramsSchema describes the params a ParamSchema accepts, other params are left alone
+func paramsSchema(params runner.ParamSchema) *Schema {
+	s := &Schema{Type: "object", Properties: make(map[string]*Schema, len(params))}
+	for name, rule := range params {
+		s.Properties[name] = &Schema{Type: jsonType(rule.Kind)}
+		if rule.Required {
+			s.Required = append(s.Required, name)
+		}
+	}
+	sort.Strings(s.Required)
+	return s
+}
+
+// requiredParams lists params when a task type has required params, they can't be left out
+func requiredParams(params runner.ParamSchema) []string {
+	for _, rule := range params {
+		if rule.Required {
+			return []string{"params"}
+		}
+	}
+	return nil
+}
+
+func jsonType(kind runner.ParamKind) string {
+	switch kind {
+	case runner.ParamBool:
+		return "boolean"
+	case runner.ParamAny:
+		return ""
+	}
+	return string(kind)
+}
+
+// Validate checks a config file and its includes against the schema of r, returning a
+// SchemaError for every value that doesn't match
+func Validate(r *runner.Runner, name string, data []byte, opts ...LoadOption) []error {
+	d, err := newLoader(opts).parse(name, data)
+	_, errs := definitions(d.entries(), r)
+	if err != nil {
+		return append([]error{err}, errs...)
+	}
+	return errs
+}
+
+// check gets the ways v doesn't match the schema, path is the JSON Pointer of v
+func (s *Schema) check(path string, v interface{}) (errs []*SchemaError) {
+	fail := func(format string, args ...interface{}) []*SchemaError {
+		return append(errs, &SchemaError{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+	if s.Type != "" && !isType(s.Type, v) {
+		return fail("is %s, not %s", typeOf(v), article(s.Type))
+	}
+	if s.Const != "" && v != s.Const {
+		return fail("is not %q", s.Const)
+	}
+	if len(s.Enum) > 0 && !contains(s.Enum, v) {
+		return fail("is %v, not one of %s", v, strings.Join(s.Enum, ", "))
+	}
+	if n, ok := number(v); ok && s.Minimum != nil && n < *s.Minimum {
+		return fail("is less than %v", *s.Minimum)
+	}
+	if list, ok := v.([]interface{}); ok && s.Items != nil {
+		for i, item := range list {
+			errs = append(errs, s.Items.check(fmt.Sprintf("%s/%d", path, i), item)...)
+		}
+	}
+	if m, ok := v.(map[string]interface{}); ok {
+		for _, name := range s.Required {
+			if _, ok := m[name]; !ok {
+				errs = append(errs, &SchemaError{Path: path, Message: fmt.Sprintf("is missing %s", name)})
+			}
+		}
+		names := make([]string, 0, len(m))
+		for name := range m {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			child := path + "/" + strings.NewReplacer("~", "~0", "/", "~1").Replace(name)
+			if p, ok := s.Properties[name]; ok {
+				errs = append(errs, p.check(child, m[name])...)
+			} else if s.AdditionalProperties != nil {
+				errs = append(errs, s.AdditionalProperties.check(child, m[name])...)
+			}
+		}
+	}
+	for _, sub := range s.AllOf {
+		errs = append(errs, sub.check(path, v)...)
+	}
+	if s.Not != nil && len(s.Not.check(path, v)) == 0 {
+		errs = append(errs, &SchemaError{Path: path, Message: "is not allowed"})
+	}
+	if s.If != nil && len(s.If.check(path, v)) == 0 && s.Then != nil {
+		errs = append(errs, s.Then.check(path, v)...)
+	}
+	return errs
+}
+
+func isType(typ string, v interface{}) bool {
+	switch typ {
+	case "integer":
+		n, ok := number(v)
+		return ok && n == math.Trunc(n)
+	case "number":
+		_, ok := number(v)
+		return ok
+	}
+	return typeOf(v) == typ
+}
+
+// typeOf gets the JSON type of a decoded value
+func typeOf(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	}
+	if _, ok := number(v); ok {
+		return "number"
+	}
+	return reflect.TypeOf(v).String()
+}
+
+func number(v interface{}) (float64, bool) {
+	switch n := reflect.ValueOf(v); n.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(n.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(n.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return n.Float(), true
+	}
+	return 0, false
+}
+
+func article(typ string) string {
+	if strings.IndexByte("aeiou", typ[0]) >= 0 {
+		return "an " + typ
+	}
+	return "a " + typ
+}
+
+func contains(list []string, v interface{}) bool {
+	s, ok := v.(string)
+	for _, item := range list {
+		if ok && item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,308 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"pkg.goda.sh/runner/v2"
+	"pkg.goda.sh/tasks"
+)
+
+// Sink types
+const (
+	SinkJSONL       = "jsonl"        // Appends a line to the file at Path
+	SinkWebhook     = "webhook"      // POSTs to URL
+	SinkRedisStream = "redis_stream" // Adds an entry to Stream on the Redis server at URL, see WithSinkType
+)
+
+// SinkFunc checks a sink and creates the function delivering its results
+type SinkFunc func(SinkConfig) (func(Output) error, error)
+
+// WithSinkType adds a sink type to those of LoadOptions, so backends the config package
+// doesn't depend on can receive results. The redis_stream type needs
+// WithSinkType(SinkRedisStream, redisbackend.StreamSink).
+func WithSinkType(typ string, fn SinkFunc) LoadOption {
+	return func(l *loader) {
+		if l.sinkTypes == nil {
+			l.sinkTypes = make(map[string]SinkFunc)
+		}
+		l.sinkTypes[typ] = fn
+	}
+}
+
+// SinkConfig declares a result sink in a config file:
+//
+//	sinks:
+//	  - name: alerts
+//	    type: webhook
+//	    url: https://hooks.example.com/runner
+//	    tags: [prod]
+//	    retry: {attempts: 3, backoff: 1s}
+//
+// Every sink receives a JSON object per result, see Output. Tasks and Tags route results:
+// a sink only gets those of tasks matching both when set.
+type SinkConfig struct {
+	Name    string            `json:"name"`
+	Type    string            `json:"type"`
+	Path    string            `json:"path,omitempty"`
+	URL     string            `json:"url,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"` // Sent with webhook requests
+	Stream  string            `json:"stream,omitempty"`
+	MaxLen  int64             `json:"max_len,omitempty"` // Approximate length the stream is trimmed to
+	Tasks   []string          `json:"tasks,omitempty"`   // Only results of these task types
+	Tags    []string          `json:"tags,omitempty"`    // Only results of tasks carrying one of these tags
+	Retry   *RetryConfig      `json:"retry,omitempty"`   // runner.DefaultRetry when unset
+}
+
+// RetryConfig is a runner.Retry with durations as strings, ex. 500ms
+type RetryConfig struct {
+	Attempts   int    `json:"attempts"`
+	Backoff    string `json:"backoff,omitempty"`
+	MaxBackoff string `json:"max_backoff,omitempty"`
+}
+
+// Output is what config sinks receive for every result
+type Output struct {
+	Date     int64       `json:"date"`
+	ID       string      `json:"id"`
+	Label    string      `json:"label"`
+	Task     string      `json:"task"`
+	Location string      `json:"location,omitempty"`
+	Update   interface{} `json:"update,omitempty"`
+	Warn     bool        `json:"warn,omitempty"`
+	Error    string      `json:"error,omitempty"`
+}
+
+// LoadOptions gets the settings of the config at path and the files it includes as options
+// for runner.NewRunner: its sinks and the concurrency limits of groups, see WithGroupLimit.
+// They're only read at startup, reloads leave them alone.
+func LoadOptions(path string, opts ...LoadOption) ([]runner.Option, error) {
+	l := newLoader(opts)
+	d, err := l.load(path)
+	if err != nil {
+		return nil, err
+	}
+	configs, err := sinks(d.sinks)
+	if err != nil {
+		return nil, err
+	}
+	var options []runner.Option
+	for _, c := range configs {
+		opt, err := c.option(l.sinkTypes)
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, opt)
+	}
+	limits, err := concurrency(d.concurrency)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for _, group := range slices.Sorted(maps.Keys(limits)) {
+		options = append(options, runner.WithGroupLimit(group, limits[group]))
+	}
+	return options, nil
+}
+
+// sinks decodes sink entries
+func sinks(entries []entry) ([]SinkConfig, error) {
+	var configs []SinkConfig
+	var errs []error
+	for _, e := range entries {
+		var c SinkConfig
+		if err := decode(e.raw, &c); err != nil {
+			file := e.file
+			if e.profile != "" {
+				file += ": profile " + e.profile
+			}
+			errs = append(errs, fmt.Errorf("%s: sink %d (%q): %w", file, e.index, e.key("name"), err))
+			continue
+		}
+		configs = append(configs, c)
+	}
+	return configs, errors.Join(errs...)
+}
+
+// concurrency decodes the concurrency limits of groups, 0 lifts the limit of a group
+func concurrency(raw map[string]interface{}) (map[string]int, error) {
+	limits := make(map[string]int, len(raw))
+	for group, v := range raw {
+		n, ok := number(v)
+		if !ok || n < 0 || n != math.Trunc(n) {
+			return nil, fmt.Errorf("concurrency of group %q is %v, not a limit", group, v)
+		}
+		limits[group] = int(n)
+	}
+	return limits, nil
+}
+
+// Option checks the sink and gets the runner.Option adding it. Only the built-in types are
+// known, those added with WithSinkType need LoadOptions.
+func (c SinkConfig) Option() (runner.Option, error) {
+	return c.option(nil)
+}
+
+func (c SinkConfig) option(types map[string]SinkFunc) (runner.Option, error) {
+	if c.Name == "" {
+		return nil, errors.New("config: sink without a name")
+	}
+	retry, err := c.Retry.retry()
+	if err != nil {
+		return nil, fmt.Errorf("config: sink %q: %w", c.Name, err)
+	}
+	var deliver func(Output) error
+	switch c.Type {
+	case SinkJSONL:
+		deliver, err = c.jsonl()
+	case SinkWebhook:
+		deliver, err = c.webhook()
+	default:
+		if fn, ok := types[c.Type]; ok {
+			deliver, err = fn(c)
+		} else {
+			err = fmt.Errorf("unknown type %q", c.Type)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("config: sink %q: %w", c.Name, err)
+	}
+	return func(r *runner.Runner) {
+		runner.WithSink(c.Name, func(t tasks.Task, result tasks.Result) error {
+			if !c.routes(r, t) {
+				return nil
+			}
+			return deliver(output(t, result))
+		}, retry)(r)
+	}, nil
+}
+
+// routes reports whether the result of a task goes to the sink
+func (c SinkConfig) routes(r *runner.Runner, t tasks.Task) bool {
+	return c.matches(t.Task, r.Tags(t.ID))
+}
+
+// matches reports whether the sink receives the results of tasks with this type and tags
+func (c SinkConfig) matches(typ string, tags []string) bool {
+	if len(c.Tasks) > 0 && !containsFold(c.Tasks, typ) {
+		return false
+	}
+	if len(c.Tags) == 0 {
+		return true
+	}
+	for _, tag := range tags {
+		if containsFold(c.Tags, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *RetryConfig) retry() (runner.Retry, error) {
+	if c == nil {
+		return runner.Retry{}, nil // WithSink falls back to runner.DefaultRetry
+	}
+	retry := runner.Retry{Attempts: c.Attempts}
+	for _, d := range []struct {
+		str string
+		out *time.Duration
+	}{{c.Backoff, &retry.Backoff}, {c.MaxBackoff, &retry.MaxBackoff}} {
+		if d.str == "" {
+			continue
+		}
+		v, err := time.ParseDuration(d.str)
+		if err != nil {
+			return retry, err
+		}
+		*d.out = v
+	}
+	return retry, nil
+}
+
+func (c SinkConfig) jsonl() (func(Output) error, error) {
+	if c.Path == "" {
+		return nil, errors.New("missing path")
+	}
+	var mu sync.Mutex
+	return func(o Output) error {
+		line, err := json.Marshal(o)
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		f, err := os.OpenFile(c.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(append(line, '\n')); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	}, nil
+}
+
+func (c SinkConfig) webhook() (func(Output) error, error) {
+	if c.URL == "" {
+		return nil, errors.New("missing url")
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	return func(o Output) error {
+		body, err := json.Marshal(o)
+		if err != nil {
+			return err
+		}
+		req, err := http.NewRequest(http.MethodPost, c.URL, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		for name, value := range c.Headers {
+			req.Header.Set(name, value)
+		}
+		res, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		res.Body.Close()
+		if res.StatusCode >= 300 {
+			return fmt.Errorf("webhook replied %s", res.Status)
+		}
+		return nil
+	}, nil
+}
+
+func output(t tasks.Task, result tasks.Result) Output {
+	o := Output{
+		Date:     time.Now().UnixNano() / int64(time.Millisecond),
+		ID:       t.ID,
+		Label:    t.Label,
+		Task:     t.Task,
+		Location: result.Location,
+		Update:   result.Update,
+		Warn:     result.Warn,
+	}
+	if result.Error != nil {
+		o.Error = result.Error.Error()
+	}
+	return o
+}
+
+func containsFold(list []string, v string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, v) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,44 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+// parseTOML decodes a TOML document, see https://toml.io/en/v1.0.0, into maps keyed by
+// string. Dates and times are kept as strings, in RFC 3339 with a T between the date and
+// the time.
+func parseTOML(data []byte) (map[string]interface{}, error) {
+	var doc map[string]interface{}
+	if err := toml.Unmarshal(data, &doc); err != nil {
+		var derr *toml.DecodeError
+		if errors.As(err, &derr) {
+			row, col := derr.Position()
+			return nil, fmt.Errorf("line %d, column %d: %v", row, col, err)
+		}
+		return nil, err
+	}
+	return plainTOML(doc).(map[string]interface{}), nil
+}
+
+// plainTOML converts the dates and times decoded by toml to strings
+func plainTOML(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, item := range v {
+			v[k] = plainTOML(item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = plainTOML(item)
+		}
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case toml.LocalDate, toml.LocalTime, toml.LocalDateTime:
+		return fmt.Sprint(v)
+	}
+	return v
+}
@@ -0,0 +1,103 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseTOML(t *testing.T) {
+	doc, err := parseTOML([]byte(`
+title = "checks" # A comment
+port = 0x1F90
+ratio = 1e3
+big = 1_000_000
+date = 2024-05-27
+at = 2024-05-27 07:32:00Z
+local = 07:32:00
+notes = """
+first \
+  second"""
+path = 'C:\tasks'
+a.b = 1
+point = {x = 1, y = [1.5, "two"]}
+
+[server.tls]
+enabled = true
+
+[[tasks]]
+label = "gateway"
+task = "http"
+params = {url = "https://gateway.internal"}
+
+[[tasks]]
+label = "db"
+task = "port"
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"title": "checks",
+		"port":  int64(8080),
+		"ratio": 1000.0,
+		"big":   int64(1000000),
+		"date":  "2024-05-27",
+		"at":    "2024-05-27T07:32:00Z",
+		"local": "07:32:00",
+		"notes": "first second",
+		"path":  `C:\tasks`,
+		"a":     map[string]interface{}{"b": int64(1)},
+		"point": map[string]interface{}{"x": int64(1), "y": []interface{}{1.5, "two"}},
+		"server": map[string]interface{}{
+			"tls": map[string]interface{}{"enabled": true},
+		},
+		"tasks": []interface{}{
+			map[string]interface{}{"label": "gateway", "task": "http", "params": map[string]interface{}{"url": "https://gateway.internal"}},
+			map[string]interface{}{"label": "db", "task": "port"},
+		},
+	}
+	if !reflect.DeepEqual(doc, want) {
+		t.Errorf("got %#v, want %#v", doc, want)
+	}
+}
+
+func TestParseTOMLRejectsInvalidDocuments(t *testing.T) {
+	for name, src := range map[string]string{
+		"duplicate key":          "a = 1\na = 2",
+		"duplicate table":        "[a]\nb = 1\n[a]\nc = 2",
+		"table after dotted key": "a.b = 1\n[a]\nc = 2",
+		"inline table extended":  "i = {x = 1}\n[i]\ny = 2",
+		"inline table dotted":    "i = {x = 1}\ni.y = 2",
+		"leading zero":           "n = 01",
+		"trailing dot":           "f = 1.",
+		"leading dot":            "f = .5",
+		"int out of range":       "n = 9223372036854775808",
+		"unterminated string":    `s = "open`,
+		"missing value":          "a =",
+		"bare word":              "a = yes",
+	} {
+		if doc, err := parseTOML([]byte(src)); err == nil {
+			t.Errorf("%s: got %v, want an error", name, doc)
+		}
+	}
+}
+
+func TestParseTOMLConfig(t *testing.T) {
+	defs, err := Parse("checks.toml", []byte(`
+[[tasks]]
+label = "gateway"
+task = "http"
+interval = "PT1M"
+params = {url = "https://gateway.internal", retries = 3}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(defs) != 1 || defs[0].Label != "gateway" || defs[0].Params["url"] != "https://gateway.internal" {
+		t.Fatalf("got %+v, want the gateway task", defs)
+	}
+	if _, err := Parse("checks.toml", []byte("[[tasks]]\nlabel = \"gateway\"\n[[tasks]\n")); err == nil || !strings.Contains(err.Error(), "checks.toml") {
+		t.Errorf("got %v, want an error naming the file", err)
+	}
+}
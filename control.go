@@ -0,0 +1,158 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+
+	"pkg.goda.sh/tasks"
+)
+
+var (
+	// ErrUnknownTask is returned when a task ID is not in the task list
+	ErrUnknownTask = errors.New("runner: unknown task")
+	// ErrNotTriggerable is returned by RunNow and RunNowWith for timerless tasks, which run on their own schedule
+	ErrNotTriggerable = errors.New("runner: task cannot be triggered")
+	// ErrInvalidTask is returned when a task definition cannot be added
+	ErrInvalidTask = errors.New("runner: invalid task")
+	// ErrDuplicateTask is returned when adding a task whose ID is already in the task list
+	ErrDuplicateTask = errors.New("runner: duplicate task")
+)
+
+// TaskErrors is returned by AddTasks with the error of every task that wasn't added
+type TaskErrors []error
+
+func (e TaskErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Is reports whether any of the errors matches target
+func (e TaskErrors) Is(target error) bool {
+	for _, err := range e {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// Remove cancels a task and removes it from the task list. Tasks that aren't in it return
+// ErrUnknownTask.
+func (r *Runner) Remove(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if !r.remove(id) {
+		return ErrUnknownTask
+	}
+	return nil
+}
+
+// remove removes a task, reporting whether it was in the task list
+func (r *Runner) remove(id string) bool {
+	id = r.resolve(id)
+	r.mu.Lock()
+	cancel, ok := r.cancels[id]
+	delete(r.cancels, id)
+	delete(r.triggers, id)
+	delete(r.keys, id)
+	delete(r.history, id)
+	delete(r.specs, id)
+	delete(r.schedules, id)
+	delete(r.backlog, id)
+	delete(r.failing, id)
+	delete(r.versions, id)
+	r.mu.Unlock()
+	if !ok {
+		return false
+	}
+	cancel()
+	r.unlist(id)
+	r.unmirror(id)
+	r.logMutation(WALRemove, id, nil)
+	r.unpersistTask(id)
+	return true
+}
+
+// Update replaces the task with the given ID by a new definition, keeping its runner-level
+// settings, and returns the new task ID. The prior definition is kept, see Rollback.
+func (r *Runner) Update(ctx context.Context, id string, t tasks.Task) (string, error) {
+	id = r.resolve(id)
+	spec := r.spec(id)
+	spec.CleanTask = tasks.CleanTask(t)
+	return r.replace(ctx, id, spec)
+}
+
+// UpdateSpec replaces the task with the given ID by a new definition along with its
+// runner-level settings, see Update
+func (r *Runner) UpdateSpec(ctx context.Context, id string, s Spec) (string, error) {
+	return r.replace(ctx, r.resolve(id), s)
+}
+
+// RunNow runs a task immediately, outside of its regular interval
+func (r *Runner) RunNow(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	t, ok := r.find(id)
+	if !ok {
+		return ErrUnknownTask
+	}
+	if r.Timerless(t.Task) {
+		return ErrNotTriggerable
+	}
+	r.mu.RLock()
+	trigger := r.triggers[t.ID]
+	r.mu.RUnlock()
+	select {
+	case trigger <- struct{}{}:
+	default:
+		r.logf(slog.LevelDebug, "Run of %s already pending\n", id)
+	}
+	return nil
+}
+
+// RunNowWith runs a task once immediately with params set over its own, ex. those of a
+// webhook call, and sends its result on the returned channel. The result is delivered like
+// those of scheduled runs but doesn't change the task. Params are checked against the schema
+// of the task type first, ErrInvalidTask is returned when they don't match.
+func (r *Runner) RunNowWith(ctx context.Context, id string, params map[string]interface{}) (<-chan tasks.Result, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s, ok := r.Spec(id)
+	if !ok {
+		return nil, ErrUnknownTask
+	}
+	if r.Timerless(s.CleanTask.Task) {
+		return nil, ErrNotTriggerable
+	}
+	merged := copyParams(s.Params)
+	if merged == nil {
+		merged = make(map[string]interface{}, len(params))
+	}
+	for k, v := range copyParams(params) {
+		merged[k] = v
+	}
+	if schema, ok := r.ParamSchema(s.CleanTask.Task); ok {
+		if err := errors.Join(schema.Check(merged)...); err != nil {
+			return nil, err
+		}
+	}
+	s.Params = merged
+	done := make(chan tasks.Result, 1)
+	go func() {
+		done <- r.runOnce(ctx, s)
+	}()
+	return done, nil
+}
+
+// find looks a task up by ID
+func (r *Runner) find(id string) (tasks.Task, bool) {
+	return r.TaskList.Get(r.resolve(id))
+}
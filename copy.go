@@ -0,0 +1,98 @@
+package runner
+
+import (
+	"reflect"
+	"slices"
+
+	"pkg.goda.sh/tasks"
+)
+
+// deepCopy copies maps, slices, arrays, interfaces and exported struct fields recursively.
+// Pointers, channels and funcs are shared.
+func deepCopy(v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+	return copyValue(reflect.ValueOf(v)).Interface()
+}
+
+func copyValue(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		out := reflect.MakeMapWithSize(v.Type(), v.Len())
+		for it := v.MapRange(); it.Next(); {
+			out.SetMapIndex(it.Key(), copyValue(it.Value()))
+		}
+		return out
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		out := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			out.Index(i).Set(copyValue(v.Index(i)))
+		}
+		return out
+	case reflect.Array:
+		out := reflect.New(v.Type()).Elem()
+		for i := 0; i < v.Len(); i++ {
+			out.Index(i).Set(copyValue(v.Index(i)))
+		}
+		return out
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		out := reflect.New(v.Type()).Elem()
+		out.Set(copyValue(v.Elem()))
+		return out
+	case reflect.Struct:
+		out := reflect.New(v.Type()).Elem()
+		out.Set(v)
+		for i := 0; i < v.NumField(); i++ {
+			if f := out.Field(i); f.CanSet() {
+				f.Set(copyValue(v.Field(i)))
+			}
+		}
+		return out
+	}
+	return v
+}
+
+// copyTask deep copies the result output of a task
+func copyTask(t tasks.Task) tasks.Task {
+	t.Last = deepCopy(t.Last)
+	t.Spark = slices.Clone(t.Spark)
+	return t
+}
+
+// copyResult deep copies the output of a result
+func copyResult(result tasks.Result) tasks.Result {
+	result.Update = deepCopy(result.Update)
+	result.Spark = slices.Clone(result.Spark)
+	return result
+}
+
+// copyParams deep copies task parameters
+func copyParams(params map[string]interface{}) map[string]interface{} {
+	out, _ := deepCopy(params).(map[string]interface{})
+	return out
+}
+
+// clone deep copies the maps and slices of a Spec
+func (s Spec) clone() Spec {
+	s.CleanTask = tasks.CleanTask(copyTask(tasks.Task(s.CleanTask)))
+	s.Params = copyParams(s.Params)
+	s.TemplateParams = copyParams(s.TemplateParams)
+	s.Tags = slices.Clone(s.Tags)
+	if s.Constraints != nil {
+		c := *s.Constraints
+		c.Locations, c.ExcludeLocations = slices.Clone(c.Locations), slices.Clone(c.ExcludeLocations)
+		c.Tags, c.ExcludeTags = slices.Clone(c.Tags), slices.Clone(c.ExcludeTags)
+		s.Constraints = &c
+	}
+	return s
+}
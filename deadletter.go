@@ -0,0 +1,188 @@
+package runner
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"pkg.goda.sh/tasks"
+)
+
+// DeadLetterPolicy decides when a failing task is moved to the dead-letter set.
+// A task is dead once either limit is reached, zero values disable a limit.
+type DeadLetterPolicy struct {
+	MaxFailures int           // Consecutive failed runs
+	FailingFor  time.Duration // Time since the first of the consecutive failures
+}
+
+// DeadLetter is a task or job taken out of rotation after failing permanently
+type DeadLetter struct {
+	ID        string `json:"id"`
+	Spec      Spec   `json:"spec"`
+	Failures  int    `json:"failures"`
+	Since     int64  `json:"since"` // First failure
+	Dead      int64  `json:"dead"`
+	LastError string `json:"last_error"`
+	Job       bool   `json:"job,omitempty"`    // A one-shot job from the queue rather than a scheduled task
+	Sealed    []byte `json:"sealed,omitempty"` // Spec encrypted with WithEncryption
+	// Sink and Result are set on results that couldn't be delivered to a Sink
+	Sink   string  `json:"sink,omitempty"`
+	Result *Record `json:"result,omitempty"`
+}
+
+// DeadLetterStore is implemented by Stores that can persist dead letters
+type DeadLetterStore interface {
+	SaveDeadLetter(ctx context.Context, d DeadLetter) error
+	DeleteDeadLetter(ctx context.Context, id string) error
+	LoadDeadLetters(ctx context.Context) ([]DeadLetter, error)
+}
+
+// failures tracks the consecutive failures of a task
+type failures struct {
+	count     int
+	since     int64
+	lastError string
+}
+
+// WithDeadLetter moves tasks that keep failing to the dead-letter set
+func WithDeadLetter(policy DeadLetterPolicy) Option {
+	return func(r *Runner) {
+		r.deadLetterPolicy = &policy
+	}
+}
+
+// track counts consecutive failures and dead-letters the task once the policy is exceeded
+func (r *Runner) track(t tasks.Task, result tasks.Result) {
+	policy := r.deadLetterPolicy
+	if policy == nil {
+		return
+	}
+	r.mu.Lock()
+	if _, scheduled := r.cancels[t.ID]; !scheduled || result.Error == nil { // Queued jobs have their own attempts
+		delete(r.failing, t.ID)
+		r.mu.Unlock()
+		return
+	}
+	now := time.Now()
+	f, ok := r.failing[t.ID]
+	if !ok {
+		f = &failures{since: now.UnixNano() / int64(time.Millisecond)}
+		r.failing[t.ID] = f
+	}
+	f.count++
+	f.lastError = result.Error.Error()
+	dead := (policy.MaxFailures > 0 && f.count >= policy.MaxFailures) ||
+		(policy.FailingFor > 0 && now.Sub(time.Unix(0, f.since*int64(time.Millisecond))) >= policy.FailingFor)
+	spec := r.specs[t.ID]
+	r.mu.Unlock()
+	if !dead {
+		return
+	}
+	r.logf(slog.LevelWarn, "Moving %q (%s/%s) to the dead-letter set after %d failures\n", t.Label, t.Task, t.ID, f.count)
+	go r.remove(t.ID) // Removing waits on the task's own goroutine
+	r.deadLetter(DeadLetter{
+		ID:        t.ID,
+		Spec:      spec,
+		Failures:  f.count,
+		Since:     f.since,
+		LastError: f.lastError,
+	})
+}
+
+// deadLetter adds an entry to the dead-letter set and persists it
+func (r *Runner) deadLetter(d DeadLetter) {
+	d.Dead = time.Now().UnixNano() / int64(time.Millisecond)
+	r.mu.Lock()
+	r.dead[d.ID] = d
+	delete(r.failing, d.ID)
+	r.mu.Unlock()
+	if store, ok := r.store.(DeadLetterStore); ok {
+		if r.cipher != nil {
+			sealed, err := r.seal(d.Spec)
+			if err != nil {
+				r.logf(slog.LevelError, "Could not encrypt dead letter %s: %v\n", d.ID, err)
+				return
+			}
+			d.Spec, d.Sealed = Spec{}, sealed
+		}
+		if err := store.SaveDeadLetter(context.Background(), d); err != nil {
+			r.logf(slog.LevelError, "Could not store dead letter %s: %v\n", d.ID, err)
+		}
+	}
+}
+
+// restoreDeadLetters loads the persisted dead-letter set
+func (r *Runner) restoreDeadLetters() {
+	store, ok := r.store.(DeadLetterStore)
+	if !ok {
+		return
+	}
+	list, err := store.LoadDeadLetters(context.Background())
+	if err != nil {
+		r.logf(slog.LevelError, "Could not load dead letters: %v\n", err)
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, d := range list {
+		if d.Sealed != nil {
+			if d.Spec, err = r.unseal(d.Sealed); err != nil {
+				r.logf(slog.LevelError, "Could not decrypt dead letter %s: %v\n", d.ID, err)
+				continue
+			}
+			d.Sealed = nil
+		}
+		r.dead[d.ID] = d
+	}
+}
+
+// DeadLetters gets every entry of the dead-letter set
+func (r *Runner) DeadLetters() (out []DeadLetter) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, d := range r.dead {
+		out = append(out, d)
+	}
+	return out
+}
+
+// Requeue takes an entry out of the dead-letter set and runs it again: scheduled tasks are
+// added back to the Runner, jobs are put back on the queue and results are delivered again
+func (r *Runner) Requeue(ctx context.Context, id string) error {
+	r.mu.RLock()
+	d, ok := r.dead[id]
+	r.mu.RUnlock()
+	if !ok {
+		return ErrUnknownTask
+	}
+	if d.Result != nil {
+		if err := r.redeliver(d); err != nil {
+			return err
+		}
+	} else if d.Job {
+		d.Spec.IdempotencyKey = "" // The key is still reserved by the original submission
+		if _, err := r.Enqueue(ctx, d.Spec); err != nil {
+			return err
+		}
+	} else {
+		if err := r.AddSpec(r.ctx, d.Spec); err != nil {
+			return err
+		}
+	}
+	r.Purge(id)
+	return nil
+}
+
+// Purge deletes an entry from the dead-letter set
+func (r *Runner) Purge(id string) bool {
+	r.mu.Lock()
+	_, ok := r.dead[id]
+	delete(r.dead, id)
+	r.mu.Unlock()
+	if store, isStore := r.store.(DeadLetterStore); ok && isStore {
+		if err := store.DeleteDeadLetter(context.Background(), id); err != nil {
+			r.logf(slog.LevelError, "Could not delete dead letter %s: %v\n", id, err)
+		}
+	}
+	return ok
+}
@@ -0,0 +1,29 @@
+package runner
+
+import (
+	"log/slog"
+	"time"
+
+	"pkg.goda.sh/tasks"
+)
+
+// settle marks a one-shot task as done in the WAL and Store once it has a successful result.
+// One-shot tasks are persisted before they first run like every other task, so a crash
+// before they succeed means they run again when the Runner is restored.
+func (r *Runner) settle(t tasks.Task, result tasks.Result) {
+	if !t.Once || result.Error != nil || result.Cancelled {
+		return
+	}
+	r.mu.RLock()
+	_, ok := r.cancels[t.ID]
+	r.mu.RUnlock()
+	if !ok {
+		return // Queued jobs are acknowledged by the queue
+	}
+	if r.wal != nil { // Logged even while replaying, so a task that completed during restore stays done
+		if err := r.wal.Append(WALEntry{Op: WALRemove, ID: t.ID, Time: time.Now().UnixNano() / int64(time.Millisecond)}); err != nil {
+			r.logf(slog.LevelError, "Could not log completion of %s: %v\n", t.ID, err)
+		}
+	}
+	r.unpersistTask(t.ID)
+}
@@ -0,0 +1,188 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"sync"
+)
+
+var (
+	// ErrSealed is returned when reading encrypted state without a Cipher
+	ErrSealed = errors.New("runner: state is encrypted")
+	// ErrCiphertext is returned when encrypted state is malformed
+	ErrCiphertext = errors.New("runner: malformed ciphertext")
+)
+
+// sealedPrefix marks encrypted snapshots
+var sealedPrefix = []byte("runner:sealed:1:")
+
+// Cipher encrypts the state written to the WAL, the Store and snapshots
+type Cipher interface {
+	Seal(plaintext []byte) ([]byte, error)
+	Open(ciphertext []byte) ([]byte, error)
+}
+
+// WithEncryption encrypts task definitions in the WAL, the Store, the dead-letter set and
+// snapshots. State written before encryption was enabled can still be read.
+func WithEncryption(c Cipher) Option {
+	return func(r *Runner) {
+		r.cipher = c
+	}
+}
+
+// AESGCM is a Cipher using AES-GCM with a random nonce prepended to every ciphertext
+type AESGCM struct {
+	aead cipher.AEAD
+}
+
+// NewAESGCM creates an AESGCM Cipher from a 16, 24 or 32 byte key
+func NewAESGCM(key []byte) (*AESGCM, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &AESGCM{aead: aead}, nil
+}
+
+// Seal encrypts plaintext
+func (c *AESGCM) Seal(plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return c.aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// Open decrypts a ciphertext created by Seal
+func (c *AESGCM) Open(ciphertext []byte) ([]byte, error) {
+	size := c.aead.NonceSize()
+	if len(ciphertext) < size {
+		return nil, ErrCiphertext
+	}
+	return c.aead.Open(nil, ciphertext[:size], ciphertext[size:], nil)
+}
+
+// KMSCipher does envelope encryption: state is encrypted with a local data key, which is
+// wrapped by a key management service and stored next to every ciphertext
+type KMSCipher struct {
+	unwrap  func(ctx context.Context, wrapped []byte) ([]byte, error)
+	wrapped []byte
+	local   *AESGCM
+	keys    map[string]*AESGCM // Unwrapped data keys by wrapped key
+	mu      sync.Mutex
+}
+
+// NewKMSCipher generates a data key and wraps it with the KMS. unwrap is called once per
+// distinct data key found in the state being read.
+func NewKMSCipher(ctx context.Context, wrap, unwrap func(ctx context.Context, key []byte) ([]byte, error)) (*KMSCipher, error) {
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, err
+	}
+	wrapped, err := wrap(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	local, err := NewAESGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	return &KMSCipher{
+		unwrap:  unwrap,
+		wrapped: wrapped,
+		local:   local,
+		keys:    map[string]*AESGCM{string(wrapped): local},
+	}, nil
+}
+
+// Seal encrypts plaintext with the data key, prefixed by the wrapped key
+func (c *KMSCipher) Seal(plaintext []byte) ([]byte, error) {
+	sealed, err := c.local.Seal(plaintext)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, 2, 2+len(c.wrapped)+len(sealed))
+	binary.BigEndian.PutUint16(out, uint16(len(c.wrapped)))
+	return append(append(out, c.wrapped...), sealed...), nil
+}
+
+// Open unwraps the data key of a ciphertext if needed and decrypts it
+func (c *KMSCipher) Open(ciphertext []byte) ([]byte, error) {
+	if len(ciphertext) < 2 {
+		return nil, ErrCiphertext
+	}
+	size := int(binary.BigEndian.Uint16(ciphertext))
+	if len(ciphertext) < 2+size {
+		return nil, ErrCiphertext
+	}
+	wrapped := ciphertext[2 : 2+size]
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	local, ok := c.keys[string(wrapped)]
+	if !ok {
+		key, err := c.unwrap(context.Background(), wrapped)
+		if err != nil {
+			return nil, err
+		}
+		if local, err = NewAESGCM(key); err != nil {
+			return nil, err
+		}
+		c.keys[string(wrapped)] = local
+	}
+	return local.Open(ciphertext[2+size:])
+}
+
+// seal encrypts a Spec
+func (r *Runner) seal(spec Spec) ([]byte, error) {
+	raw, err := json.Marshal(spec)
+	if err != nil {
+		return nil, err
+	}
+	return r.cipher.Seal(raw)
+}
+
+// unseal decrypts a Spec created by seal
+func (r *Runner) unseal(sealed []byte) (spec Spec, err error) {
+	if r.cipher == nil {
+		return spec, ErrSealed
+	}
+	raw, err := r.cipher.Open(sealed)
+	if err != nil {
+		return spec, err
+	}
+	return spec, json.Unmarshal(raw, &spec)
+}
+
+// sealSnapshot encrypts a serialized snapshot
+func (r *Runner) sealSnapshot(data []byte) ([]byte, error) {
+	if r.cipher == nil {
+		return data, nil
+	}
+	sealed, err := r.cipher.Seal(data)
+	if err != nil {
+		return nil, err
+	}
+	return append(append([]byte(nil), sealedPrefix...), sealed...), nil
+}
+
+// openSnapshot decrypts a snapshot created by sealSnapshot, passing plain ones through
+func (r *Runner) openSnapshot(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, sealedPrefix) {
+		return data, nil
+	}
+	if r.cipher == nil {
+		return nil, ErrSealed
+	}
+	return r.cipher.Open(data[len(sealedPrefix):])
+}
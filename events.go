@@ -0,0 +1,41 @@
+package runner
+
+import (
+	"context"
+
+	"pkg.goda.sh/tasks"
+)
+
+// Event is a task result delivered to listeners
+type Event struct {
+	Task   tasks.CleanTask `json:"task"`
+	Result tasks.Result    `json:"-"`
+}
+
+// Listen streams every result until ctx is done. Events are dropped for listeners
+// that fall more than buffer events behind.
+func (r *Runner) Listen(ctx context.Context, buffer int) <-chan Event {
+	ch := make(chan Event, buffer)
+	r.mu.Lock()
+	r.listeners[ch] = struct{}{}
+	r.mu.Unlock()
+	go func() {
+		<-ctx.Done()
+		r.mu.Lock()
+		delete(r.listeners, ch)
+		r.mu.Unlock()
+		close(ch)
+	}()
+	return ch
+}
+
+func (r *Runner) emit(e Event) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for ch := range r.listeners {
+		select {
+		case ch <- Event{Task: tasks.CleanTask(copyTask(tasks.Task(e.Task))), Result: copyResult(e.Result)}:
+		default:
+		}
+	}
+}
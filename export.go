@@ -0,0 +1,68 @@
+package runner
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// ExportVersion is the version of the export format written by ExportTasks
+const ExportVersion = 1
+
+// Export is a machine-independent task list
+type Export struct {
+	Version  int    `json:"version"`
+	Exported int64  `json:"exported"`
+	Tasks    []Spec `json:"tasks"`
+}
+
+// ExportTasks serializes the task definitions without their IDs and Location, so they can be
+// kept in version control and imported on other runners
+func (r *Runner) ExportTasks() ([]byte, error) {
+	exp := Export{
+		Version:  ExportVersion,
+		Exported: time.Now().UnixNano() / int64(time.Millisecond),
+		Tasks:    make([]Spec, 0),
+	}
+	for _, t := range r.Tasks("") {
+		spec := r.spec(t.ID)
+		spec.ID, spec.Location = "", ""
+		exp.Tasks = append(exp.Tasks, spec)
+	}
+	return json.MarshalIndent(exp, "", "  ")
+}
+
+// ImportTasks validates every task of an export and adds them with IDs hashed for this
+// runner. Nothing is added if any task is invalid and tasks that are already running are
+// skipped.
+func (r *Runner) ImportTasks(data []byte) error {
+	var exp Export
+	if err := json.Unmarshal(data, &exp); err != nil {
+		return err
+	}
+	if exp.Version != ExportVersion {
+		return fmt.Errorf("runner: unsupported export version %d", exp.Version)
+	}
+	seen := make(map[string]bool)
+	for i := range exp.Tasks {
+		spec := &exp.Tasks[i]
+		spec.ID, spec.Location = "", r.Identity.Location
+		if err := r.validate(*spec); err != nil {
+			return fmt.Errorf("task %d (%q): %w", i, spec.Label, err)
+		}
+		id := r.Hash(spec.Task())
+		if seen[id] {
+			return fmt.Errorf("task %d (%q): %w: duplicate definition", i, spec.Label, ErrInvalidTask)
+		}
+		seen[id] = true
+	}
+	for _, spec := range exp.Tasks {
+		if _, ok := r.find(r.Hash(spec.Task())); ok {
+			continue
+		}
+		if err := r.AddSpec(r.ctx, spec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package runner
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// MachineStore is implemented by Stores that keep the state of several machines and can
+// garbage collect the ones that are gone
+type MachineStore interface {
+	SaveHeartbeat(ctx context.Context, machine string, seen int64) error
+	// Machines gets every machine with stored tasks along with when it was last active,
+	// which is its last heartbeat or the last time one of its tasks was saved
+	Machines(ctx context.Context) (map[string]int64, error)
+	// DeleteMachine removes the tasks, schedules, results and heartbeat of a machine
+	DeleteMachine(ctx context.Context, machine string) error
+}
+
+// StoreHeartbeat is how often a Runner saves its heartbeat to a Store implementing
+// MachineStore, whether or not it runs GC itself
+const StoreHeartbeat = time.Minute
+
+// WithGC removes the persisted state of machines that haven't been active within retention,
+// checking at the given cadence. Every Runner sharing the Store saves its heartbeat at least
+// every StoreHeartbeat, retention must be longer.
+func WithGC(retention, every time.Duration) Option {
+	return func(r *Runner) {
+		r.gcRetention, r.gcEvery = retention, every
+	}
+}
+
+// GC removes the persisted state of machines that haven't been active within retention and
+// returns their MachineIDs. The Store must implement MachineStore.
+func (r *Runner) GC(ctx context.Context, retention time.Duration) ([]string, error) {
+	store, ok := r.store.(MachineStore)
+	if !ok {
+		return nil, ErrNoStore
+	}
+	machines, err := store.Machines(ctx)
+	if err != nil {
+		return nil, err
+	}
+	cutoff := time.Now().Add(-retention).UnixNano() / int64(time.Millisecond)
+	var removed []string
+	for machine, active := range machines {
+		if machine == r.Identity.MachineID || active >= cutoff {
+			continue
+		}
+		if err := store.DeleteMachine(ctx, machine); err != nil {
+			return removed, err
+		}
+		r.logf(slog.LevelInfo, "Removed the persisted state of %s, last active %s\n", machine, time.Unix(0, active*int64(time.Millisecond)))
+		removed = append(removed, machine)
+	}
+	return removed, nil
+}
+
+// touch saves the heartbeat of this machine when the Store keeps them
+func (r *Runner) touch(ctx context.Context) {
+	if store, ok := r.store.(MachineStore); ok {
+		if err := store.SaveHeartbeat(ctx, r.Identity.MachineID, time.Now().UnixNano()/int64(time.Millisecond)); err != nil {
+			r.logf(slog.LevelError, "Could not store heartbeat: %v\n", err)
+		}
+	}
+}
+
+// startHeartbeats saves the heartbeat of this machine every StoreHeartbeat, or at the cadence
+// of GC when it's shorter, until the Runner is stopped
+func (r *Runner) startHeartbeats() {
+	if _, ok := r.store.(MachineStore); !ok {
+		return
+	}
+	every := StoreHeartbeat
+	if r.gcEvery > 0 && r.gcEvery < every {
+		every = r.gcEvery
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	r.mu.Lock()
+	r.cancellations = append(r.cancellations, cancel)
+	r.mu.Unlock()
+	go func() {
+		ticker := time.NewTicker(every)
+		defer ticker.Stop()
+		for {
+			r.touch(ctx)
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// startGC runs GC at the configured cadence until the Runner is stopped
+func (r *Runner) startGC() {
+	if r.store == nil || r.gcEvery <= 0 || r.gcRetention <= 0 {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	r.mu.Lock()
+	r.cancellations = append(r.cancellations, cancel)
+	r.mu.Unlock()
+	go func() {
+		ticker := time.NewTicker(r.gcEvery)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if _, err := r.GC(ctx, r.gcRetention); err != nil {
+					r.logf(slog.LevelError, "Could not collect stale machines: %v\n", err)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,200 @@
+package runner
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"maps"
+	"time"
+
+	"pkg.goda.sh/tasks"
+)
+
+const (
+	// GossipChannel is the subject task state digests are exchanged on
+	GossipChannel = "runner:gossip"
+	// gossipRecent is the number of recent results included per task in a digest
+	gossipRecent = 5
+	// gossipPage bounds the JSON of a page of a digest, so pages fit in the datagrams of a
+	// UDPTransport once base64 encoded
+	gossipPage = 32 << 10
+)
+
+// PeerState is the last known state of a runner, as received through gossip
+type PeerState struct {
+	Identity Identity            `json:"identity"`
+	Tasks    []tasks.CleanTask   `json:"tasks"`
+	Recent   map[string][]Record `json:"recent"`
+	Updated  int64               `json:"updated"`
+	Every    int64               `json:"every"`           // Gossip interval in milliseconds
+	Page     int                 `json:"page,omitempty"`  // Of the digest sent at Updated, from 0
+	Pages    int                 `json:"pages,omitempty"` // Of the digest sent at Updated
+}
+
+// gossipRound is a digest of a peer being received
+type gossipRound struct {
+	state PeerState
+	seen  map[int]bool
+}
+
+// Alive reports whether the peer has gossiped recently
+func (p PeerState) Alive() bool {
+	return time.Now().UnixNano()/int64(time.Millisecond)-p.Updated <= 3*p.Every
+}
+
+// Gossip exchanges task states and recent results with other runners every interval
+// until ctx is done. A nil Transport uses the Runner's own, passing a separate one
+// (ex. a UDPTransport) keeps the fleet view available when the main one is down.
+//
+// Digests are sent in pages of at most 32KiB, spread over half the interval, and the state
+// of a peer is replaced once every page of one of its digests is received. Tasks too large
+// for a page are sent without their last result and recent history.
+func (r *Runner) Gossip(ctx context.Context, every time.Duration, t Transport) error {
+	if t == nil {
+		t = r.transport
+	}
+	if t == nil {
+		return ErrNoTransport
+	}
+	if err := t.Subscribe(ctx, func(_ string, payload []byte) {
+		var page PeerState
+		if err := json.Unmarshal(payload, &page); err != nil {
+			r.logf(slog.LevelWarn, "Skipping malformed gossip: %v\n", err)
+			return
+		}
+		r.receive(page)
+	}, r.ns(GossipChannel)); err != nil {
+		return err
+	}
+	go func() {
+		ticker := time.NewTicker(every)
+		defer ticker.Stop()
+		for {
+			pages := r.digest(every)
+			for i, page := range pages {
+				if i > 0 { // Spread over half the interval, bursts would overflow the buffers of peers
+					select {
+					case <-time.After(every / time.Duration(2*len(pages))):
+					case <-ctx.Done():
+						return
+					}
+				}
+				payload, err := json.Marshal(page)
+				if err == nil {
+					err = t.Publish(ctx, r.ns(GossipChannel), payload)
+				}
+				if err != nil {
+					r.logf(slog.LevelError, "Could not gossip task state: %v\n", err)
+					break
+				}
+			}
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// receive assembles a page of the digest of a peer, older digests than the one known are
+// dropped
+func (r *Runner) receive(page PeerState) {
+	machine := page.Identity.MachineID
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if known, ok := r.peers[machine]; ok && page.Updated < known.Updated {
+		return
+	}
+	if page.Pages <= 1 {
+		page.Page, page.Pages = 0, 0
+		r.peers[machine] = page
+		delete(r.rounds, machine)
+		return
+	}
+	round := r.rounds[machine]
+	switch {
+	case round == nil || round.state.Updated < page.Updated:
+		round = &gossipRound{state: page, seen: make(map[int]bool, page.Pages)}
+		round.state.Tasks, round.state.Recent = nil, make(map[string][]Record)
+		round.state.Page, round.state.Pages = 0, 0
+		r.rounds[machine] = round
+	case round.state.Updated > page.Updated:
+		return
+	}
+	if round.seen[page.Page] || page.Page < 0 || page.Page >= page.Pages {
+		return
+	}
+	round.seen[page.Page] = true
+	round.state.Tasks = append(round.state.Tasks, page.Tasks...)
+	maps.Copy(round.state.Recent, page.Recent)
+	if len(round.seen) == page.Pages {
+		r.peers[machine] = round.state
+		delete(r.rounds, machine)
+	}
+}
+
+// digest gets the state of the Runner in pages of at most gossipPage bytes
+func (r *Runner) digest(every time.Duration) []PeerState {
+	base := PeerState{
+		Identity: r.Identity,
+		Recent:   make(map[string][]Record),
+		Updated:  time.Now().UnixNano() / int64(time.Millisecond),
+		Every:    int64(every / time.Millisecond),
+	}
+	sized := base
+	sized.Page, sized.Pages = 1<<20, 1<<20 // Past the numbers of pages sent
+	empty, _ := json.Marshal(sized)
+	pages := []PeerState{base}
+	size := len(empty)
+	for _, t := range r.Tasks("") {
+		recent := r.History(t.ID)
+		if len(recent) > gossipRecent {
+			recent = recent[len(recent)-gossipRecent:]
+		}
+		n := encodedSize(t, recent)
+		if n > gossipPage {
+			t.Last, recent = nil, nil
+			n = encodedSize(t, nil)
+		}
+		page := &pages[len(pages)-1]
+		if len(page.Tasks) > 0 && size+n > gossipPage {
+			pages = append(pages, base)
+			pages[len(pages)-1].Recent = make(map[string][]Record)
+			page, size = &pages[len(pages)-1], len(empty)
+		}
+		page.Tasks = append(page.Tasks, t)
+		if len(recent) > 0 {
+			page.Recent[t.ID] = recent
+		}
+		size += n
+	}
+	for i := range pages {
+		pages[i].Page, pages[i].Pages = i, len(pages)
+	}
+	return pages
+}
+
+// encodedSize gets the bytes a task and its recent results add to a page of a digest
+func encodedSize(t tasks.CleanTask, recent []Record) int {
+	task, _ := json.Marshal(t)
+	n := len(task) + 1 // Comma
+	if len(recent) > 0 {
+		history, _ := json.Marshal(map[string][]Record{t.ID: recent})
+		n += len(history)
+	}
+	return n
+}
+
+// Fleet gets the state of every runner heard from through gossip that is still alive
+func (r *Runner) Fleet() (out []PeerState) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, state := range r.peers {
+		if state.Alive() {
+			out = append(out, state)
+		}
+	}
+	return out
+}
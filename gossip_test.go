@@ -0,0 +1,98 @@
+package runner_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"pkg.goda.sh/runner/v2"
+	"pkg.goda.sh/runner/v2/runnertest"
+	"pkg.goda.sh/tasks"
+)
+
+func TestGossipLargeDigestOverUDP(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	key := []byte("fleet key")
+	probe := runnertest.NewScript(tasks.Result{Update: strings.Repeat("x", 2048)})
+	sender, _ := runnertest.New(t, map[string]*runnertest.Script{"probe": probe})
+	for i := 0; i < 300; i++ {
+		if err := sender.AddSpec(ctx, sender.NewTask("probe").Label(fmt.Sprint("probe-", i)).Interval("PT1M").MustBuild()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := sender.RunOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	in, err := runner.NewUDPTransport("127.0.0.1:0", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	out, err := runner.NewUDPTransport("127.0.0.1:0", key, in.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	receiver := runner.NewRunner(runner.Identity{MachineID: "receiver"}, nil, nil, true)
+	defer receiver.Stop()
+	if err := receiver.Gossip(ctx, time.Second, in); err != nil {
+		t.Fatal(err)
+	}
+	if err := sender.Gossip(ctx, 200*time.Millisecond, out); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		for _, peer := range receiver.Fleet() {
+			if peer.Identity.MachineID == "runnertest" && len(peer.Tasks) == 300 {
+				if got := len(peer.Recent); got != 300 {
+					t.Errorf("recent results of %d tasks, want 300", got)
+				}
+				return
+			}
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Fatalf("the digest of 300 tasks wasn't received within 5s, fleet: %d peers", len(receiver.Fleet()))
+}
+
+func TestUDPTransportDropsUnsignedDatagrams(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	in, err := runner.NewUDPTransport("127.0.0.1:0", []byte("fleet key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	received := make(chan string, 4)
+	in.Subscribe(ctx, func(_ string, payload []byte) { received <- string(payload) }, "subject")
+
+	for _, key := range [][]byte{nil, []byte("other key"), []byte("fleet key")} {
+		out, err := runner.NewUDPTransport("127.0.0.1:0", key, in.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := out.Publish(ctx, "subject", []byte(fmt.Sprintf("key %q", key))); err != nil {
+			t.Fatal(err)
+		}
+		out.Close()
+	}
+	select {
+	case got := <-received:
+		if got != `key "fleet key"` {
+			t.Fatalf("received %s, want only the datagram signed with the fleet key", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("the signed datagram wasn't received")
+	}
+	select {
+	case got := <-received:
+		t.Fatalf("received %s too", got)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
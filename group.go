@@ -0,0 +1,126 @@
+package runner
+
+import (
+	"context"
+	"iter"
+	"strings"
+
+	"pkg.goda.sh/tasks"
+)
+
+// Group is a named set of tasks within a Runner that can be operated independently,
+// tasks join a group through Spec.Group
+type Group struct {
+	r    *Runner
+	name string
+}
+
+type group struct {
+	paused bool
+	slots  chan struct{} // nil when runs aren't limited
+}
+
+// WithGroupLimit lets at most n tasks of a group run at the same time, runs over the
+// limit wait for a slot
+func WithGroupLimit(name string, n int) Option {
+	return func(r *Runner) {
+		g := r.group(name)
+		g.slots = nil
+		if n > 0 {
+			g.slots = make(chan struct{}, n)
+		}
+	}
+}
+
+// Group gets a group by name, it doesn't need to have any tasks yet. The empty name is
+// the group of the tasks without one.
+func (r *Runner) Group(name string) *Group {
+	return &Group{r: r, name: name}
+}
+
+// Name gets the name of the group
+func (g *Group) Name() string {
+	return g.name
+}
+
+// All iterates over the tasks of the group
+func (g *Group) All() iter.Seq2[string, tasks.Task] {
+	return g.r.Where(func(t tasks.Task) bool { return g.has(t.ID) })
+}
+
+// Pause temporarily pauses the tasks of the group, unless ctx is already done
+func (g *Group) Pause(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	g.r.mu.Lock()
+	g.r.group(g.name).paused = true
+	g.r.mu.Unlock()
+	return nil
+}
+
+// Resume restarts the tasks of the group, unless ctx is already done
+func (g *Group) Resume(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	g.r.mu.Lock()
+	g.r.group(g.name).paused = false
+	g.r.mu.Unlock()
+	return nil
+}
+
+// Paused reports whether the group is paused
+func (g *Group) Paused() bool {
+	g.r.mu.RLock()
+	defer g.r.mu.RUnlock()
+	state := g.r.groups[strings.ToLower(g.name)]
+	return state != nil && state.paused
+}
+
+// Stop cancels the running tasks of the group, like Runner.Stop
+func (g *Group) Stop() {
+	var cancels []context.CancelFunc
+	g.r.mu.RLock()
+	for id, cancel := range g.r.cancels {
+		if strings.EqualFold(g.r.specs[id].Group, g.name) {
+			cancels = append(cancels, cancel)
+		}
+	}
+	g.r.mu.RUnlock()
+	for _, cancel := range cancels {
+		cancel()
+	}
+}
+
+func (g *Group) has(id string) bool {
+	return strings.EqualFold(g.r.spec(id).Group, g.name)
+}
+
+// group gets the state of a group by name, creating it if needed. r.mu must be held
+// outside of options.
+func (r *Runner) group(name string) *group {
+	name = strings.ToLower(name)
+	g, ok := r.groups[name]
+	if !ok {
+		g = &group{}
+		r.groups[name] = g
+	}
+	return g
+}
+
+// acquire waits for a run slot in the task's group, ok is false when the task is cancelled first
+func (r *Runner) acquire(t tasks.Task) (release func(), ok bool) {
+	r.mu.RLock()
+	g := r.groups[strings.ToLower(r.specs[t.ID].Group)]
+	r.mu.RUnlock()
+	if g == nil || g.slots == nil {
+		return func() {}, true
+	}
+	select {
+	case g.slots <- struct{}{}:
+		return func() { <-g.slots }, true
+	case <-t.CTX.Done():
+		return nil, false
+	}
+}
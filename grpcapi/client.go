@@ -0,0 +1,116 @@
+package grpcapi
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"pkg.goda.sh/runner/v2"
+	"pkg.goda.sh/runner/v2/grpcapi/runnerv1"
+	"pkg.goda.sh/tasks"
+)
+
+// Client calls the control API of a remote runner
+type Client struct {
+	rc runnerv1.RunnerClient
+}
+
+// NewClient creates a Client on an established connection
+func NewClient(cc grpc.ClientConnInterface) *Client {
+	return &Client{rc: runnerv1.NewRunnerClient(cc)}
+}
+
+// ResultEvent is a single result sent on a result stream
+type ResultEvent struct {
+	Task     tasks.CleanTask `json:"task"`
+	Location string          `json:"location"`
+	Error    string          `json:"error,omitempty"`
+}
+
+// Add adds tasks to the remote runner, all of them or none, and returns their IDs in order
+func (c *Client) Add(ctx context.Context, specs ...runner.Spec) ([]string, error) {
+	req := &runnerv1.AddRequest{Tasks: make([]*runnerv1.Spec, len(specs))}
+	for i, s := range specs {
+		spec, err := specToProto(s)
+		if err != nil {
+			return nil, err
+		}
+		req.Tasks[i] = spec
+	}
+	out, err := c.rc.Add(ctx, req)
+	return out.GetIds(), err
+}
+
+// Remove removes a task from the remote runner
+func (c *Client) Remove(ctx context.Context, id string) error {
+	_, err := c.rc.Remove(ctx, &runnerv1.RemoveRequest{Id: id})
+	return err
+}
+
+// Update replaces the definition of a task on the remote runner along with its runner-level
+// settings, and returns the new task ID
+func (c *Client) Update(ctx context.Context, id string, s runner.Spec) (string, error) {
+	spec, err := specToProto(s)
+	if err != nil {
+		return "", err
+	}
+	out, err := c.rc.Update(ctx, &runnerv1.UpdateRequest{Id: id, Spec: spec})
+	return out.GetId(), err
+}
+
+// Pause pauses the remote runner
+func (c *Client) Pause(ctx context.Context) error {
+	_, err := c.rc.Pause(ctx, &runnerv1.PauseRequest{})
+	return err
+}
+
+// Resume resumes the remote runner
+func (c *Client) Resume(ctx context.Context) error {
+	_, err := c.rc.Resume(ctx, &runnerv1.ResumeRequest{})
+	return err
+}
+
+// Tasks lists the tasks of the remote runner, of every type when name is empty
+func (c *Client) Tasks(ctx context.Context, name string) ([]tasks.CleanTask, error) {
+	out, err := c.rc.Tasks(ctx, &runnerv1.TasksRequest{Name: name})
+	if err != nil {
+		return nil, err
+	}
+	list := make([]tasks.CleanTask, len(out.GetTasks()))
+	for i, t := range out.GetTasks() {
+		list[i] = taskFromProto(t)
+	}
+	return list, nil
+}
+
+// RunNow runs a task on the remote runner immediately
+func (c *Client) RunNow(ctx context.Context, id string) error {
+	_, err := c.rc.RunNow(ctx, &runnerv1.RunNowRequest{Id: id})
+	return err
+}
+
+// Subscribe streams results from the remote runner until ctx is done. The runner buffers
+// buffer results for a slow client, 64 when 0, before dropping them.
+func (c *Client) Subscribe(ctx context.Context, buffer int) (<-chan ResultEvent, <-chan error, error) {
+	stream, err := c.rc.Subscribe(ctx, &runnerv1.SubscribeRequest{Buffer: int32(buffer)})
+	if err != nil {
+		return nil, nil, err
+	}
+	events, errs := make(chan ResultEvent), make(chan error, 1)
+	go func() {
+		defer close(events)
+		for {
+			in, err := stream.Recv()
+			if err != nil {
+				errs <- err
+				return
+			}
+			event := ResultEvent{Task: taskFromProto(in.GetTask()), Location: in.GetLocation(), Error: in.GetError()}
+			select {
+			case events <- event:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return events, errs, nil
+}
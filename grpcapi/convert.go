@@ -0,0 +1,144 @@
+package grpcapi
+
+import (
+	"encoding/json"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/structpb"
+	"pkg.goda.sh/runner/v2"
+	"pkg.goda.sh/runner/v2/grpcapi/runnerv1"
+	"pkg.goda.sh/tasks"
+)
+
+// specFromProto converts a definition of the API to a Spec, params decode as they do from JSON
+func specFromProto(s *runnerv1.Spec) runner.Spec {
+	spec := runner.Spec{
+		CleanTask: tasks.CleanTask{
+			Label:    s.GetLabel(),
+			Interval: s.GetInterval(),
+			Task:     s.GetTask(),
+			Once:     s.GetOnce(),
+		},
+		Quorum:         int(s.GetQuorum()),
+		IdempotencyKey: s.GetIdempotencyKey(),
+		Broadcast:      s.GetBroadcast(),
+		Tags:           s.GetTags(),
+		Group:          s.GetGroup(),
+		Template:       s.GetTemplate(),
+	}
+	if c := s.GetConstraints(); c != nil {
+		spec.Constraints = &runner.Constraints{
+			Locations:        c.GetLocations(),
+			ExcludeLocations: c.GetExcludeLocations(),
+			Tags:             c.GetTags(),
+			ExcludeTags:      c.GetExcludeTags(),
+		}
+	}
+	if s.GetParams() != nil {
+		spec.Params = s.GetParams().AsMap()
+	}
+	if s.GetTemplateParams() != nil {
+		spec.TemplateParams = s.GetTemplateParams().AsMap()
+	}
+	return spec
+}
+
+// specToProto converts a Spec to a definition of the API
+func specToProto(s runner.Spec) (*runnerv1.Spec, error) {
+	params, err := toStruct(s.Params)
+	if err != nil {
+		return nil, err
+	}
+	templateParams, err := toStruct(s.TemplateParams)
+	if err != nil {
+		return nil, err
+	}
+	spec := &runnerv1.Spec{
+		Label:          s.Label,
+		Interval:       s.Interval,
+		Task:           s.CleanTask.Task,
+		Once:           s.Once,
+		Quorum:         int32(s.Quorum),
+		IdempotencyKey: s.IdempotencyKey,
+		Broadcast:      s.Broadcast,
+		Params:         params,
+		Tags:           s.Tags,
+		Group:          s.Group,
+		Template:       s.Template,
+		TemplateParams: templateParams,
+	}
+	if c := s.Constraints; c != nil {
+		spec.Constraints = &runnerv1.Constraints{
+			Locations:        c.Locations,
+			ExcludeLocations: c.ExcludeLocations,
+			Tags:             c.Tags,
+			ExcludeTags:      c.ExcludeTags,
+		}
+	}
+	return spec, nil
+}
+
+// taskToProto converts a task to the API, its last update as it encodes to JSON
+func taskToProto(t tasks.CleanTask) (*runnerv1.Task, error) {
+	task := &runnerv1.Task{
+		Id:       t.ID,
+		Label:    t.Label,
+		Interval: t.Interval,
+		Task:     t.Task,
+		Once:     t.Once,
+		Location: t.Location,
+		Warn:     t.Warn,
+		Spark:    t.Spark,
+		Date:     t.Date,
+	}
+	if t.Last != nil {
+		last, err := toValue(t.Last)
+		if err != nil {
+			return nil, err
+		}
+		task.Last = last
+	}
+	return task, nil
+}
+
+// taskFromProto converts a task of the API, its last update decodes as it does from JSON
+func taskFromProto(t *runnerv1.Task) tasks.CleanTask {
+	return tasks.CleanTask{
+		ID:       t.GetId(),
+		Label:    t.GetLabel(),
+		Interval: t.GetInterval(),
+		Task:     t.GetTask(),
+		Once:     t.GetOnce(),
+		Location: t.GetLocation(),
+		Last:     t.GetLast().AsInterface(),
+		Warn:     t.GetWarn(),
+		Spark:    t.GetSpark(),
+		Date:     t.GetDate(),
+	}
+}
+
+// toValue converts v to a protobuf Value, through JSON for the types structpb doesn't take
+// as they are, ex. structs and typed slices
+func toValue(v interface{}) (*structpb.Value, error) {
+	if value, err := structpb.NewValue(v); err == nil {
+		return value, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	value := new(structpb.Value)
+	return value, protojson.Unmarshal(data, value)
+}
+
+// toStruct converts params to a protobuf Struct, nil when there are none
+func toStruct(m map[string]interface{}) (*structpb.Struct, error) {
+	if m == nil {
+		return nil, nil
+	}
+	value, err := toValue(m)
+	if err != nil {
+		return nil, err
+	}
+	return value.GetStructValue(), nil
+}
@@ -0,0 +1,139 @@
+// Package grpcapi exposes a Runner over gRPC.
+//
+// The runner.v1.Runner service is defined in runnerv1/runner.proto, controllers in other
+// languages generate their stubs from it. Messages use the default protobuf codec.
+package grpcapi
+
+//go:generate buf generate
+
+import (
+	"context"
+	"errors"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"pkg.goda.sh/runner/v2"
+	"pkg.goda.sh/runner/v2/grpcapi/runnerv1"
+)
+
+// Version is the version of the control API, part of the gRPC service name
+const Version = "v1"
+
+// ServiceName is the fully qualified gRPC service name
+const ServiceName = "runner." + Version + ".Runner"
+
+// Server implements the control API on top of a Runner
+type Server struct {
+	runnerv1.UnimplementedRunnerServer
+	Runner *runner.Runner
+}
+
+// Register registers the control API for r on a gRPC server
+func Register(s grpc.ServiceRegistrar, r *runner.Runner) {
+	runnerv1.RegisterRunnerServer(s, &Server{Runner: r})
+}
+
+// Add adds tasks to the runner, all of them or none, see Runner.AddSpecs
+func (s *Server) Add(ctx context.Context, req *runnerv1.AddRequest) (*runnerv1.AddResponse, error) {
+	specs := make([]runner.Spec, len(req.GetTasks()))
+	for i, spec := range req.GetTasks() {
+		specs[i] = specFromProto(spec)
+	}
+	ids, err := s.Runner.AddSpecs(s.Runner.Context(), specs) // Tasks outlive the request
+	if errors.Is(err, runner.ErrInvalidTask) {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	} else if errors.Is(err, runner.ErrDuplicateTask) {
+		return nil, status.Error(codes.AlreadyExists, err.Error())
+	} else if err != nil {
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+	return &runnerv1.AddResponse{Ids: ids}, nil
+}
+
+// Remove removes a task
+func (s *Server) Remove(ctx context.Context, req *runnerv1.RemoveRequest) (*runnerv1.RemoveResponse, error) {
+	if err := s.Runner.Remove(ctx, req.GetId()); errors.Is(err, runner.ErrUnknownTask) {
+		return nil, status.Errorf(codes.NotFound, "%v: %q", err, req.GetId())
+	} else if err != nil {
+		return nil, status.FromContextError(err).Err()
+	}
+	return &runnerv1.RemoveResponse{}, nil
+}
+
+// Update replaces the definition of a task along with its runner-level settings
+func (s *Server) Update(ctx context.Context, req *runnerv1.UpdateRequest) (*runnerv1.UpdateResponse, error) {
+	id, err := s.Runner.UpdateSpec(s.Runner.Context(), req.GetId(), specFromProto(req.GetSpec()))
+	if errors.Is(err, runner.ErrInvalidTask) {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	} else if errors.Is(err, runner.ErrDuplicateTask) {
+		return nil, status.Error(codes.AlreadyExists, err.Error())
+	} else if err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	return &runnerv1.UpdateResponse{Id: id}, nil
+}
+
+// Pause pauses task execution
+func (s *Server) Pause(ctx context.Context, _ *runnerv1.PauseRequest) (*runnerv1.PauseResponse, error) {
+	if err := s.Runner.Pause(ctx); err != nil {
+		return nil, status.FromContextError(err).Err()
+	}
+	return &runnerv1.PauseResponse{}, nil
+}
+
+// Resume resumes task execution
+func (s *Server) Resume(ctx context.Context, _ *runnerv1.ResumeRequest) (*runnerv1.ResumeResponse, error) {
+	if err := s.Runner.Resume(ctx); err != nil {
+		return nil, status.FromContextError(err).Err()
+	}
+	return &runnerv1.ResumeResponse{}, nil
+}
+
+// Tasks lists tasks
+func (s *Server) Tasks(ctx context.Context, req *runnerv1.TasksRequest) (*runnerv1.TasksResponse, error) {
+	list := s.Runner.Tasks(req.GetName())
+	out := &runnerv1.TasksResponse{Tasks: make([]*runnerv1.Task, len(list))}
+	for i, t := range list {
+		task, err := taskToProto(t)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "task %q: %v", t.ID, err)
+		}
+		out.Tasks[i] = task
+	}
+	return out, nil
+}
+
+// RunNow runs a task immediately
+func (s *Server) RunNow(ctx context.Context, req *runnerv1.RunNowRequest) (*runnerv1.RunNowResponse, error) {
+	switch err := s.Runner.RunNow(ctx, req.GetId()); {
+	case err == nil:
+		return &runnerv1.RunNowResponse{}, nil
+	case errors.Is(err, runner.ErrUnknownTask):
+		return nil, status.Error(codes.NotFound, err.Error())
+	default:
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+}
+
+// Subscribe streams results until the client disconnects
+func (s *Server) Subscribe(req *runnerv1.SubscribeRequest, stream runnerv1.Runner_SubscribeServer) error {
+	buffer := int(req.GetBuffer())
+	if buffer <= 0 {
+		buffer = 64
+	}
+	for e := range s.Runner.Listen(stream.Context(), buffer) {
+		task, err := taskToProto(e.Task)
+		if err != nil {
+			return status.Errorf(codes.Internal, "task %q: %v", e.Task.ID, err)
+		}
+		event := &runnerv1.ResultEvent{Task: task, Location: e.Result.Location}
+		if e.Result.Error != nil {
+			event.Error = e.Result.Error.Error()
+		}
+		if err := stream.Send(event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
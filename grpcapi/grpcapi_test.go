@@ -0,0 +1,118 @@
+package grpcapi_test
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"pkg.goda.sh/runner/v2"
+	"pkg.goda.sh/runner/v2/grpcapi"
+	"pkg.goda.sh/runner/v2/runnertest"
+	"pkg.goda.sh/tasks"
+)
+
+// serve serves the control API of r in memory and connects a Client to it
+func serve(t *testing.T, r *runner.Runner) *grpcapi.Client {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer()
+	grpcapi.Register(srv, r)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+	cc, err := grpc.Dial("bufconn", grpc.WithInsecure(), grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+		return lis.Dial()
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cc.Close() })
+	return grpcapi.NewClient(cc)
+}
+
+func TestClientControlsTheRunner(t *testing.T) {
+	ctx := context.Background()
+	probe := runnertest.NewScript(tasks.Result{Update: map[string]interface{}{"ms": 12}})
+	r, _ := runnertest.New(t, map[string]*runnertest.Script{"probe": probe})
+	c := serve(t, r)
+
+	gateway := r.NewTask("probe").Label("gateway").Interval("5m").MustBuild()
+	gateway.Params = map[string]interface{}{"url": "https://gateway.internal", "retries": 3.0, "codes": []interface{}{200.0, 204.0}}
+	gateway.Constraints = &runner.Constraints{Tags: []string{"edge"}}
+	ids, err := c.Add(ctx, gateway, r.NewTask("probe").Label("api").Interval("PT1M").MustBuild())
+	if err != nil || len(ids) != 2 {
+		t.Fatalf("got %v, %v, want 2 tasks added", ids, err)
+	}
+	if spec, ok := r.Spec(ids[0]); !ok || !reflect.DeepEqual(spec.Params, gateway.Params) || !reflect.DeepEqual(spec.Constraints, gateway.Constraints) {
+		t.Errorf("got %+v, want the params and constraints sent", spec)
+	}
+	list, err := c.Tasks(ctx, "probe")
+	if err != nil || len(list) != 2 {
+		t.Fatalf("got %v, %v, want 2 tasks", list, err)
+	}
+
+	_, err = c.Add(ctx, r.NewTask("probe").Label("db").Interval("PT1M").MustBuild(), runner.Spec{CleanTask: tasks.CleanTask{Label: "cache", Task: "missing", Interval: "PT1M"}})
+	if status.Code(err) != codes.InvalidArgument || len(r.Tasks("probe")) != 2 {
+		t.Errorf("got %v and %d tasks, want InvalidArgument and none added", err, len(r.Tasks("probe")))
+	}
+	if _, err := c.Add(ctx, gateway); status.Code(err) != codes.AlreadyExists {
+		t.Errorf("got %v, want AlreadyExists", err)
+	}
+
+	updated := gateway
+	updated.Tags = []string{"critical"}
+	updated.Params = map[string]interface{}{"url": "https://gateway.internal/health"}
+	id, err := c.Update(ctx, ids[0], updated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spec, ok := r.Spec(id); !ok || !reflect.DeepEqual(spec.Tags, updated.Tags) || !reflect.DeepEqual(spec.Params, updated.Params) {
+		t.Errorf("got %+v, want the tags and params of the update", spec)
+	}
+
+	if err := c.Remove(ctx, ids[1]); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Remove(ctx, ids[1]); status.Code(err) != codes.NotFound {
+		t.Errorf("got %v removing a removed task, want NotFound", err)
+	}
+	if err := c.RunNow(ctx, ids[1]); status.Code(err) != codes.NotFound {
+		t.Errorf("got %v running a removed task, want NotFound", err)
+	}
+}
+
+func TestClientSubscribes(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	probe := runnertest.NewScript(tasks.Result{Update: map[string]interface{}{"ms": 12}})
+	r, _ := runnertest.New(t, map[string]*runnertest.Script{"probe": probe})
+	c := serve(t, r)
+	ids, err := c.Add(ctx, r.NewTask("probe").Label("gateway").Interval("PT1M").MustBuild())
+	if err != nil {
+		t.Fatal(err)
+	}
+	events, errs, err := c.Subscribe(ctx, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for { // The stream may be opened after a first result, so results are triggered until one comes
+		runnertest.Trigger(t, r, ids[0])
+		select {
+		case e := <-events:
+			if e.Task.ID != ids[0] || !reflect.DeepEqual(e.Task.Last, map[string]interface{}{"ms": 12.0}) {
+				t.Errorf("got %+v, want the result of %s", e, ids[0])
+			}
+			return
+		case err := <-errs:
+			t.Fatal(err)
+		case <-ctx.Done():
+			t.Fatal("no result streamed")
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+}
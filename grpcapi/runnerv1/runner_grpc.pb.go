@@ -0,0 +1,397 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+
+package runnerv1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// RunnerClient is the client API for Runner service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type RunnerClient interface {
+	// Add adds tasks, all of them or none when one is invalid or a duplicate
+	Add(ctx context.Context, in *AddRequest, opts ...grpc.CallOption) (*AddResponse, error)
+	// Remove removes a task
+	Remove(ctx context.Context, in *RemoveRequest, opts ...grpc.CallOption) (*RemoveResponse, error)
+	// Update replaces the definition of a task along with its runner-level settings
+	Update(ctx context.Context, in *UpdateRequest, opts ...grpc.CallOption) (*UpdateResponse, error)
+	// Pause pauses task execution
+	Pause(ctx context.Context, in *PauseRequest, opts ...grpc.CallOption) (*PauseResponse, error)
+	// Resume resumes task execution
+	Resume(ctx context.Context, in *ResumeRequest, opts ...grpc.CallOption) (*ResumeResponse, error)
+	// Tasks lists tasks
+	Tasks(ctx context.Context, in *TasksRequest, opts ...grpc.CallOption) (*TasksResponse, error)
+	// RunNow runs a task immediately
+	RunNow(ctx context.Context, in *RunNowRequest, opts ...grpc.CallOption) (*RunNowResponse, error)
+	// Subscribe streams results until the client disconnects
+	Subscribe(ctx context.Context, in *SubscribeRequest, opts ...grpc.CallOption) (Runner_SubscribeClient, error)
+}
+
+type runnerClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewRunnerClient(cc grpc.ClientConnInterface) RunnerClient {
+	return &runnerClient{cc}
+}
+
+func (c *runnerClient) Add(ctx context.Context, in *AddRequest, opts ...grpc.CallOption) (*AddResponse, error) {
+	out := new(AddResponse)
+	err := c.cc.Invoke(ctx, "/runner.v1.Runner/Add", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *runnerClient) Remove(ctx context.Context, in *RemoveRequest, opts ...grpc.CallOption) (*RemoveResponse, error) {
+	out := new(RemoveResponse)
+	err := c.cc.Invoke(ctx, "/runner.v1.Runner/Remove", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *runnerClient) Update(ctx context.Context, in *UpdateRequest, opts ...grpc.CallOption) (*UpdateResponse, error) {
+	out := new(UpdateResponse)
+	err := c.cc.Invoke(ctx, "/runner.v1.Runner/Update", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *runnerClient) Pause(ctx context.Context, in *PauseRequest, opts ...grpc.CallOption) (*PauseResponse, error) {
+	out := new(PauseResponse)
+	err := c.cc.Invoke(ctx, "/runner.v1.Runner/Pause", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *runnerClient) Resume(ctx context.Context, in *ResumeRequest, opts ...grpc.CallOption) (*ResumeResponse, error) {
+	out := new(ResumeResponse)
+	err := c.cc.Invoke(ctx, "/runner.v1.Runner/Resume", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *runnerClient) Tasks(ctx context.Context, in *TasksRequest, opts ...grpc.CallOption) (*TasksResponse, error) {
+	out := new(TasksResponse)
+	err := c.cc.Invoke(ctx, "/runner.v1.Runner/Tasks", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *runnerClient) RunNow(ctx context.Context, in *RunNowRequest, opts ...grpc.CallOption) (*RunNowResponse, error) {
+	out := new(RunNowResponse)
+	err := c.cc.Invoke(ctx, "/runner.v1.Runner/RunNow", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *runnerClient) Subscribe(ctx context.Context, in *SubscribeRequest, opts ...grpc.CallOption) (Runner_SubscribeClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Runner_ServiceDesc.Streams[0], "/runner.v1.Runner/Subscribe", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &runnerSubscribeClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Runner_SubscribeClient interface {
+	Recv() (*ResultEvent, error)
+	grpc.ClientStream
+}
+
+type runnerSubscribeClient struct {
+	grpc.ClientStream
+}
+
+func (x *runnerSubscribeClient) Recv() (*ResultEvent, error) {
+	m := new(ResultEvent)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// RunnerServer is the server API for Runner service.
+// All implementations must embed UnimplementedRunnerServer
+// for forward compatibility
+type RunnerServer interface {
+	// Add adds tasks, all of them or none when one is invalid or a duplicate
+	Add(context.Context, *AddRequest) (*AddResponse, error)
+	// Remove removes a task
+	Remove(context.Context, *RemoveRequest) (*RemoveResponse, error)
+	// Update replaces the definition of a task along with its runner-level settings
+	Update(context.Context, *UpdateRequest) (*UpdateResponse, error)
+	// Pause pauses task execution
+	Pause(context.Context, *PauseRequest) (*PauseResponse, error)
+	// Resume resumes task execution
+	Resume(context.Context, *ResumeRequest) (*ResumeResponse, error)
+	// Tasks lists tasks
+	Tasks(context.Context, *TasksRequest) (*TasksResponse, error)
+	// RunNow runs a task immediately
+	RunNow(context.Context, *RunNowRequest) (*RunNowResponse, error)
+	// Subscribe streams results until the client disconnects
+	Subscribe(*SubscribeRequest, Runner_SubscribeServer) error
+	mustEmbedUnimplementedRunnerServer()
+}
+
+// UnimplementedRunnerServer must be embedded to have forward compatible implementations.
+type UnimplementedRunnerServer struct {
+}
+
+func (UnimplementedRunnerServer) Add(context.Context, *AddRequest) (*AddResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Add not implemented")
+}
+func (UnimplementedRunnerServer) Remove(context.Context, *RemoveRequest) (*RemoveResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Remove not implemented")
+}
+func (UnimplementedRunnerServer) Update(context.Context, *UpdateRequest) (*UpdateResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Update not implemented")
+}
+func (UnimplementedRunnerServer) Pause(context.Context, *PauseRequest) (*PauseResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Pause not implemented")
+}
+func (UnimplementedRunnerServer) Resume(context.Context, *ResumeRequest) (*ResumeResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Resume not implemented")
+}
+func (UnimplementedRunnerServer) Tasks(context.Context, *TasksRequest) (*TasksResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Tasks not implemented")
+}
+func (UnimplementedRunnerServer) RunNow(context.Context, *RunNowRequest) (*RunNowResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RunNow not implemented")
+}
+func (UnimplementedRunnerServer) Subscribe(*SubscribeRequest, Runner_SubscribeServer) error {
+	return status.Errorf(codes.Unimplemented, "method Subscribe not implemented")
+}
+func (UnimplementedRunnerServer) mustEmbedUnimplementedRunnerServer() {}
+
+// UnsafeRunnerServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to RunnerServer will
+// result in compilation errors.
+type UnsafeRunnerServer interface {
+	mustEmbedUnimplementedRunnerServer()
+}
+
+func RegisterRunnerServer(s grpc.ServiceRegistrar, srv RunnerServer) {
+	s.RegisterService(&Runner_ServiceDesc, srv)
+}
+
+func _Runner_Add_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AddRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RunnerServer).Add(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/runner.v1.Runner/Add",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RunnerServer).Add(ctx, req.(*AddRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Runner_Remove_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RemoveRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RunnerServer).Remove(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/runner.v1.Runner/Remove",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RunnerServer).Remove(ctx, req.(*RemoveRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Runner_Update_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RunnerServer).Update(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/runner.v1.Runner/Update",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RunnerServer).Update(ctx, req.(*UpdateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Runner_Pause_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PauseRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RunnerServer).Pause(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/runner.v1.Runner/Pause",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RunnerServer).Pause(ctx, req.(*PauseRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Runner_Resume_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ResumeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RunnerServer).Resume(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/runner.v1.Runner/Resume",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RunnerServer).Resume(ctx, req.(*ResumeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Runner_Tasks_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TasksRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RunnerServer).Tasks(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/runner.v1.Runner/Tasks",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RunnerServer).Tasks(ctx, req.(*TasksRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Runner_RunNow_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RunNowRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RunnerServer).RunNow(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/runner.v1.Runner/RunNow",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RunnerServer).RunNow(ctx, req.(*RunNowRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Runner_Subscribe_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(SubscribeRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(RunnerServer).Subscribe(m, &runnerSubscribeServer{stream})
+}
+
+type Runner_SubscribeServer interface {
+	Send(*ResultEvent) error
+	grpc.ServerStream
+}
+
+type runnerSubscribeServer struct {
+	grpc.ServerStream
+}
+
+func (x *runnerSubscribeServer) Send(m *ResultEvent) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// Runner_ServiceDesc is the grpc.ServiceDesc for Runner service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Runner_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "runner.v1.Runner",
+	HandlerType: (*RunnerServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Add",
+			Handler:    _Runner_Add_Handler,
+		},
+		{
+			MethodName: "Remove",
+			Handler:    _Runner_Remove_Handler,
+		},
+		{
+			MethodName: "Update",
+			Handler:    _Runner_Update_Handler,
+		},
+		{
+			MethodName: "Pause",
+			Handler:    _Runner_Pause_Handler,
+		},
+		{
+			MethodName: "Resume",
+			Handler:    _Runner_Resume_Handler,
+		},
+		{
+			MethodName: "Tasks",
+			Handler:    _Runner_Tasks_Handler,
+		},
+		{
+			MethodName: "RunNow",
+			Handler:    _Runner_RunNow_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Subscribe",
+			Handler:       _Runner_Subscribe_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "runnerv1/runner.proto",
+}
@@ -0,0 +1,275 @@
+package runner
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+
+	"github.com/cespare/xxhash/v2"
+	"pkg.goda.sh/tasks"
+)
+
+// HashVersion selects how task IDs are derived from their definition
+type HashVersion int
+
+const (
+	// HashV1 is the MD5 of the gob encoding of tasks.Hash. It is the default for compatibility
+	// with existing IDs, but changes whenever tasks.Hash or the gob encoding does.
+	HashV1 HashVersion = 1
+	// HashV2 is the hex MD5 of "runner/v2" followed by the fields Label, Interval, Task, ID,
+	// Once ("1" or "0") and Machine, each as a uvarint byte length and its UTF-8 bytes. Machine
+	// is "<namespace>/<MachineID>" with WithNamespace, "<MachineID>" otherwise and empty for
+	// FleetKey. This layout is guaranteed not to change.
+	HashV2 HashVersion = 2
+	// HashV3 is the hex digest, using the HashAlgorithm set by WithHashing, of "runner/v3"
+	// followed by the name and value of each selected HashField in their declared order, both
+	// encoded like the fields of HashV2.
+	HashV3 HashVersion = 3
+	// HashV4 is the hex SHA-256 of the canonical JSON object of a task, so IDs can be computed
+	// outside of Go. The object has the keys id, interval, label, machine, once and task in
+	// this order, without whitespace. Once is a boolean, every other value a string escaping
+	// only " and \ with a backslash and control characters as \b, \f, \n, \r, \t or \u00xx.
+	// Machine is the same as in HashV2. This matches JSON.stringify in JavaScript:
+	//
+	//	sha256(JSON.stringify({id, interval, label, machine, once, task}))
+	//
+	// Interval is hashed as given when it is ISO 8601 or can't be parsed. Go durations and
+	// phrases ("5m", "every 5 minutes", "hourly", "daily", "weekly") are rewritten as ISO 8601
+	// first, like tasks are stored: "P", the whole days and "D", then when anything is left
+	// "T" followed by the whole hours and "H", the whole minutes and "M" and the seconds left
+	// as the shortest decimal and "S", leaving out the parts that are zero. So "5m" is hashed
+	// as "PT5M", "90s" as "PT1M30S", "36h" as "P1DT12H" and "1.5s" as "PT1.5S". The task added
+	// on the runnertest machine with the label "gateway", the type "probe" and the interval
+	// "5m" has the ID of
+	//
+	//	{"id":"","interval":"PT5M","label":"gateway","machine":"runnertest","once":false,"task":"probe"}
+	//
+	// which is 03d178f711e439091f2d62fa0a06f447d69a35c6567581df5014e4f43085b668. The other
+	// versions hash the interval rewritten the same way.
+	HashV4 HashVersion = 4
+)
+
+// HashAlgorithm is the hash function used by HashV3
+type HashAlgorithm string
+
+// Hash algorithms
+const (
+	HashMD5    HashAlgorithm = "md5"
+	HashSHA256 HashAlgorithm = "sha256"
+	HashXXH64  HashAlgorithm = "xxhash" // 64-bit xxHash, 16 hex digits
+)
+
+// HashField is a task field that can take part in HashV3 IDs
+type HashField string
+
+// Hash fields, in their HashV3 order
+const (
+	HashLabel    HashField = "label"
+	HashInterval HashField = "interval"
+	HashTask     HashField = "task"
+	HashID       HashField = "id"
+	HashOnce     HashField = "once"
+	HashMachine  HashField = "machine" // Without it, tasks share IDs across runners
+)
+
+// HashFields are every HashField, in their HashV3 order
+var HashFields = []HashField{HashLabel, HashInterval, HashTask, HashID, HashOnce, HashMachine}
+
+// WithHashing uses HashV3 task IDs computed with alg over fields, every field when empty.
+// Leaving HashInterval out keeps the ID of a task when its interval is changed. IDs created
+// by the versions in from are accepted like with WithHashVersion.
+func WithHashing(alg HashAlgorithm, fields []HashField, from ...HashVersion) Option {
+	return func(r *Runner) {
+		if len(fields) == 0 {
+			fields = HashFields
+		}
+		r.hashVersion = HashV3
+		r.hashFrom = from
+		r.hashAlg = alg
+		r.hashFields = fields
+	}
+}
+
+// WithHashVersion sets the HashVersion of task IDs. IDs created by the versions in from are
+// accepted wherever a task ID is and resolve to the ID of the current version, see Migrations.
+func WithHashVersion(v HashVersion, from ...HashVersion) Option {
+	return func(r *Runner) {
+		r.hashVersion = v
+		r.hashFrom = from
+	}
+}
+
+// HashWith generates the ID of a task for this runner using a specific HashVersion
+func (r *Runner) HashWith(t tasks.Task, v HashVersion) string {
+	return r.hashWith(t, r.Identity.MachineID, v)
+}
+
+// Migrations maps the IDs tasks had under the HashVersions passed to WithHashVersion to their
+// current ID
+func (r *Runner) Migrations() map[string]string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make(map[string]string, len(r.aliases))
+	for old, id := range r.aliases {
+		out[old] = id
+	}
+	return out
+}
+
+// resolve maps an older ID of a task to its current one
+func (r *Runner) resolve(id string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if current, ok := r.aliases[id]; ok {
+		return current
+	}
+	return id
+}
+
+// alias records the IDs a task had under older HashVersions
+func (r *Runner) alias(t tasks.Task, id string) {
+	for _, v := range r.hashFrom {
+		if old := r.hashWith(t, r.Identity.MachineID, v); old != id {
+			r.mu.Lock()
+			r.aliases[old] = id
+			r.mu.Unlock()
+		}
+	}
+}
+
+func (r *Runner) hash(t tasks.Task, machine string) string {
+	return r.hashWith(t, machine, r.hashVersion)
+}
+
+func (r *Runner) hashWith(t tasks.Task, machine string, v HashVersion) string {
+	t.Interval = normalizeInterval(t.Interval)
+	if r.namespace != "" {
+		machine = r.namespace + "/" + machine // Tenants never share task IDs
+	}
+	if v == HashV4 {
+		return fmt.Sprintf("%x", sha256.Sum256(canonical(t, machine)))
+	}
+	if v == HashV3 {
+		return r.hashV3(t, machine)
+	}
+	if v == HashV2 {
+		var b bytes.Buffer
+		b.WriteString("runner/v2")
+		once := "0"
+		if t.Once {
+			once = "1"
+		}
+		for _, field := range []string{t.Label, t.Interval, t.Task, t.ID, once, machine} {
+			var size [binary.MaxVarintLen64]byte
+			b.Write(size[:binary.PutUvarint(size[:], uint64(len(field)))])
+			b.WriteString(field)
+		}
+		return fmt.Sprintf("%x", md5.Sum(b.Bytes()))
+	}
+	var b bytes.Buffer
+	if err := gob.NewEncoder(&b).Encode(tasks.Hash{
+		Label:    t.Label,
+		Interval: t.Interval,
+		Task:     t.Task,
+		ID:       t.ID,
+		Once:     t.Once,
+		Machine:  machine,
+	}); err == nil {
+		return fmt.Sprintf("%x", md5.Sum(b.Bytes()))
+	}
+	return fmt.Sprintf("%s-%s", r.Identity.MachineID, newUUID()) // Return MachineID + UUIDv4 if gob encoder fails
+}
+
+// hashV3 generates a HashV3 ID with the configured algorithm and fields
+func (r *Runner) hashV3(t tasks.Task, machine string) string {
+	once := "0"
+	if t.Once {
+		once = "1"
+	}
+	values := map[HashField]string{
+		HashLabel:    t.Label,
+		HashInterval: t.Interval,
+		HashTask:     t.Task,
+		HashID:       t.ID,
+		HashOnce:     once,
+		HashMachine:  machine,
+	}
+	var b bytes.Buffer
+	b.WriteString("runner/v3")
+	for _, field := range HashFields {
+		if !containsField(r.hashFields, field) {
+			continue
+		}
+		for _, s := range []string{string(field), values[field]} {
+			var size [binary.MaxVarintLen64]byte
+			b.Write(size[:binary.PutUvarint(size[:], uint64(len(s)))])
+			b.WriteString(s)
+		}
+	}
+	switch r.hashAlg {
+	case HashSHA256:
+		return fmt.Sprintf("%x", sha256.Sum256(b.Bytes()))
+	case HashXXH64:
+		return fmt.Sprintf("%016x", xxhash.Sum64(b.Bytes()))
+	}
+	return fmt.Sprintf("%x", md5.Sum(b.Bytes()))
+}
+
+func containsField(list []HashField, f HashField) bool {
+	for _, item := range list {
+		if item == f {
+			return true
+		}
+	}
+	return false
+}
+
+// canonical encodes the hashed fields of a task as the canonical JSON object of HashV4
+func canonical(t tasks.Task, machine string) []byte {
+	var b bytes.Buffer
+	for _, field := range []struct{ key, value string }{
+		{`{"id":`, t.ID},
+		{`,"interval":`, t.Interval},
+		{`,"label":`, t.Label},
+		{`,"machine":`, machine},
+	} {
+		b.WriteString(field.key)
+		quote(&b, field.value)
+	}
+	fmt.Fprintf(&b, `,"once":%t,"task":`, t.Once)
+	quote(&b, t.Task)
+	b.WriteByte('}')
+	return b.Bytes()
+}
+
+// quote writes s as a JSON string, escaping no more than JSON.stringify does
+func quote(b *bytes.Buffer, s string) {
+	b.WriteByte('"')
+	for _, c := range []byte(s) {
+		switch c {
+		case '"', '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case '\b':
+			b.WriteString(`\b`)
+		case '\f':
+			b.WriteString(`\f`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			if c < 0x20 {
+				fmt.Fprintf(b, `\u%04x`, c)
+			} else {
+				b.WriteByte(c)
+			}
+		}
+	}
+	b.WriteByte('"')
+}
@@ -0,0 +1,33 @@
+package runner_test
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"testing"
+
+	"pkg.goda.sh/runner/v2"
+	"pkg.goda.sh/runner/v2/runnertest"
+	"pkg.goda.sh/tasks"
+)
+
+// TestHashV4Vectors checks the IDs documented for other languages, with the canonical JSON
+// they are the SHA-256 of
+func TestHashV4Vectors(t *testing.T) {
+	r, _ := runnertest.New(t, map[string]*runnertest.Script{"probe": runnertest.NewScript()}, runner.WithHashVersion(runner.HashV4))
+	for _, c := range []struct {
+		interval, canonical, want string
+	}{
+		{"5m", `{"id":"","interval":"PT5M","label":"gateway","machine":"runnertest","once":false,"task":"probe"}`, "03d178f711e439091f2d62fa0a06f447d69a35c6567581df5014e4f43085b668"},
+		{"PT5M", `{"id":"","interval":"PT5M","label":"gateway","machine":"runnertest","once":false,"task":"probe"}`, "03d178f711e439091f2d62fa0a06f447d69a35c6567581df5014e4f43085b668"},
+		{"90s", `{"id":"","interval":"PT1M30S","label":"gateway","machine":"runnertest","once":false,"task":"probe"}`, "da07b9375de08a95be248e88d0955ca9a3c067f227e663045c119a6211621733"},
+		{"every 36 hours", `{"id":"","interval":"P1DT12H","label":"gateway","machine":"runnertest","once":false,"task":"probe"}`, "d4ef3570f4a8ed5760b10b77f996d0c00a8a2da504645b33d4c3c71112cfd4ca"},
+		{"1.5s", `{"id":"","interval":"PT1.5S","label":"gateway","machine":"runnertest","once":false,"task":"probe"}`, "1a0de49b6707df549d131987dd644245f57f2c79358a71f425cbefefb2fe04fb"},
+	} {
+		if sum := fmt.Sprintf("%x", sha256.Sum256([]byte(c.canonical))); sum != c.want {
+			t.Errorf("%s: the SHA-256 of %s is %s, not %s", c.interval, c.canonical, sum, c.want)
+		}
+		if id := r.Hash(tasks.Task{Label: "gateway", Interval: c.interval, Task: "probe"}); id != c.want {
+			t.Errorf("%s: got %s, want %s", c.interval, id, c.want)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package runner
+
+import (
+	"time"
+
+	"pkg.goda.sh/tasks"
+)
+
+// DefaultHistorySize is the number of results kept per task unless WithHistory is used
+const DefaultHistorySize = 32
+
+// Record is a single past result of a task
+type Record struct {
+	Date     int64       `json:"date"`
+	Location string      `json:"location"`
+	Update   interface{} `json:"update"`
+	Warn     bool        `json:"warn"`
+	Error    string      `json:"error,omitempty"`
+	Rollup   *Rollup     `json:"rollup,omitempty"` // Set on the hourly summaries left by compaction
+	Expires  int64       `json:"expires,omitempty"`
+}
+
+// WithHistory sets how many results are kept per task, 0 disables history
+func WithHistory(size int) Option {
+	return func(r *Runner) {
+		r.historySize = size
+	}
+}
+
+func (r *Runner) remember(t tasks.Task, result tasks.Result) {
+	rec := Record{
+		Date:     time.Now().UnixNano() / int64(time.Millisecond),
+		Location: result.Location,
+		Update:   result.Update,
+		Warn:     result.Warn,
+	}
+	if result.Error != nil {
+		rec.Error = result.Error.Error()
+	}
+	r.persistResult(t.ID, rec)
+	if r.historySize <= 0 {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	list := append(r.history[t.ID], rec)
+	if len(list) > r.historySize {
+		list = list[len(list)-r.historySize:]
+	}
+	r.history[t.ID] = list
+}
+
+// History gets the most recent results of a task, oldest first
+func (r *Runner) History(id string) []Record {
+	id = r.resolve(id)
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make([]Record, len(r.history[id]))
+	for i, rec := range r.history[id] {
+		rec.Update = deepCopy(rec.Update)
+		out[i] = rec
+	}
+	return out
+}
@@ -0,0 +1,298 @@
+// Package httpapi provides a REST admin API for a Runner.
+//
+// The handler serves the following routes relative to where it is mounted:
+//
+//	GET    /tasks                list tasks, see below for the filters
+//	POST   /tasks                add one task or an array of tasks (runner.Spec JSON)
+//	GET    /tasks/{id}           get a task with its last result
+//	DELETE /tasks/{id}           remove a task
+//	GET    /tasks/{id}/history   get the recent results of a task
+//	POST   /tasks/{id}/run       run a task immediately
+//	POST   /pause                pause task execution
+//	POST   /resume               resume task execution
+//	POST   /groups/{name}/pause  pause the tasks of a group
+//	POST   /groups/{name}/resume resume the tasks of a group
+//	POST   /groups/{name}/stop   stop the tasks of a group
+//	GET    /export               export the task definitions, see Runner.ExportTasks
+//
+// GET /tasks accepts the following query parameters, the number of matching tasks
+// before pagination is returned in the X-Total-Count header:
+//
+//	task=<type>                  task type
+//	label=<regexp>               label pattern
+//	tag=<tag>[,<tag>...]         carrying every one of these tags
+//	group=<name>                 group name
+//	state=<state>[,<state>...]   pending, ok, warning or failing
+//	warn=<bool>                  warn flag of the last result
+//	ran_within=<ISO8601>         last run at most this long ago
+//	not_run_for=<ISO8601>        last run at least this long ago, or never ran
+//	sort=<key>                   id, label, type or last_run
+//	order=desc                   reverse the order
+//	offset=<n>, limit=<n>        pagination
+//
+// Wrap the handler with RequireToken when it's reachable by others than the admins, the API
+// adds and removes tasks, which may run commands.
+package httpapi
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"pkg.goda.sh/runner/v2"
+)
+
+// maxBody is the largest request body accepted
+const maxBody = 1 << 20
+
+type handler struct {
+	r *runner.Runner
+}
+
+// Handler creates an http.Handler serving the admin API for r, mount it with http.StripPrefix
+func Handler(r *runner.Runner) http.Handler {
+	return &handler{r: r}
+}
+
+// RequireToken wraps an admin API handler so requests must carry token in an "Authorization:
+// Bearer" header, others are rejected with 401
+func RequireToken(token string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		got, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+		if !ok || token == "" || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="runner"`)
+			fail(w, http.StatusUnauthorized, errors.New("missing or wrong bearer token"))
+			return
+		}
+		h.ServeHTTP(w, req)
+	})
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	parts := strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+	switch {
+	case len(parts) == 1 && parts[0] == "tasks":
+		switch req.Method {
+		case http.MethodGet:
+			q, err := h.query(req.URL.Query())
+			if err != nil {
+				fail(w, http.StatusBadRequest, err)
+				return
+			}
+			res := h.r.Query(q)
+			w.Header().Set("X-Total-Count", strconv.Itoa(res.Total))
+			reply(w, http.StatusOK, res.Tasks)
+		case http.MethodPost:
+			h.add(w, req)
+		default:
+			methodNotAllowed(w, http.MethodGet, http.MethodPost)
+		}
+	case len(parts) == 2 && parts[0] == "tasks":
+		switch req.Method {
+		case http.MethodGet:
+			h.get(w, parts[1])
+		case http.MethodDelete:
+			if err := h.r.Remove(req.Context(), parts[1]); errors.Is(err, runner.ErrUnknownTask) {
+				fail(w, http.StatusNotFound, err)
+				return
+			} else if err != nil {
+				fail(w, http.StatusServiceUnavailable, err)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			methodNotAllowed(w, http.MethodGet, http.MethodDelete)
+		}
+	case len(parts) == 3 && parts[0] == "tasks" && parts[2] == "history":
+		if req.Method != http.MethodGet {
+			methodNotAllowed(w, http.MethodGet)
+			return
+		}
+		if _, ok := h.r.Task(parts[1]); !ok {
+			fail(w, http.StatusNotFound, runner.ErrUnknownTask)
+			return
+		}
+		reply(w, http.StatusOK, h.r.History(parts[1]))
+	case len(parts) == 3 && parts[0] == "tasks" && parts[2] == "run":
+		if req.Method != http.MethodPost {
+			methodNotAllowed(w, http.MethodPost)
+			return
+		}
+		switch err := h.r.RunNow(req.Context(), parts[1]); {
+		case err == nil:
+			w.WriteHeader(http.StatusAccepted)
+		case errors.Is(err, runner.ErrUnknownTask):
+			fail(w, http.StatusNotFound, err)
+		default:
+			fail(w, http.StatusConflict, err)
+		}
+	case len(parts) == 1 && (parts[0] == "pause" || parts[0] == "resume"):
+		if req.Method != http.MethodPost {
+			methodNotAllowed(w, http.MethodPost)
+			return
+		}
+		pause := h.r.Resume
+		if parts[0] == "pause" {
+			pause = h.r.Pause
+		}
+		if err := pause(req.Context()); err != nil {
+			fail(w, http.StatusServiceUnavailable, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case len(parts) == 3 && parts[0] == "groups":
+		if req.Method != http.MethodPost {
+			methodNotAllowed(w, http.MethodPost)
+			return
+		}
+		g := h.r.Group(parts[1])
+		var err error
+		switch parts[2] {
+		case "pause":
+			err = g.Pause(req.Context())
+		case "resume":
+			err = g.Resume(req.Context())
+		case "stop":
+			g.Stop()
+		default:
+			fail(w, http.StatusNotFound, errors.New("not found"))
+			return
+		}
+		if err != nil {
+			fail(w, http.StatusServiceUnavailable, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case len(parts) == 1 && parts[0] == "export":
+		if req.Method != http.MethodGet {
+			methodNotAllowed(w, http.MethodGet)
+			return
+		}
+		data, err := h.r.ExportTasks()
+		if err != nil {
+			fail(w, http.StatusInternalServerError, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	default:
+		fail(w, http.StatusNotFound, errors.New("not found"))
+	}
+}
+
+// query converts the parameters of GET /tasks into a runner.Query
+func (h *handler) query(v url.Values) (q runner.Query, err error) {
+	q.Type, q.Group = v.Get("task"), v.Get("group")
+	if label := v.Get("label"); label != "" {
+		if q.Label, err = regexp.Compile(label); err != nil {
+			return q, err
+		}
+	}
+	for _, tag := range strings.Split(v.Get("tag"), ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			q.Tags = append(q.Tags, tag)
+		}
+	}
+	for _, state := range strings.Split(v.Get("state"), ",") {
+		switch s := runner.State(strings.TrimSpace(state)); s {
+		case "":
+		case runner.StatePending, runner.StateOK, runner.StateWarning, runner.StateFailing:
+			q.States = append(q.States, s)
+		default:
+			return q, fmt.Errorf("unknown state %q", state)
+		}
+	}
+	if warn := v.Get("warn"); warn != "" {
+		b, err := strconv.ParseBool(warn)
+		if err != nil {
+			return q, err
+		}
+		q.Warn = &b
+	}
+	for name, d := range map[string]*time.Duration{"ran_within": &q.RanWithin, "not_run_for": &q.NotRunFor} {
+		if str := v.Get(name); str != "" {
+			if *d = h.r.ParseDuration(str); *d <= 0 {
+				return q, fmt.Errorf("bad %s duration %q", name, str)
+			}
+		}
+	}
+	switch key := runner.SortKey(v.Get("sort")); key {
+	case runner.SortInsertion, runner.SortID, runner.SortLabel, runner.SortType, runner.SortLastRun:
+		q.Sort = key
+	default:
+		return q, fmt.Errorf("unknown sort key %q", key)
+	}
+	q.Desc = strings.EqualFold(v.Get("order"), "desc")
+	for name, n := range map[string]*int{"offset": &q.Offset, "limit": &q.Limit} {
+		if str := v.Get(name); str != "" {
+			if *n, err = strconv.Atoi(str); err != nil || *n < 0 {
+				return q, fmt.Errorf("bad %s %q", name, str)
+			}
+		}
+	}
+	return q, nil
+}
+
+func (h *handler) add(w http.ResponseWriter, req *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(req.Body, maxBody))
+	if err != nil {
+		fail(w, http.StatusBadRequest, err)
+		return
+	}
+	var specs []runner.Spec
+	if body = bytes.TrimSpace(body); len(body) > 0 && body[0] == '[' {
+		err = json.Unmarshal(body, &specs)
+	} else {
+		specs = make([]runner.Spec, 1)
+		err = json.Unmarshal(body, &specs[0])
+	}
+	if err != nil {
+		fail(w, http.StatusBadRequest, err)
+		return
+	}
+	ids, err := h.r.AddSpecs(h.r.Context(), specs) // Tasks outlive the request
+	if errors.Is(err, runner.ErrInvalidTask) {
+		fail(w, http.StatusBadRequest, err)
+		return
+	} else if errors.Is(err, runner.ErrDuplicateTask) {
+		fail(w, http.StatusConflict, err)
+		return
+	} else if err != nil {
+		fail(w, http.StatusServiceUnavailable, err)
+		return
+	}
+	reply(w, http.StatusCreated, map[string][]string{"ids": ids})
+}
+
+func (h *handler) get(w http.ResponseWriter, id string) {
+	t, ok := h.r.Task(id)
+	if !ok {
+		fail(w, http.StatusNotFound, runner.ErrUnknownTask)
+		return
+	}
+	reply(w, http.StatusOK, t)
+}
+
+func reply(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func fail(w http.ResponseWriter, code int, err error) {
+	reply(w, code, map[string]string{"error": err.Error()})
+}
+
+func methodNotAllowed(w http.ResponseWriter, allowed ...string) {
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	fail(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+}
@@ -0,0 +1,56 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+)
+
+const (
+	// IdempotencyKeyPrefix is the prefix of the Store locks reserving idempotency keys
+	IdempotencyKeyPrefix = "runner:idempotency:"
+	// DefaultIdempotencyTTL is how long an idempotency key is remembered unless WithIdempotencyTTL is used
+	DefaultIdempotencyTTL = 24 * time.Hour
+)
+
+// ErrDuplicateSubmission is returned when a Spec's idempotency key was already used
+var ErrDuplicateSubmission = errors.New("runner: duplicate submission")
+
+// WithIdempotencyTTL sets how long idempotency keys are remembered
+func WithIdempotencyTTL(ttl time.Duration) Option {
+	return func(r *Runner) {
+		r.idempotencyTTL = ttl
+	}
+}
+
+// reserve claims an idempotency key for a submission. If the key was already claimed it
+// returns the value stored by the first submission along with ErrDuplicateSubmission.
+func (r *Runner) reserve(ctx context.Context, key, value string) (string, error) {
+	if key == "" {
+		return value, nil
+	}
+	if r.store == nil {
+		return "", ErrNoStore
+	}
+	ttl := r.idempotencyTTL
+	if ttl <= 0 {
+		ttl = DefaultIdempotencyTTL
+	}
+	existing, ok, err := r.store.Lock(ctx, r.ns(IdempotencyKeyPrefix+key), value, ttl)
+	if err != nil {
+		return "", err
+	} else if !ok {
+		return existing, ErrDuplicateSubmission
+	}
+	return value, nil
+}
+
+// release forgets an idempotency key after a submission failed
+func (r *Runner) release(ctx context.Context, key string) {
+	if key != "" && r.store != nil {
+		if err := r.store.Unlock(ctx, r.ns(IdempotencyKeyPrefix+key)); err != nil {
+			r.logf(slog.LevelError, "Could not release idempotency key %s: %v\n", key, err)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package runner
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"pkg.goda.sh/tasks"
+)
+
+// phrase matches intervals written out, like "every 5 minutes" or "hourly"
+var phrase = regexp.MustCompile(`(?i)^\s*(?:every\s+)?(?:(\d+(?:\.\d+)?|an?|one)\s*)?(s|secs?|seconds?|m|mins?|minutes?|h|hrs?|hours?|d|days?|w|weeks?)\s*$`)
+
+// phraseUnits maps the first letter of the unit of a phrase to its duration
+var phraseUnits = map[byte]time.Duration{
+	's': time.Second,
+	'm': time.Minute,
+	'h': time.Hour,
+	'd': 24 * time.Hour,
+	'w': 7 * 24 * time.Hour,
+}
+
+// DefaultInterval is how often tasks without an interval run unless WithDefaultInterval is used
+const DefaultInterval = time.Minute
+
+// WithDefaultInterval sets how often tasks without an interval run, or the interval of their
+// task type in byType. A zero interval rejects tasks without one with ErrInvalidTask.
+func WithDefaultInterval(d time.Duration, byType map[string]time.Duration) Option {
+	return func(r *Runner) {
+		r.types.Lock()
+		defer r.types.Unlock()
+		r.intervals = make(map[string]time.Duration, len(byType)+1)
+		r.intervals[""] = d
+		for typ, d := range byType {
+			r.intervals[strings.ToLower(typ)] = d
+		}
+	}
+}
+
+// interval gets how often a task runs
+func (r *Runner) interval(t tasks.Task) time.Duration {
+	if t.Interval != "" {
+		return r.ParseDuration(t.Interval)
+	}
+	return r.defaultInterval(t.Task)
+}
+
+// defaultInterval gets the interval of a task type for tasks without one
+func (r *Runner) defaultInterval(typ string) time.Duration {
+	r.types.RLock()
+	defer r.types.RUnlock()
+	if r.intervals == nil {
+		return DefaultInterval
+	}
+	d, ok := r.intervals[strings.ToLower(typ)]
+	if !ok {
+		d = r.intervals[""]
+	}
+	return d
+}
+
+// parseHumane parses Go durations ("90s", "2h30m") and phrases ("every 5 minutes", "daily")
+func parseHumane(str string) (time.Duration, bool) {
+	if d, err := time.ParseDuration(strings.TrimSpace(str)); err == nil {
+		return d, true
+	}
+	switch strings.ToLower(strings.TrimSpace(str)) {
+	case "hourly":
+		return time.Hour, true
+	case "daily":
+		return 24 * time.Hour, true
+	case "weekly":
+		return 7 * 24 * time.Hour, true
+	}
+	match := phrase.FindStringSubmatch(str)
+	if match == nil {
+		return 0, false
+	}
+	n := 1.0
+	if parsed, err := strconv.ParseFloat(match[1], 64); err == nil {
+		n = parsed
+	}
+	return time.Duration(n * float64(phraseUnits[strings.ToLower(match[2])[0]])), true
+}
+
+// normalizeInterval rewrites Go durations and phrases as ISO8601, leaving other intervals as is
+func normalizeInterval(str string) string {
+	d, ok := parseHumane(str)
+	if !ok || d <= 0 {
+		return str
+	}
+	var b strings.Builder
+	b.WriteString("P")
+	if days := d / (24 * time.Hour); days > 0 {
+		fmt.Fprintf(&b, "%dD", days)
+		d -= days * 24 * time.Hour
+	}
+	if d > 0 {
+		b.WriteString("T")
+		if hours := d / time.Hour; hours > 0 {
+			fmt.Fprintf(&b, "%dH", hours)
+			d -= hours * time.Hour
+		}
+		if minutes := d / time.Minute; minutes > 0 {
+			fmt.Fprintf(&b, "%dM", minutes)
+			d -= minutes * time.Minute
+		}
+		if d > 0 {
+			b.WriteString(strconv.FormatFloat(d.Seconds(), 'f', -1, 64) + "S")
+		}
+	}
+	return b.String()
+}
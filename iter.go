@@ -0,0 +1,66 @@
+package runner
+
+import (
+	"iter"
+	"strings"
+
+	"pkg.goda.sh/tasks"
+)
+
+// All iterates over the task list by ID in insertion order
+func (r *Runner) All() iter.Seq2[string, tasks.Task] {
+	return r.TaskList.All()
+}
+
+// Where iterates over the tasks matching pred
+func (r *Runner) Where(pred func(tasks.Task) bool) iter.Seq2[string, tasks.Task] {
+	return func(yield func(string, tasks.Task) bool) {
+		for id, t := range r.TaskList.All() {
+			if pred(t) && !yield(id, t) {
+				return
+			}
+		}
+	}
+}
+
+// OfType iterates over the tasks of a task type
+func (r *Runner) OfType(name string) iter.Seq2[string, tasks.Task] {
+	return r.Where(func(t tasks.Task) bool { return strings.EqualFold(t.Task, name) })
+}
+
+// Warning iterates over the tasks whose last result was a warning
+func (r *Runner) Warning() iter.Seq2[string, tasks.Task] {
+	return r.Where(func(t tasks.Task) bool { return t.Warn })
+}
+
+// Count gets the number of tasks
+func (r *Runner) Count() int {
+	return r.TaskList.Count()
+}
+
+// CountByType gets the number of tasks of each task type, keyed by lowercase type
+func (r *Runner) CountByType() map[string]int {
+	out := make(map[string]int)
+	for _, t := range r.All() {
+		out[strings.ToLower(t.Task)]++
+	}
+	return out
+}
+
+// Get looks a task up by ID
+func (r *Runner) Get(id string) (tasks.Task, bool) {
+	t, ok := r.find(id)
+	return copyTask(t), ok
+}
+
+// Task gets a snapshot of a task and its last result output
+func (r *Runner) Task(id string) (tasks.CleanTask, bool) {
+	t, ok := r.find(id)
+	if !ok {
+		return tasks.CleanTask{}, false
+	}
+	if t.Last == nil {
+		t.Last = struct{}{}
+	}
+	return tasks.CleanTask(copyTask(t)), true
+}
@@ -0,0 +1,81 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"log/slog"
+	"strings"
+	"sync/atomic"
+)
+
+// WithLogger routes the messages of the Runner, its WAL and its Transport through l with
+// levels, nil silences them. Without it, messages go to the standard log package.
+func WithLogger(l *slog.Logger) Option {
+	return func(r *Runner) {
+		if l == nil {
+			l = slog.New(discard{})
+		}
+		r.logger = l
+	}
+}
+
+// Logger gets the logger messages of the Runner go through, slog.Default when WithLogger isn't
+// set, for the task types and helpers built on top of it
+func (r *Runner) Logger() *slog.Logger {
+	if r.logger == nil {
+		return slog.Default()
+	}
+	return r.logger
+}
+
+// logf logs a message through the logger of the Runner
+func (r *Runner) logf(level slog.Level, format string, args ...interface{}) {
+	logf(r.logger, level, format, args...)
+}
+
+// setLoggers hands the logger of the Runner to its WAL and Transport, those with a SetLogger
+// method
+func (r *Runner) setLoggers() {
+	if r.logger == nil {
+		return
+	}
+	for _, v := range []interface{}{r.wal, r.transport} {
+		if l, ok := v.(interface{ SetLogger(*slog.Logger) }); ok {
+			l.SetLogger(r.logger)
+		}
+	}
+}
+
+func logf(l *slog.Logger, level slog.Level, format string, args ...interface{}) {
+	if l == nil {
+		log.Printf(format, args...)
+		return
+	}
+	if !l.Enabled(context.Background(), level) {
+		return
+	}
+	l.Log(context.Background(), level, strings.TrimSuffix(fmt.Sprintf(format, args...), "\n"))
+}
+
+// logs is embedded by the types the Runner hands its logger to
+type logs struct {
+	logger atomic.Pointer[slog.Logger]
+}
+
+// SetLogger sets the logger messages go through, the Runner sets its own, see WithLogger
+func (l *logs) SetLogger(logger *slog.Logger) {
+	l.logger.Store(logger)
+}
+
+func (l *logs) logf(level slog.Level, format string, args ...interface{}) {
+	logf(l.logger.Load(), level, format, args...)
+}
+
+// discard is a slog.Handler dropping every record
+type discard struct{}
+
+func (discard) Enabled(context.Context, slog.Level) bool  { return false }
+func (discard) Handle(context.Context, slog.Record) error { return nil }
+func (d discard) WithAttrs([]slog.Attr) slog.Handler      { return d }
+func (d discard) WithGroup(string) slog.Handler           { return d }
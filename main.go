@@ -1,21 +1,16 @@
 package runner
 
 import (
-	"bytes"
 	"context"
-	"crypto/md5"
-	"encoding/gob"
 	"fmt"
-	"log"
+	"log/slog"
 	"regexp"
 	"strconv"
-	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/google/uuid"
 	"pkg.goda.sh/tasks"
-	"pkg.goda.sh/utils"
 )
 
 var (
@@ -34,120 +29,375 @@ var (
 
 // Identity describes the server
 type Identity struct {
-	MachineID string `json:"id"`
-	Location  string `json:"location"`
+	MachineID string   `json:"id"`
+	Location  string   `json:"location"`
+	Tags      []string `json:"tags,omitempty"` // Node capabilities (ex. gpu, behind-vpn, arm64) matched by Constraints
 }
 
-// Runner describes the job runner instance
+// Runner describes the job runner instance.
+//
+// Values handed out by the Runner are owned by the caller: tasks and results passed to
+// OnResult, tag routes and listeners, and the tasks, records and specs it returns are deep
+// copies that can be changed freely. The iterators yield the values of the task list itself
+// to avoid copying, these must not be changed.
 type Runner struct {
-	RedisControl  tasks.Redis
-	Identity      Identity
-	TaskList      *utils.OrderedItems
-	Paused        bool
-	cancellations []context.CancelFunc
-	OnResult      func(tasks.Task, tasks.Result)
-	mu            sync.Mutex
+	RedisControl     tasks.Redis // Handed to the task functions, see WithTaskRedis
+	Identity         Identity
+	TaskList         *OrderedMap[string, tasks.Task]
+	halted           atomic.Bool                    // Set by Pause, read by the ticker loops
+	cancellations    []context.CancelFunc           // Of the background loops, tasks are cancelled through cancels
+	OnResult         func(tasks.Task, tasks.Result) // Receives copies it owns
+	transport        Transport
+	queue            Queue
+	aggregates       map[string]*Aggregate
+	keys             map[string]string
+	specs            map[string]Spec
+	nodes            map[string]Node
+	peers            map[string]PeerState
+	rounds           map[string]*gossipRound
+	cancels          map[string]context.CancelFunc
+	triggers         map[string]chan struct{}
+	listeners        map[chan Event]struct{}
+	history          map[string][]Record
+	historySize      int
+	limiter          Limiter
+	limitKey         func(tasks.Task) string
+	idempotencyTTL   time.Duration
+	namespace        string
+	wal              WAL
+	store            Store
+	schedules        map[string]Schedule
+	checkpointEvery  time.Duration
+	catchUpPolicy    CatchUp
+	backlog          map[string]int
+	deadLetterPolicy *DeadLetterPolicy
+	failing          map[string]*failures
+	dead             map[string]DeadLetter
+	versions         map[string][]Version
+	cipher           Cipher
+	gcRetention      time.Duration
+	gcEvery          time.Duration
+	mirrorTo         Mirror
+	compaction       map[string]Compaction
+	compactEvery     time.Duration
+	hashVersion      HashVersion
+	hashFrom         []HashVersion
+	hashAlg          HashAlgorithm
+	hashFields       []HashField
+	aliases          map[string]string
+	resultTTL        map[string]time.Duration
+	replaying        bool
+	stopping         bool // Set by Stop, tasks it cancels stay in the WAL
+	funcs            map[string]TaskFunc
+	pausedTags       map[string]bool
+	groups           map[string]*group
+	templates        map[string]Template
+	intervals        map[string]time.Duration
+	sinks            map[string]*sink
+	watchers         map[*watcher]struct{}
+	schemas          map[string]ParamSchema
+	timerless        map[string]bool
+	secrets          []SecretResolver
+	parallelism      int
+	logger           *slog.Logger
+	routes           map[string][]func(tasks.Task, tasks.Result)
+	ctx              context.Context
+	mu               sync.RWMutex // Guards the maps above, the task list has its own lock
+	types            sync.RWMutex // Guards funcs, schemas, intervals and timerless, see Register
 }
 
 // NewRunner creates a job runner instance
-func NewRunner(id Identity, list []tasks.Task, rc tasks.Redis, OnResult func(tasks.Task, tasks.Result), paused bool) *Runner {
-	return (&Runner{
-		RedisControl:  rc,
+func NewRunner(id Identity, list []tasks.Task, OnResult func(tasks.Task, tasks.Result), paused bool, opts ...Option) *Runner {
+	r := &Runner{
 		Identity:      id,
-		TaskList:      utils.NewOrderedMap(),
-		Paused:        paused,
+		TaskList:      NewOrderedMap[string, tasks.Task](),
 		cancellations: make([]context.CancelFunc, 0),
 		OnResult:      OnResult,
-		mu:            sync.Mutex{},
-	}).AddTasks(list)
+		aggregates:    make(map[string]*Aggregate),
+		keys:          make(map[string]string),
+		specs:         make(map[string]Spec),
+		nodes:         make(map[string]Node),
+		peers:         make(map[string]PeerState),
+		rounds:        make(map[string]*gossipRound),
+		cancels:       make(map[string]context.CancelFunc),
+		triggers:      make(map[string]chan struct{}),
+		listeners:     make(map[chan Event]struct{}),
+		history:       make(map[string][]Record),
+		historySize:   DefaultHistorySize,
+		schedules:     make(map[string]Schedule),
+		backlog:       make(map[string]int),
+		failing:       make(map[string]*failures),
+		dead:          make(map[string]DeadLetter),
+		versions:      make(map[string][]Version),
+		aliases:       make(map[string]string),
+		groups:        make(map[string]*group),
+		hashVersion:   HashV1,
+		ctx:           context.Background(),
+	}
+	r.halted.Store(paused)
+	for _, opt := range opts {
+		opt(r)
+	}
+	r.setLoggers()
+	if err := r.migrate(context.Background()); err != nil {
+		r.logf(slog.LevelError, "Not using the store: %v\n", err) // Writing to state we can't read would corrupt it
+		r.store = nil
+	}
+	if done := r.ctx.Done(); done != nil {
+		go func() {
+			<-done
+			r.Stop()
+		}()
+	}
+	r.resetMirror()
+	r.replaying = true
+	if err := r.AddTasks(r.ctx, list); err != nil {
+		r.logf(slog.LevelWarn, "Skipping tasks: %v\n", err)
+	}
+	r.replay()
+	r.compactWAL()
+	r.restore()
+	r.restoreDeadLetters()
+	r.replaying = false
+	r.catchUp()
+	r.startCheckpoints()
+	r.startHeartbeats()
+	r.startGC()
+	r.startCompaction()
+	r.startSinks()
+	return r
+}
+
+// Context gets the lifecycle context of the Runner, see WithContext. Use it to add tasks
+// that should outlive the request adding them.
+func (r *Runner) Context() context.Context {
+	return r.ctx
 }
 
-// AddTasks adds a slice of tasks to the Runner
-func (r *Runner) AddTasks(list []tasks.Task) *Runner {
+// AddTasks adds a slice of tasks to the Runner. Every valid task is added, the others are
+// reported in a TaskErrors.
+func (r *Runner) AddTasks(ctx context.Context, list []tasks.Task) error {
+	var errs TaskErrors
 	for _, t := range list {
 		t.Location = r.Identity.Location
-		r.Add(t)
+		if err := r.Add(ctx, t); err != nil {
+			errs = append(errs, err)
+		}
 	}
-	return r
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// Add adds a job to the queue. The task is cancelled and removed from the task list once ctx
+// is done. Tasks of an unknown type or with a bad interval return ErrInvalidTask and tasks
+// already in the list ErrDuplicateTask.
+func (r *Runner) Add(ctx context.Context, t tasks.Task) error {
+	return r.add(ctx, t, Spec{})
 }
 
-// Add adds a job to the queue
-func (r *Runner) Add(t tasks.Task) *Runner {
-	t.ID = r.Hash(t) // Hash the task for SSE + remote tasks
-	ctx, cancel := context.WithCancel(context.Background())
-	t.CTX = ctx
+func (r *Runner) add(ctx context.Context, t tasks.Task, spec Spec) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	fn, ok := r.lookup(t.Task)
+	if !ok {
+		return fmt.Errorf("%w: unknown task type %q", ErrInvalidTask, t.Task)
+	}
+	t.Interval = normalizeInterval(t.Interval) // Stored as hashed, see hashWith
+	key := r.FleetKey(t)
+	spec = spec.clone() // The caller keeps its maps
+	spec.CleanTask = definition(t)
+	if err := r.validate(spec); err != nil {
+		return fmt.Errorf("%q: %w", t.Label, err)
+	}
+	t.ID = r.Hash(t) // Hash the task for watchers + remote tasks
+	r.alias(tasks.Task(spec.CleanTask), t.ID)
+	ctx, cancel := context.WithCancel(ctx)
+	t.CTX = r.withSecrets(withParams(ctx, spec.Params))
 	t.Cancel = func() bool {
 		cancel()
 		select {
 		case <-t.CTX.Done():
 			return true
 		default:
-			log.Printf("Could not cancel %v (%s/%s)\n", t.Label, t.Task, t.ID)
+			r.logf(slog.LevelError, "Could not cancel %v (%s/%s)\n", t.Label, t.Task, t.ID)
 			return false
 		}
 	}
-	r.cancellations = append(r.cancellations, cancel)
-	if typ, ok := tasks.TaskRunners[strings.ToLower(t.Task)]; ok {
-		if tasks.Timerless(t.Task) {
-			result := typ.Func(&tasks.TaskArgs{
-				Task: r.TaskList.Add(t.ID, t).(tasks.Task),
-				Callback: func(result tasks.Result) {
-					t.Last = result.Update
-					t.Warn = result.Warn
-					t.Spark = result.Spark
-					t.Date = time.Now().UnixNano() / int64(time.Millisecond)
-					result.Location = r.Identity.Location
-					r.OnResult(r.TaskList.Update(t.ID, t).(tasks.Task), result)
-				},
-				Redis: r.RedisControl,
-			})
-			if result.Error != nil {
-				log.Printf("%s returned an error: %q - deleted: %v", t.Task, result.Error, r.TaskList.Del(t.ID))
-			}
-		} else {
-			go func(t tasks.Task, duration time.Duration) bool {
-				interval := time.Duration(250 * time.Millisecond)
-				if t.Interval != "" {
-					interval = r.ParseDuration(t.Interval)
+	trigger := make(chan struct{}, 1)
+	r.mu.Lock()
+	if _, exists := r.cancels[t.ID]; exists {
+		r.mu.Unlock()
+		cancel()
+		return fmt.Errorf("%w: %q (%s/%s)", ErrDuplicateTask, t.Label, t.Task, t.ID)
+	}
+	r.keys[t.ID] = key
+	r.specs[t.ID] = spec
+	r.cancels[t.ID] = cancel
+	r.triggers[t.ID] = trigger
+	r.mu.Unlock()
+	r.logMutation(WALAdd, t.ID, &spec)
+	r.persistTask(t.ID, spec)
+	r.mirror(t)
+	r.notify(TaskAdded, t, tasks.Result{})
+	if r.Timerless(t.Task) {
+		result := fn(&tasks.TaskArgs{
+			Task: r.TaskList.Add(t.ID, t),
+			Callback: func(result tasks.Result) {
+				t = r.record(t, result)
+			},
+			Redis: r.RedisControl,
+		})
+		if result.Error != nil {
+			r.logf(slog.LevelError, "%s returned an error: %q - deleted: %v", t.Task, result.Error, r.unlist(t.ID))
+			r.unmirror(t.ID)
+		}
+		go func() {
+			<-ctx.Done()
+			r.forget(t.ID, trigger)
+		}()
+	} else {
+		go func(t tasks.Task, duration time.Duration) bool {
+			interval := r.interval(t)
+			ticker := time.NewTicker(duration)
+			r.scheduled(t.ID, time.Time{}, time.Now().Add(duration))
+			run := func() {
+				if !r.allow(t) {
+					return
 				}
-				ticker := time.NewTicker(duration)
-				for {
-					select {
-					case <-ticker.C:
-						if r.Paused {
-							ticker.Reset(duration + (5 * time.Second))
-							continue
-						}
-						ticker.Reset(interval)
-						if result := typ.Func(&tasks.TaskArgs{
-							Task:  t,
-							Stop:  func() { ticker.Stop() },
-							Redis: r.RedisControl,
-						}); !result.Cancelled {
-							t.Last = result.Update
-							t.Warn = result.Warn
-							t.Spark = result.Spark
-							t.Date = time.Now().UnixNano() / int64(time.Millisecond)
-							result.Location = r.Identity.Location
-							r.OnResult(r.TaskList.Update(t.ID, t).(tasks.Task), result)
+				release, ok := r.acquire(t)
+				if !ok {
+					return
+				}
+				defer release()
+				if result := fn(&tasks.TaskArgs{
+					Task:  t,
+					Stop:  func() { ticker.Stop() },
+					Redis: r.RedisControl,
+				}); !result.Cancelled {
+					t = r.record(t, result)
+				}
+			}
+			for {
+				select {
+				case <-ticker.C:
+					if r.paused(t.ID) {
+						ticker.Reset(duration + (5 * time.Second))
+						r.scheduled(t.ID, time.Time{}, time.Now().Add(duration+(5*time.Second)))
+						continue
+					}
+					ticker.Reset(interval)
+					r.scheduled(t.ID, time.Now(), time.Now().Add(interval))
+					run()
+				case <-trigger:
+					run()
+					if r.takeBacklog(t.ID) {
+						select {
+						case trigger <- struct{}{}:
+						default: // A run is already pending
 						}
-					case <-t.CTX.Done():
-						log.Printf("Removing %q (%s/%s) from task list.\n", t.Label, t.ID, t.Task)
-						ticker.Stop()
-						return r.TaskList.Del(t.ID)
 					}
+				case <-t.CTX.Done():
+					r.logf(slog.LevelInfo, "Removing %q (%s/%s) from task list.\n", t.Label, t.ID, t.Task)
+					ticker.Stop()
+					return r.forget(t.ID, trigger)
 				}
-			}(r.TaskList.Add(t.ID, t).(tasks.Task), time.Duration(r.TaskList.Count())*time.Second)
-		}
-	} else {
-		log.Printf("skipping invalid task: %s", t.Task)
+			}
+		}(r.TaskList.Add(t.ID, t), time.Duration(r.TaskList.Count())*time.Second)
 	}
-	return r
+	return nil
 }
 
-// ParseDuration converts ISO8601 to time.Duration
-func (r *Runner) ParseDuration(str string) (duration time.Duration) {
+// forget drops a task whose context is done from the task list and the Runner's state,
+// unless it was removed or replaced by a task with the same ID in the meantime, and removes
+// it from the WAL and Store as Remove does
+func (r *Runner) forget(id string, trigger chan struct{}) bool {
+	r.mu.Lock()
+	if current, ok := r.triggers[id]; !ok || current != trigger {
+		r.mu.Unlock()
+		return false
+	}
+	logRemoval := !r.stopping && r.ctx.Err() == nil // Tasks of a stopped Runner are restored on start
+	delete(r.cancels, id)
+	delete(r.triggers, id)
+	delete(r.keys, id)
+	delete(r.specs, id)
+	delete(r.schedules, id)
+	delete(r.backlog, id)
+	delete(r.failing, id)
+	t, _ := r.TaskList.Get(id)
+	listed := r.TaskList.Del(id) // Before a task with the same ID can be added again
+	r.mu.Unlock()
+	if logRemoval {
+		r.logMutation(WALRemove, id, nil)
+		r.unpersistTask(id)
+	}
+	r.unmirror(id)
+	if listed {
+		r.notify(TaskRemoved, t, tasks.Result{})
+	}
+	return listed
+}
+
+// unlist deletes a task from the task list and notifies watchers
+func (r *Runner) unlist(id string) bool {
+	t, _ := r.TaskList.Get(id)
+	if !r.TaskList.Del(id) {
+		return false
+	}
+	r.notify(TaskRemoved, t, tasks.Result{})
+	return true
+}
+
+// record stores a result on its task in the task list and delivers it
+func (r *Runner) record(t tasks.Task, result tasks.Result) tasks.Task {
+	t, result = r.apply(t, result)
+	t = r.TaskList.Update(t.ID, t)
+	r.mirror(t)
+	r.notify(TaskUpdated, t, result)
+	r.deliver(t, result)
+	r.settle(t, result)
+	return t
+}
+
+// apply copies a result onto its task
+func (r *Runner) apply(t tasks.Task, result tasks.Result) (tasks.Task, tasks.Result) {
+	result = redact(t, result)
+	t.Last = result.Update
+	t.Warn = result.Warn
+	t.Spark = result.Spark
+	t.Date = time.Now().UnixNano() / int64(time.Millisecond)
+	result.Location = r.Identity.Location
+	return t, result
+}
+
+// deliver hands a result to OnResult, listeners and other runners
+func (r *Runner) deliver(t tasks.Task, result tasks.Result) {
+	r.remember(t, result)
+	r.track(t, result)
+	r.OnResult(copyTask(t), copyResult(result))
+	r.route(t, result)
+	r.sink(t, result)
+	r.publish(t, result)
+	r.emit(Event{Task: tasks.CleanTask(t), Result: result})
+}
+
+// ParseDuration converts ISO8601, Go durations ("90s") and phrases ("every 5 minutes") to
+// time.Duration
+func (r *Runner) ParseDuration(str string) time.Duration {
+	return parseDuration(str)
+}
+
+func parseDuration(str string) (duration time.Duration) {
+	if d, ok := parseHumane(str); ok {
+		return d
+	}
 	match := ISO8601.FindStringSubmatch(str)
+	if match == nil {
+		return 0
+	}
 	for i, name := range ISO8601.SubexpNames() {
 		if l := len(match[i]); l > 0 {
 			if parsed, err := strconv.ParseFloat(match[i][:l-1], 64); err == nil {
@@ -160,51 +410,63 @@ func (r *Runner) ParseDuration(str string) (duration time.Duration) {
 
 // Tasks gets a list of current tasks and their last result output
 func (r *Runner) Tasks(name string) (out []tasks.CleanTask) {
-	for task := range r.TaskList.Iter() {
-		t := task.Value.(tasks.Task)
+	seq := r.All()
+	if len(name) > 0 {
+		seq = r.OfType(name)
+	}
+	for _, t := range seq {
 		if t.Last == nil {
 			t.Last = struct{}{}
 		}
-		if len(name) == 0 || strings.EqualFold(t.Task, name) {
-			out = append(out, tasks.CleanTask(t))
-		}
+		out = append(out, tasks.CleanTask(copyTask(t)))
 	}
 	return out
 }
 
-// Pause temporarily pauses task execution
-func (r *Runner) Pause() {
-	r.mu.Lock()
-	r.Paused = true
-	r.mu.Unlock()
+// Pause temporarily pauses task execution, unless ctx is already done
+func (r *Runner) Pause(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.halted.Store(true)
+	return nil
 }
 
-// Resume restarts task execution
-func (r *Runner) Resume() {
-	r.mu.Lock()
-	r.Paused = false
-	r.mu.Unlock()
+// Resume restarts task execution, unless ctx is already done
+func (r *Runner) Resume(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.halted.Store(false)
+	return nil
+}
+
+// Paused reports whether task execution is paused, see Pause
+func (r *Runner) Paused() bool {
+	return r.halted.Load()
 }
 
 // Stop cancels all running tasks
 func (r *Runner) Stop() {
-	for _, cancel := range r.cancellations {
+	r.mu.Lock()
+	r.stopping = true
+	cancels := make([]context.CancelFunc, 0, len(r.cancels)+len(r.cancellations))
+	for _, cancel := range r.cancels {
+		cancels = append(cancels, cancel)
+	}
+	cancels = append(cancels, r.cancellations...)
+	r.mu.Unlock()
+	for _, cancel := range cancels {
 		cancel()
 	}
 }
 
 // Hash generates a unique ID based on a task struct
 func (r *Runner) Hash(t tasks.Task) string {
-	var b bytes.Buffer
-	if err := gob.NewEncoder(&b).Encode(tasks.Hash{
-		Label:    t.Label,
-		Interval: t.Interval,
-		Task:     t.Task,
-		ID:       t.ID,
-		Once:     t.Once,
-		Machine:  r.Identity.MachineID, // Use the MachineID to create a unique hash per node
-	}); err == nil {
-		return fmt.Sprintf("%x", md5.Sum(b.Bytes()))
-	}
-	return fmt.Sprintf("%s-%s", r.Identity.MachineID, uuid.Must(uuid.NewRandom()).String()) // Return MachineID + UUIDv4 if gob encoder fails
+	return r.hash(t, r.Identity.MachineID) // Use the MachineID to create a unique hash per node
+}
+
+// FleetKey generates an ID for a task that is shared by every node running the same definition
+func (r *Runner) FleetKey(t tasks.Task) string {
+	return r.hash(t, "")
 }
@@ -0,0 +1,135 @@
+package runner_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"pkg.goda.sh/runner/v2"
+	"pkg.goda.sh/runner/v2/runnertest"
+	"pkg.goda.sh/tasks"
+)
+
+func TestRemovedTaskAddedAgainStaysListed(t *testing.T) {
+	ctx := context.Background()
+	r, _ := runnertest.New(t, map[string]*runnertest.Script{"probe": runnertest.NewScript()})
+	specs := make(map[string]runner.Spec)
+	for i := 0; i < 8; i++ {
+		spec := r.NewTask("probe").Label(fmt.Sprint("gateway-", i)).Interval("PT1M").MustBuild()
+		if err := r.AddSpec(ctx, spec); err != nil {
+			t.Fatal(err)
+		}
+		specs[spec.Label] = spec
+	}
+	var wg sync.WaitGroup
+	for _, task := range r.Tasks("probe") {
+		id, spec := task.ID, specs[task.Label]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 500; i++ {
+				if err := r.Remove(ctx, id); err != nil {
+					t.Errorf("run %d: %s wasn't running", i, id)
+					return
+				}
+				if err := r.AddSpec(ctx, spec); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+			time.Sleep(50 * time.Millisecond) // Lets the goroutines of the removed tasks end
+			if _, ok := r.Get(id); !ok {
+				t.Errorf("%s was unlisted by a task removed before it was added again", id)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestStopWhileAddingTasks(t *testing.T) {
+	ctx := context.Background()
+	r, _ := runnertest.New(t, map[string]*runnertest.Script{"probe": runnertest.NewScript()})
+	added := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 200; i++ {
+			if err := r.AddSpec(ctx, r.NewTask("probe").Label(fmt.Sprint("probe-", i)).Interval("PT1M").MustBuild()); err != nil {
+				t.Error(err)
+				return
+			}
+			if i == 100 {
+				close(added)
+			}
+		}
+	}()
+	<-added
+	r.Stop()
+	<-done
+	r.Stop() // Again, for the tasks added after the first Stop
+	deadline := time.Now().Add(5 * time.Second)
+	for len(r.Tasks("probe")) > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := len(r.Tasks("probe")); n > 0 {
+		t.Errorf("%d tasks still running after Stop", n)
+	}
+}
+
+func TestAddSpecsAddsAllOrNone(t *testing.T) {
+	ctx := context.Background()
+	r, _ := runnertest.New(t, map[string]*runnertest.Script{"probe": runnertest.NewScript()})
+	gateway := r.NewTask("probe").Label("gateway").Interval("PT1M").MustBuild()
+	for _, c := range []struct {
+		name  string
+		specs []runner.Spec
+		want  error
+	}{
+		{"invalid", []runner.Spec{gateway, {CleanTask: tasks.CleanTask{Label: "api", Task: "probe", Interval: "soon"}}}, runner.ErrInvalidTask},
+		{"unknown type", []runner.Spec{gateway, {CleanTask: tasks.CleanTask{Label: "api", Task: "missing", Interval: "PT1M"}}}, runner.ErrInvalidTask},
+		{"twice", []runner.Spec{gateway, gateway}, runner.ErrDuplicateTask},
+	} {
+		if _, err := r.AddSpecs(ctx, c.specs); !errors.Is(err, c.want) {
+			t.Errorf("%s: got %v, want %v", c.name, err, c.want)
+		}
+		if n := len(r.Tasks("probe")); n > 0 {
+			t.Errorf("%s: %d tasks added from a failed batch", c.name, n)
+		}
+	}
+	ids, err := r.AddSpecs(ctx, []runner.Spec{gateway, r.NewTask("probe").Label("api").Interval("PT1M").MustBuild()})
+	if err != nil || len(ids) != 2 {
+		t.Fatalf("got %v, %v, want 2 tasks added", ids, err)
+	}
+	for _, id := range ids {
+		if _, ok := r.Get(id); !ok {
+			t.Errorf("%s wasn't added", id)
+		}
+	}
+	if _, err := r.AddSpecs(ctx, []runner.Spec{r.NewTask("probe").Label("db").Interval("PT1M").MustBuild(), gateway}); !errors.Is(err, runner.ErrDuplicateTask) || len(r.Tasks("probe")) != 2 {
+		t.Errorf("got %v and %d tasks, want ErrDuplicateTask and none added", err, len(r.Tasks("probe")))
+	}
+}
+
+func TestRemoveUnknownTask(t *testing.T) {
+	ctx := context.Background()
+	r, _ := runnertest.New(t, map[string]*runnertest.Script{"probe": runnertest.NewScript()})
+	spec := r.NewTask("probe").Label("gateway").Interval("PT1M").MustBuild()
+	if err := r.AddSpec(ctx, spec); err != nil {
+		t.Fatal(err)
+	}
+	id := r.Tasks("probe")[0].ID
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := r.Remove(cancelled, id); !errors.Is(err, context.Canceled) || len(r.Tasks("probe")) != 1 {
+		t.Errorf("got %v, want the task kept with a done context", err)
+	}
+	if err := r.Remove(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Remove(ctx, id); !errors.Is(err, runner.ErrUnknownTask) {
+		t.Errorf("got %v removing a removed task, want ErrUnknownTask", err)
+	}
+}
@@ -0,0 +1,251 @@
+package runner
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+var (
+	_ Store           = (*MemoryStore)(nil)
+	_ DeadLetterStore = (*MemoryStore)(nil)
+	_ MachineStore    = (*MemoryStore)(nil)
+	_ ResultCompactor = (*MemoryStore)(nil)
+	_ SchemaStore     = (*MemoryStore)(nil)
+)
+
+// MemoryStore is a Store kept in memory, for tests and runners that don't need to survive restarts
+type MemoryStore struct {
+	tasks     map[string]StoredTask
+	schedules map[string]Schedule
+	results   map[string][]Record
+	locks     map[string]memoryLock
+	dead      map[string]DeadLetter
+	seen      map[string]int64
+	schema    int
+	mu        sync.Mutex
+}
+
+type memoryLock struct {
+	value   string
+	expires time.Time
+}
+
+// NewMemoryStore creates an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		tasks:     make(map[string]StoredTask),
+		schedules: make(map[string]Schedule),
+		results:   make(map[string][]Record),
+		locks:     make(map[string]memoryLock),
+		dead:      make(map[string]DeadLetter),
+		seen:      make(map[string]int64),
+	}
+}
+
+// SaveTask stores a task definition
+func (s *MemoryStore) SaveTask(ctx context.Context, t StoredTask) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tasks[t.ID] = t
+	return nil
+}
+
+// DeleteTask removes a task definition along with its schedule and results
+func (s *MemoryStore) DeleteTask(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.tasks, id)
+	delete(s.schedules, id)
+	delete(s.results, id)
+	return nil
+}
+
+// LoadTasks gets every task stored for a MachineID
+func (s *MemoryStore) LoadTasks(ctx context.Context, machine string) (out []StoredTask, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, t := range s.tasks {
+		if t.Machine == machine {
+			out = append(out, t)
+		}
+	}
+	return out, nil
+}
+
+// SaveSchedule stores the schedule state of a task
+func (s *MemoryStore) SaveSchedule(ctx context.Context, id string, sched Schedule) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.schedules[id] = sched
+	return nil
+}
+
+// LoadSchedules gets the stored schedule state of the given tasks
+func (s *MemoryStore) LoadSchedules(ctx context.Context, ids []string) (map[string]Schedule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make(map[string]Schedule)
+	for _, id := range ids {
+		if sched, ok := s.schedules[id]; ok {
+			out[id] = sched
+		}
+	}
+	return out, nil
+}
+
+// SaveResult stores a result, keeping at most keep results per task
+func (s *MemoryStore) SaveResult(ctx context.Context, id string, rec Record, keep int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var list []Record
+	for _, old := range s.results[id] {
+		if !old.Expired(time.Now()) {
+			list = append(list, old)
+		}
+	}
+	list = append(list, rec)
+	if len(list) > keep {
+		list = append([]Record(nil), list[len(list)-keep:]...)
+	}
+	s.results[id] = list
+	return nil
+}
+
+// Results gets up to limit of the most recent results of a task, oldest first
+func (s *MemoryStore) Results(ctx context.Context, id string, limit int) ([]Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var list []Record
+	for _, rec := range s.results[id] {
+		if !rec.Expired(time.Now()) {
+			list = append(list, rec)
+		}
+	}
+	if len(list) > limit {
+		list = list[len(list)-limit:]
+	}
+	return list, nil
+}
+
+// Lock claims a key unless it is held and not expired
+func (s *MemoryStore) Lock(ctx context.Context, key, value string, ttl time.Duration) (string, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if l, ok := s.locks[key]; ok && time.Now().Before(l.expires) {
+		return l.value, false, nil
+	}
+	s.locks[key] = memoryLock{value: value, expires: time.Now().Add(ttl)}
+	return value, true, nil
+}
+
+// Unlock releases a key
+func (s *MemoryStore) Unlock(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.locks, key)
+	return nil
+}
+
+// SaveDeadLetter stores a dead letter
+func (s *MemoryStore) SaveDeadLetter(ctx context.Context, d DeadLetter) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dead[d.ID] = d
+	return nil
+}
+
+// DeleteDeadLetter removes a dead letter
+func (s *MemoryStore) DeleteDeadLetter(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.dead, id)
+	return nil
+}
+
+// LoadDeadLetters gets every dead letter
+func (s *MemoryStore) LoadDeadLetters(ctx context.Context) (out []DeadLetter, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, d := range s.dead {
+		out = append(out, d)
+	}
+	return out, nil
+}
+
+// SaveHeartbeat stores when a machine was last seen
+func (s *MemoryStore) SaveHeartbeat(ctx context.Context, machine string, seen int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seen[machine] = seen
+	return nil
+}
+
+// Machines gets every machine with stored tasks and when it was last active
+func (s *MemoryStore) Machines(ctx context.Context) (map[string]int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make(map[string]int64)
+	for _, t := range s.tasks {
+		if active := max64(t.Updated, s.seen[t.Machine]); active > out[t.Machine] {
+			out[t.Machine] = active
+		}
+	}
+	return out, nil
+}
+
+// DeleteMachine removes the state of a machine
+func (s *MemoryStore) DeleteMachine(ctx context.Context, machine string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, t := range s.tasks {
+		if t.Machine == machine {
+			delete(s.tasks, id)
+			delete(s.schedules, id)
+			delete(s.results, id)
+		}
+	}
+	delete(s.seen, machine)
+	return nil
+}
+
+func max64(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// CompactResults rewrites the stored results of a task while holding the lock
+func (s *MemoryStore) CompactResults(ctx context.Context, id string, limit int, fn func([]Record) ([]Record, bool)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var list []Record
+	for _, rec := range s.results[id] {
+		if !rec.Expired(time.Now()) {
+			list = append(list, rec)
+		}
+	}
+	if len(list) > limit {
+		list = list[len(list)-limit:]
+	}
+	if recs, changed := fn(list); changed {
+		s.results[id] = append([]Record(nil), recs...)
+	}
+	return nil
+}
+
+// SchemaVersion gets the version of the stored state
+func (s *MemoryStore) SchemaVersion(ctx context.Context) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.schema, nil
+}
+
+// SetSchemaVersion records the version of the stored state
+func (s *MemoryStore) SetSchemaVersion(ctx context.Context, v int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.schema = v
+	return nil
+}
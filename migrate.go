@@ -0,0 +1,59 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+)
+
+// SchemaVersion is the version of the persisted state written by this version of the runner
+const SchemaVersion = 2
+
+// Migration upgrades the persisted state of a Store to Version
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(ctx context.Context, r *Runner, s Store) error
+}
+
+// Migrations are applied in order to Stores whose state is older than SchemaVersion. Every
+// change to the persisted format adds one and bumps SchemaVersion.
+var Migrations = []Migration{
+	{Version: 1, Name: "baseline", Up: func(context.Context, *Runner, Store) error { return nil }},
+	{Version: 2, Name: "result expiry", Up: addResultExpiry},
+}
+
+// SchemaStore is implemented by Stores that record the version of their state
+type SchemaStore interface {
+	// SchemaVersion gets the version of the stored state, 0 if it was never migrated
+	SchemaVersion(ctx context.Context) (int, error)
+	SetSchemaVersion(ctx context.Context, v int) error
+}
+
+// migrate brings the Store up to SchemaVersion
+func (r *Runner) migrate(ctx context.Context) error {
+	store, ok := r.store.(SchemaStore)
+	if !ok {
+		return nil
+	}
+	current, err := store.SchemaVersion(ctx)
+	if err != nil {
+		return err
+	}
+	if current > SchemaVersion {
+		return fmt.Errorf("runner: store schema %d is newer than %d", current, SchemaVersion)
+	}
+	for _, m := range Migrations {
+		if m.Version <= current {
+			continue
+		}
+		r.logf(slog.LevelInfo, "Migrating store to schema %d (%s)\n", m.Version, m.Name)
+		if err := m.Up(ctx, r, r.store); err != nil {
+			return fmt.Errorf("runner: migration %d (%s): %w", m.Version, m.Name, err)
+		}
+		if err := store.SetSchemaVersion(ctx, m.Version); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package runner
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+
+	"pkg.goda.sh/tasks"
+)
+
+// Mirror keeps a copy of the task list other services can read directly, see WithMirror
+type Mirror interface {
+	// Reset clears the entries left by a previous run
+	Reset(ctx context.Context) error
+	// Set writes the JSON encoded tasks.CleanTask of a task, its last result included
+	Set(ctx context.Context, id string, task []byte) error
+	// Delete removes a task
+	Delete(ctx context.Context, id string) error
+}
+
+// WithMirror keeps m in sync with the task list, one entry per task ID holding the task and
+// its last result
+func WithMirror(m Mirror) Option {
+	return func(r *Runner) {
+		r.mirrorTo = m
+	}
+}
+
+// resetMirror clears the entries left by a previous run
+func (r *Runner) resetMirror() {
+	if r.mirrorTo == nil {
+		return
+	}
+	if err := r.mirrorTo.Reset(context.Background()); err != nil {
+		r.logf(slog.LevelError, "Could not reset task list mirror: %v\n", err)
+	}
+}
+
+// mirror writes a task to the mirror
+func (r *Runner) mirror(t tasks.Task) {
+	if r.mirrorTo == nil {
+		return
+	}
+	if t.Last == nil {
+		t.Last = struct{}{}
+	}
+	raw, err := json.Marshal(tasks.CleanTask(t))
+	if err != nil {
+		r.logf(slog.LevelError, "Could not mirror %s: %v\n", t.ID, err)
+		return
+	}
+	if err := r.mirrorTo.Set(context.Background(), t.ID, raw); err != nil {
+		r.logf(slog.LevelError, "Could not mirror %s: %v\n", t.ID, err)
+	}
+}
+
+// unmirror deletes a task from the mirror
+func (r *Runner) unmirror(id string) {
+	if r.mirrorTo == nil {
+		return
+	}
+	if err := r.mirrorTo.Delete(context.Background(), id); err != nil {
+		r.logf(slog.LevelError, "Could not remove %s from the mirror: %v\n", id, err)
+	}
+}
@@ -0,0 +1,29 @@
+package runner
+
+// WithNamespace isolates the Runner in a tenant namespace. The namespace is part of every
+// task ID, Store key and Transport subject, so products sharing a backend and a runner fleet
+// neither collide nor see each other's tasks.
+func WithNamespace(ns string) Option {
+	return func(r *Runner) {
+		r.namespace = ns
+	}
+}
+
+// Namespace gets the tenant namespace of the Runner
+func (r *Runner) Namespace() string {
+	return r.namespace
+}
+
+// ns qualifies a key or Transport subject with the Runner's namespace
+func (r *Runner) ns(name string) string {
+	return Namespaced(r.namespace, name)
+}
+
+// Namespaced qualifies a key or Transport subject with a namespace the way the Runner does,
+// for the backends keeping keys of their own, see WithNamespace
+func Namespaced(namespace, name string) string {
+	if namespace == "" {
+		return name
+	}
+	return namespace + ":" + name
+}
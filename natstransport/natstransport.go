@@ -0,0 +1,72 @@
+// Package natstransport provides a runner.Transport backed by NATS, optionally
+// routing selected subjects through JetStream so they are persisted
+package natstransport
+
+import (
+	"context"
+
+	"github.com/nats-io/nats.go"
+	"pkg.goda.sh/runner/v2"
+)
+
+var _ runner.Transport = (*Transport)(nil)
+
+// Transport is a runner.Transport using NATS pub/sub
+type Transport struct {
+	conn    *nats.Conn
+	js      nats.JetStreamContext
+	durable map[string]bool
+}
+
+// New creates a Transport using an established NATS connection
+func New(conn *nats.Conn) *Transport {
+	return &Transport{conn: conn, durable: make(map[string]bool)}
+}
+
+// WithJetStream publishes the given subjects (ex. runner.ResultsChannel) through JetStream,
+// which must have a stream configured to capture them
+func (t *Transport) WithJetStream(js nats.JetStreamContext, subjects ...string) *Transport {
+	t.js = js
+	for _, subject := range subjects {
+		t.durable[subject] = true
+	}
+	return t
+}
+
+// Publish sends a payload to a NATS subject
+func (t *Transport) Publish(ctx context.Context, subject string, payload []byte) error {
+	if t.js != nil && t.durable[subject] {
+		_, err := t.js.Publish(subject, payload, nats.Context(ctx))
+		return err
+	}
+	return t.conn.Publish(subject, payload)
+}
+
+// Subscribe listens on NATS subjects until ctx is done
+func (t *Transport) Subscribe(ctx context.Context, fn func(subject string, payload []byte), subjects ...string) error {
+	subs := make([]*nats.Subscription, 0, len(subjects))
+	unsubscribe := func() {
+		for _, sub := range subs {
+			sub.Unsubscribe()
+		}
+	}
+	for _, subject := range subjects {
+		sub, err := t.conn.Subscribe(subject, func(msg *nats.Msg) {
+			fn(msg.Subject, msg.Data)
+		})
+		if err != nil {
+			unsubscribe()
+			return err
+		}
+		subs = append(subs, sub)
+	}
+	if err := t.conn.Flush(); err != nil {
+		unsubscribe()
+		return err
+	}
+	go func() {
+		<-ctx.Done()
+		unsubscribe()
+	}()
+	return nil
+}
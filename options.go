@@ -0,0 +1,33 @@
+package runner
+
+import (
+	"context"
+
+	"pkg.goda.sh/tasks"
+)
+
+// Option configures optional Runner behaviour
+type Option func(*Runner)
+
+// WithTaskRedis sets the connection handed to the task functions as their TaskArgs.Redis. The
+// Runner itself doesn't use it, its Transport, Store and Queue are set on their own.
+func WithTaskRedis(rc tasks.Redis) Option {
+	return func(r *Runner) {
+		r.RedisControl = rc
+	}
+}
+
+// WithContext sets the lifecycle of the Runner: tasks passed to NewRunner and added by the
+// Runner itself derive their context from ctx, and the Runner stops once it is done
+func WithContext(ctx context.Context) Option {
+	return func(r *Runner) {
+		r.ctx = ctx
+	}
+}
+
+// WithTransport sets the Transport used to exchange results and control messages with other runners
+func WithTransport(t Transport) Option {
+	return func(r *Runner) {
+		r.transport = t
+	}
+}
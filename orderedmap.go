@@ -0,0 +1,109 @@
+package runner
+
+import (
+	"iter"
+	"sync"
+)
+
+// OrderedMap is a map that keeps the insertion order of its keys, safe for concurrent use
+type OrderedMap[K comparable, V any] struct {
+	keys  []K
+	items map[K]V
+	mu    sync.RWMutex
+}
+
+// NewOrderedMap creates an empty OrderedMap
+func NewOrderedMap[K comparable, V any]() *OrderedMap[K, V] {
+	return &OrderedMap[K, V]{items: make(map[K]V)}
+}
+
+// Add sets the value of a key, appending the key if it is new, and returns the value
+func (m *OrderedMap[K, V]) Add(k K, v V) V {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.items[k]; !ok {
+		m.keys = append(m.keys, k)
+	}
+	m.items[k] = v
+	return v
+}
+
+// Update sets the value of a key that is present and returns the value
+func (m *OrderedMap[K, V]) Update(k K, v V) V {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.items[k]; ok {
+		m.items[k] = v
+	}
+	return v
+}
+
+// Get gets the value of a key
+func (m *OrderedMap[K, V]) Get(k K) (V, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	v, ok := m.items[k]
+	return v, ok
+}
+
+// Del deletes a key and reports whether it was present
+func (m *OrderedMap[K, V]) Del(k K) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.items[k]; !ok {
+		return false
+	}
+	delete(m.items, k)
+	for i, key := range m.keys {
+		if key == k {
+			m.keys = append(m.keys[:i], m.keys[i+1:]...)
+			break
+		}
+	}
+	return true
+}
+
+// Count gets the number of keys
+func (m *OrderedMap[K, V]) Count() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.keys)
+}
+
+// Keys gets every key in insertion order
+func (m *OrderedMap[K, V]) Keys() []K {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return append([]K(nil), m.keys...)
+}
+
+// Values gets every value in insertion order
+func (m *OrderedMap[K, V]) Values() []V {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	out := make([]V, 0, len(m.keys))
+	for _, k := range m.keys {
+		out = append(out, m.items[k])
+	}
+	return out
+}
+
+// All iterates over the keys and values in insertion order without copying them. The lock
+// is not held while yielding, so entries added or removed meanwhile may or may not be seen.
+func (m *OrderedMap[K, V]) All() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		for i := 0; ; i++ {
+			m.mu.RLock()
+			if i >= len(m.keys) {
+				m.mu.RUnlock()
+				return
+			}
+			k := m.keys[i]
+			v := m.items[k]
+			m.mu.RUnlock()
+			if !yield(k, v) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package runner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"pkg.goda.sh/tasks"
+)
+
+type paramsKey struct{}
+
+// withParams attaches the parameters of a Spec to a task context
+func withParams(ctx context.Context, params map[string]interface{}) context.Context {
+	if len(params) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, paramsKey{}, params)
+}
+
+// ContextWithParams attaches parameters to a context the way a Runner does for its tasks,
+// to run a TaskFunc outside of one, ex. in a plugin
+func ContextWithParams(ctx context.Context, params map[string]interface{}) context.Context {
+	return withParams(ctx, copyParams(params))
+}
+
+// ParamsFrom gets a copy of the parameters of the task a context belongs to, TaskRunners call
+// it with the CTX of their task. Secret references are resolved, see WithSecrets, those that
+// can't be are left as they are; Params reports them.
+func ParamsFrom(ctx context.Context) map[string]interface{} {
+	params, _ := paramsFrom(ctx)
+	return params
+}
+
+// paramsFrom is ParamsFrom also getting the references that couldn't be resolved
+func paramsFrom(ctx context.Context) (map[string]interface{}, error) {
+	if ctx == nil {
+		return nil, nil
+	}
+	params, _ := ctx.Value(paramsKey{}).(map[string]interface{})
+	params = copyParams(params)
+	return params, resolveParams(ctx, params)
+}
+
+// Param gets a single parameter of the task a context belongs to
+func Param(ctx context.Context, name string) (interface{}, bool) {
+	v, ok := ParamsFrom(ctx)[name]
+	return v, ok
+}
+
+// Validator is implemented by parameter types that check themselves after decoding
+type Validator interface {
+	Validate() error
+}
+
+// Params decodes the parameters of a task into T and validates them when T implements
+// Validator
+func Params[T any](t tasks.Task) (T, error) {
+	var out T
+	params, err := paramsFrom(t.CTX)
+	if err != nil {
+		return out, fmt.Errorf("params: %w", err)
+	}
+	raw, err := json.Marshal(params)
+	if err != nil {
+		return out, err
+	}
+	if err := json.Unmarshal(raw, &out); err != nil {
+		return out, fmt.Errorf("%w: params: %v", ErrInvalidTask, err)
+	}
+	if v, ok := any(&out).(Validator); ok {
+		if err := v.Validate(); err != nil {
+			return out, fmt.Errorf("%w: params: %v", ErrInvalidTask, err)
+		}
+	}
+	return out, nil
+}
+
+// Typed wraps a TaskFunc taking decoded parameters, returning the decoding error as the
+// result of runs with invalid parameters
+func Typed[T any](fn func(args *tasks.TaskArgs, params T) tasks.Result) TaskFunc {
+	return func(args *tasks.TaskArgs) tasks.Result {
+		params, err := Params[T](args.Task)
+		if err != nil {
+			return tasks.Result{Error: err}
+		}
+		return fn(args, params)
+	}
+}
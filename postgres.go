@@ -0,0 +1,117 @@
+package runner
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+)
+
+// ErrNoExecutions is returned by Executions on stores that don't keep an execution history
+var ErrNoExecutions = errors.New("runner: store does not keep an execution history")
+
+// PostgresSchema is the schema used by the Postgres store, applied by SetupPostgres.
+// Specs and records are stored as JSONB so they can be queried directly.
+var PostgresSchema = []string{
+	`CREATE TABLE IF NOT EXISTS runner_tasks (
+		id TEXT PRIMARY KEY,
+		machine TEXT NOT NULL,
+		spec JSONB NOT NULL,
+		updated BIGINT NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS runner_tasks_machine ON runner_tasks (machine)`,
+	`CREATE TABLE IF NOT EXISTS runner_schedules (
+		id TEXT PRIMARY KEY,
+		last_run BIGINT NOT NULL,
+		next_due BIGINT NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS runner_results (
+		id TEXT NOT NULL,
+		date BIGINT NOT NULL,
+		record JSONB NOT NULL,
+		expires BIGINT NOT NULL DEFAULT 0
+	)`,
+	`CREATE INDEX IF NOT EXISTS runner_results_id_date ON runner_results (id, date)`,
+	`CREATE TABLE IF NOT EXISTS runner_executions (
+		id TEXT NOT NULL,
+		date BIGINT NOT NULL,
+		location TEXT NOT NULL,
+		warn BOOLEAN NOT NULL,
+		error TEXT NOT NULL,
+		record JSONB NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS runner_executions_id_date ON runner_executions (id, date)`,
+	`CREATE TABLE IF NOT EXISTS runner_dead_letters (
+		id TEXT PRIMARY KEY,
+		entry JSONB NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS runner_locks (
+		key TEXT PRIMARY KEY,
+		value TEXT NOT NULL,
+		expires BIGINT NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS runner_heartbeats (
+		machine TEXT PRIMARY KEY,
+		seen BIGINT NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS runner_schema (
+		version INTEGER NOT NULL
+	)`,
+}
+
+// SetupPostgres creates the tables used by the Postgres store if they don't exist
+func SetupPostgres(ctx context.Context, db *sql.DB) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	for _, stmt := range PostgresSchema {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// NewPostgresStore sets up the schema and returns a Store on a Postgres database (ex. using
+// github.com/jackc/pgx/v4/stdlib or github.com/lib/pq). Besides the recent results, every
+// execution is kept in runner_executions for querying.
+func NewPostgresStore(ctx context.Context, db *sql.DB) (*SQLStore, error) {
+	s := &SQLStore{db: db, numbered: true, executions: true}
+	return s, SetupPostgres(ctx, db)
+}
+
+// saveExecution appends a result to the execution history
+func (s *SQLStore) saveExecution(ctx context.Context, id string, rec Record, raw []byte) error {
+	_, err := s.db.ExecContext(ctx, s.q(`INSERT INTO runner_executions (id, date, location, warn, error, record) VALUES (?, ?, ?, ?, ?, ?)`),
+		id, rec.Date, rec.Location, rec.Warn, rec.Error, string(raw))
+	return err
+}
+
+// Executions gets the execution history of a task between two dates in milliseconds, oldest first
+func (s *SQLStore) Executions(ctx context.Context, id string, from, to int64) ([]Record, error) {
+	if !s.executions {
+		return nil, ErrNoExecutions
+	}
+	rows, err := s.db.QueryContext(ctx, s.q(`SELECT record FROM runner_executions WHERE id = ? AND date >= ? AND date <= ? ORDER BY date`), id, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []Record
+	for rows.Next() {
+		var (
+			raw string
+			rec Record
+		)
+		if err := rows.Scan(&raw); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(raw), &rec); err != nil {
+			return nil, err
+		}
+		out = append(out, rec)
+	}
+	return out, rows.Err()
+}
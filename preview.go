@@ -0,0 +1,82 @@
+package runner
+
+import (
+	"fmt"
+	"time"
+
+	"pkg.goda.sh/tasks"
+)
+
+// Projection is the projected schedule of a task, see Preview
+type Projection struct {
+	ID       string      `json:"id"`
+	Label    string      `json:"label"`
+	Task     string      `json:"task"`
+	Interval string      `json:"interval"`
+	Runs     []time.Time `json:"runs"`             // Next fire times, empty while paused
+	Proposed bool        `json:"proposed"`         // Not in the task list yet
+	Paused   bool        `json:"paused,omitempty"` // By the Runner, its group or one of its tags
+}
+
+// Preview projects the next n fire times of every task along with the specs that would be
+// added, without running or adding anything. Added tasks start after the same stagger as
+// AddSpec applies: one second per task in the task list. Pausing the Runner, a group or a
+// tag stands in for a blackout window. Timerless tasks aren't projected.
+func (r *Runner) Preview(specs []Spec, n int) ([]Projection, error) {
+	for i, s := range specs {
+		if err := r.validate(s); err != nil {
+			return nil, fmt.Errorf("spec %d: %w", i, err)
+		}
+	}
+	now := time.Now()
+	schedules := r.Schedules()
+	var out []Projection
+	for id, t := range r.All() {
+		if r.Timerless(t.Task) {
+			continue
+		}
+		next := now
+		if due := schedules[id].NextDue; due > 0 {
+			next = time.Unix(0, due*int64(time.Millisecond))
+		}
+		out = append(out, r.project(t, next, n, r.paused(id), false))
+	}
+	count := r.TaskList.Count()
+	for _, s := range specs {
+		t := s.Task()
+		t.Interval = normalizeInterval(t.Interval)
+		t.ID = r.Hash(t)
+		if r.Timerless(t.Task) {
+			continue
+		}
+		count++ // The first run waits one second per task, itself included
+		next := now.Add(time.Duration(count) * time.Second)
+		r.mu.RLock()
+		paused := r.halted.Load() || r.held(s)
+		r.mu.RUnlock()
+		out = append(out, r.project(t, next, n, paused, true))
+	}
+	return out, nil
+}
+
+// project lists the next n runs of a task starting at next
+func (r *Runner) project(t tasks.Task, next time.Time, n int, paused, proposed bool) Projection {
+	p := Projection{
+		ID:       t.ID,
+		Label:    t.Label,
+		Task:     t.Task,
+		Interval: t.Interval,
+		Runs:     make([]time.Time, 0, n),
+		Proposed: proposed,
+		Paused:   paused,
+	}
+	if paused {
+		return p
+	}
+	interval := r.interval(t)
+	for i := 0; i < n && interval > 0; i++ {
+		p.Runs = append(p.Runs, next)
+		next = next.Add(interval)
+	}
+	return p
+}
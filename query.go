@@ -0,0 +1,158 @@
+package runner
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"pkg.goda.sh/tasks"
+)
+
+// State is the health of a task according to its last result
+type State string
+
+// Task states
+const (
+	StatePending State = "pending" // Hasn't run yet
+	StateOK      State = "ok"
+	StateWarning State = "warning"
+	StateFailing State = "failing" // Last run returned an error, needs history, see WithHistory
+)
+
+// SortKey is the field a Query is sorted by
+type SortKey string
+
+// Sort keys, tasks are kept in insertion order by default
+const (
+	SortInsertion SortKey = ""
+	SortID        SortKey = "id"
+	SortLabel     SortKey = "label"
+	SortType      SortKey = "type"
+	SortLastRun   SortKey = "last_run"
+)
+
+// Query selects tasks from the task list, zero values match every task
+type Query struct {
+	Type      string         // Task type, case-insensitive
+	Label     *regexp.Regexp // Matched against the label
+	Tags      []string       // Every one of these tags
+	Group     string         // Group name, case-insensitive
+	States    []State        // Any of these states
+	Warn      *bool          // Warn flag of the last result
+	RanWithin time.Duration  // Last run at most this long ago
+	NotRunFor time.Duration  // Last run at least this long ago, or never ran
+	Sort      SortKey
+	Desc      bool
+	Offset    int
+	Limit     int // 0 means no limit
+}
+
+// QueryResult is a page of tasks matching a Query
+type QueryResult struct {
+	Tasks []tasks.CleanTask `json:"tasks"`
+	Total int               `json:"total"` // Matching tasks before pagination
+}
+
+// Query gets the tasks matching q along with their last result output
+func (r *Runner) Query(q Query) QueryResult {
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	out := make([]tasks.CleanTask, 0)
+	for _, t := range r.Where(func(t tasks.Task) bool { return r.matches(q, t, now) }) {
+		if t.Last == nil {
+			t.Last = struct{}{}
+		}
+		out = append(out, tasks.CleanTask(copyTask(t)))
+	}
+	if q.Sort != SortInsertion {
+		sort.SliceStable(out, func(i, j int) bool { return less(q.Sort, out[i], out[j]) })
+	}
+	if q.Desc {
+		for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+			out[i], out[j] = out[j], out[i]
+		}
+	}
+	total := len(out)
+	if q.Offset > 0 {
+		out = out[min(q.Offset, len(out)):]
+	}
+	if q.Limit > 0 && q.Limit < len(out) {
+		out = out[:q.Limit]
+	}
+	return QueryResult{Tasks: out, Total: total}
+}
+
+// State gets the state of a task, it is pending for unknown tasks
+func (r *Runner) State(id string) State {
+	t, ok := r.find(id)
+	if !ok {
+		return StatePending
+	}
+	return r.state(t)
+}
+
+func (r *Runner) state(t tasks.Task) State {
+	if t.Date == 0 {
+		return StatePending
+	}
+	r.mu.RLock()
+	list := r.history[t.ID]
+	failing := len(list) > 0 && list[len(list)-1].Error != ""
+	r.mu.RUnlock()
+	switch {
+	case failing:
+		return StateFailing
+	case t.Warn:
+		return StateWarning
+	}
+	return StateOK
+}
+
+// matches reports whether a task is selected by q, now is in ms
+func (r *Runner) matches(q Query, t tasks.Task, now int64) bool {
+	if q.Type != "" && !strings.EqualFold(t.Task, q.Type) {
+		return false
+	}
+	if q.Label != nil && !q.Label.MatchString(t.Label) {
+		return false
+	}
+	if q.Group != "" && !strings.EqualFold(r.spec(t.ID).Group, q.Group) {
+		return false
+	}
+	if len(q.Tags) > 0 && !r.tagged(t.ID, q.Tags) {
+		return false
+	}
+	if q.Warn != nil && t.Warn != *q.Warn {
+		return false
+	}
+	if q.RanWithin > 0 && (t.Date == 0 || now-t.Date > q.RanWithin.Milliseconds()) {
+		return false
+	}
+	if q.NotRunFor > 0 && t.Date != 0 && now-t.Date < q.NotRunFor.Milliseconds() {
+		return false
+	}
+	if len(q.States) > 0 {
+		state := r.state(t)
+		for _, s := range q.States {
+			if s == state {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func less(key SortKey, a, b tasks.CleanTask) bool {
+	switch key {
+	case SortID:
+		return a.ID < b.ID
+	case SortLabel:
+		return strings.ToLower(a.Label) < strings.ToLower(b.Label)
+	case SortType:
+		return strings.ToLower(a.Task) < strings.ToLower(b.Task)
+	case SortLastRun:
+		return a.Date < b.Date
+	}
+	return false
+}
@@ -0,0 +1,222 @@
+package runner
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"time"
+
+	"pkg.goda.sh/tasks"
+)
+
+// ErrNoQueue is returned when Enqueue or Work is used without a Queue
+var ErrNoQueue = errors.New("runner: no queue configured")
+
+// ErrTimerless is returned when a timerless task is submitted as a one-shot job, or run with
+// RunType
+var ErrTimerless = errors.New("runner: timerless tasks cannot run as one-shot jobs")
+
+// Job is a one-shot task submitted through the queue
+type Job struct {
+	ID        string `json:"id"`
+	Spec      Spec   `json:"spec"`
+	Attempts  int    `json:"attempts"`
+	Submitted int64  `json:"submitted"`
+}
+
+// Queue holds the one-shot jobs of Enqueue until working runners take them, see WithQueue.
+// Jobs are JSON encoded Jobs. A node takes a job into a list of its own and claims it from
+// there, so the jobs of a node that dies in between aren't lost.
+type Queue interface {
+	// Push adds a job to the queue
+	Push(ctx context.Context, job []byte) error
+	// Take moves a job from the queue to the list of node, waiting up to wait for one, and
+	// returns nil without an error when there's none
+	Take(ctx context.Context, node string, wait time.Duration) ([]byte, error)
+	// Claim removes a taken job from the list of node and marks claimed, the job with its
+	// attempts counted, pending until deadline
+	Claim(ctx context.Context, node string, taken, claimed []byte, deadline time.Time) error
+	// Drop removes a taken job from the list of node
+	Drop(ctx context.Context, node string, taken []byte) error
+	// Extend pushes the deadline of a pending job back
+	Extend(ctx context.Context, claimed []byte, deadline time.Time) error
+	// Ack removes a pending job, once its result is published
+	Ack(ctx context.Context, claimed []byte) error
+	// Heartbeat tells the other working nodes node is working until deadline
+	Heartbeat(ctx context.Context, node string, deadline time.Time) error
+	// Requeue puts the pending jobs whose deadline is before now back on the queue, along with
+	// the taken jobs of the nodes whose heartbeat is, and returns how many it put back
+	Requeue(ctx context.Context, now time.Time) (int, error)
+	// Restore puts the taken jobs of node back on the queue, and returns how many
+	Restore(ctx context.Context, node string) (int, error)
+}
+
+// WithQueue sets the Queue of the one-shot jobs of Enqueue and Work
+func WithQueue(q Queue) Option {
+	return func(r *Runner) {
+		r.queue = q
+	}
+}
+
+// Enqueue submits a one-shot task that will be run by exactly one working runner,
+// at least once even if that runner dies before publishing the result. Resubmitting a
+// Spec with the same IdempotencyKey returns the original job ID and ErrDuplicateSubmission.
+func (r *Runner) Enqueue(ctx context.Context, spec Spec) (string, error) {
+	if r.queue == nil {
+		return "", ErrNoQueue
+	}
+	if r.Timerless(spec.CleanTask.Task) {
+		return "", ErrTimerless
+	}
+	job := Job{
+		ID:        newUUID(),
+		Spec:      spec,
+		Submitted: time.Now().UnixNano() / int64(time.Millisecond),
+	}
+	if id, err := r.reserve(ctx, spec.IdempotencyKey, job.ID); err != nil {
+		return id, err
+	}
+	payload, err := json.Marshal(job)
+	if err == nil {
+		err = r.queue.Push(ctx, payload)
+	}
+	if err != nil {
+		r.release(ctx, spec.IdempotencyKey)
+		return "", err
+	}
+	return job.ID, nil
+}
+
+// Work takes jobs from the queue until ctx is done. A claimed job stays pending until its
+// result is published, its deadline extended by visibility while it runs; if the runner stops
+// extending it, it is handed to another runner, up to maxAttempts times (0 retries forever)
+// before going to the dead-letter set. Working runners send heartbeats, the jobs a runner
+// was taking when it stopped sending them are put back on the queue by the others.
+func (r *Runner) Work(ctx context.Context, visibility time.Duration, maxAttempts int) error {
+	if r.queue == nil {
+		return ErrNoQueue
+	}
+	node := r.Identity.MachineID
+	// Recover jobs taken by a previous run of this node that never made it to pending
+	if n, err := r.queue.Restore(ctx, node); err != nil {
+		return err
+	} else if n > 0 {
+		r.logf(slog.LevelInfo, "Recovered %d job(s) from a previous run\n", n)
+	}
+	go func() {
+		ticker := time.NewTicker(visibility / 2)
+		defer ticker.Stop()
+		for {
+			if err := r.queue.Heartbeat(ctx, node, time.Now().Add(visibility)); err != nil && ctx.Err() == nil {
+				r.logf(slog.LevelError, "Could not send a worker heartbeat: %v\n", err)
+			}
+			if n, err := r.queue.Requeue(ctx, time.Now()); err != nil {
+				if ctx.Err() == nil {
+					r.logf(slog.LevelError, "Could not requeue expired jobs: %v\n", err)
+				}
+			} else if n > 0 {
+				r.logf(slog.LevelInfo, "Requeued %d expired job(s)\n", n)
+			}
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	go func() {
+		for ctx.Err() == nil {
+			payload, err := r.queue.Take(ctx, node, time.Second)
+			if err != nil {
+				if ctx.Err() == nil {
+					r.logf(slog.LevelError, "Could not take a job from the queue: %v\n", err)
+					time.Sleep(time.Second)
+				}
+				continue
+			}
+			if payload != nil {
+				r.claim(ctx, node, payload, visibility, maxAttempts)
+			}
+		}
+	}()
+	return nil
+}
+
+// claim marks a job as pending, runs it and acknowledges it once its result is published
+func (r *Runner) claim(ctx context.Context, node string, payload []byte, visibility time.Duration, maxAttempts int) {
+	var job Job
+	if err := json.Unmarshal(payload, &job); err != nil {
+		r.logf(slog.LevelWarn, "Dropping malformed job: %v\n", err)
+		r.queue.Drop(ctx, node, payload)
+		return
+	}
+	job.Attempts++
+	if maxAttempts > 0 && job.Attempts > maxAttempts {
+		r.logf(slog.LevelWarn, "Moving job %s to the dead-letter set after %d attempts\n", job.ID, maxAttempts)
+		r.deadLetter(DeadLetter{ID: job.ID, Spec: job.Spec, Failures: maxAttempts, Since: job.Submitted, LastError: "retries exhausted", Job: true})
+		r.queue.Drop(ctx, node, payload)
+		return
+	}
+	claimed, _ := json.Marshal(job)
+	if err := r.queue.Claim(ctx, node, payload, claimed, time.Now().Add(visibility)); err != nil {
+		r.logf(slog.LevelError, "Could not claim job %s: %v\n", job.ID, err)
+		return
+	}
+	done := make(chan struct{})
+	go r.extend(ctx, job.ID, claimed, visibility, done)
+	defer close(done)
+	if result := r.runOnce(context.Background(), job.Spec); result.Error == nil && !result.Cancelled {
+		if err := r.queue.Ack(ctx, claimed); err != nil {
+			r.logf(slog.LevelError, "Could not acknowledge job %s: %v\n", job.ID, err)
+		}
+	} else {
+		r.logf(slog.LevelWarn, "Job %s failed, it will be retried after its deadline: %v\n", job.ID, result.Error)
+	}
+}
+
+// extend pushes the deadline of a pending job back while it runs, until done is closed
+func (r *Runner) extend(ctx context.Context, id string, claimed []byte, visibility time.Duration, done <-chan struct{}) {
+	ticker := time.NewTicker(visibility / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := r.queue.Extend(ctx, claimed, time.Now().Add(visibility)); err != nil && ctx.Err() == nil {
+				r.logf(slog.LevelError, "Could not extend job %s: %v\n", id, err)
+			}
+		case <-done:
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// runOnce runs a task a single time without scheduling it, delivering the result like any other
+func (r *Runner) runOnce(ctx context.Context, spec Spec) tasks.Result {
+	t := spec.Task()
+	t.Location = r.Identity.Location
+	t.ID = r.Hash(t)
+	fn, ok := r.lookup(t.Task)
+	if !ok {
+		return tasks.Result{Error: ErrUnknownTask}
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	t.CTX = r.withSecrets(withParams(ctx, spec.Params))
+	t.Cancel = func() bool {
+		cancel()
+		return true
+	}
+	result := fn(&tasks.TaskArgs{
+		Task:  t,
+		Stop:  func() {},
+		Redis: r.RedisControl,
+	})
+	if !result.Cancelled {
+		t, result = r.apply(t, result)
+		r.deliver(t, result)
+	}
+	return result
+}
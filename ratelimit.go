@@ -0,0 +1,41 @@
+package runner
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+
+	"pkg.goda.sh/tasks"
+)
+
+// Limiter decides whether a task run is allowed under a rate limit shared by key
+type Limiter interface {
+	Allow(ctx context.Context, key string) (bool, error)
+}
+
+// WithRateLimit checks every scheduled run against a Limiter. The key function picks the
+// bucket a task draws from, nil uses the task type.
+func WithRateLimit(l Limiter, key func(tasks.Task) string) Option {
+	return func(r *Runner) {
+		if key == nil {
+			key = func(t tasks.Task) string { return strings.ToLower(t.Task) }
+		}
+		r.limiter, r.limitKey = l, key
+	}
+}
+
+// allow reports whether a task may run now, failing open if the limiter is unavailable
+func (r *Runner) allow(t tasks.Task) bool {
+	if r.limiter == nil {
+		return true
+	}
+	ok, err := r.limiter.Allow(t.CTX, r.ns(r.limitKey(t)))
+	if err != nil {
+		r.logf(slog.LevelWarn, "Rate limiter unavailable for %q (%s/%s): %v\n", t.Label, t.Task, t.ID, err)
+		return true
+	}
+	if !ok {
+		r.logf(slog.LevelDebug, "Rate limited %q (%s/%s)\n", t.Label, t.Task, t.ID)
+	}
+	return ok
+}
@@ -0,0 +1,35 @@
+module pkg.goda.sh/runner/v2/redisbackend
+
+go 1.23
+
+require (
+	github.com/go-redis/redis/v8 v8.11.3
+	pkg.goda.sh/runner/v2 v2.0.0
+	pkg.goda.sh/tasks v1.0.0-beta.1
+)
+
+require (
+	github.com/PuerkitoBio/goquery v1.7.1 // indirect
+	github.com/andybalholm/cascadia v1.2.0 // indirect
+	github.com/cespare/xxhash/v2 v2.1.2 // indirect
+	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
+	github.com/fsnotify/fsnotify v1.4.9 // indirect
+	github.com/go-ping/ping v0.0.0-20210506233800-ff8be3320020 // indirect
+	github.com/json-iterator/go v1.1.11 // indirect
+	github.com/mmcdole/gofeed v1.1.3 // indirect
+	github.com/mmcdole/goxpp v0.0.0-20200921145534-2f3784f67354 // indirect
+	github.com/modern-go/concurrent v0.0.0-20180306012644-bacd9c7ef1dd // indirect
+	github.com/modern-go/reflect2 v1.0.1 // indirect
+	github.com/pelletier/go-toml/v2 v2.2.3 // indirect
+	github.com/tidwall/gjson v1.9.0 // indirect
+	github.com/tidwall/match v1.0.3 // indirect
+	github.com/tidwall/pretty v1.2.0 // indirect
+	golang.org/x/net v0.0.0-20210805182204-aaa1db679c0d // indirect
+	golang.org/x/sync v0.0.0-20210220032951-036812b2e83c // indirect
+	golang.org/x/sys v0.28.0 // indirect
+	golang.org/x/text v0.3.6 // indirect
+	gopkg.in/yaml.v2 v2.4.0 // indirect
+	pkg.goda.sh/utils v1.0.0-beta.1 // indirect
+)
+
+replace pkg.goda.sh/runner/v2 => ../
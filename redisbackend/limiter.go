@@ -0,0 +1,56 @@
+package redisbackend
+
+import (
+	"context"
+
+	"github.com/go-redis/redis/v8"
+	"pkg.goda.sh/runner/v2"
+)
+
+var _ runner.Limiter = (*Limiter)(nil)
+
+// Limiter is a runner.Limiter of token buckets stored in Redis, so every runner sharing the
+// Redis instance draws from the same bucket for a given key
+type Limiter struct {
+	Client redis.UniversalClient
+	Rate   float64 // Tokens added per second
+	Burst  int     // Bucket size
+	Prefix string  // Key prefix, defaults to "runner:ratelimit:"
+}
+
+// tokenBucket refills the bucket based on the Redis server clock so runner clock skew
+// doesn't matter, then takes a token if one is available
+var tokenBucket = redis.NewScript(`
+redis.replicate_commands()
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local now = redis.call('TIME')
+now = tonumber(now[1]) + tonumber(now[2]) / 1000000
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1]) or burst
+local ts = tonumber(state[2]) or now
+tokens = math.min(burst, tokens + math.max(0, now - ts) * rate)
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', tostring(now))
+redis.call('EXPIRE', KEYS[1], math.ceil(burst / rate) * 2 + 1)
+return allowed
+`)
+
+// NewLimiter creates a Limiter allowing rate runs per second with bursts of up to burst runs
+func NewLimiter(client redis.UniversalClient, rate float64, burst int) *Limiter {
+	return &Limiter{Client: client, Rate: rate, Burst: burst}
+}
+
+// Allow takes a token from the bucket for key
+func (l *Limiter) Allow(ctx context.Context, key string) (bool, error) {
+	prefix := l.Prefix
+	if prefix == "" {
+		prefix = "runner:ratelimit:"
+	}
+	allowed, err := tokenBucket.Run(ctx, l.Client, []string{prefix + key}, l.Rate, l.Burst).Int()
+	return allowed == 1, err
+}
@@ -0,0 +1,40 @@
+package redisbackend
+
+import (
+	"context"
+
+	"github.com/go-redis/redis/v8"
+	"pkg.goda.sh/runner/v2"
+)
+
+// MirrorKey is the prefix of the Redis hashes mirroring the task list of each MachineID
+const MirrorKey = "runner:tasks:"
+
+var _ runner.Mirror = (*Mirror)(nil)
+
+// Mirror is a runner.Mirror in a Redis hash, one field per task ID holding the task and its
+// last result, so other services can read the task list of a runner directly
+type Mirror struct {
+	Client redis.UniversalClient
+	Key    string
+}
+
+// NewMirror creates a Mirror in the hash at MirrorKey+machine, qualified with namespace
+func NewMirror(client redis.UniversalClient, namespace, machine string) *Mirror {
+	return &Mirror{Client: client, Key: runner.Namespaced(namespace, MirrorKey+machine)}
+}
+
+// Reset deletes the hash
+func (m *Mirror) Reset(ctx context.Context) error {
+	return m.Client.Del(ctx, m.Key).Err()
+}
+
+// Set writes a task to the hash
+func (m *Mirror) Set(ctx context.Context, id string, task []byte) error {
+	return m.Client.HSet(ctx, m.Key, id, task).Err()
+}
+
+// Delete removes a task from the hash
+func (m *Mirror) Delete(ctx context.Context, id string) error {
+	return m.Client.HDel(ctx, m.Key, id).Err()
+}
@@ -0,0 +1,151 @@
+package redisbackend
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"pkg.goda.sh/runner/v2"
+)
+
+// The queue keys share the {queue} hash tag so scripts and transactions spanning
+// them can run on Redis Cluster
+const (
+	// QueueKey is the Redis list one-shot jobs wait in
+	QueueKey = "runner:{queue}"
+	// PendingKey is the Redis sorted set of claimed jobs, scored by their visibility deadline
+	PendingKey = "runner:{queue}:pending"
+	// processingKey is the prefix of the per-node list a job passes through while being claimed
+	processingKey = "runner:{queue}:processing:"
+	// WorkersKey is the Redis sorted set of working nodes, scored by their heartbeat deadline
+	WorkersKey = "runner:{queue}:workers"
+)
+
+var _ runner.Queue = (*Queue)(nil)
+
+// Queue is a runner.Queue in Redis lists and sorted sets, scored in Unix milliseconds
+type Queue struct {
+	Client    redis.UniversalClient
+	Namespace string // Qualifies the keys, see runner.WithNamespace
+}
+
+// NewQueue creates a Queue at the keys above, qualified with namespace
+func NewQueue(client redis.UniversalClient, namespace string) *Queue {
+	return &Queue{Client: client, Namespace: namespace}
+}
+
+// requeue moves every pending job whose deadline has passed back onto the queue
+var requeue = redis.NewScript(`
+local expired = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1])
+for _, job in ipairs(expired) do
+	redis.call('ZREM', KEYS[1], job)
+	redis.call('RPUSH', KEYS[2], job)
+end
+return #expired
+`)
+
+// recoverJobs moves the jobs of the processing list of a node back onto the queue, unless the
+// node sent a heartbeat since it was seen expired
+var recoverJobs = redis.NewScript(`
+local deadline = redis.call('ZSCORE', KEYS[3], ARGV[1])
+if deadline and tonumber(deadline) > tonumber(ARGV[2]) then
+	return 0
+end
+local n = 0
+while redis.call('RPOPLPUSH', KEYS[1], KEYS[2]) do
+	n = n + 1
+end
+redis.call('ZREM', KEYS[3], ARGV[1])
+return n
+`)
+
+func (q *Queue) key(name string) string {
+	return runner.Namespaced(q.Namespace, name)
+}
+
+func score(t time.Time) float64 {
+	return float64(t.UnixNano() / int64(time.Millisecond))
+}
+
+// Push adds a job to the queue
+func (q *Queue) Push(ctx context.Context, job []byte) error {
+	return q.Client.LPush(ctx, q.key(QueueKey), job).Err()
+}
+
+// Take moves a job from the queue to the processing list of node
+func (q *Queue) Take(ctx context.Context, node string, wait time.Duration) ([]byte, error) {
+	payload, err := q.Client.BRPopLPush(ctx, q.key(QueueKey), q.key(processingKey+node), wait).Result()
+	if err == redis.Nil {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return []byte(payload), nil
+}
+
+// Claim moves a taken job to the pending set in a transaction
+func (q *Queue) Claim(ctx context.Context, node string, taken, claimed []byte, deadline time.Time) error {
+	pipe := q.Client.TxPipeline()
+	pipe.ZAdd(ctx, q.key(PendingKey), &redis.Z{Score: score(deadline), Member: string(claimed)})
+	pipe.LRem(ctx, q.key(processingKey+node), 1, string(taken))
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// Drop removes a taken job from the processing list of node
+func (q *Queue) Drop(ctx context.Context, node string, taken []byte) error {
+	return q.Client.LRem(ctx, q.key(processingKey+node), 1, string(taken)).Err()
+}
+
+// Extend pushes the deadline of a pending job back, unless it isn't pending anymore
+func (q *Queue) Extend(ctx context.Context, claimed []byte, deadline time.Time) error {
+	return q.Client.ZAddXX(ctx, q.key(PendingKey), &redis.Z{Score: score(deadline), Member: string(claimed)}).Err()
+}
+
+// Ack removes a pending job
+func (q *Queue) Ack(ctx context.Context, claimed []byte) error {
+	return q.Client.ZRem(ctx, q.key(PendingKey), string(claimed)).Err()
+}
+
+// Heartbeat scores node in the workers set with its deadline
+func (q *Queue) Heartbeat(ctx context.Context, node string, deadline time.Time) error {
+	return q.Client.ZAdd(ctx, q.key(WorkersKey), &redis.Z{Score: score(deadline), Member: node}).Err()
+}
+
+// Requeue puts the expired pending jobs back on the queue, then the processing lists of the
+// workers whose heartbeat expired
+func (q *Queue) Requeue(ctx context.Context, now time.Time) (int, error) {
+	ms := strconv.FormatInt(now.UnixNano()/int64(time.Millisecond), 10)
+	n, err := requeue.Run(ctx, q.Client, []string{q.key(PendingKey), q.key(QueueKey)}, ms).Int()
+	if err != nil {
+		return 0, err
+	}
+	expired, err := q.Client.ZRangeByScore(ctx, q.key(WorkersKey), &redis.ZRangeBy{Min: "-inf", Max: ms}).Result()
+	if err != nil {
+		return n, err
+	}
+	for _, machine := range expired {
+		keys := []string{q.key(processingKey + machine), q.key(QueueKey), q.key(WorkersKey)}
+		recovered, err := recoverJobs.Run(ctx, q.Client, keys, machine, ms).Int()
+		if err != nil {
+			return n, err
+		}
+		n += recovered
+	}
+	return n, nil
+}
+
+// Restore moves the processing list of node back onto the queue
+func (q *Queue) Restore(ctx context.Context, node string) (int, error) {
+	n := 0
+	for {
+		err := q.Client.RPopLPush(ctx, q.key(processingKey+node), q.key(QueueKey)).Err()
+		if err == redis.Nil {
+			return n, nil
+		} else if err != nil {
+			return n, err
+		}
+		n++
+	}
+}
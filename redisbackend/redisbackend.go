@@ -0,0 +1,60 @@
+// Package redisbackend provides the Redis backends of a runner.Runner: a Transport on
+// pub/sub, a Store, a WAL on a stream, a Queue for Enqueue and Work, a rate Limiter and a
+// Mirror of the task list, along with the redis task type and the redis_stream config sink.
+// It's a module of its own, so runners without Redis don't depend on a Redis client:
+//
+//	client := redisbackend.NewClient(redisbackend.Config{Addrs: []string{"localhost:6379"}})
+//	r := runner.NewRunner(id, nil, onResult, false,
+//		runner.WithTransport(redisbackend.NewTransport(client)),
+//		runner.WithStore(redisbackend.NewStore(client)),
+//		runner.WithQueue(redisbackend.NewQueue(client, "")),
+//	)
+//
+// Keys are qualified with the namespace of the Runner by the constructors taking it, see
+// runner.WithNamespace.
+package redisbackend
+
+import (
+	"crypto/tls"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Config describes how to reach Redis. Which client is created depends on the fields set:
+//
+//   - MasterName set: a Sentinel-backed client following failovers, Addrs are the sentinels
+//   - several Addrs: a Redis Cluster client
+//   - otherwise: a single standalone instance
+//
+// The tasks.Redis connection handed to task runners is configured separately by the embedder,
+// see runner.WithTaskRedis.
+type Config struct {
+	Addrs            []string
+	MasterName       string
+	Username         string
+	Password         string
+	SentinelPassword string
+	DB               int // Ignored by Redis Cluster
+	TLS              *tls.Config
+	DialTimeout      time.Duration
+	ReadOnly         bool // Allow read commands on Cluster replicas
+}
+
+// NewClient creates a client for standalone Redis, Redis Sentinel or Redis Cluster, the latter
+// when given several Addrs without a MasterName. The keys used together in scripts and
+// transactions share a hash tag on Redis Cluster, see Store and QueueKey.
+func NewClient(cfg Config) redis.UniversalClient {
+	return redis.NewUniversalClient(&redis.UniversalOptions{
+		Addrs:            cfg.Addrs,
+		MasterName:       cfg.MasterName,
+		Username:         cfg.Username,
+		Password:         cfg.Password,
+		SentinelPassword: cfg.SentinelPassword,
+		DB:               cfg.DB,
+		TLSConfig:        cfg.TLS,
+		DialTimeout:      cfg.DialTimeout,
+		ReadOnly:         cfg.ReadOnly,
+		RouteByLatency:   cfg.ReadOnly,
+	})
+}
@@ -0,0 +1,39 @@
+package redisbackend
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/go-redis/redis/v8"
+	"pkg.goda.sh/runner/v2/config"
+)
+
+var _ config.SinkFunc = StreamSink
+
+// StreamSink delivers the results of a config.SinkRedisStream sink by adding an entry to
+// Stream on the Redis server at URL, trimmed to about MaxLen entries when set:
+//
+//	opts, err := config.LoadOptions(path, config.WithSinkType(config.SinkRedisStream, redisbackend.StreamSink))
+func StreamSink(c config.SinkConfig) (func(config.Output) error, error) {
+	if c.Stream == "" {
+		return nil, errors.New("missing stream")
+	}
+	opts, err := redis.ParseURL(c.URL)
+	if err != nil {
+		return nil, err
+	}
+	client := redis.NewClient(opts)
+	return func(o config.Output) error {
+		result, err := json.Marshal(o)
+		if err != nil {
+			return err
+		}
+		return client.XAdd(context.Background(), &redis.XAddArgs{
+			Stream: c.Stream,
+			MaxLen: c.MaxLen,
+			Approx: c.MaxLen > 0,
+			Values: map[string]interface{}{"id": o.ID, "result": result},
+		}).Err()
+	}, nil
+}
@@ -0,0 +1,317 @@
+package redisbackend
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"pkg.goda.sh/runner/v2"
+)
+
+// StorePrefix is the default prefix of the keys used by a Store
+const StorePrefix = "runner:store"
+
+var (
+	_ runner.Store           = (*Store)(nil)
+	_ runner.DeadLetterStore = (*Store)(nil)
+	_ runner.MachineStore    = (*Store)(nil)
+	_ runner.ResultCompactor = (*Store)(nil)
+	_ runner.SchemaStore     = (*Store)(nil)
+)
+
+// Store is a runner.Store in Redis. Task definitions, schedules and dead letters are kept in
+// hashes and the results of every task in a capped list. Lock keys are used as is. On Redis
+// Cluster, the other keys have the Prefix as their hash tag, ex. {runner:store}:tasks, so
+// the transactions spanning them stay atomic.
+type Store struct {
+	Client redis.UniversalClient
+	Prefix string
+}
+
+// NewStore creates a Store using the default prefix. Set Prefix to runner.Namespaced(ns,
+// StorePrefix) for the Runners of a namespace.
+func NewStore(client redis.UniversalClient) *Store {
+	return &Store{Client: client, Prefix: StorePrefix}
+}
+
+func (s *Store) key(name string) string {
+	if _, ok := s.Client.(*redis.ClusterClient); ok && !strings.Contains(s.Prefix, "{") {
+		return "{" + s.Prefix + "}:" + name
+	}
+	return s.Prefix + ":" + name
+}
+
+// SaveTask stores a task definition
+func (s *Store) SaveTask(ctx context.Context, t runner.StoredTask) error {
+	raw, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	return s.Client.HSet(ctx, s.key("tasks"), t.ID, raw).Err()
+}
+
+// DeleteTask removes a task definition along with its schedule and results
+func (s *Store) DeleteTask(ctx context.Context, id string) error {
+	_, err := s.Client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HDel(ctx, s.key("tasks"), id)
+		pipe.HDel(ctx, s.key("schedules"), id)
+		pipe.Del(ctx, s.key("results:"+id))
+		return nil
+	})
+	return err
+}
+
+// LoadTasks gets every task stored for a MachineID
+func (s *Store) LoadTasks(ctx context.Context, machine string) ([]runner.StoredTask, error) {
+	all, err := s.Client.HGetAll(ctx, s.key("tasks")).Result()
+	if err != nil {
+		return nil, err
+	}
+	var out []runner.StoredTask
+	for _, raw := range all {
+		var t runner.StoredTask
+		if err := json.Unmarshal([]byte(raw), &t); err != nil {
+			return nil, err
+		}
+		if t.Machine == machine {
+			out = append(out, t)
+		}
+	}
+	return out, nil
+}
+
+// SaveSchedule stores the schedule state of a task
+func (s *Store) SaveSchedule(ctx context.Context, id string, sched runner.Schedule) error {
+	raw, err := json.Marshal(sched)
+	if err != nil {
+		return err
+	}
+	return s.Client.HSet(ctx, s.key("schedules"), id, raw).Err()
+}
+
+// LoadSchedules gets the stored schedule state of the given tasks
+func (s *Store) LoadSchedules(ctx context.Context, ids []string) (map[string]runner.Schedule, error) {
+	out := make(map[string]runner.Schedule)
+	if len(ids) == 0 {
+		return out, nil
+	}
+	values, err := s.Client.HMGet(ctx, s.key("schedules"), ids...).Result()
+	if err != nil {
+		return nil, err
+	}
+	for i, v := range values {
+		raw, ok := v.(string)
+		if !ok {
+			continue // Never scheduled
+		}
+		var sched runner.Schedule
+		if err := json.Unmarshal([]byte(raw), &sched); err != nil {
+			return nil, err
+		}
+		out[ids[i]] = sched
+	}
+	return out, nil
+}
+
+// SaveResult stores a result, keeping at most keep results per task
+func (s *Store) SaveResult(ctx context.Context, id string, rec runner.Record, keep int) error {
+	raw, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	_, err = s.Client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.RPush(ctx, s.key("results:"+id), raw)
+		pipe.LTrim(ctx, s.key("results:"+id), int64(-keep), -1)
+		if rec.Expires > 0 { // Expired entries are skipped on read until the whole list expires
+			pipe.PExpireAt(ctx, s.key("results:"+id), time.Unix(0, rec.Expires*int64(time.Millisecond)))
+		}
+		return nil
+	})
+	return err
+}
+
+// Results gets up to limit of the most recent results of a task, oldest first
+func (s *Store) Results(ctx context.Context, id string, limit int) ([]runner.Record, error) {
+	list, err := s.Client.LRange(ctx, s.key("results:"+id), int64(-limit), -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]runner.Record, 0, len(list))
+	for _, raw := range list {
+		var rec runner.Record
+		if err := json.Unmarshal([]byte(raw), &rec); err != nil {
+			return nil, err
+		}
+		if !rec.Expired(time.Now()) {
+			out = append(out, rec)
+		}
+	}
+	return out, nil
+}
+
+// Lock claims a key with SET NX
+func (s *Store) Lock(ctx context.Context, key, value string, ttl time.Duration) (string, bool, error) {
+	ok, err := s.Client.SetNX(ctx, key, value, ttl).Result()
+	if err != nil {
+		return "", false, err
+	} else if ok {
+		return value, true, nil
+	}
+	existing, err := s.Client.Get(ctx, key).Result()
+	if err == redis.Nil {
+		return s.Lock(ctx, key, value, ttl) // Expired in between, try again
+	} else if err != nil {
+		return "", false, err
+	}
+	return existing, false, nil
+}
+
+// Unlock releases a key
+func (s *Store) Unlock(ctx context.Context, key string) error {
+	return s.Client.Del(ctx, key).Err()
+}
+
+// SaveDeadLetter stores a dead letter
+func (s *Store) SaveDeadLetter(ctx context.Context, d runner.DeadLetter) error {
+	raw, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	return s.Client.HSet(ctx, s.key("dead"), d.ID, raw).Err()
+}
+
+// DeleteDeadLetter removes a dead letter
+func (s *Store) DeleteDeadLetter(ctx context.Context, id string) error {
+	return s.Client.HDel(ctx, s.key("dead"), id).Err()
+}
+
+// LoadDeadLetters gets every dead letter
+func (s *Store) LoadDeadLetters(ctx context.Context) ([]runner.DeadLetter, error) {
+	all, err := s.Client.HGetAll(ctx, s.key("dead")).Result()
+	if err != nil {
+		return nil, err
+	}
+	var out []runner.DeadLetter
+	for _, raw := range all {
+		var d runner.DeadLetter
+		if err := json.Unmarshal([]byte(raw), &d); err != nil {
+			return nil, err
+		}
+		out = append(out, d)
+	}
+	return out, nil
+}
+
+// SaveHeartbeat stores when a machine was last seen
+func (s *Store) SaveHeartbeat(ctx context.Context, machine string, seen int64) error {
+	return s.Client.HSet(ctx, s.key("heartbeats"), machine, seen).Err()
+}
+
+// Machines gets every machine with stored tasks and when it was last active
+func (s *Store) Machines(ctx context.Context) (map[string]int64, error) {
+	all, err := s.Client.HGetAll(ctx, s.key("tasks")).Result()
+	if err != nil {
+		return nil, err
+	}
+	seen, err := s.Client.HGetAll(ctx, s.key("heartbeats")).Result()
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]int64)
+	for _, raw := range all {
+		var t runner.StoredTask
+		if err := json.Unmarshal([]byte(raw), &t); err != nil {
+			return nil, err
+		}
+		hb, _ := strconv.ParseInt(seen[t.Machine], 10, 64)
+		if active := max(t.Updated, hb); active > out[t.Machine] {
+			out[t.Machine] = active
+		}
+	}
+	return out, nil
+}
+
+// DeleteMachine removes the state of a machine
+func (s *Store) DeleteMachine(ctx context.Context, machine string) error {
+	stored, err := s.LoadTasks(ctx, machine)
+	if err != nil {
+		return err
+	}
+	_, err = s.Client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, t := range stored {
+			pipe.HDel(ctx, s.key("tasks"), t.ID)
+			pipe.HDel(ctx, s.key("schedules"), t.ID)
+			pipe.Del(ctx, s.key("results:"+t.ID))
+		}
+		pipe.HDel(ctx, s.key("heartbeats"), machine)
+		return nil
+	})
+	return err
+}
+
+// CompactResults rewrites the stored results of a task in a transaction watching them, retried
+// when results are saved meanwhile
+func (s *Store) CompactResults(ctx context.Context, id string, limit int, fn func([]runner.Record) ([]runner.Record, bool)) error {
+	key := s.key("results:" + id)
+	compact := func(tx *redis.Tx) error {
+		list, err := tx.LRange(ctx, key, int64(-limit), -1).Result()
+		if err != nil {
+			return err
+		}
+		recs := make([]runner.Record, 0, len(list))
+		for _, raw := range list {
+			var rec runner.Record
+			if err := json.Unmarshal([]byte(raw), &rec); err != nil {
+				return err
+			}
+			if !rec.Expired(time.Now()) {
+				recs = append(recs, rec)
+			}
+		}
+		recs, changed := fn(recs)
+		if !changed {
+			return nil
+		}
+		values := make([]interface{}, 0, len(recs))
+		for _, rec := range recs {
+			raw, err := json.Marshal(rec)
+			if err != nil {
+				return err
+			}
+			values = append(values, raw)
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Del(ctx, key)
+			if len(values) > 0 {
+				pipe.RPush(ctx, key, values...)
+			}
+			return nil
+		})
+		return err
+	}
+	for attempt := 0; attempt < 3; attempt++ {
+		if err := s.Client.Watch(ctx, compact, key); err != redis.TxFailedErr {
+			return err
+		}
+	}
+	return redis.TxFailedErr
+}
+
+// SchemaVersion gets the version of the stored state
+func (s *Store) SchemaVersion(ctx context.Context) (int, error) {
+	v, err := s.Client.Get(ctx, s.key("schema")).Result()
+	if err == redis.Nil {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(v)
+}
+
+// SetSchemaVersion records the version of the stored state
+func (s *Store) SetSchemaVersion(ctx context.Context, v int) error {
+	return s.Client.Set(ctx, s.key("schema"), v, 0).Err()
+}
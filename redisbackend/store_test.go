@@ -0,0 +1,26 @@
+package redisbackend_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/go-redis/redis/v8"
+	"pkg.goda.sh/runner/v2/redisbackend"
+	"pkg.goda.sh/runner/v2/storetest"
+)
+
+// TestStore runs against the server of the RUNNER_TEST_REDIS URL, ex.
+// redis://localhost:6379/15
+func TestStore(t *testing.T) {
+	url := os.Getenv("RUNNER_TEST_REDIS")
+	if url == "" {
+		t.Skip("RUNNER_TEST_REDIS isn't set")
+	}
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := redis.NewClient(opts)
+	defer client.Close()
+	storetest.Run(t, redisbackend.NewStore(client))
+}
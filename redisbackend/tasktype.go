@@ -0,0 +1,205 @@
+package redisbackend
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"pkg.goda.sh/runner/v2"
+	"pkg.goda.sh/tasks"
+)
+
+// TaskTypeName is the name of the task type of TaskType
+const TaskTypeName = "redis"
+
+// Bounds of the runs of TaskType, as those of the task types of the tasktypes package
+const (
+	defaultTimeout = 30 * time.Second
+	sparkLen       = 30
+)
+
+// ErrNotAllowed is returned by the runs of commands TaskType doesn't allow
+var ErrNotAllowed = errors.New("redisbackend: command not allowed")
+
+// DefaultCommands are the Commands of a TaskType without any, those reading keys and the
+// state of the server
+var DefaultCommands = []string{
+	"BITCOUNT", "DBSIZE", "EXISTS", "GET", "GETRANGE", "HEXISTS", "HGET", "HGETALL", "HLEN",
+	"HMGET", "HSTRLEN", "INFO", "LINDEX", "LLEN", "LRANGE", "MGET", "PFCOUNT", "PING", "PTTL",
+	"SCARD", "SISMEMBER", "STRLEN", "TTL", "TYPE", "XLEN", "ZCARD", "ZCOUNT", "ZSCORE",
+}
+
+// TaskType runs the Redis command of tasks, ex. the LLEN of a queue, and reports its reply:
+//
+//	{"command": "LLEN jobs", "value": 12, "ms": 0.4}
+//
+// The command is a string split on spaces or a list of arguments. The field param picks a
+// field of the reply of INFO, like used_memory, or of a hash. Tasks warn when the value is
+// over their warn_above or under their warn_below, and fail when it isn't a number then.
+// Missing keys have a null value. Numeric values are kept in Spark.
+//
+// Commands run on Client, which can be the one of the Store and Transport of the Runner.
+type TaskType struct {
+	Client   redis.UniversalClient
+	Commands []string      // Tasks may run, DefaultCommands when nil
+	Timeout  time.Duration // 30s when 0
+}
+
+// redisParams are the params of the tasks of TaskType
+type redisParams struct {
+	Command   words    `json:"command"`
+	Field     string   `json:"field"`
+	WarnAbove *float64 `json:"warn_above"`
+	WarnBelow *float64 `json:"warn_below"`
+}
+
+func (p *redisParams) Validate() error {
+	if len(p.Command) == 0 {
+		return errors.New("no command")
+	}
+	return nil
+}
+
+// words are the arguments of a command, a string split on spaces or a list
+type words []string
+
+func (w *words) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*w = strings.Fields(s)
+		return nil
+	}
+	var list []interface{}
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*w = make(words, len(list))
+	for i, v := range list {
+		(*w)[i] = fmt.Sprint(v)
+	}
+	return nil
+}
+
+// Register adds the task type to r
+func (rd TaskType) Register(r *runner.Runner) error {
+	if rd.Client == nil {
+		return errors.New("redisbackend: task type without a client")
+	}
+	return r.Register(TaskTypeName, runner.Typed(rd.run), runner.TaskType{Params: runner.ParamSchema{
+		"command":    {Kind: runner.ParamAny, Required: true},
+		"field":      {Kind: runner.ParamString},
+		"warn_above": {Kind: runner.ParamNumber},
+		"warn_below": {Kind: runner.ParamNumber},
+	}})
+}
+
+func (rd TaskType) run(args *tasks.TaskArgs, p redisParams) tasks.Result {
+	name := strings.ToUpper(p.Command[0])
+	allowed := rd.Commands
+	if allowed == nil {
+		allowed = DefaultCommands
+	}
+	if !slices.ContainsFunc(allowed, func(c string) bool { return strings.EqualFold(c, name) }) {
+		return tasks.Result{Error: fmt.Errorf("%w: %s", ErrNotAllowed, name)}
+	}
+	ctx, cancel := taskContext(args.Task, rd.Timeout)
+	defer cancel()
+	cmd := make([]interface{}, len(p.Command))
+	for i, arg := range p.Command {
+		cmd[i] = arg
+	}
+	start := time.Now()
+	reply, err := rd.Client.Do(ctx, cmd...).Result()
+	ms := float64(time.Since(start).Microseconds()) / 1000
+	if args.Task.CTX != nil && args.Task.CTX.Err() != nil {
+		return tasks.Result{Cancelled: true}
+	}
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return tasks.Result{Error: err}
+	}
+	value := redisValue(reply)
+	if p.Field != "" {
+		value = redisField(value, p.Field)
+	}
+	update := map[string]interface{}{"command": strings.Join(p.Command, " "), "value": value, "ms": ms}
+	n, numeric := value.(float64)
+	if !numeric {
+		if p.WarnAbove != nil || p.WarnBelow != nil {
+			return tasks.Result{Error: fmt.Errorf("%s: %v isn't a number", update["command"], value)}
+		}
+		return tasks.Result{Update: update, Spark: args.Task.Spark}
+	}
+	warn := (p.WarnAbove != nil && n > *p.WarnAbove) || (p.WarnBelow != nil && n < *p.WarnBelow)
+	return tasks.Result{Update: update, Warn: warn, Spark: spark(args.Task, n)}
+}
+
+// redisValue converts a reply, numbers and numeric strings become float64
+func redisValue(reply interface{}) interface{} {
+	switch v := reply.(type) {
+	case int64:
+		return float64(v)
+	case string:
+		if n, err := strconv.ParseFloat(v, 64); err == nil {
+			return n
+		}
+		return v
+	case []interface{}:
+		values := make([]interface{}, len(v))
+		for i, e := range v {
+			values[i] = redisValue(e)
+		}
+		return values
+	case map[interface{}]interface{}:
+		values := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			values[fmt.Sprint(k)] = redisValue(e)
+		}
+		return values
+	}
+	return reply
+}
+
+// redisField gets a field of the reply of INFO or HGETALL, nil when missing
+func redisField(value interface{}, field string) interface{} {
+	switch v := value.(type) {
+	case string: // INFO, field:value lines
+		for _, line := range strings.Split(v, "\n") {
+			if name, value, ok := strings.Cut(strings.TrimSpace(line), ":"); ok && name == field {
+				return redisValue(value)
+			}
+		}
+	case []interface{}: // Field value pairs
+		for i := 0; i+1 < len(v); i += 2 {
+			if fmt.Sprint(v[i]) == field {
+				return v[i+1]
+			}
+		}
+	case map[string]interface{}:
+		return v[field]
+	}
+	return nil
+}
+
+// spark adds a value to the Spark of a task, a result replaces the previous one
+func spark(t tasks.Task, v float64) []float64 {
+	values := append(slices.Clone(t.Spark), v)
+	return values[max(len(values)-sparkLen, 0):]
+}
+
+// taskContext gets the context of a run, cancelled with its task, bounded by timeout
+func taskContext(t tasks.Task, timeout time.Duration) (context.Context, context.CancelFunc) {
+	ctx := t.CTX
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	return context.WithTimeout(ctx, timeout)
+}
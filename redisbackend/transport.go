@@ -0,0 +1,50 @@
+package redisbackend
+
+import (
+	"context"
+
+	"github.com/go-redis/redis/v8"
+	"pkg.goda.sh/runner/v2"
+)
+
+var _ runner.Transport = (*Transport)(nil)
+
+// Transport is a runner.Transport backed by Redis pub/sub
+type Transport struct {
+	Client redis.UniversalClient
+}
+
+// NewTransport creates a Transport using the given Redis client
+func NewTransport(client redis.UniversalClient) *Transport {
+	return &Transport{Client: client}
+}
+
+// Publish sends a payload to a Redis channel
+func (t *Transport) Publish(ctx context.Context, subject string, payload []byte) error {
+	return t.Client.Publish(ctx, subject, payload).Err()
+}
+
+// Subscribe listens on Redis channels until ctx is done
+func (t *Transport) Subscribe(ctx context.Context, fn func(subject string, payload []byte), subjects ...string) error {
+	sub := t.Client.Subscribe(ctx, subjects...)
+	if _, err := sub.Receive(ctx); err != nil {
+		sub.Close()
+		return err
+	}
+	go func() {
+		defer sub.Close()
+		messages := sub.Channel()
+		for {
+			select {
+			case msg, ok := <-messages:
+				if !ok {
+					return
+				}
+				fn(msg.Channel, []byte(msg.Payload))
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return nil
+}
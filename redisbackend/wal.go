@@ -0,0 +1,104 @@
+package redisbackend
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sync/atomic"
+
+	"github.com/go-redis/redis/v8"
+	"pkg.goda.sh/runner/v2"
+)
+
+var _ runner.CompactingWAL = (*WAL)(nil)
+
+// WAL is a runner.WAL stored in a Redis stream
+type WAL struct {
+	Client redis.UniversalClient
+	Stream string
+	logger atomic.Pointer[slog.Logger]
+}
+
+// NewWAL creates a WAL appending to a Redis stream
+func NewWAL(client redis.UniversalClient, stream string) *WAL {
+	return &WAL{Client: client, Stream: stream}
+}
+
+// SetLogger sets the logger corrupt entries are reported to, the Runner sets its own, see
+// runner.WithLogger
+func (w *WAL) SetLogger(l *slog.Logger) {
+	w.logger.Store(l)
+}
+
+func (w *WAL) logf(level slog.Level, format string, args ...interface{}) {
+	logger := w.logger.Load()
+	if logger == nil {
+		logger = slog.Default()
+	}
+	logger.Log(context.Background(), level, fmt.Sprintf(format, args...))
+}
+
+// Append adds an entry to the stream
+func (w *WAL) Append(e runner.WALEntry) error {
+	entry, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return w.Client.XAdd(context.Background(), &redis.XAddArgs{
+		Stream: w.Stream,
+		Values: map[string]interface{}{"entry": string(entry)},
+	}).Err()
+}
+
+// Replay reads the whole stream
+func (w *WAL) Replay(fn func(runner.WALEntry) error) error {
+	messages, err := w.Client.XRange(context.Background(), w.Stream, "-", "+").Result()
+	if err != nil {
+		return err
+	}
+	for _, msg := range messages {
+		raw, _ := msg.Values["entry"].(string)
+		var e runner.WALEntry
+		if err := json.Unmarshal([]byte(raw), &e); err != nil {
+			w.logf(slog.LevelWarn, "Skipping corrupt task log entry %s: %v", msg.ID, err)
+			continue
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Compact deletes the entries of the tasks that were removed from the stream. Entries
+// appended meanwhile are kept, as they are after the ones read.
+func (w *WAL) Compact() error {
+	ctx := context.Background()
+	messages, err := w.Client.XRange(ctx, w.Stream, "-", "+").Result()
+	if err != nil {
+		return err
+	}
+	entries := make([]runner.WALEntry, len(messages))
+	for i, msg := range messages {
+		raw, _ := msg.Values["entry"].(string)
+		if err := json.Unmarshal([]byte(raw), &entries[i]); err != nil {
+			entries[i] = runner.WALEntry{} // Corrupt, neither added nor removed
+		}
+	}
+	keep := runner.LiveEntries(entries)
+	var drop []string
+	for i, msg := range messages {
+		if !keep[i] {
+			drop = append(drop, msg.ID)
+		}
+	}
+	for len(drop) > 0 {
+		n := min(len(drop), 1000)
+		if err := w.Client.XDel(ctx, w.Stream, drop[:n]...).Err(); err != nil {
+			return err
+		}
+		drop = drop[n:]
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+// Package runnertest provides helpers for testing code built on a runner.Runner without
+// Redis or waiting for intervals.
+//
+// New creates a paused Runner with scripted task types, whose tasks only run when
+// triggered. Scripts record every call and Recorders every delivered result:
+//
+//	ping := runnertest.NewScript(tasks.Result{Update: 12.5})
+//	r, rec := runnertest.New(t, map[string]*runnertest.Script{"ping": ping})
+//	r.AddSpec(ctx, r.NewTask("ping").Label("gateway").Interval("PT1M").MustBuild())
+//	runnertest.Trigger(t, r, r.Tasks("ping")[0].ID)
+//	runnertest.AssertRuns(t, ping, "gateway", 1)
+package runnertest
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"pkg.goda.sh/runner/v2"
+	"pkg.goda.sh/tasks"
+)
+
+// Timeout is how long Trigger waits for a result
+var Timeout = 5 * time.Second
+
+// Call is a single run of a scripted task type
+type Call struct {
+	Task   tasks.CleanTask
+	Params map[string]interface{}
+}
+
+// Script is a task type returning scripted results in order, repeating the last one
+type Script struct {
+	results []tasks.Result
+	calls   []Call
+	mu      sync.Mutex
+}
+
+// NewScript creates a Script returning the given results, an empty result when there are none
+func NewScript(results ...tasks.Result) *Script {
+	return &Script{results: results}
+}
+
+// Func runs the Script, it is the runner.TaskFunc registered by New
+func (s *Script) Func(args *tasks.TaskArgs) tasks.Result {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := len(s.calls)
+	s.calls = append(s.calls, Call{Task: tasks.CleanTask(args.Task), Params: runner.ParamsFrom(args.Task.CTX)})
+	switch {
+	case len(s.results) == 0:
+		return tasks.Result{}
+	case n < len(s.results):
+		return s.results[n]
+	default:
+		return s.results[len(s.results)-1]
+	}
+}
+
+// Calls gets every run of the Script, oldest first
+func (s *Script) Calls() []Call {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Call(nil), s.calls...)
+}
+
+// Runs gets the runs of the Script for tasks with the given label
+func (s *Script) Runs(label string) (out []Call) {
+	for _, c := range s.Calls() {
+		if c.Task.Label == label {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// Recorder records the results delivered by a Runner
+type Recorder struct {
+	results map[string][]tasks.Result
+	mu      sync.Mutex
+}
+
+// NewRecorder creates an empty Recorder
+func NewRecorder() *Recorder {
+	return &Recorder{results: make(map[string][]tasks.Result)}
+}
+
+// OnResult records a result, it is the OnResult of the Runners created by New
+func (rec *Recorder) OnResult(t tasks.Task, result tasks.Result) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.results[t.ID] = append(rec.results[t.ID], result)
+}
+
+// Results gets the results recorded for a task ID, oldest first
+func (rec *Recorder) Results(id string) []tasks.Result {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	return append([]tasks.Result(nil), rec.results[id]...)
+}
+
+// New creates a paused Runner with the Scripts as its task types. It is stopped when the
+// test ends.
+func New(t testing.TB, scripts map[string]*Script, opts ...runner.Option) (*runner.Runner, *Recorder) {
+	t.Helper()
+	funcs := make(map[string]runner.TaskFunc, len(scripts))
+	for name, s := range scripts {
+		funcs[name] = s.Func
+	}
+	rec := NewRecorder()
+	r := runner.NewRunner(runner.Identity{MachineID: "runnertest", Location: "test"}, nil, rec.OnResult, true,
+		append(opts, runner.WithTaskRunners(funcs))...)
+	t.Cleanup(r.Stop)
+	return r, rec
+}
+
+// Trigger runs a task immediately and waits for its result
+func Trigger(t testing.TB, r *runner.Runner, id string) tasks.Result {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	defer cancel()
+	events := r.Listen(ctx, 16)
+	if err := r.RunNow(ctx, id); err != nil {
+		t.Fatalf("runnertest: run %s: %v", id, err)
+	}
+	for e := range events {
+		if e.Task.ID == id {
+			return e.Result
+		}
+	}
+	t.Fatalf("runnertest: no result for %s within %s", id, Timeout)
+	return tasks.Result{}
+}
+
+// AssertRuns fails the test unless the Script ran exactly n times for tasks with the label
+func AssertRuns(t testing.TB, s *Script, label string, n int) {
+	t.Helper()
+	if got := len(s.Runs(label)); got != n {
+		t.Errorf("runnertest: %q ran %d times, want %d", label, got, n)
+	}
+}
+
+// AssertRanWith fails the test unless the Script ran for a task with the label and params
+func AssertRanWith(t testing.TB, s *Script, label string, params map[string]interface{}) {
+	t.Helper()
+	runs := s.Runs(label)
+	for _, c := range runs {
+		if reflect.DeepEqual(c.Params, params) {
+			return
+		}
+	}
+	t.Errorf("runnertest: %q never ran with %v in %d runs", label, params, len(runs))
+}
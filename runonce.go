@@ -0,0 +1,78 @@
+package runner
+
+import (
+	"context"
+	"sync"
+
+	"pkg.goda.sh/tasks"
+)
+
+// WithParallelism lets RunOnce run up to n tasks at the same time, they run one by one otherwise
+func WithParallelism(n int) Option {
+	return func(r *Runner) {
+		r.parallelism = n
+	}
+}
+
+// RunOnce runs every scheduled task a single time, in task list order, and returns their
+// results once all of them are done. Results are recorded like those of scheduled runs.
+// Timerless tasks are skipped. When ctx is done, runs are cancelled, the tasks that didn't
+// start get a cancelled result and the error of ctx is returned. Create the Runner paused
+// to only run tasks through RunOnce.
+func (r *Runner) RunOnce(ctx context.Context) ([]tasks.Result, error) {
+	var list []tasks.Task
+	for _, t := range r.All() {
+		if !r.Timerless(t.Task) {
+			list = append(list, t)
+		}
+	}
+	results := make([]tasks.Result, len(list))
+	slots := make(chan struct{}, max(r.parallelism, 1))
+	var wg sync.WaitGroup
+	for i, t := range list {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			results[i] = tasks.Result{Cancelled: true}
+			continue
+		}
+		wg.Add(1)
+		go func(i int, t tasks.Task) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			results[i] = r.runWith(ctx, t)
+		}(i, t)
+	}
+	wg.Wait()
+	return results, ctx.Err()
+}
+
+// runWith runs a task from the task list once, cancelling the run when ctx is done
+func (r *Runner) runWith(ctx context.Context, t tasks.Task) tasks.Result {
+	fn, ok := r.lookup(t.Task)
+	if !ok {
+		return tasks.Result{Error: ErrUnknownTask}
+	}
+	if ctx.Err() != nil {
+		return tasks.Result{Cancelled: true}
+	}
+	release, ok := r.acquire(t)
+	if !ok {
+		return tasks.Result{Cancelled: true}
+	}
+	defer release()
+	run, cancel := context.WithCancel(t.CTX)
+	defer cancel()
+	defer context.AfterFunc(ctx, cancel)()
+	scheduled := t
+	scheduled.CTX = run
+	result := fn(&tasks.TaskArgs{
+		Task:  scheduled,
+		Stop:  func() {},
+		Redis: r.RedisControl,
+	})
+	if !result.Cancelled {
+		r.record(t, result)
+	}
+	return result
+}
@@ -0,0 +1,253 @@
+// Package s3backup uploads compressed Runner snapshots to an S3-compatible bucket and
+// restores them, for disaster recovery. Requests are signed with AWS Signature Version 4,
+// so it works with AWS S3, MinIO, Ceph and other compatible services.
+//
+// Backups are stored as <Prefix><MachineID>/<timestamp>.json.gz, so keys sort by date.
+package s3backup
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"pkg.goda.sh/runner/v2"
+	"pkg.goda.sh/runner/v2/internal/sigv4"
+)
+
+// keyDate is the timestamp format of backup keys
+const keyDate = "20060102T150405.000Z"
+
+var (
+	// ErrNoBackup is returned by Restore when no backup exists for the runner
+	ErrNoBackup = errors.New("s3backup: no backup found")
+)
+
+// Config describes the bucket backups are written to
+type Config struct {
+	Endpoint     string // ex. https://s3.eu-west-1.amazonaws.com or http://minio:9000
+	Region       string
+	Bucket       string
+	Prefix       string // Prepended to every key, ex. backups/
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+	PathStyle    bool // Address the bucket as <endpoint>/<bucket> instead of <bucket>.<endpoint>, needed for most non-AWS services
+	Client       *http.Client
+}
+
+// Retention decides which backups are deleted after an upload, zero values disable a rule.
+// The most recent backup is always kept.
+type Retention struct {
+	Keep   int           // Number of backups to keep
+	MaxAge time.Duration // Delete backups older than this
+}
+
+// Object is a stored backup
+type Object struct {
+	Key          string    `xml:"Key"`
+	LastModified time.Time `xml:"LastModified"`
+	Size         int64     `xml:"Size"`
+}
+
+// Backup backs a Runner up to a bucket
+type Backup struct {
+	r   *runner.Runner
+	cfg Config
+}
+
+// New creates a Backup for r
+func New(r *runner.Runner, cfg Config) *Backup {
+	if cfg.Client == nil {
+		cfg.Client = http.DefaultClient
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	return &Backup{r: r, cfg: cfg}
+}
+
+// Run uploads a backup at the given cadence and applies the retention rules until ctx is done
+func (b *Backup) Run(ctx context.Context, every time.Duration, keep Retention) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if _, err := b.Upload(ctx); err != nil {
+				b.r.Logger().Error(fmt.Sprintf("Could not upload backup: %v", err))
+				continue
+			}
+			if err := b.Prune(ctx, keep); err != nil {
+				b.r.Logger().Error(fmt.Sprintf("Could not prune backups: %v", err))
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Upload writes a compressed snapshot and returns its key
+func (b *Backup) Upload(ctx context.Context) (string, error) {
+	snap, err := b.r.Snapshot()
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(snap); err != nil {
+		return "", err
+	}
+	if err := zw.Close(); err != nil {
+		return "", err
+	}
+	key := b.machinePrefix() + time.Now().UTC().Format(keyDate) + ".json.gz"
+	resp, err := b.do(ctx, http.MethodPut, key, nil, buf.Bytes(), "application/gzip")
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	return key, nil
+}
+
+// List gets the backups of this runner, oldest first
+func (b *Backup) List(ctx context.Context) ([]Object, error) {
+	var (
+		out   []Object
+		token string
+	)
+	for {
+		q := url.Values{"list-type": {"2"}, "prefix": {b.machinePrefix()}}
+		if token != "" {
+			q.Set("continuation-token", token)
+		}
+		resp, err := b.do(ctx, http.MethodGet, "", q, nil, "")
+		if err != nil {
+			return nil, err
+		}
+		var page struct {
+			Contents              []Object `xml:"Contents"`
+			IsTruncated           bool     `xml:"IsTruncated"`
+			NextContinuationToken string   `xml:"NextContinuationToken"`
+		}
+		err = xml.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, page.Contents...)
+		if !page.IsTruncated || page.NextContinuationToken == "" {
+			break
+		}
+		token = page.NextContinuationToken
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+	return out, nil
+}
+
+// Prune deletes the backups that fall outside of the retention rules
+func (b *Backup) Prune(ctx context.Context, keep Retention) error {
+	list, err := b.List(ctx)
+	if err != nil || len(list) <= 1 {
+		return err
+	}
+	cutoff := time.Now().Add(-keep.MaxAge)
+	for i, obj := range list[:len(list)-1] {
+		expired := keep.MaxAge > 0 && obj.LastModified.Before(cutoff)
+		excess := keep.Keep > 0 && len(list)-i > keep.Keep
+		if !expired && !excess {
+			continue
+		}
+		resp, err := b.do(ctx, http.MethodDelete, obj.Key, nil, nil, "")
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+	}
+	return nil
+}
+
+// Restore applies a backup to the Runner, the most recent one when key is empty
+func (b *Backup) Restore(ctx context.Context, key string) error {
+	if key == "" {
+		list, err := b.List(ctx)
+		if err != nil {
+			return err
+		}
+		if len(list) == 0 {
+			return ErrNoBackup
+		}
+		key = list[len(list)-1].Key
+	}
+	resp, err := b.do(ctx, http.MethodGet, key, nil, nil, "")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	zr, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		return err
+	}
+	snap, err := io.ReadAll(zr)
+	if err != nil {
+		return err
+	}
+	return b.r.RestoreSnapshot(snap)
+}
+
+func (b *Backup) machinePrefix() string {
+	return b.cfg.Prefix + b.r.Identity.MachineID + "/"
+}
+
+// do sends a signed request for an object key, or for the bucket when key is empty
+func (b *Backup) do(ctx context.Context, method, key string, q url.Values, body []byte, contentType string) (*http.Response, error) {
+	u, err := url.Parse(b.cfg.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if b.cfg.PathStyle {
+		u.Path = "/" + b.cfg.Bucket + "/" + key
+	} else {
+		u.Host = b.cfg.Bucket + "." + u.Host
+		u.Path = "/" + key
+	}
+	u.RawPath = sigv4.URIEncode(u.Path, false)
+	u.RawQuery = strings.ReplaceAll(q.Encode(), "+", "%20")
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	payloadHash := sigv4.EmptySHA256
+	if body != nil {
+		payloadHash = sigv4.HashHex(body)
+	}
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	sigv4.Signer{
+		AccessKey:    b.cfg.AccessKey,
+		SecretKey:    b.cfg.SecretKey,
+		SessionToken: b.cfg.SessionToken,
+		Region:       b.cfg.Region,
+		Service:      "s3",
+	}.Sign(req, payloadHash, time.Now())
+	resp, err := b.cfg.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		return nil, fmt.Errorf("s3backup: %s %s: %s: %s", method, key, resp.Status, bytes.TrimSpace(msg))
+	}
+	return resp, nil
+}
@@ -0,0 +1,219 @@
+package runner
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"pkg.goda.sh/tasks"
+)
+
+// SecretScheme prefixes the parameter values referring to a secret, ex. secret://api-token
+const SecretScheme = "secret://"
+
+// Redacted replaces the values of secrets found in results
+const Redacted = "[redacted]"
+
+// ErrSecretNotFound is returned by a SecretResolver that doesn't have a secret
+var ErrSecretNotFound = errors.New("runner: secret not found")
+
+// SecretResolver gets the value of a secret by name
+type SecretResolver interface {
+	Resolve(ctx context.Context, name string) (string, error)
+}
+
+// SecretFunc is a function used as a SecretResolver
+type SecretFunc func(ctx context.Context, name string) (string, error)
+
+// Resolve calls f
+func (f SecretFunc) Resolve(ctx context.Context, name string) (string, error) {
+	return f(ctx, name)
+}
+
+// WithSecrets resolves the secret references of task parameters, see SecretScheme, with the
+// first of the resolvers that has them. References are resolved when the TaskRunner reads
+// its parameters, through ParamsFrom or Params, so the values never reach the task list, the
+// WAL, the Store or snapshots. Values showing up in results are replaced with Redacted.
+func WithSecrets(resolvers ...SecretResolver) Option {
+	return func(r *Runner) {
+		r.secrets = append(r.secrets, resolvers...)
+	}
+}
+
+// EnvSecrets resolves secrets from environment variables: secret://api-token reads
+// <Prefix>API_TOKEN
+type EnvSecrets struct {
+	Prefix string
+}
+
+// Resolve gets the value of the variable named after the secret
+func (e EnvSecrets) Resolve(_ context.Context, name string) (string, error) {
+	key := e.Prefix + strings.ToUpper(strings.NewReplacer("-", "_", ".", "_", "/", "_").Replace(name))
+	v, ok := os.LookupEnv(key)
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrSecretNotFound, name)
+	}
+	return v, nil
+}
+
+// FileSecrets resolves secrets from the files of a directory, ex. those Docker and Kubernetes
+// mount under /run/secrets. A trailing newline is dropped.
+type FileSecrets struct {
+	Dir string
+}
+
+// Resolve reads the file named after the secret
+func (f FileSecrets) Resolve(_ context.Context, name string) (string, error) {
+	if !filepath.IsLocal(name) {
+		return "", fmt.Errorf("%w: %s", ErrSecretNotFound, name)
+	}
+	data, err := os.ReadFile(filepath.Join(f.Dir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("%w: %s", ErrSecretNotFound, name)
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(string(data), "\n"), "\r"), nil
+}
+
+type secretsKey struct{}
+
+// secretSet resolves the references of a task and remembers the values, to redact results
+type secretSet struct {
+	resolvers []SecretResolver
+	mu        sync.Mutex
+	values    map[string]bool
+}
+
+// withSecrets attaches the resolvers of r to a task context
+func (r *Runner) withSecrets(ctx context.Context) context.Context {
+	if len(r.secrets) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, secretsKey{}, &secretSet{resolvers: r.secrets})
+}
+
+// resolveParams resolves the secret references of params in place
+func resolveParams(ctx context.Context, params map[string]interface{}) error {
+	s, _ := ctx.Value(secretsKey{}).(*secretSet)
+	if s == nil {
+		return nil
+	}
+	var errs []error
+	var walk func(v interface{}) interface{}
+	walk = func(v interface{}) interface{} {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			for k, item := range v {
+				v[k] = walk(item)
+			}
+		case []interface{}:
+			for i, item := range v {
+				v[i] = walk(item)
+			}
+		case string:
+			name, ok := strings.CutPrefix(v, SecretScheme)
+			if !ok {
+				return v
+			}
+			value, err := s.resolve(ctx, name)
+			if err != nil {
+				errs = append(errs, err)
+				return v
+			}
+			return value
+		}
+		return v
+	}
+	walk(params)
+	return errors.Join(errs...)
+}
+
+// resolve gets a secret from the first resolver that has it
+func (s *secretSet) resolve(ctx context.Context, name string) (string, error) {
+	for _, res := range s.resolvers {
+		v, err := res.Resolve(ctx, name)
+		if errors.Is(err, ErrSecretNotFound) {
+			continue
+		}
+		if err != nil {
+			return "", fmt.Errorf("secret %s: %w", name, err)
+		}
+		s.mu.Lock()
+		if s.values == nil {
+			s.values = make(map[string]bool)
+		}
+		if v != "" {
+			s.values[v] = true
+		}
+		s.mu.Unlock()
+		return v, nil
+	}
+	return "", fmt.Errorf("%w: %s", ErrSecretNotFound, name)
+}
+
+// redact replaces the secrets resolved for a task in its result
+func redact(t tasks.Task, result tasks.Result) tasks.Result {
+	if t.CTX == nil {
+		return result
+	}
+	s, _ := t.CTX.Value(secretsKey{}).(*secretSet)
+	if s == nil {
+		return result
+	}
+	s.mu.Lock()
+	var pairs []string
+	for v := range s.values {
+		pairs = append(pairs, v, Redacted)
+	}
+	s.mu.Unlock()
+	if len(pairs) == 0 {
+		return result
+	}
+	replacer := strings.NewReplacer(pairs...)
+	if result.Error != nil {
+		if msg := replacer.Replace(result.Error.Error()); msg != result.Error.Error() {
+			result.Error = &redactedError{msg: msg, err: result.Error}
+		}
+	}
+	if result.Update == nil {
+		return result
+	}
+	data, err := json.Marshal(result.Update)
+	if err != nil {
+		return result
+	}
+	var escaped []string
+	for i := 0; i < len(pairs); i += 2 {
+		quoted, _ := json.Marshal(pairs[i])
+		escaped = append(escaped, string(quoted[1:len(quoted)-1]), Redacted)
+	}
+	if out := strings.NewReplacer(escaped...).Replace(string(data)); out != string(data) {
+		var update interface{}
+		if json.Unmarshal([]byte(out), &update) != nil {
+			update = Redacted
+		}
+		result.Update = update
+	}
+	return result
+}
+
+// redactedError is an error with secrets taken out of its message
+type redactedError struct {
+	msg string
+	err error
+}
+
+func (e *redactedError) Error() string {
+	return e.msg
+}
+
+func (e *redactedError) Unwrap() error {
+	return e.err
+}
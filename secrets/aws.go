@@ -0,0 +1,82 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"pkg.goda.sh/runner/v2"
+	"pkg.goda.sh/runner/v2/internal/sigv4"
+)
+
+// AWS resolves secrets from AWS Secrets Manager: secret://prod/db#password reads the password
+// key of the JSON SecretString of prod/db. Requests are signed with Signature Version 4.
+type AWS struct {
+	Region       string
+	Endpoint     string // https://secretsmanager.<Region>.amazonaws.com by default
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+	Client       *http.Client
+}
+
+// Resolve gets the current version of a secret
+func (a *AWS) Resolve(ctx context.Context, name string) (string, error) {
+	id, key := split(name)
+	payload, err := json.Marshal(map[string]string{"SecretId": id})
+	if err != nil {
+		return "", err
+	}
+	endpoint := a.Endpoint
+	if endpoint == "" {
+		endpoint = "https://secretsmanager." + a.Region + ".amazonaws.com"
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(endpoint, "/")+"/", bytes.NewReader(payload))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	sigv4.Signer{
+		AccessKey:    a.AccessKey,
+		SecretKey:    a.SecretKey,
+		SessionToken: a.SessionToken,
+		Region:       a.Region,
+		Service:      "secretsmanager",
+	}.Sign(req, sigv4.HashHex(payload), time.Now())
+	client := a.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	var body struct {
+		SecretString string `json:"SecretString"`
+		Type         string `json:"__type"`
+		Message      string `json:"message"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil && res.StatusCode < 300 {
+		return "", err
+	}
+	if res.StatusCode >= 300 {
+		if strings.HasSuffix(body.Type, "ResourceNotFoundException") {
+			return "", fmt.Errorf("%w: %s", runner.ErrSecretNotFound, name)
+		}
+		return "", fmt.Errorf("secrets manager replied %s: %s %s", res.Status, body.Type, body.Message)
+	}
+	if key == "" {
+		return body.SecretString, nil
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(body.SecretString), &fields); err != nil {
+		return "", fmt.Errorf("%s isn't a JSON object, it has no %s key", id, key)
+	}
+	return pick(id, key, fields)
+}
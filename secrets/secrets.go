@@ -0,0 +1,76 @@
+// Package secrets resolves the secret references of task parameters from Vault and AWS
+// Secrets Manager, see runner.WithSecrets:
+//
+//	r := runner.NewRunner(id, nil, onResult, false, runner.WithSecrets(
+//		runner.EnvSecrets{Prefix: "SECRET_"},
+//		secrets.Cache(&secrets.Vault{Addr: "https://vault:8200", Token: token}, time.Minute),
+//	))
+//
+// Names may select a key of a secret holding several, ex. secret://db#password. Secrets
+// without keys, or a SecretString that isn't a JSON object, are used as a whole.
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"pkg.goda.sh/runner/v2"
+)
+
+// Cache keeps the secrets resolved by res for ttl, so tasks running often don't hit the
+// secret store on every run. Missing secrets aren't cached.
+func Cache(res runner.SecretResolver, ttl time.Duration) runner.SecretResolver {
+	return &cache{res: res, ttl: ttl, values: make(map[string]cached)}
+}
+
+type cache struct {
+	res    runner.SecretResolver
+	ttl    time.Duration
+	mu     sync.Mutex
+	values map[string]cached
+}
+
+type cached struct {
+	value   string
+	expires time.Time
+}
+
+func (c *cache) Resolve(ctx context.Context, name string) (string, error) {
+	c.mu.Lock()
+	v, ok := c.values[name]
+	c.mu.Unlock()
+	if ok && time.Now().Before(v.expires) {
+		return v.value, nil
+	}
+	value, err := c.res.Resolve(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	c.mu.Lock()
+	c.values[name] = cached{value: value, expires: time.Now().Add(c.ttl)}
+	c.mu.Unlock()
+	return value, nil
+}
+
+// split separates a secret name from the key it selects, if any
+func split(name string) (string, string) {
+	name, key, _ := strings.Cut(name, "#")
+	return name, key
+}
+
+// pick gets a key of a secret, the secret itself when no key is selected
+func pick(name, key string, fields map[string]interface{}) (string, error) {
+	v, ok := fields[key]
+	if !ok {
+		return "", fmt.Errorf("%w: %s#%s", runner.ErrSecretNotFound, name, key)
+	}
+	if s, ok := v.(string); ok {
+		return s, nil
+	}
+	data, err := json.Marshal(v)
+	return string(data), err
+}
@@ -0,0 +1,67 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"pkg.goda.sh/runner/v2"
+)
+
+// Vault resolves secrets from a HashiCorp Vault KV version 2 secrets engine: secret://db#password
+// reads the password key of <Mount>/data/db. The value key is used when none is selected.
+type Vault struct {
+	Addr      string // ex. https://vault:8200
+	Token     string
+	Mount     string // secret by default
+	Namespace string // Vault Enterprise namespace
+	Client    *http.Client
+}
+
+// Resolve reads a key of a secret
+func (v *Vault) Resolve(ctx context.Context, name string) (string, error) {
+	path, key := split(name)
+	if key == "" {
+		key = "value"
+	}
+	mount := v.Mount
+	if mount == "" {
+		mount = "secret"
+	}
+	u := strings.TrimSuffix(v.Addr, "/") + "/v1/" + strings.Trim(mount, "/") + "/data/" + (&url.URL{Path: path}).EscapedPath()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", v.Token)
+	if v.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.Namespace)
+	}
+	client := v.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	switch {
+	case res.StatusCode == http.StatusNotFound:
+		return "", fmt.Errorf("%w: %s", runner.ErrSecretNotFound, name)
+	case res.StatusCode >= 300:
+		return "", fmt.Errorf("vault replied %s", res.Status)
+	}
+	var body struct {
+		Data struct {
+			Data map[string]interface{} `json:"data"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		return "", err
+	}
+	return pick(path, key, body.Data.Data)
+}
@@ -0,0 +1,153 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"pkg.goda.sh/tasks"
+)
+
+// SinkBuffer is the number of results queued per sink, results over it are dead-lettered
+const SinkBuffer = 1024
+
+// ErrSinkFull is returned when requeueing a result to a sink whose buffer is full
+var ErrSinkFull = errors.New("runner: sink buffer full")
+
+// Sink receives results like OnResult, returning an error has the delivery retried
+type Sink func(tasks.Task, tasks.Result) error
+
+// Retry bounds the attempts at delivering a result to a Sink
+type Retry struct {
+	Attempts   int           // Including the first one, at least 1
+	Backoff    time.Duration // Wait after the first failure, doubled after each one
+	MaxBackoff time.Duration
+}
+
+// DefaultRetry is the Retry used by WithSink when Attempts is 0
+var DefaultRetry = Retry{Attempts: 5, Backoff: 100 * time.Millisecond, MaxBackoff: 10 * time.Second}
+
+type sink struct {
+	fn    Sink
+	retry Retry
+	queue chan delivery
+}
+
+type delivery struct {
+	task   tasks.Task
+	result tasks.Result
+}
+
+// WithSink delivers every result to fn in order, retrying failed deliveries with backoff.
+// Results that still can't be delivered are moved to the dead-letter set, see Requeue.
+func WithSink(name string, fn Sink, retry Retry) Option {
+	return func(r *Runner) {
+		if retry.Attempts <= 0 {
+			retry = DefaultRetry
+		}
+		if r.sinks == nil {
+			r.sinks = make(map[string]*sink)
+		}
+		r.sinks[name] = &sink{fn: fn, retry: retry, queue: make(chan delivery, SinkBuffer)}
+	}
+}
+
+// sink queues a result for every sink
+func (r *Runner) sink(t tasks.Task, result tasks.Result) {
+	for name, s := range r.sinks {
+		select {
+		case s.queue <- delivery{task: copyTask(t), result: copyResult(result)}:
+		default:
+			r.undeliverable(name, t, result, 0, ErrSinkFull)
+		}
+	}
+}
+
+// startSinks starts delivering to every sink until the Runner stops
+func (r *Runner) startSinks() {
+	if len(r.sinks) == 0 {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	r.mu.Lock()
+	r.cancellations = append(r.cancellations, cancel)
+	r.mu.Unlock()
+	for name, s := range r.sinks {
+		go func(name string, s *sink) {
+			for {
+				select {
+				case d := <-s.queue:
+					r.send(ctx, name, s, d)
+				case <-ctx.Done():
+					return
+				}
+			}
+		}(name, s)
+	}
+}
+
+// send delivers a result to a sink, retrying until it succeeds or runs out of attempts
+func (r *Runner) send(ctx context.Context, name string, s *sink, d delivery) {
+	backoff := s.retry.Backoff
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = s.fn(copyTask(d.task), copyResult(d.result)); err == nil {
+			return
+		}
+		if attempt >= s.retry.Attempts {
+			r.undeliverable(name, d.task, d.result, attempt, err)
+			return
+		}
+		r.logf(slog.LevelWarn, "Could not deliver result of %q (%s/%s) to %s, attempt %d: %v\n", d.task.Label, d.task.Task, d.task.ID, name, attempt, err)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return
+		}
+		if backoff *= 2; s.retry.MaxBackoff > 0 && backoff > s.retry.MaxBackoff {
+			backoff = s.retry.MaxBackoff
+		}
+	}
+}
+
+// undeliverable moves a result that couldn't be delivered to a sink to the dead-letter set
+func (r *Runner) undeliverable(name string, t tasks.Task, result tasks.Result, attempts int, err error) {
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	r.logf(slog.LevelWarn, "Moving result of %q (%s/%s) for %s to the dead-letter set: %v\n", t.Label, t.Task, t.ID, name, err)
+	rec := Record{Date: now, Location: result.Location, Update: result.Update, Warn: result.Warn}
+	if result.Error != nil {
+		rec.Error = result.Error.Error()
+	}
+	spec := r.spec(t.ID)
+	spec.ID = t.ID // Redelivered as is, never added back
+	r.deadLetter(DeadLetter{
+		ID:        fmt.Sprintf("%s:%s:%d", name, t.ID, now),
+		Spec:      spec,
+		Failures:  attempts,
+		Since:     now,
+		LastError: err.Error(),
+		Sink:      name,
+		Result:    &rec,
+	})
+}
+
+// redeliver queues a dead-lettered result for its sink again
+func (r *Runner) redeliver(d DeadLetter) error {
+	s, ok := r.sinks[d.Sink]
+	if !ok {
+		return fmt.Errorf("runner: unknown sink %q", d.Sink)
+	}
+	result := tasks.Result{Update: d.Result.Update, Warn: d.Result.Warn, Location: d.Result.Location}
+	if d.Result.Error != "" {
+		result.Error = errors.New(d.Result.Error)
+	}
+	t := d.Spec.Task()
+	select {
+	case s.queue <- delivery{task: t, result: result}:
+		return nil
+	default:
+		return ErrSinkFull
+	}
+}
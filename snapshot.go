@@ -0,0 +1,75 @@
+package runner
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// SnapshotVersion is the version of the snapshot format written by Snapshot
+const SnapshotVersion = 1
+
+// Snapshot is the serialized state of a Runner
+type Snapshot struct {
+	Version int            `json:"version"`
+	Taken   int64          `json:"taken"`
+	Paused  bool           `json:"paused"`
+	Tasks   []SnapshotTask `json:"tasks"`
+}
+
+// SnapshotTask is a task definition along with its schedule state
+type SnapshotTask struct {
+	ID      string `json:"id"`
+	Spec    Spec   `json:"spec"`
+	LastRun int64  `json:"last_run,omitempty"`
+}
+
+// Snapshot serializes every task definition and its schedule state, encrypted with WithEncryption
+func (r *Runner) Snapshot() ([]byte, error) {
+	snap := Snapshot{
+		Version: SnapshotVersion,
+		Taken:   time.Now().UnixNano() / int64(time.Millisecond),
+		Paused:  r.Paused(),
+		Tasks:   make([]SnapshotTask, 0),
+	}
+	for _, t := range r.Tasks("") {
+		snap.Tasks = append(snap.Tasks, SnapshotTask{
+			ID:      t.ID,
+			Spec:    r.spec(t.ID),
+			LastRun: t.Date,
+		})
+	}
+	raw, err := json.Marshal(snap)
+	if err != nil {
+		return nil, err
+	}
+	return r.sealSnapshot(raw)
+}
+
+// RestoreSnapshot adds every task of a snapshot that isn't already running and restores the
+// paused state. Tasks keep their IDs when restored on the same MachineID and namespace.
+func (r *Runner) RestoreSnapshot(data []byte) error {
+	data, err := r.openSnapshot(data)
+	if err != nil {
+		return err
+	}
+	var snap Snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return err
+	}
+	if snap.Version != SnapshotVersion {
+		return fmt.Errorf("runner: unsupported snapshot version %d", snap.Version)
+	}
+	if snap.Paused {
+		r.Pause(r.ctx)
+	}
+	for _, st := range snap.Tasks {
+		if _, ok := r.find(st.ID); ok {
+			continue
+		}
+		if err := r.AddSpec(r.ctx, st.Spec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
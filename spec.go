@@ -0,0 +1,135 @@
+package runner
+
+import (
+	"context"
+	"strings"
+
+	"pkg.goda.sh/tasks"
+)
+
+// Spec is a serializable task definition along with the scheduling rules attached to it
+type Spec struct {
+	tasks.CleanTask
+	Constraints *Constraints `json:"constraints,omitempty"`
+	// Quorum marks a task as critical: its aggregated result only goes down once this
+	// many machines report a failure at the same time
+	Quorum int `json:"quorum,omitempty"`
+	// IdempotencyKey deduplicates remote submissions of the same job across the fleet
+	IdempotencyKey string `json:"idempotency_key,omitempty"`
+	// Broadcast runs the task on every matching runner, see Runner.Broadcast
+	Broadcast bool `json:"broadcast,omitempty"`
+	// Params are handed to the TaskRunner through the task context, see ParamsFrom
+	Params map[string]interface{} `json:"params,omitempty"`
+	// Tags group tasks for queries and bulk operations, they aren't part of the task ID
+	Tags []string `json:"tags,omitempty"`
+	// Group can be paused, stopped and limited on its own, see Runner.Group
+	Group string `json:"group,omitempty"`
+	// Template and TemplateParams are set on the instances of a Template, see Instantiate
+	Template       string                 `json:"template,omitempty"`
+	TemplateParams map[string]interface{} `json:"template_params,omitempty"`
+}
+
+// Constraints limits which runners a Spec may be placed on
+type Constraints struct {
+	Locations        []string `json:"locations,omitempty"`         // Only place on these Locations
+	ExcludeLocations []string `json:"exclude_locations,omitempty"` // Never place on these Locations
+	Tags             []string `json:"tags,omitempty"`              // Only place on nodes carrying all of these tags
+	ExcludeTags      []string `json:"exclude_tags,omitempty"`      // Never place on nodes carrying any of these tags
+}
+
+// Allows reports whether a runner with the given Identity satisfies the constraints
+func (c *Constraints) Allows(id Identity) bool {
+	if c == nil {
+		return true
+	}
+	if len(c.Locations) > 0 && !containsFold(c.Locations, id.Location) {
+		return false
+	}
+	if containsFold(c.ExcludeLocations, id.Location) {
+		return false
+	}
+	for _, tag := range c.Tags {
+		if !containsFold(id.Tags, tag) {
+			return false
+		}
+	}
+	for _, tag := range c.ExcludeTags {
+		if containsFold(id.Tags, tag) {
+			return false
+		}
+	}
+	return true
+}
+
+// AddSpec adds a task along with its runner-level settings, see Add
+func (r *Runner) AddSpec(ctx context.Context, s Spec) error {
+	t := s.Task()
+	t.Location = r.Identity.Location
+	return r.add(ctx, t, s)
+}
+
+// AddSpecs adds a batch of definitions, all of them or none. The batch is checked with
+// ValidateSpecs before any is added and its errors are returned in a TaskErrors. Should adding
+// one still fail, the ones added before it are removed. It gives the IDs of the tasks added.
+func (r *Runner) AddSpecs(ctx context.Context, specs []Spec) ([]string, error) {
+	if errs := r.ValidateSpecs(specs); len(errs) > 0 {
+		return nil, TaskErrors(errs)
+	}
+	ids := make([]string, 0, len(specs))
+	for _, s := range specs {
+		if err := r.AddSpec(ctx, s); err != nil {
+			for _, id := range ids {
+				r.remove(id)
+			}
+			return nil, err
+		}
+		t := s.Task()
+		t.Location = r.Identity.Location
+		ids = append(ids, r.Hash(t))
+	}
+	return ids, nil
+}
+
+// definition strips the runtime state from a task, leaving what is needed to add it again
+func definition(t tasks.Task) tasks.CleanTask {
+	t.CTX, t.Cancel = nil, nil
+	t.Last, t.Warn, t.Spark, t.Date = nil, false, nil, 0
+	return tasks.CleanTask(t)
+}
+
+// spec gets the definition a task was added with, along with its runner-level settings
+func (r *Runner) spec(id string) Spec {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.specs[id].clone()
+}
+
+// Spec gets the definition a task was added with, along with its runner-level settings
+func (r *Runner) Spec(id string) (Spec, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	s, ok := r.specs[r.resolve(id)]
+	return s.clone(), ok
+}
+
+// Task converts the Spec into a runnable task
+func (s Spec) Task() tasks.Task {
+	return tasks.Task(s.CleanTask)
+}
+
+func containsFold(list []string, v string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// validate checks that a definition can be scheduled by this runner, see ValidateSpec
+func (r *Runner) validate(s Spec) error {
+	if errs := r.check(s); len(errs) > 0 {
+		return errs[0]
+	}
+	return nil
+}
@@ -0,0 +1,447 @@
+package runner
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SQLStore is a Store on top of database/sql. The driver is registered by the embedder,
+// ex. modernc.org/sqlite or github.com/mattn/go-sqlite3 for SQLite.
+type SQLStore struct {
+	db         *sql.DB
+	numbered   bool // Use $1 style placeholders instead of ?
+	executions bool // Keep every result in runner_executions
+}
+
+// sqliteSchema creates the tables used by SQLStore on SQLite
+var sqliteSchema = []string{
+	`CREATE TABLE IF NOT EXISTS runner_tasks (
+		id TEXT PRIMARY KEY,
+		machine TEXT NOT NULL,
+		spec TEXT NOT NULL,
+		updated INTEGER NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS runner_tasks_machine ON runner_tasks (machine)`,
+	`CREATE TABLE IF NOT EXISTS runner_schedules (
+		id TEXT PRIMARY KEY,
+		last_run INTEGER NOT NULL,
+		next_due INTEGER NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS runner_results (
+		id TEXT NOT NULL,
+		date INTEGER NOT NULL,
+		record TEXT NOT NULL,
+		expires BIGINT NOT NULL DEFAULT 0
+	)`,
+	`CREATE INDEX IF NOT EXISTS runner_results_id_date ON runner_results (id, date)`,
+	`CREATE TABLE IF NOT EXISTS runner_dead_letters (
+		id TEXT PRIMARY KEY,
+		entry TEXT NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS runner_locks (
+		key TEXT PRIMARY KEY,
+		value TEXT NOT NULL,
+		expires INTEGER NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS runner_heartbeats (
+		machine TEXT PRIMARY KEY,
+		seen INTEGER NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS runner_schema (
+		version INTEGER NOT NULL
+	)`,
+}
+
+// NewSQLiteStore creates the schema if needed and returns a Store on a SQLite database
+func NewSQLiteStore(ctx context.Context, db *sql.DB) (*SQLStore, error) {
+	s := &SQLStore{db: db}
+	return s, s.exec(ctx, sqliteSchema)
+}
+
+func (s *SQLStore) exec(ctx context.Context, statements []string) error {
+	for _, stmt := range statements {
+		if _, err := s.db.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hasColumn reports whether a SQLite table has a column
+func (s *SQLStore) hasColumn(ctx context.Context, table, column string) (bool, error) {
+	rows, err := s.db.QueryContext(ctx, `PRAGMA table_info(`+table+`)`)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			cid, notNull, pk int
+			name, typ        string
+			def              sql.NullString
+		)
+		if err := rows.Scan(&cid, &name, &typ, &notNull, &def, &pk); err != nil {
+			return false, err
+		}
+		if strings.EqualFold(name, column) {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
+}
+
+// q rewrites ? placeholders for drivers using numbered ones
+func (s *SQLStore) q(query string) string {
+	if !s.numbered {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, c := range query {
+		if c == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// storedSpec is the spec column, the Spec itself or its ciphertext
+type storedSpec struct {
+	Spec
+	Sealed []byte `json:"sealed,omitempty"`
+}
+
+// SaveTask inserts or replaces a task definition
+func (s *SQLStore) SaveTask(ctx context.Context, t StoredTask) error {
+	spec, err := json.Marshal(storedSpec{Spec: t.Spec, Sealed: t.Sealed})
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, s.q(`INSERT INTO runner_tasks (id, machine, spec, updated) VALUES (?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET machine = excluded.machine, spec = excluded.spec, updated = excluded.updated`),
+		t.ID, t.Machine, string(spec), t.Updated)
+	return err
+}
+
+// DeleteTask removes a task definition along with its schedule and results
+func (s *SQLStore) DeleteTask(ctx context.Context, id string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	for _, table := range []string{"runner_tasks", "runner_schedules", "runner_results"} { // Executions are kept
+		if _, err := tx.ExecContext(ctx, s.q(`DELETE FROM `+table+` WHERE id = ?`), id); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// LoadTasks gets every task definition stored for a MachineID
+func (s *SQLStore) LoadTasks(ctx context.Context, machine string) ([]StoredTask, error) {
+	rows, err := s.db.QueryContext(ctx, s.q(`SELECT id, machine, spec, updated FROM runner_tasks WHERE machine = ? ORDER BY updated`), machine)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []StoredTask
+	for rows.Next() {
+		var (
+			t    StoredTask
+			raw  string
+			spec storedSpec
+		)
+		if err := rows.Scan(&t.ID, &t.Machine, &raw, &t.Updated); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(raw), &spec); err != nil {
+			return nil, err
+		}
+		t.Spec, t.Sealed = spec.Spec, spec.Sealed
+		out = append(out, t)
+	}
+	return out, rows.Err()
+}
+
+// SaveSchedule inserts or replaces the schedule state of a task
+func (s *SQLStore) SaveSchedule(ctx context.Context, id string, sc Schedule) error {
+	_, err := s.db.ExecContext(ctx, s.q(`INSERT INTO runner_schedules (id, last_run, next_due) VALUES (?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET last_run = excluded.last_run, next_due = excluded.next_due`),
+		id, sc.LastRun, sc.NextDue)
+	return err
+}
+
+// LoadSchedules gets the schedule state of the given tasks
+func (s *SQLStore) LoadSchedules(ctx context.Context, ids []string) (map[string]Schedule, error) {
+	out := make(map[string]Schedule, len(ids))
+	for _, id := range ids {
+		var sc Schedule
+		err := s.db.QueryRowContext(ctx, s.q(`SELECT last_run, next_due FROM runner_schedules WHERE id = ?`), id).Scan(&sc.LastRun, &sc.NextDue)
+		if err == sql.ErrNoRows {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		out[id] = sc
+	}
+	return out, nil
+}
+
+// SaveResult stores a result and drops the ones older than the most recent keep
+func (s *SQLStore) SaveResult(ctx context.Context, id string, rec Record, keep int) error {
+	raw, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	if _, err := s.db.ExecContext(ctx, s.q(`INSERT INTO runner_results (id, date, record, expires) VALUES (?, ?, ?, ?)`), id, rec.Date, string(raw), rec.Expires); err != nil {
+		return err
+	}
+	if _, err := s.db.ExecContext(ctx, s.q(`DELETE FROM runner_results WHERE id = ? AND expires > 0 AND expires <= ?`),
+		id, time.Now().UnixNano()/int64(time.Millisecond)); err != nil {
+		return err
+	}
+	if s.executions {
+		if err := s.saveExecution(ctx, id, rec, raw); err != nil {
+			return err
+		}
+	}
+	_, err = s.db.ExecContext(ctx, s.q(`DELETE FROM runner_results WHERE id = ? AND date < (
+		SELECT date FROM runner_results WHERE id = ? ORDER BY date DESC LIMIT 1 OFFSET ?
+	)`), id, id, keep-1)
+	return err
+}
+
+// Results gets the most recent results of a task, oldest first
+func (s *SQLStore) Results(ctx context.Context, id string, limit int) ([]Record, error) {
+	rows, err := s.db.QueryContext(ctx, s.q(`SELECT record FROM runner_results WHERE id = ? AND (expires = 0 OR expires > ?) ORDER BY date DESC LIMIT ?`),
+		id, time.Now().UnixNano()/int64(time.Millisecond), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []Record
+	for rows.Next() {
+		var (
+			raw string
+			rec Record
+		)
+		if err := rows.Scan(&raw); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(raw), &rec); err != nil {
+			return nil, err
+		}
+		out = append([]Record{rec}, out...)
+	}
+	return out, rows.Err()
+}
+
+// SaveDeadLetter inserts or replaces a dead letter
+func (s *SQLStore) SaveDeadLetter(ctx context.Context, d DeadLetter) error {
+	raw, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, s.q(`INSERT INTO runner_dead_letters (id, entry) VALUES (?, ?)
+		ON CONFLICT (id) DO UPDATE SET entry = excluded.entry`), d.ID, string(raw))
+	return err
+}
+
+// DeleteDeadLetter removes a dead letter
+func (s *SQLStore) DeleteDeadLetter(ctx context.Context, id string) error {
+	_, err := s.db.ExecContext(ctx, s.q(`DELETE FROM runner_dead_letters WHERE id = ?`), id)
+	return err
+}
+
+// LoadDeadLetters gets every dead letter
+func (s *SQLStore) LoadDeadLetters(ctx context.Context) ([]DeadLetter, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT entry FROM runner_dead_letters`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []DeadLetter
+	for rows.Next() {
+		var (
+			raw string
+			d   DeadLetter
+		)
+		if err := rows.Scan(&raw); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(raw), &d); err != nil {
+			return nil, err
+		}
+		out = append(out, d)
+	}
+	return out, rows.Err()
+}
+
+// Lock claims a key unless it is held and not expired
+func (s *SQLStore) Lock(ctx context.Context, key, value string, ttl time.Duration) (string, bool, error) {
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", false, err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, s.q(`DELETE FROM runner_locks WHERE key = ? AND expires <= ?`), key, now); err != nil {
+		return "", false, err
+	}
+	res, err := tx.ExecContext(ctx, s.q(`INSERT INTO runner_locks (key, value, expires) VALUES (?, ?, ?) ON CONFLICT (key) DO NOTHING`),
+		key, value, now+int64(ttl/time.Millisecond))
+	if err != nil {
+		return "", false, err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return "", false, err
+	} else if n == 1 {
+		return value, true, tx.Commit()
+	}
+	var existing string
+	if err := tx.QueryRowContext(ctx, s.q(`SELECT value FROM runner_locks WHERE key = ?`), key).Scan(&existing); err != nil {
+		return "", false, err
+	}
+	return existing, false, tx.Commit()
+}
+
+// Unlock releases a key
+func (s *SQLStore) Unlock(ctx context.Context, key string) error {
+	_, err := s.db.ExecContext(ctx, s.q(`DELETE FROM runner_locks WHERE key = ?`), key)
+	return err
+}
+
+// SaveHeartbeat inserts or replaces when a machine was last seen
+func (s *SQLStore) SaveHeartbeat(ctx context.Context, machine string, seen int64) error {
+	_, err := s.db.ExecContext(ctx, s.q(`INSERT INTO runner_heartbeats (machine, seen) VALUES (?, ?)
+		ON CONFLICT (machine) DO UPDATE SET seen = excluded.seen`), machine, seen)
+	return err
+}
+
+// Machines gets every machine with stored tasks and when it was last active
+func (s *SQLStore) Machines(ctx context.Context) (map[string]int64, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT t.machine, MAX(t.updated), COALESCE(MAX(h.seen), 0)
+		FROM runner_tasks t LEFT JOIN runner_heartbeats h ON h.machine = t.machine GROUP BY t.machine`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make(map[string]int64)
+	for rows.Next() {
+		var (
+			machine       string
+			updated, seen int64
+		)
+		if err := rows.Scan(&machine, &updated, &seen); err != nil {
+			return nil, err
+		}
+		out[machine] = max64(updated, seen)
+	}
+	return out, rows.Err()
+}
+
+// DeleteMachine removes the state of a machine, keeping executions
+func (s *SQLStore) DeleteMachine(ctx context.Context, machine string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, stmt := range []string{
+		`DELETE FROM runner_schedules WHERE id IN (SELECT id FROM runner_tasks WHERE machine = ?)`,
+		`DELETE FROM runner_results WHERE id IN (SELECT id FROM runner_tasks WHERE machine = ?)`,
+		`DELETE FROM runner_tasks WHERE machine = ?`,
+		`DELETE FROM runner_heartbeats WHERE machine = ?`,
+	} {
+		if _, err := tx.ExecContext(ctx, s.q(stmt), machine); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// CompactResults rewrites the stored results of a task in a transaction, keeping executions.
+// Only the results up to the newest one read are replaced, results saved meanwhile are kept.
+func (s *SQLStore) CompactResults(ctx context.Context, id string, limit int, fn func([]Record) ([]Record, bool)) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	rows, err := tx.QueryContext(ctx, s.q(`SELECT record FROM runner_results WHERE id = ? AND (expires = 0 OR expires > ?) ORDER BY date DESC LIMIT ?`),
+		id, time.Now().UnixNano()/int64(time.Millisecond), limit)
+	if err != nil {
+		return err
+	}
+	var recs []Record
+	for rows.Next() {
+		var (
+			raw string
+			rec Record
+		)
+		if err := rows.Scan(&raw); err != nil {
+			rows.Close()
+			return err
+		}
+		if err := json.Unmarshal([]byte(raw), &rec); err != nil {
+			rows.Close()
+			return err
+		}
+		recs = append([]Record{rec}, recs...)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(recs) == 0 {
+		return nil
+	}
+	newest := recs[len(recs)-1].Date
+	recs, changed := fn(recs)
+	if !changed {
+		return nil
+	}
+	if _, err := tx.ExecContext(ctx, s.q(`DELETE FROM runner_results WHERE id = ? AND date <= ?`), id, newest); err != nil {
+		return err
+	}
+	for _, rec := range recs {
+		raw, err := json.Marshal(rec)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, s.q(`INSERT INTO runner_results (id, date, record, expires) VALUES (?, ?, ?, ?)`), id, rec.Date, string(raw), rec.Expires); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// SchemaVersion gets the version of the stored state
+func (s *SQLStore) SchemaVersion(ctx context.Context) (v int, err error) {
+	err = s.db.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM runner_schema`).Scan(&v)
+	return v, err
+}
+
+// SetSchemaVersion records the version of the stored state
+func (s *SQLStore) SetSchemaVersion(ctx context.Context, v int) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, `DELETE FROM runner_schema`); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, s.q(`INSERT INTO runner_schema (version) VALUES (?)`), v); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,128 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+)
+
+// ErrNoStore is returned when a feature requiring persistence is used without a Store
+var ErrNoStore = errors.New("runner: no store configured")
+
+// StoredTask is a task definition as kept by a Store
+type StoredTask struct {
+	ID      string `json:"id"`
+	Machine string `json:"machine"`
+	Spec    Spec   `json:"spec"`
+	Sealed  []byte `json:"sealed,omitempty"` // Spec encrypted with WithEncryption
+	Updated int64  `json:"updated"`
+}
+
+// Schedule is the persisted schedule state of a task
+type Schedule struct {
+	LastRun int64 `json:"last_run"`
+	NextDue int64 `json:"next_due"`
+}
+
+// Store persists task definitions, schedules and recent results
+type Store interface {
+	SaveTask(ctx context.Context, t StoredTask) error
+	DeleteTask(ctx context.Context, id string) error
+	// LoadTasks gets every task stored for a MachineID
+	LoadTasks(ctx context.Context, machine string) ([]StoredTask, error)
+	SaveSchedule(ctx context.Context, id string, s Schedule) error
+	LoadSchedules(ctx context.Context, ids []string) (map[string]Schedule, error)
+	// SaveResult stores a result, keeping at most keep results per task
+	SaveResult(ctx context.Context, id string, rec Record, keep int) error
+	// Results gets up to limit of the most recent results of a task, oldest first
+	Results(ctx context.Context, id string, limit int) ([]Record, error)
+	// Lock claims a key for ttl unless it is already held, in which case it returns
+	// the value of the current holder and false
+	Lock(ctx context.Context, key, value string, ttl time.Duration) (string, bool, error)
+	Unlock(ctx context.Context, key string) error
+}
+
+// WithStore persists the task list and results, and restores the stored tasks of this
+// MachineID when the Runner is created.
+func WithStore(s Store) Option {
+	return func(r *Runner) {
+		r.store = s
+	}
+}
+
+// restore adds the stored tasks of this node
+func (r *Runner) restore() {
+	if r.store == nil {
+		return
+	}
+	stored, err := r.store.LoadTasks(context.Background(), r.Identity.MachineID)
+	if err != nil {
+		r.logf(slog.LevelError, "Could not load stored tasks: %v\n", err)
+		return
+	}
+	for _, st := range stored {
+		if st.Sealed != nil {
+			if st.Spec, err = r.unseal(st.Sealed); err != nil {
+				r.logf(slog.LevelError, "Could not decrypt stored task %s: %v\n", st.ID, err)
+				continue
+			}
+		}
+		if err := r.AddSpec(r.ctx, st.Spec); err != nil && !errors.Is(err, ErrDuplicateTask) {
+			r.logf(slog.LevelError, "Could not restore stored task %s: %v\n", st.ID, err)
+			continue
+		}
+		if id := r.Hash(st.Spec.Task()); id != st.ID {
+			r.logf(slog.LevelInfo, "Migrated stored task %s to %s\n", st.ID, id)
+			r.unpersistTask(st.ID)
+		}
+	}
+}
+
+func (r *Runner) persistTask(id string, spec Spec) {
+	if r.store == nil {
+		return
+	}
+	st := StoredTask{
+		ID:      id,
+		Machine: r.Identity.MachineID,
+		Spec:    spec,
+		Updated: time.Now().UnixNano() / int64(time.Millisecond),
+	}
+	if r.cipher != nil {
+		sealed, err := r.seal(spec)
+		if err != nil {
+			r.logf(slog.LevelError, "Could not encrypt task %s: %v\n", id, err)
+			return
+		}
+		st.Spec, st.Sealed = Spec{}, sealed
+	}
+	if err := r.store.SaveTask(context.Background(), st); err != nil {
+		r.logf(slog.LevelError, "Could not store task %s: %v\n", id, err)
+	}
+}
+
+func (r *Runner) unpersistTask(id string) {
+	if r.store == nil {
+		return
+	}
+	if err := r.store.DeleteTask(context.Background(), id); err != nil {
+		r.logf(slog.LevelError, "Could not delete stored task %s: %v\n", id, err)
+	}
+}
+
+func (r *Runner) persistResult(id string, rec Record) {
+	if r.store == nil {
+		return
+	}
+	keep := r.historySize
+	if r.compaction != nil {
+		keep = MaxCompactedResults // Results are kept by age
+	} else if keep <= 0 {
+		keep = DefaultHistorySize
+	}
+	rec.Expires = r.expiry(id, rec.Date)
+	if err := r.store.SaveResult(context.Background(), id, rec, keep); err != nil {
+		r.logf(slog.LevelError, "Could not store result of %s: %v\n", id, err)
+	}
+}
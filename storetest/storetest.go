@@ -0,0 +1,294 @@
+// Package storetest checks that a runner.Store behaves like the others, so every store is
+// held to the same contract:
+//
+//	func TestStore(t *testing.T) {
+//		storetest.Run(t, runner.NewMemoryStore())
+//	}
+//
+// Keys, IDs and machines are unique to every run, so stores shared with other tests or
+// left over from earlier runs can be checked.
+package storetest
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"pkg.goda.sh/runner/v2"
+	"pkg.goda.sh/tasks"
+)
+
+// Run checks s against the contract of runner.Store, and of runner.ResultCompactor when s
+// implements it
+func Run(t *testing.T, s runner.Store) {
+	t.Helper()
+	prefix := fmt.Sprintf("storetest-%d-", time.Now().UnixNano())
+	t.Run("Tasks", func(t *testing.T) { testTasks(t, s, prefix+"tasks-") })
+	t.Run("Schedules", func(t *testing.T) { testSchedules(t, s, prefix+"schedules-") })
+	t.Run("SaveResultKeeps", func(t *testing.T) { testKeep(t, s, prefix+"keep-") })
+	t.Run("ResultsExpire", func(t *testing.T) { testExpiry(t, s, prefix+"expiry-") })
+	t.Run("Lock", func(t *testing.T) { testLock(t, s, prefix+"lock-") })
+	if c, ok := s.(runner.ResultCompactor); ok {
+		t.Run("CompactResults", func(t *testing.T) { testCompact(t, s, c, prefix+"compact-") })
+	}
+}
+
+// now is the current time in milliseconds, the unit of Record dates
+func now() int64 {
+	return time.Now().UnixNano() / int64(time.Millisecond)
+}
+
+// save stores results dated from to to-1
+func save(t *testing.T, s runner.Store, id string, from, to int64, keep int) {
+	t.Helper()
+	for date := from; date < to; date++ {
+		if err := s.SaveResult(context.Background(), id, runner.Record{Date: date, Update: float64(date - from)}, keep); err != nil {
+			t.Fatalf("save result %d of %s: %v", date, id, err)
+		}
+	}
+}
+
+// dates gets the dates of the results of a task, oldest first
+func dates(t *testing.T, s runner.Store, id string, limit int) []int64 {
+	t.Helper()
+	recs, err := s.Results(context.Background(), id, limit)
+	if err != nil {
+		t.Fatalf("results of %s: %v", id, err)
+	}
+	out := make([]int64, len(recs))
+	for i, rec := range recs {
+		out[i] = rec.Date
+	}
+	return out
+}
+
+// span gets the dates from to to-1
+func span(from, to int64) []int64 {
+	out := make([]int64, 0, to-from)
+	for date := from; date < to; date++ {
+		out = append(out, date)
+	}
+	return out
+}
+
+func testTasks(t *testing.T, s runner.Store, prefix string) {
+	ctx := context.Background()
+	machine, other := prefix+"machine", prefix+"other"
+	spec := func(label string) runner.Spec {
+		return runner.Spec{CleanTask: tasks.CleanTask{Label: label, Task: "probe", Interval: "PT1M"}, Tags: []string{"edge"}}
+	}
+	for i, st := range []runner.StoredTask{
+		{ID: prefix + "a", Machine: machine, Spec: spec("a"), Updated: 1},
+		{ID: prefix + "b", Machine: machine, Spec: spec("b"), Updated: 2},
+		{ID: prefix + "c", Machine: other, Spec: spec("c"), Updated: 3},
+		{ID: prefix + "a", Machine: machine, Spec: spec("a again"), Updated: 4}, // Replaces the first
+	} {
+		if err := s.SaveTask(ctx, st); err != nil {
+			t.Fatalf("save task %d: %v", i, err)
+		}
+	}
+	list, err := s.LoadTasks(ctx, machine)
+	if err != nil {
+		t.Fatal(err)
+	}
+	labels := map[string]string{}
+	for _, st := range list {
+		labels[st.ID] = st.Spec.Label
+		if !reflect.DeepEqual(st.Spec.Tags, []string{"edge"}) {
+			t.Errorf("%s: loaded tags %v, want [edge]", st.ID, st.Spec.Tags)
+		}
+	}
+	if want := map[string]string{prefix + "a": "a again", prefix + "b": "b"}; !reflect.DeepEqual(labels, want) {
+		t.Errorf("loaded %v for %s, want %v", labels, machine, want)
+	}
+
+	if err := s.SaveSchedule(ctx, prefix+"b", runner.Schedule{LastRun: 1, NextDue: 2}); err != nil {
+		t.Fatal(err)
+	}
+	save(t, s, prefix+"b", now(), now()+3, 10)
+	if err := s.DeleteTask(ctx, prefix+"b"); err != nil {
+		t.Fatal(err)
+	}
+	if list, _ := s.LoadTasks(ctx, machine); len(list) != 1 || list[0].ID != prefix+"a" {
+		t.Errorf("loaded %v after deleting %sb, want only %sa", list, prefix, prefix)
+	}
+	if scheds, _ := s.LoadSchedules(ctx, []string{prefix + "b"}); len(scheds) > 0 {
+		t.Errorf("loaded schedules %v of a deleted task", scheds)
+	}
+	if got := dates(t, s, prefix+"b", 10); len(got) > 0 {
+		t.Errorf("loaded results %v of a deleted task", got)
+	}
+	if err := s.DeleteTask(ctx, prefix+"missing"); err != nil {
+		t.Errorf("deleting a missing task: %v", err)
+	}
+}
+
+func testSchedules(t *testing.T, s runner.Store, prefix string) {
+	ctx := context.Background()
+	for i, sc := range []runner.Schedule{{LastRun: 10, NextDue: 20}, {LastRun: 30, NextDue: 40}} {
+		if err := s.SaveSchedule(ctx, prefix+"a", sc); err != nil {
+			t.Fatalf("save schedule %d: %v", i, err)
+		}
+	}
+	if err := s.SaveSchedule(ctx, prefix+"b", runner.Schedule{LastRun: 50, NextDue: 60}); err != nil {
+		t.Fatal(err)
+	}
+	scheds, err := s.LoadSchedules(ctx, []string{prefix + "a", prefix + "b", prefix + "missing"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]runner.Schedule{prefix + "a": {LastRun: 30, NextDue: 40}, prefix + "b": {LastRun: 50, NextDue: 60}}
+	if !reflect.DeepEqual(scheds, want) {
+		t.Errorf("loaded %v, want %v", scheds, want)
+	}
+}
+
+// testKeep checks the trimming of results to the most recent keep, SQL stores delete those
+// older than the one at OFFSET keep-1
+func testKeep(t *testing.T, s runner.Store, prefix string) {
+	start := now()
+	for _, c := range []struct {
+		keep, saved int
+	}{{1, 4}, {3, 2}, {3, 3}, {3, 10}, {50, 60}} {
+		id := fmt.Sprintf("%s%d-%d", prefix, c.keep, c.saved)
+		save(t, s, id, start, start+int64(c.saved), c.keep)
+		kept := c.saved
+		if kept > c.keep {
+			kept = c.keep
+		}
+		want := span(start+int64(c.saved-kept), start+int64(c.saved))
+		if got := dates(t, s, id, 100); !reflect.DeepEqual(got, want) {
+			t.Errorf("keep %d of %d: kept %v, want %v", c.keep, c.saved, got, want)
+		}
+		if kept > 1 {
+			if got := dates(t, s, id, 2); !reflect.DeepEqual(got, want[len(want)-2:]) {
+				t.Errorf("keep %d of %d: got %v with a limit of 2, want the 2 most recent oldest first", c.keep, c.saved, got)
+			}
+		}
+	}
+	// Lowering keep trims the results saved with a higher one
+	id := prefix + "lowered"
+	save(t, s, id, start, start+10, 10)
+	save(t, s, id, start+10, start+11, 2)
+	if got := dates(t, s, id, 100); !reflect.DeepEqual(got, span(start+9, start+11)) {
+		t.Errorf("kept %v after saving with a lower keep, want %v", got, span(start+9, start+11))
+	}
+	// Tasks are trimmed on their own
+	a, b := prefix+"a", prefix+"b"
+	save(t, s, a, start, start+5, 5)
+	save(t, s, b, start, start+5, 2)
+	if got := dates(t, s, a, 100); len(got) != 5 {
+		t.Errorf("kept %d results of %s trimming %s, want 5", len(got), a, b)
+	}
+}
+
+func testExpiry(t *testing.T, s runner.Store, prefix string) {
+	ctx := context.Background()
+	start := now()
+	id := prefix + "task"
+	for _, rec := range []runner.Record{
+		{Date: start, Expires: start - 1},
+		{Date: start + 1},
+		{Date: start + 2, Expires: start + int64(time.Hour/time.Millisecond)},
+	} {
+		if err := s.SaveResult(ctx, id, rec, 10); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, want := dates(t, s, id, 10), []int64{start + 1, start + 2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want the results that haven't expired %v", got, want)
+	}
+}
+
+func testLock(t *testing.T, s runner.Store, prefix string) {
+	ctx := context.Background()
+	key := prefix + "key"
+	lock := func(value string, ttl time.Duration, wantHolder string, wantOK bool) {
+		t.Helper()
+		holder, ok, err := s.Lock(ctx, key, value, ttl)
+		if err != nil {
+			t.Fatalf("lock %s for %s: %v", key, value, err)
+		}
+		if holder != wantHolder || ok != wantOK {
+			t.Errorf("lock %s for %s: got %q, %t, want %q, %t", key, value, holder, ok, wantHolder, wantOK)
+		}
+	}
+	lock("first", time.Minute, "first", true)
+	lock("second", time.Minute, "first", false)
+	if holder, ok, err := s.Lock(ctx, prefix+"other", "second", time.Minute); err != nil || !ok || holder != "second" {
+		t.Errorf("lock %sother: got %q, %t, %v, want keys held on their own", prefix, holder, ok, err)
+	}
+	if err := s.Unlock(ctx, key); err != nil {
+		t.Fatal(err)
+	}
+	lock("second", 200*time.Millisecond, "second", true)
+	lock("third", time.Minute, "second", false)
+	time.Sleep(400 * time.Millisecond) // Expired, the next lock replaces it
+	lock("third", time.Minute, "third", true)
+	lock("second", time.Minute, "third", false)
+	for _, k := range []string{key, prefix + "other"} {
+		if err := s.Unlock(ctx, k); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Unlock(ctx, prefix+"missing"); err != nil {
+		t.Errorf("unlocking a missing key: %v", err)
+	}
+}
+
+func testCompact(t *testing.T, s runner.Store, c runner.ResultCompactor, prefix string) {
+	ctx := context.Background()
+	start := now()
+	id := prefix + "task"
+	save(t, s, id, start, start+6, 10)
+	compact := func(limit int, fn func([]runner.Record) ([]runner.Record, bool)) {
+		t.Helper()
+		if err := c.CompactResults(ctx, id, limit, fn); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var read []int64
+	compact(4, func(recs []runner.Record) ([]runner.Record, bool) {
+		for _, rec := range recs {
+			read = append(read, rec.Date)
+		}
+		return nil, false
+	})
+	if want := span(start+2, start+6); !reflect.DeepEqual(read, want) {
+		t.Errorf("compacting read %v, want the 4 most recent oldest first %v", read, want)
+	}
+	if got := dates(t, s, id, 10); !reflect.DeepEqual(got, span(start, start+6)) {
+		t.Errorf("got %v after compacting without changes, want every result kept", got)
+	}
+
+	compact(10, func(recs []runner.Record) ([]runner.Record, bool) {
+		merged := runner.Record{Date: recs[0].Date, Rollup: &runner.Rollup{Runs: len(recs) - 1}}
+		return []runner.Record{merged, recs[len(recs)-1]}, true
+	})
+	recs, err := s.Results(ctx, id, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != 2 || recs[0].Date != start || recs[0].Rollup == nil || recs[0].Rollup.Runs != 5 || recs[1].Date != start+5 {
+		t.Errorf("got %+v after compacting, want the rollup and the last result", recs)
+	}
+
+	save(t, s, id, start+6, start+8, 3) // Compacted results are trimmed like the others
+	if got, want := dates(t, s, id, 10), span(start+5, start+8); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v saving after compacting, want %v", got, want)
+	}
+
+	compact(10, func([]runner.Record) ([]runner.Record, bool) { return nil, true })
+	if got := dates(t, s, id, 10); len(got) > 0 {
+		t.Errorf("got %v after compacting to nothing, want no results", got)
+	}
+	compact(10, func(recs []runner.Record) ([]runner.Record, bool) {
+		if len(recs) > 0 {
+			t.Errorf("compacting read %d results of a task without any", len(recs))
+		}
+		return recs, false
+	})
+}
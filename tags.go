@@ -0,0 +1,125 @@
+package runner
+
+import (
+	"context"
+	"iter"
+	"strings"
+
+	"pkg.goda.sh/tasks"
+)
+
+// WithTagRoute hands the results of every task tagged with tag to fn, on top of OnResult
+func WithTagRoute(tag string, fn func(tasks.Task, tasks.Result)) Option {
+	return func(r *Runner) {
+		if r.routes == nil {
+			r.routes = make(map[string][]func(tasks.Task, tasks.Result))
+		}
+		tag = strings.ToLower(tag)
+		r.routes[tag] = append(r.routes[tag], fn)
+	}
+}
+
+// Tags gets the tags of a task
+func (r *Runner) Tags(id string) []string {
+	return append([]string(nil), r.spec(r.resolve(id)).Tags...)
+}
+
+// Tagged iterates over the tasks carrying every one of tags
+func (r *Runner) Tagged(tags ...string) iter.Seq2[string, tasks.Task] {
+	return r.Where(func(t tasks.Task) bool { return r.tagged(t.ID, tags) })
+}
+
+// Retag replaces the tags of a task. Tags aren't part of the hash, so the ID is kept.
+func (r *Runner) Retag(ctx context.Context, id string, tags ...string) (string, error) {
+	id = r.resolve(id)
+	if _, ok := r.find(id); !ok {
+		return "", ErrUnknownTask
+	}
+	spec := r.spec(id)
+	spec.Tags = tags
+	return r.replace(ctx, id, spec)
+}
+
+// PauseTagged pauses the tasks carrying tag until ResumeTagged, unless ctx is already done
+func (r *Runner) PauseTagged(ctx context.Context, tag string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	if r.pausedTags == nil {
+		r.pausedTags = make(map[string]bool)
+	}
+	r.pausedTags[strings.ToLower(tag)] = true
+	r.mu.Unlock()
+	return nil
+}
+
+// ResumeTagged restarts the tasks carrying tag, unless ctx is already done. Tasks that
+// carry another paused tag stay paused.
+func (r *Runner) ResumeTagged(ctx context.Context, tag string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	delete(r.pausedTags, strings.ToLower(tag))
+	r.mu.Unlock()
+	return nil
+}
+
+// RemoveTagged removes every task carrying tag and returns their IDs
+func (r *Runner) RemoveTagged(tag string) (ids []string) {
+	for id := range r.Tagged(tag) {
+		ids = append(ids, id)
+	}
+	for _, id := range ids {
+		r.remove(id)
+	}
+	return ids
+}
+
+// tagged reports whether a task carries every one of tags
+func (r *Runner) tagged(id string, tags []string) bool {
+	spec := r.spec(id)
+	for _, tag := range tags {
+		if !containsFold(spec.Tags, tag) {
+			return false
+		}
+	}
+	return true
+}
+
+// paused reports whether a task shouldn't run, because the runner, its group or one of its
+// tags is paused
+func (r *Runner) paused(id string) bool {
+	if r.halted.Load() {
+		return true
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.held(r.specs[id])
+}
+
+// held reports whether the group or one of the tags of a spec is paused, r.mu must be held
+func (r *Runner) held(s Spec) bool {
+	if g := r.groups[strings.ToLower(s.Group)]; g != nil && g.paused {
+		return true
+	}
+	for _, tag := range s.Tags {
+		if r.pausedTags[strings.ToLower(tag)] {
+			return true
+		}
+	}
+	return false
+}
+
+// route hands a result to the handlers of the task's tags
+func (r *Runner) route(t tasks.Task, result tasks.Result) {
+	if len(r.routes) == 0 {
+		return
+	}
+	for _, tag := range r.spec(t.ID).Tags {
+		for _, fn := range r.routes[strings.ToLower(tag)] {
+			fn(copyTask(t), copyResult(result))
+		}
+	}
+}
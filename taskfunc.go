@@ -0,0 +1,144 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"pkg.goda.sh/tasks"
+)
+
+// TaskFunc runs a task once, like the Func of the tasks.TaskRunners
+type TaskFunc func(*tasks.TaskArgs) tasks.Result
+
+// TaskType holds the settings of a task type registered on a Runner, see Register
+type TaskType struct {
+	Params    ParamSchema   // Checked when tasks are added, see WithParamSchema
+	Interval  time.Duration // Of tasks without one, see WithDefaultInterval
+	Timerless bool          // Tasks run once when added and report through their Callback, like the timerless tasks.TaskRunners
+}
+
+// WithTaskRunners adds task types to this Runner only, taking precedence over tasks.TaskRunners
+func WithTaskRunners(funcs map[string]TaskFunc) Option {
+	return func(r *Runner) {
+		for name, fn := range funcs {
+			r.register(name, fn, TaskType{}, false)
+		}
+	}
+}
+
+// Register adds a task type to this Runner only, taking precedence over tasks.TaskRunners, so
+// Runners of the same process can run different task types and tests don't need to change
+// global state. Registering a type again replaces it for the tasks added from then on.
+func (r *Runner) Register(name string, fn TaskFunc, typ TaskType) error {
+	if name == "" || fn == nil {
+		return fmt.Errorf("%w: task type %q without a name or func", ErrInvalidTask, name)
+	}
+	r.register(name, fn, typ, true)
+	return nil
+}
+
+// register adds a task type, replacing the settings of a type registered before under the
+// name when replace is set. WithTaskRunners keeps those of WithParamSchema and
+// WithDefaultInterval, options applied in any order.
+func (r *Runner) register(name string, fn TaskFunc, typ TaskType, replace bool) {
+	name = strings.ToLower(name)
+	r.types.Lock()
+	defer r.types.Unlock()
+	if r.funcs == nil {
+		r.funcs = make(map[string]TaskFunc)
+	}
+	r.funcs[name] = fn
+	if replace {
+		delete(r.schemas, name)
+		delete(r.intervals, name)
+		delete(r.timerless, name)
+	}
+	if typ.Params != nil {
+		if r.schemas == nil {
+			r.schemas = make(map[string]ParamSchema)
+		}
+		r.schemas[name] = typ.Params
+	}
+	if typ.Interval > 0 {
+		if r.intervals == nil {
+			r.intervals = map[string]time.Duration{"": DefaultInterval}
+		}
+		r.intervals[name] = typ.Interval
+	}
+	if typ.Timerless {
+		if r.timerless == nil {
+			r.timerless = make(map[string]bool)
+		}
+		r.timerless[name] = true
+	}
+}
+
+// Timerless reports whether tasks of a type run once when added rather than on an interval
+func (r *Runner) Timerless(typ string) bool {
+	r.types.RLock()
+	defer r.types.RUnlock()
+	return r.timerless[strings.ToLower(typ)] || tasks.Timerless(typ)
+}
+
+// RunType runs a task type once with params for the task t, for task types made of others,
+// ex. checking several things in one run. The run has the context of t, so it's cancelled
+// with it and resolves secret references like t, and its Label and Spark. Params are
+// checked against the schema of the type, timerless types can't run this way.
+func (r *Runner) RunType(t tasks.Task, typ string, params map[string]interface{}) tasks.Result {
+	fn, ok := r.lookup(typ)
+	if !ok {
+		return tasks.Result{Error: fmt.Errorf("%w: %s", ErrUnknownTask, typ)}
+	}
+	if r.Timerless(typ) {
+		return tasks.Result{Error: fmt.Errorf("%w: %s", ErrTimerless, typ)}
+	}
+	if schema, ok := r.ParamSchema(typ); ok {
+		if err := errors.Join(schema.Check(params)...); err != nil {
+			return tasks.Result{Error: err}
+		}
+	}
+	ctx := t.CTX
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	t.Task, t.CTX = typ, withParams(ctx, copyParams(params))
+	return fn(&tasks.TaskArgs{Task: t, Stop: func() {}, Redis: r.RedisControl})
+}
+
+// TaskTypes gets the task types this Runner can run, lowercased and sorted
+func (r *Runner) TaskTypes() []string {
+	r.types.RLock()
+	defer r.types.RUnlock()
+	seen := make(map[string]bool, len(r.funcs)+len(tasks.TaskRunners))
+	for name := range r.funcs {
+		seen[name] = true
+	}
+	for name := range tasks.TaskRunners {
+		seen[strings.ToLower(name)] = true
+	}
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// lookup gets the TaskFunc of a task type
+func (r *Runner) lookup(name string) (TaskFunc, bool) {
+	name = strings.ToLower(name)
+	r.types.RLock()
+	fn, ok := r.funcs[name]
+	r.types.RUnlock()
+	if ok {
+		return fn, true
+	}
+	if typ, ok := tasks.TaskRunners[name]; ok {
+		return typ.Func, true
+	}
+	return nil, false
+}
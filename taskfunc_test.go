@@ -0,0 +1,34 @@
+package runner_test
+
+import (
+	"testing"
+	"time"
+
+	"pkg.goda.sh/runner/v2"
+	"pkg.goda.sh/runner/v2/runnertest"
+)
+
+func TestRegisterAgainReplacesTheType(t *testing.T) {
+	probe := runnertest.NewScript()
+	r, _ := runnertest.New(t, map[string]*runnertest.Script{"probe": probe})
+	schema := runner.ParamSchema{"url": {Kind: runner.ParamString, Required: true}}
+	if err := r.Register("probe", probe.Func, runner.TaskType{Params: schema, Interval: time.Hour, Timerless: true}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := r.ParamSchema("probe"); !ok || !r.Timerless("probe") {
+		t.Fatal("the settings of the type weren't registered")
+	}
+	if err := r.Register("Probe", probe.Func, runner.TaskType{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := r.ParamSchema("probe"); ok {
+		t.Error("the schema of the replaced type is still checked")
+	}
+	if r.Timerless("probe") {
+		t.Error("the replaced type is still timerless")
+	}
+	spec := r.NewTask("probe").Label("gateway").MustBuild()
+	if errs := r.ValidateSpec(spec); len(errs) > 0 {
+		t.Errorf("got %v, want a task without params or interval valid", errs)
+	}
+}
@@ -0,0 +1,217 @@
+package taskplugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/rpc"
+	"os"
+	"os/exec"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-plugin"
+
+	"pkg.goda.sh/runner/v2"
+	"pkg.goda.sh/tasks"
+)
+
+// StartTimeout is how long Start waits for a plugin to complete the handshake
+var StartTimeout = 10 * time.Second
+
+// RestartBackoff is how long a plugin must have been running to be restarted when it exits
+// or its connection is lost, plugins crashing sooner fail the runs of their task types until
+// then
+var RestartBackoff = 10 * time.Second
+
+// Plugin is a running plugin process, restarted when it exits or the connection to it is lost
+type Plugin struct {
+	Path    string
+	ctx     context.Context
+	args    []string
+	mu      sync.Mutex // Guards the fields below
+	client  *plugin.Client
+	conn    *rpc.Client
+	types   []TypeInfo
+	runners []*runner.Runner // Registered on, registered again when the plugin restarts
+	started time.Time
+	closed  bool
+	calls   atomic.Uint64 // IDs of runs, to cancel them
+	close   sync.Once
+}
+
+// Start runs a plugin binary and connects to it. The plugin is killed once ctx is done,
+// see Close.
+func Start(ctx context.Context, path string, args ...string) (*Plugin, error) {
+	p := &Plugin{Path: path, ctx: ctx, args: args}
+	if err := p.start(); err != nil {
+		return nil, err
+	}
+	context.AfterFunc(ctx, func() { p.Close() })
+	return p, nil
+}
+
+// start runs the plugin binary and connects to it, p.mu must be held unless p isn't shared yet
+func (p *Plugin) start() error {
+	client := plugin.NewClient(&plugin.ClientConfig{
+		HandshakeConfig:  Handshake,
+		Plugins:          plugin.PluginSet{name: &typesPlugin{}},
+		Cmd:              exec.Command(p.Path, p.args...),
+		AllowedProtocols: []plugin.Protocol{plugin.ProtocolNetRPC},
+		StartTimeout:     StartTimeout,
+		Stderr:           os.Stderr, // Plugins log there
+		SyncStdout:       os.Stderr,
+		SyncStderr:       os.Stderr,
+		Logger:           hclog.NewNullLogger(), // The stderr of plugins is copied already
+	})
+	var types []TypeInfo
+	conn, err := dispense(client)
+	if err == nil {
+		err = call(conn, "Types", struct{}{}, &types)
+	}
+	if err != nil {
+		client.Kill()
+		return fmt.Errorf("taskplugin: %s: %w", p.Path, err)
+	}
+	p.client, p.conn, p.types, p.started = client, conn, types, time.Now()
+	return nil
+}
+
+// dispense connects to a plugin
+func dispense(client *plugin.Client) (*rpc.Client, error) {
+	protocol, err := client.Client()
+	if err != nil {
+		return nil, err
+	}
+	raw, err := protocol.Dispense(name)
+	if err != nil {
+		return nil, err
+	}
+	return raw.(*rpc.Client), nil
+}
+
+// restart starts the plugin again when it exited or its connection was lost, unless it was
+// restarted through another run already, and registers its task types again
+func (p *Plugin) restart(lost *rpc.Client) error {
+	p.mu.Lock()
+	switch {
+	case p.closed || p.ctx.Err() != nil:
+		p.mu.Unlock()
+		return errors.New("plugin closed")
+	case p.conn != lost:
+		p.mu.Unlock()
+		return nil
+	case time.Since(p.started) < RestartBackoff:
+		p.mu.Unlock()
+		return fmt.Errorf("plugin lost within %s of starting, not restarted yet", RestartBackoff)
+	}
+	p.client.Kill()
+	err := p.start()
+	runners := slices.Clone(p.runners)
+	p.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, r := range runners {
+		errs = append(errs, p.register(r))
+	}
+	return errors.Join(errs...)
+}
+
+// connect gets the connection to the plugin and whether the plugin exited
+func (p *Plugin) connect() (*rpc.Client, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.conn, p.client.Exited()
+}
+
+// Types gets the task types of the plugin
+func (p *Plugin) Types() []TypeInfo {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]TypeInfo(nil), p.types...)
+}
+
+// Register adds the task types of the plugin to r, see Runner.Register. They're registered
+// again when the plugin restarts, the types it serves then replacing them.
+func (p *Plugin) Register(r *runner.Runner) error {
+	p.mu.Lock()
+	if !slices.Contains(p.runners, r) {
+		p.runners = append(p.runners, r)
+	}
+	p.mu.Unlock()
+	return p.register(r)
+}
+
+func (p *Plugin) register(r *runner.Runner) error {
+	var errs []error
+	for _, t := range p.Types() {
+		if t.Type.Timerless {
+			errs = append(errs, fmt.Errorf("taskplugin: %s: timerless task type %q", p.Path, t.Name))
+			continue
+		}
+		errs = append(errs, r.Register(t.Name, p.TaskFunc(t.Name), t.Type))
+	}
+	return errors.Join(errs...)
+}
+
+// TaskFunc gets a TaskFunc running tasks of a type in the plugin. Runs are cancelled in the
+// plugin when their task is. A plugin found exited is restarted before running the task, and
+// a run failing because the connection to the plugin was lost restarts it, see
+// RestartBackoff.
+func (p *Plugin) TaskFunc(typ string) runner.TaskFunc {
+	return func(args *tasks.TaskArgs) tasks.Result {
+		conn, exited := p.connect()
+		if exited {
+			if err := p.restart(conn); err != nil {
+				return tasks.Result{Error: fmt.Errorf("taskplugin: %s: plugin exited (%v)", p.Path, err)}
+			}
+			conn, _ = p.connect()
+		}
+		run := RunArgs{ID: p.calls.Add(1), Type: typ, Task: tasks.CleanTask(args.Task), Params: runner.ParamsFrom(args.Task.CTX)}
+		run.Task.CTX, run.Task.Cancel = nil, nil
+		var reply RunReply
+		done := make(chan error, 1)
+		go func() { done <- call(conn, "Run", run, &reply) }()
+		ctx := args.Task.CTX
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		select {
+		case err := <-done:
+			var remote rpc.ServerError
+			if err != nil && !errors.As(err, &remote) {
+				if restartErr := p.restart(conn); restartErr != nil {
+					return tasks.Result{Error: fmt.Errorf("taskplugin: %s: %w (%v)", p.Path, err, restartErr)}
+				}
+				return tasks.Result{Error: fmt.Errorf("taskplugin: %s: %w, restarted", p.Path, err)}
+			}
+			if err != nil {
+				return tasks.Result{Error: fmt.Errorf("taskplugin: %s: %w", p.Path, err)}
+			}
+		case <-ctx.Done():
+			conn.Go(service+".Cancel", run.ID, nil, make(chan *rpc.Call, 1)) // Not waited for, the run is over for the task
+			return tasks.Result{Cancelled: true}
+		}
+		result := tasks.Result{Update: reply.Update, Warn: reply.Warn, Spark: reply.Spark, Cancelled: reply.Cancelled}
+		if reply.Error != "" {
+			result.Error = errors.New(reply.Error)
+		}
+		return result
+	}
+}
+
+// Close disconnects from the plugin and stops it
+func (p *Plugin) Close() error {
+	p.close.Do(func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		p.closed = true
+		p.client.Kill()
+	})
+	return nil
+}
@@ -0,0 +1,108 @@
+package taskplugin
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"pkg.goda.sh/runner/v2"
+	"pkg.goda.sh/runner/v2/runnertest"
+	"pkg.goda.sh/tasks"
+)
+
+// TestMain serves the task types below when the test binary is started as a plugin, and more
+// named in the file of its argument
+func TestMain(m *testing.M) {
+	if os.Getenv(CookieKey) != CookieValue {
+		os.Exit(m.Run())
+	}
+	types := map[string]Type{
+		"ok":    {Func: func(*tasks.TaskArgs) tasks.Result { return tasks.Result{Update: "ok"} }},
+		"crash": {Func: func(*tasks.TaskArgs) tasks.Result { os.Exit(1); return tasks.Result{} }},
+		"wait": {Func: func(args *tasks.TaskArgs) tasks.Result {
+			<-args.Task.CTX.Done()
+			os.WriteFile(runner.ParamsFrom(args.Task.CTX)["marker"].(string), nil, 0600)
+			return tasks.Result{Cancelled: true}
+		}},
+	}
+	if len(os.Args) > 1 {
+		names, _ := os.ReadFile(os.Args[1])
+		for _, name := range strings.Fields(string(names)) {
+			types[name] = Type{Func: types["ok"].Func, TaskType: runner.TaskType{Interval: time.Minute}}
+		}
+	}
+	Serve(types)
+	os.Exit(0)
+}
+
+func start(t *testing.T, args ...string) *Plugin {
+	t.Helper()
+	p, err := Start(context.Background(), os.Args[0], args...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { p.Close() })
+	return p
+}
+
+func run(ctx context.Context, p *Plugin, typ string) tasks.Result {
+	return p.TaskFunc(typ)(&tasks.TaskArgs{Task: tasks.Task{Label: typ, Task: typ, CTX: ctx}})
+}
+
+func TestCancelledRunsAreCancelledInThePlugin(t *testing.T) {
+	p := start(t)
+	marker := filepath.Join(t.TempDir(), "cancelled")
+	ctx, cancel := context.WithCancel(runner.ContextWithParams(context.Background(), map[string]interface{}{"marker": marker}))
+	time.AfterFunc(100*time.Millisecond, cancel)
+	if result := run(ctx, p, "wait"); !result.Cancelled {
+		t.Fatalf("got %+v, want a cancelled result", result)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if _, err := os.Stat(marker); err == nil {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("the context of the run wasn't cancelled in the plugin")
+}
+
+func TestCrashedPluginIsRestarted(t *testing.T) {
+	defer func(backoff time.Duration) { RestartBackoff = backoff }(RestartBackoff)
+	RestartBackoff = 0
+	p := start(t)
+	if result := run(context.Background(), p, "crash"); result.Error == nil {
+		t.Fatalf("got %+v from a plugin that crashed, want an error", result)
+	}
+	if result := run(context.Background(), p, "ok"); result.Error != nil || result.Update != "ok" {
+		t.Fatalf("got %+v after the crash, want the restarted plugin to run the task", result)
+	}
+}
+
+func TestRestartedPluginTypesAreRegisteredAgain(t *testing.T) {
+	defer func(backoff time.Duration) { RestartBackoff = backoff }(RestartBackoff)
+	RestartBackoff = 0
+	names := filepath.Join(t.TempDir(), "types")
+	if err := os.WriteFile(names, []byte("first"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	p := start(t, names)
+	r, _ := runnertest.New(t, nil)
+	if err := p.Register(r); err != nil {
+		t.Fatal(err)
+	}
+	second := runner.Spec{CleanTask: tasks.CleanTask{Label: "second", Task: "second"}}
+	if errs := r.ValidateSpec(second); len(errs) == 0 {
+		t.Fatal("a task type the plugin doesn't serve yet is registered")
+	}
+	if err := os.WriteFile(names, []byte("first second"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	run(context.Background(), p, "crash")
+	if errs := r.ValidateSpec(second); len(errs) > 0 {
+		t.Fatalf("got %v after the restart, want the task types of the restarted plugin registered", errs)
+	}
+}
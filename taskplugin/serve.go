@@ -0,0 +1,108 @@
+package taskplugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-plugin"
+
+	"pkg.goda.sh/runner/v2"
+	"pkg.goda.sh/tasks"
+)
+
+// Serve serves task types to the runner that started the program, until the runner closes
+// the connection or exits
+func Serve(types map[string]Type) error {
+	if os.Getenv(CookieKey) != CookieValue {
+		return ErrNotPlugin // plugin.Serve would exit the program
+	}
+	plugin.Serve(&plugin.ServeConfig{
+		HandshakeConfig: Handshake,
+		Plugins:         plugin.PluginSet{name: &typesPlugin{types: types}},
+		Logger:          hclog.New(&hclog.LoggerOptions{Name: "taskplugin", Level: hclog.Warn, Output: os.Stderr}),
+	})
+	return nil
+}
+
+// server is the RPC service of a plugin
+type server struct {
+	types   map[string]Type
+	mu      sync.Mutex
+	running map[uint64]context.CancelFunc // By run ID
+}
+
+// Types lists the task types of the plugin
+func (s *server) Types(_ []byte, reply *[]byte) error {
+	var types []TypeInfo
+	for name, t := range s.types {
+		types = append(types, TypeInfo{Name: strings.ToLower(name), Type: t.TaskType})
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i].Name < types[j].Name })
+	return encode(types, reply)
+}
+
+// Run runs a task once
+func (s *server) Run(data []byte, reply *[]byte) error {
+	var args RunArgs
+	if err := json.Unmarshal(data, &args); err != nil {
+		return err
+	}
+	var t Type
+	var ok bool
+	for name, typ := range s.types {
+		if strings.EqualFold(name, args.Type) {
+			t, ok = typ, true
+		}
+	}
+	if !ok {
+		return fmt.Errorf("%w: %q", runner.ErrUnknownTask, args.Type)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s.mu.Lock()
+	s.running[args.ID] = cancel
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.running, args.ID)
+		s.mu.Unlock()
+	}()
+	task := tasks.Task(args.Task)
+	task.CTX = runner.ContextWithParams(ctx, args.Params)
+	task.Cancel = func() bool {
+		cancel()
+		return true
+	}
+	result := t.Func(&tasks.TaskArgs{Task: task, Stop: func() {}})
+	out := RunReply{Update: result.Update, Warn: result.Warn, Spark: result.Spark, Cancelled: result.Cancelled}
+	if result.Error != nil {
+		out.Error = result.Error.Error()
+	}
+	return encode(out, reply)
+}
+
+// Cancel cancels the context of a run, when it's still running
+func (s *server) Cancel(id uint64, _ *struct{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if cancel, ok := s.running[id]; ok {
+		cancel()
+	}
+	return nil
+}
+
+// encode sets the reply of a call to v as JSON, see call
+func encode(v interface{}, reply *[]byte) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	*reply = data
+	return nil
+}
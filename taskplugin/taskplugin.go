@@ -0,0 +1,115 @@
+// Package taskplugin runs task types from external plugin binaries, so teams can add task
+// types without rebuilding the runner. A plugin is a program calling Serve:
+//
+//	func main() {
+//		taskplugin.Serve(map[string]taskplugin.Type{
+//			"ldap": {Func: checkLDAP, TaskType: runner.TaskType{Interval: time.Minute}},
+//		})
+//	}
+//
+// and the runner starts it and registers its task types:
+//
+//	p, err := taskplugin.Start(ctx, "/usr/lib/runner/ldap")
+//	...
+//	err = p.Register(r)
+//
+// Plugins are served and started with hashicorp/go-plugin, which runs the plugin as a child
+// process, checks the magic cookie of Handshake so plugins refuse to run on their own, and
+// connects to it. Calls are net/rpc, task params and results travel as JSON. The context of
+// runs is cancelled in the plugin when their task is, and a plugin that exits or loses its
+// connection is started again, its task types registered again on the Runners it was
+// registered on. Timerless task types aren't supported.
+package taskplugin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/rpc"
+
+	"github.com/hashicorp/go-plugin"
+
+	"pkg.goda.sh/runner/v2"
+	"pkg.goda.sh/tasks"
+)
+
+// Handshake values shared by the host and its plugins
+const (
+	CookieKey   = "RUNNER_PLUGIN_COOKIE"
+	CookieValue = "d0c5c1e1-runner-task-plugin"
+	Version     = 1 // Of the protocol
+)
+
+// Handshake is the go-plugin handshake of the host and its plugins
+var Handshake = plugin.HandshakeConfig{
+	ProtocolVersion:  Version,
+	MagicCookieKey:   CookieKey,
+	MagicCookieValue: CookieValue,
+}
+
+// ErrNotPlugin is returned by Serve when the program wasn't started by a runner
+var ErrNotPlugin = errors.New("taskplugin: not started by a runner, this program is a plugin")
+
+// Type is a task type served by a plugin
+type Type struct {
+	Func runner.TaskFunc
+	runner.TaskType
+}
+
+// service is the name go-plugin gives the RPC service of plugins, and name the one of the
+// plugin.Plugin serving task types
+const (
+	service = "Plugin"
+	name    = "tasks"
+)
+
+// typesPlugin is the plugin.Plugin serving task types over net/rpc. It holds the task types
+// in plugins and nothing in the host, whose clients are the *rpc.Client of the connection.
+type typesPlugin struct {
+	types map[string]Type
+}
+
+func (p *typesPlugin) Server(*plugin.MuxBroker) (interface{}, error) {
+	return &server{types: p.types, running: make(map[uint64]context.CancelFunc)}, nil
+}
+
+func (*typesPlugin) Client(_ *plugin.MuxBroker, c *rpc.Client) (interface{}, error) {
+	return c, nil
+}
+
+// call calls a method of plugins, args and reply travel as JSON, gob needing the types of
+// the values of params and updates registered
+func call(c *rpc.Client, method string, args, reply interface{}) error {
+	data, err := json.Marshal(args)
+	if err != nil {
+		return err
+	}
+	var out []byte
+	if err := c.Call(service+"."+method, data, &out); err != nil {
+		return err
+	}
+	return json.Unmarshal(out, reply)
+}
+
+// TypeInfo describes a task type of a plugin
+type TypeInfo struct {
+	Name string          `json:"name"`
+	Type runner.TaskType `json:"type"`
+}
+
+// RunArgs asks a plugin to run a task once
+type RunArgs struct {
+	ID     uint64                 `json:"id"` // Of the run, to cancel it
+	Type   string                 `json:"type"`
+	Task   tasks.CleanTask        `json:"task"`
+	Params map[string]interface{} `json:"params,omitempty"` // Secret references resolved
+}
+
+// RunReply is the result of a run
+type RunReply struct {
+	Update    interface{} `json:"update,omitempty"`
+	Warn      bool        `json:"warn,omitempty"`
+	Spark     []float64   `json:"spark,omitempty"`
+	Error     string      `json:"error,omitempty"`
+	Cancelled bool        `json:"cancelled,omitempty"`
+}
@@ -0,0 +1,149 @@
+package tasktypes
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"pkg.goda.sh/runner/v2"
+	"pkg.goda.sh/tasks"
+)
+
+// CertType is the task type of Cert
+const CertType = "cert"
+
+// DefaultWarnDays is the WarnDays of a Cert of 0
+const DefaultWarnDays = 14
+
+// Cert checks the TLS certificate served on the port of tasks, 443 by default:
+//
+//	{"address": "example.com:443", "subject": "example.com", "issuer": "R3",
+//	 "not_after": "2026-12-01T00:00:00Z", "days_left": 48.2, "sans": ["example.com"],
+//	 "chain_ok": true, "ms": 31.4}
+//
+// The chain is verified against the system roots, or the PEM bundle of the ca_file param,
+// for the server_name of the task, its host by default, and chain_error says why it failed.
+// Tasks warn when the certificate expires in fewer than their warn_days or when the chain
+// doesn't verify. Servers that can't be reached or don't complete the handshake fail the
+// task. The days left are kept in Spark.
+type Cert struct {
+	WarnDays float64       // Of tasks without warn_days, DefaultWarnDays when 0
+	Timeout  time.Duration // DefaultTimeout when 0
+}
+
+// certParams are the params of Cert tasks
+type certParams struct {
+	Host       string   `json:"host"`
+	Port       int      `json:"port"`
+	ServerName string   `json:"server_name"`
+	CAFile     string   `json:"ca_file"`
+	WarnDays   *float64 `json:"warn_days"`
+}
+
+func (p *certParams) Validate() error {
+	if p.Host == "" {
+		return errors.New("no host")
+	}
+	if p.Port == 0 {
+		p.Port = 443
+	}
+	if p.Port < 0 || p.Port > 65535 {
+		return fmt.Errorf("port %d out of range", p.Port)
+	}
+	if p.ServerName == "" {
+		p.ServerName = p.Host
+	}
+	return nil
+}
+
+// Register adds the Cert task type to r
+func (c Cert) Register(r *runner.Runner) error {
+	return r.Register(CertType, runner.Typed(c.run), runner.TaskType{Params: runner.ParamSchema{
+		"host":        {Kind: runner.ParamString, Required: true},
+		"port":        {Kind: runner.ParamNumber},
+		"server_name": {Kind: runner.ParamString},
+		"ca_file":     {Kind: runner.ParamString},
+		"warn_days":   {Kind: runner.ParamNumber},
+	}})
+}
+
+func (c Cert) run(args *tasks.TaskArgs, p certParams) tasks.Result {
+	var roots *x509.CertPool
+	if p.CAFile != "" {
+		pem, err := os.ReadFile(p.CAFile)
+		if err != nil {
+			return tasks.Result{Error: err}
+		}
+		roots = x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(pem) {
+			return tasks.Result{Error: fmt.Errorf("no certificates in %s", p.CAFile)}
+		}
+	}
+	ctx, cancel := taskContext(args.Task, c.Timeout)
+	defer cancel()
+	address := net.JoinHostPort(p.Host, strconv.Itoa(p.Port))
+	// The chain is verified below, to report its issues rather than fail the handshake
+	dialer := tls.Dialer{Config: &tls.Config{ServerName: p.ServerName, InsecureSkipVerify: true}}
+	start := time.Now()
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	ms := float64(time.Since(start).Microseconds()) / 1000
+	if args.Task.CTX != nil && args.Task.CTX.Err() != nil {
+		return tasks.Result{Cancelled: true}
+	}
+	if err != nil {
+		return tasks.Result{Error: err}
+	}
+	state := conn.(*tls.Conn).ConnectionState()
+	conn.Close()
+	if len(state.PeerCertificates) == 0 {
+		return tasks.Result{Error: fmt.Errorf("%s sent no certificate", address)}
+	}
+
+	leaf := state.PeerCertificates[0]
+	intermediates := x509.NewCertPool()
+	for _, cert := range state.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, verifyErr := leaf.Verify(x509.VerifyOptions{DNSName: p.ServerName, Roots: roots, Intermediates: intermediates})
+	days := math.Round(time.Until(leaf.NotAfter).Hours()/24*10) / 10
+	sans := append([]string{}, leaf.DNSNames...)
+	for _, ip := range leaf.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	update := map[string]interface{}{
+		"address":   address,
+		"subject":   certName(leaf.Subject),
+		"issuer":    certName(leaf.Issuer),
+		"not_after": leaf.NotAfter.UTC().Format(time.RFC3339),
+		"days_left": days,
+		"sans":      sans,
+		"chain_ok":  verifyErr == nil,
+		"ms":        ms,
+	}
+	if verifyErr != nil {
+		update["chain_error"] = verifyErr.Error()
+	}
+	warnDays := c.WarnDays
+	if warnDays == 0 {
+		warnDays = DefaultWarnDays
+	}
+	if p.WarnDays != nil {
+		warnDays = *p.WarnDays
+	}
+	return tasks.Result{Update: update, Warn: days < warnDays || verifyErr != nil, Spark: spark(args.Task, days)}
+}
+
+// certName is the common name of n, or all of n without one
+func certName(n pkix.Name) string {
+	if n.CommonName != "" {
+		return n.CommonName
+	}
+	return n.String()
+}
@@ -0,0 +1,134 @@
+package tasktypes
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"pkg.goda.sh/runner/v2"
+	"pkg.goda.sh/tasks"
+)
+
+// CompositeType is the task type of Composite
+const CompositeType = "composite"
+
+// Composite runs the checks of tasks, child tasks of any type the Runner has, in one run and
+// merges their results, so a single tile shows the health of a service made of several
+// checks:
+//
+//	{"ok": 2, "warn": 1, "failed": 0, "checks": [
+//	 {"name": "web", "task": "http", "ok": true, "update": {"status": 200, "ms": 41.2}},
+//	 {"name": "dns", "task": "dns", "ok": true, "update": {"name": "shop.example.com", ...}},
+//	 {"name": "cert", "task": "cert", "warn": true, "update": {"days_left": 9, ...}}]}
+//
+// Checks run one after the other, or all at once when the task sets parallel. Their params
+// are checked against the schema of their type when they run, not when the task is added,
+// and their errors are reported in their entry rather than failing the task. Tasks warn when
+// a check warns or fails. The number of checks that didn't pass is kept in Spark.
+type Composite struct {
+	Timeout time.Duration // Of runs, checks included, DefaultTimeout when 0
+}
+
+// compositeParams are the params of Composite tasks
+type compositeParams struct {
+	Checks   []compositeCheck `json:"checks"`
+	Parallel bool             `json:"parallel"`
+}
+
+// compositeCheck is a child task of a Composite task
+type compositeCheck struct {
+	Name   string                 `json:"name"` // The task type when empty
+	Task   string                 `json:"task"`
+	Params map[string]interface{} `json:"params"`
+}
+
+func (p *compositeParams) Validate() error {
+	if len(p.Checks) == 0 {
+		return errors.New("no checks")
+	}
+	seen := make(map[string]bool, len(p.Checks))
+	for i := range p.Checks {
+		c := &p.Checks[i]
+		if c.Task == "" {
+			return fmt.Errorf("check %d has no task", i)
+		}
+		if c.Name == "" {
+			c.Name = c.Task
+		}
+		if seen[c.Name] {
+			return fmt.Errorf("checks named %q twice", c.Name)
+		}
+		seen[c.Name] = true
+	}
+	return nil
+}
+
+// Register adds the Composite task type to r, checks run the task types of r
+func (c Composite) Register(r *runner.Runner) error {
+	return r.Register(CompositeType, runner.Typed(func(args *tasks.TaskArgs, p compositeParams) tasks.Result {
+		return c.run(r, args, p)
+	}), runner.TaskType{Params: runner.ParamSchema{
+		"checks":   {Kind: runner.ParamArray, Required: true},
+		"parallel": {Kind: runner.ParamBool},
+	}})
+}
+
+func (c Composite) run(r *runner.Runner, args *tasks.TaskArgs, p compositeParams) tasks.Result {
+	ctx, cancel := taskContext(args.Task, c.Timeout)
+	defer cancel()
+	results := make([]tasks.Result, len(p.Checks))
+	check := func(i int) {
+		child := args.Task
+		child.CTX, child.Label, child.Spark = ctx, args.Task.Label+"/"+p.Checks[i].Name, nil
+		results[i] = r.RunType(child, p.Checks[i].Task, p.Checks[i].Params)
+	}
+	if p.Parallel {
+		var wg sync.WaitGroup
+		for i := range p.Checks {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				check(i)
+			}()
+		}
+		wg.Wait()
+	} else {
+		for i := range p.Checks {
+			if ctx.Err() != nil {
+				results[i] = tasks.Result{Cancelled: true}
+				continue
+			}
+			check(i)
+		}
+	}
+	if args.Task.CTX != nil && args.Task.CTX.Err() != nil {
+		return tasks.Result{Cancelled: true}
+	}
+
+	checks := make([]interface{}, len(p.Checks))
+	ok, warned, failed := 0, 0, 0
+	for i, res := range results {
+		entry := map[string]interface{}{"name": p.Checks[i].Name, "task": p.Checks[i].Task}
+		if res.Cancelled { // By the timeout of the run
+			res.Error = fmt.Errorf("composite: %w", ctx.Err())
+		}
+		switch {
+		case res.Error != nil:
+			entry["error"] = res.Error.Error()
+			failed++
+		case res.Warn:
+			entry["warn"] = true
+			warned++
+		default:
+			entry["ok"] = true
+			ok++
+		}
+		if res.Update != nil {
+			entry["update"] = res.Update
+		}
+		checks[i] = entry
+	}
+	update := map[string]interface{}{"ok": ok, "warn": warned, "failed": failed, "checks": checks}
+	return tasks.Result{Update: update, Warn: ok < len(checks), Spark: spark(args.Task, float64(warned+failed))}
+}
@@ -0,0 +1,205 @@
+package tasktypes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"pkg.goda.sh/runner/v2"
+	"pkg.goda.sh/tasks"
+)
+
+// DNSType is the task type of DNS
+const DNSType = "dns"
+
+// DNS resolves the name of tasks, against their server or the resolver of the system, and
+// reports the records found and the response time:
+//
+//	{"name": "example.com", "type": "A", "server": "1.1.1.1:53", "records": ["93.184.216.34"], "ms": 12.1}
+//
+// The type is one of A, AAAA, CNAME, MX, NS, SRV and TXT, A by default. MX records read
+// "10 mx.example.com.", SRV ones "priority weight port target". Tasks warn when a record of
+// their expect list is missing, or with exact when any other record is found too, comparing
+// names case insensitively with or without their final dot. Names that don't exist warn as
+// well, so tasks on runners of several Locations show where a change didn't propagate.
+// Servers that don't answer fail the task. Response times are kept in Spark.
+type DNS struct {
+	Timeout time.Duration // DefaultTimeout when 0
+}
+
+// dnsParams are the params of DNS tasks
+type dnsParams struct {
+	Name     string   `json:"name"`
+	Type     string   `json:"type"`
+	Server   string   `json:"server"`   // host[:port], the resolver of the system when empty
+	Protocol string   `json:"protocol"` // udp, or tcp to query over TCP only
+	Expect   []string `json:"expect"`
+	Exact    bool     `json:"exact"`
+}
+
+// dnsTypes are the record types of DNS tasks
+var dnsTypes = []string{"A", "AAAA", "CNAME", "MX", "NS", "SRV", "TXT"}
+
+func (p *dnsParams) Validate() error {
+	if p.Name == "" {
+		return errors.New("no name")
+	}
+	if p.Type = strings.ToUpper(p.Type); p.Type == "" {
+		p.Type = "A"
+	}
+	if !slices.Contains(dnsTypes, p.Type) {
+		return fmt.Errorf("type %q isn't one of %s", p.Type, strings.Join(dnsTypes, ", "))
+	}
+	if p.Server != "" {
+		if _, _, err := net.SplitHostPort(p.Server); err != nil {
+			p.Server = net.JoinHostPort(strings.Trim(p.Server, "[]"), "53")
+		}
+	}
+	switch p.Protocol = strings.ToLower(p.Protocol); p.Protocol {
+	case "", "udp", "tcp":
+	default:
+		return fmt.Errorf("protocol %q isn't udp or tcp", p.Protocol)
+	}
+	return nil
+}
+
+// Register adds the DNS task type to r
+func (d DNS) Register(r *runner.Runner) error {
+	return r.Register(DNSType, runner.Typed(d.run), runner.TaskType{Params: runner.ParamSchema{
+		"name":     {Kind: runner.ParamString, Required: true},
+		"type":     {Kind: runner.ParamString},
+		"server":   {Kind: runner.ParamString},
+		"protocol": {Kind: runner.ParamString},
+		"expect":   {Kind: runner.ParamArray},
+		"exact":    {Kind: runner.ParamBool},
+	}})
+}
+
+func (d DNS) run(args *tasks.TaskArgs, p dnsParams) tasks.Result {
+	ctx, cancel := taskContext(args.Task, d.Timeout)
+	defer cancel()
+	resolver := net.DefaultResolver
+	if p.Server != "" || p.Protocol == "tcp" {
+		resolver = &net.Resolver{PreferGo: true, Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			if p.Server != "" {
+				address = p.Server
+			}
+			if p.Protocol == "tcp" {
+				network = "tcp"
+			}
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, network, address)
+		}}
+	}
+	update := map[string]interface{}{"name": p.Name, "type": p.Type}
+	if p.Server != "" {
+		update["server"] = p.Server
+	}
+
+	start := time.Now()
+	records, err := lookup(ctx, resolver, p.Type, p.Name)
+	ms := float64(time.Since(start).Microseconds()) / 1000
+	if args.Task.CTX != nil && args.Task.CTX.Err() != nil {
+		return tasks.Result{Cancelled: true}
+	}
+	var dnsErr *net.DNSError
+	if err != nil && (!errors.As(err, &dnsErr) || !dnsErr.IsNotFound) {
+		return tasks.Result{Error: err, Spark: spark(args.Task, ms)}
+	}
+	if records == nil {
+		records = []string{}
+	}
+	update["records"], update["ms"] = records, ms
+	warn := err != nil
+	if err != nil {
+		update["error"] = "not found"
+	}
+	found := make(map[string]bool, len(records))
+	for _, r := range records {
+		found[dnsKey(r)] = true
+	}
+	var missing []string
+	for _, e := range p.Expect {
+		if !found[dnsKey(e)] {
+			missing = append(missing, e)
+		}
+		delete(found, dnsKey(e))
+	}
+	if len(p.Expect) > 0 {
+		warn = warn || len(missing) > 0 || (p.Exact && len(found) > 0)
+		update["matched"] = !warn
+		if len(missing) > 0 {
+			update["missing"] = missing
+		}
+	}
+	return tasks.Result{Update: update, Warn: warn, Spark: spark(args.Task, ms)}
+}
+
+// dnsKey is the form records are compared in
+func dnsKey(record string) string {
+	return strings.ToLower(strings.TrimSuffix(strings.TrimSpace(record), "."))
+}
+
+// lookup gets the records of a type, sorted unless their order matters
+func lookup(ctx context.Context, r *net.Resolver, typ, name string) ([]string, error) {
+	var records []string
+	switch typ {
+	case "A", "AAAA":
+		network := "ip4"
+		if typ == "AAAA" {
+			network = "ip6"
+		}
+		ips, err := r.LookupIP(ctx, network, name)
+		if err != nil {
+			return nil, err
+		}
+		for _, ip := range ips {
+			records = append(records, ip.String())
+		}
+	case "CNAME":
+		cname, err := r.LookupCNAME(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		return []string{cname}, nil
+	case "MX":
+		mxs, err := r.LookupMX(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		for _, mx := range mxs {
+			records = append(records, strconv.Itoa(int(mx.Pref))+" "+mx.Host)
+		}
+		return records, nil
+	case "NS":
+		nss, err := r.LookupNS(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		for _, ns := range nss {
+			records = append(records, ns.Host)
+		}
+	case "SRV":
+		_, srvs, err := r.LookupSRV(ctx, "", "", name)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range srvs {
+			records = append(records, fmt.Sprintf("%d %d %d %s", s.Priority, s.Weight, s.Port, s.Target))
+		}
+		return records, nil
+	case "TXT":
+		txts, err := r.LookupTXT(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		records = txts
+	}
+	slices.Sort(records)
+	return records, nil
+}
@@ -0,0 +1,209 @@
+package tasktypes
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"pkg.goda.sh/runner/v2"
+	"pkg.goda.sh/tasks"
+)
+
+// DockerType is the task type of Docker
+const DockerType = "docker"
+
+// DefaultDockerSocket is the Socket of a Docker without one, unless DOCKER_HOST is a unix://
+// socket
+const DefaultDockerSocket = "/var/run/docker.sock"
+
+// Docker reports the state and resource usage of the containers of tasks, by name or ID,
+// from the Docker Engine API, or that of Podman:
+//
+//	{"containers": {"web": {"state": "running", "health": "healthy", "restarting": false, "restarts": 0,
+//	 "cpu_percent": 3.1, "memory": 52428800, "memory_limit": 1073741824, "memory_percent": 4.9}},
+//	 "missing": []}
+//
+// Tasks warn when a container is missing, isn't running, is restarting or is unhealthy.
+// Stats are only read for running containers. The CPU percent of all of them is kept in
+// Spark. A daemon that can't be reached fails tasks.
+type Docker struct {
+	Socket  string        // Of the API, DefaultDockerSocket when empty
+	Timeout time.Duration // DefaultTimeout when 0
+}
+
+// dockerParams are the params of Docker tasks
+type dockerParams struct {
+	Containers []string `json:"containers"`
+}
+
+func (p *dockerParams) Validate() error {
+	if len(p.Containers) == 0 {
+		return errors.New("no containers")
+	}
+	for _, c := range p.Containers {
+		if c == "" || strings.ContainsAny(c, "/?#") {
+			return fmt.Errorf("bad container %q", c)
+		}
+	}
+	return nil
+}
+
+// Register adds the Docker task type to r
+func (d Docker) Register(r *runner.Runner) error {
+	return r.Register(DockerType, runner.Typed(d.run), runner.TaskType{Params: runner.ParamSchema{
+		"containers": {Kind: runner.ParamArray, Required: true},
+	}})
+}
+
+// dockerInspect is the part of the inspect of a container read
+type dockerInspect struct {
+	RestartCount int
+	State        struct {
+		Status     string
+		Running    bool
+		Restarting bool
+		Health     *struct{ Status string }
+	}
+}
+
+// dockerStats is the part of the stats of a container read
+type dockerStats struct {
+	CPUStats    dockerCPU `json:"cpu_stats"`
+	PreCPUStats dockerCPU `json:"precpu_stats"`
+	MemoryStats struct {
+		Usage uint64            `json:"usage"`
+		Limit uint64            `json:"limit"`
+		Stats map[string]uint64 `json:"stats"`
+	} `json:"memory_stats"`
+}
+
+type dockerCPU struct {
+	CPUUsage struct {
+		TotalUsage uint64 `json:"total_usage"`
+	} `json:"cpu_usage"`
+	SystemUsage uint64 `json:"system_cpu_usage"`
+	OnlineCPUs  int    `json:"online_cpus"`
+}
+
+func (d Docker) run(args *tasks.TaskArgs, p dockerParams) tasks.Result {
+	ctx, cancel := taskContext(args.Task, d.Timeout)
+	defer cancel()
+	client := d.client()
+	containers := make(map[string]interface{}, len(p.Containers))
+	missing := []string{}
+	warn, cpu := false, 0.0
+	for _, name := range p.Containers {
+		var inspect dockerInspect
+		found, err := d.get(ctx, client, "/containers/"+url.PathEscape(name)+"/json", &inspect)
+		if args.Task.CTX != nil && args.Task.CTX.Err() != nil {
+			return tasks.Result{Cancelled: true}
+		}
+		if err != nil {
+			return tasks.Result{Error: err}
+		}
+		if !found {
+			missing, warn = append(missing, name), true
+			continue
+		}
+		c := map[string]interface{}{
+			"state":      inspect.State.Status,
+			"restarting": inspect.State.Restarting,
+			"restarts":   inspect.RestartCount,
+		}
+		if inspect.State.Health != nil {
+			c["health"] = inspect.State.Health.Status
+			warn = warn || inspect.State.Health.Status == "unhealthy"
+		}
+		warn = warn || !inspect.State.Running || inspect.State.Restarting
+		if inspect.State.Running {
+			var stats dockerStats
+			if _, err := d.get(ctx, client, "/containers/"+url.PathEscape(name)+"/stats?stream=false", &stats); err != nil {
+				if args.Task.CTX != nil && args.Task.CTX.Err() != nil {
+					return tasks.Result{Cancelled: true}
+				}
+				return tasks.Result{Error: err}
+			}
+			used := stats.cpuPercent()
+			cpu += used
+			memory := stats.memory()
+			c["cpu_percent"], c["memory"], c["memory_limit"] = round(used), memory, stats.MemoryStats.Limit
+			c["memory_percent"] = percent(memory, stats.MemoryStats.Limit)
+		}
+		containers[name] = c
+	}
+	update := map[string]interface{}{"containers": containers, "missing": missing}
+	return tasks.Result{Update: update, Warn: warn, Spark: spark(args.Task, round(cpu))}
+}
+
+// cpuPercent is the CPU used since the previous sample, as docker stats shows it
+func (s dockerStats) cpuPercent() float64 {
+	usage := float64(s.CPUStats.CPUUsage.TotalUsage) - float64(s.PreCPUStats.CPUUsage.TotalUsage)
+	system := float64(s.CPUStats.SystemUsage) - float64(s.PreCPUStats.SystemUsage)
+	if usage <= 0 || system <= 0 {
+		return 0
+	}
+	return usage / system * float64(max(s.CPUStats.OnlineCPUs, 1)) * 100
+}
+
+// memory is the memory used without the page cache, as docker stats shows it
+func (s dockerStats) memory() uint64 {
+	cache := s.MemoryStats.Stats["inactive_file"] // cgroup v2
+	if c, ok := s.MemoryStats.Stats["total_inactive_file"]; ok {
+		cache = c // cgroup v1
+	}
+	if cache > s.MemoryStats.Usage {
+		return s.MemoryStats.Usage
+	}
+	return s.MemoryStats.Usage - cache
+}
+
+// client talks to the daemon over its socket
+func (d Docker) client() *http.Client {
+	socket := d.Socket
+	if socket == "" {
+		socket = DefaultDockerSocket
+		if host, ok := strings.CutPrefix(os.Getenv("DOCKER_HOST"), "unix://"); ok {
+			socket = host
+		}
+	}
+	return &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, "unix", socket)
+		},
+		DisableKeepAlives: true,
+	}}
+}
+
+// get decodes the reply of the API to a GET of path into v, found is false on a 404
+func (d Docker) get(ctx context.Context, client *http.Client, path string, v interface{}) (found bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://docker"+path, nil)
+	if err != nil {
+		return false, err
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer res.Body.Close()
+	switch {
+	case res.StatusCode == http.StatusNotFound:
+		return false, nil
+	case res.StatusCode != http.StatusOK:
+		var apiErr struct{ Message string }
+		body, _ := io.ReadAll(io.LimitReader(res.Body, 4096))
+		if json.Unmarshal(body, &apiErr) == nil && apiErr.Message != "" {
+			return false, fmt.Errorf("docker: %s", apiErr.Message)
+		}
+		return false, fmt.Errorf("docker: %s", res.Status)
+	}
+	return true, json.NewDecoder(res.Body).Decode(v)
+}
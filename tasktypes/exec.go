@@ -0,0 +1,190 @@
+package tasktypes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"pkg.goda.sh/runner/v2"
+	"pkg.goda.sh/tasks"
+)
+
+// ExecType is the task type of Exec
+const ExecType = "exec"
+
+// ErrNotAllowed is returned when a task runs a command missing from the Allow of Exec
+var ErrNotAllowed = errors.New("tasktypes: command not allowed")
+
+// Exec runs the command of tasks, with their args, env, dir and stdin. The result has the
+// exit code and output:
+//
+//	{"exit_code": 0, "stdout": "...", "stderr": "...", "ms": 12.5, "truncated": false}
+//
+// and warns when the exit code isn't one of the ok_codes of the task, 0 by default. Commands
+// that can't start or run past their timeout fail. The duration of runs is kept in Spark.
+//
+// With Allow set, tasks only run the commands of Allow, set the env variables of AllowEnv
+// and name dirs inside Dir, so they can't run other programs through LD_PRELOAD, PATH or
+// a relative command found in a dir of their choosing.
+type Exec struct {
+	Allow     []string      // Commands tasks may run, by name in PATH or by path, relative to Dir, any when empty
+	AllowEnv  []string      // Env variables tasks may set when Allow is set, none when empty
+	Dir       string        // Of commands, tasks can only name dirs inside it when Allow is set
+	Env       []string      // KEY=value set for every command, the environment of the runner when nil
+	Timeout   time.Duration // Of runs and the longest a task can ask for, DefaultTimeout when 0
+	MaxOutput int           // Bytes of stdout and of stderr kept, DefaultMaxOutput when 0
+}
+
+// execParams are the params of Exec tasks
+type execParams struct {
+	Command string            `json:"command"`
+	Args    []string          `json:"args"`
+	Env     map[string]string `json:"env"`
+	Dir     string            `json:"dir"`
+	Stdin   string            `json:"stdin"`
+	Timeout string            `json:"timeout"`
+	OKCodes []int             `json:"ok_codes"`
+}
+
+func (p *execParams) Validate() error {
+	if p.Command == "" {
+		return errors.New("no command")
+	}
+	if p.Timeout != "" {
+		if _, err := time.ParseDuration(p.Timeout); err != nil {
+			return fmt.Errorf("timeout: %v", err)
+		}
+	}
+	return nil
+}
+
+// Register adds the Exec task type to r
+func (e Exec) Register(r *runner.Runner) error {
+	return r.Register(ExecType, runner.Typed(e.run), runner.TaskType{Params: runner.ParamSchema{
+		"command":  {Kind: runner.ParamString, Required: true},
+		"args":     {Kind: runner.ParamArray},
+		"env":      {Kind: runner.ParamObject},
+		"dir":      {Kind: runner.ParamString},
+		"stdin":    {Kind: runner.ParamString},
+		"timeout":  {Kind: runner.ParamString},
+		"ok_codes": {Kind: runner.ParamArray},
+	}})
+}
+
+// command gets the path, dir and env a task runs its command with, checked against Allow,
+// AllowEnv and Dir when Allow is set
+func (e Exec) command(name, dir string, env map[string]string) (string, string, []string, error) {
+	if len(e.Allow) == 0 {
+		if dir == "" {
+			dir = e.Dir
+		}
+		return name, dir, commandEnv(e.Env, env), nil
+	}
+	path := e.resolve(name)
+	if !slices.ContainsFunc(e.Allow, func(a string) bool { return e.resolve(a) == path }) {
+		return "", "", nil, fmt.Errorf("%w: %s", ErrNotAllowed, name)
+	}
+	for _, k := range slices.Sorted(maps.Keys(env)) {
+		if !slices.Contains(e.AllowEnv, k) {
+			return "", "", nil, fmt.Errorf("%w: %s with env %s", ErrNotAllowed, name, k)
+		}
+	}
+	switch {
+	case dir == "":
+		dir = e.Dir
+	case e.Dir == "" || !filepath.IsLocal(dir):
+		return "", "", nil, fmt.Errorf("%w: %s in dir %s, tasks name dirs relative to that of the type", ErrNotAllowed, name, dir)
+	default:
+		dir = filepath.Join(e.Dir, dir)
+	}
+	return path, dir, commandEnv(e.Env, env), nil
+}
+
+// resolve gets the absolute path of a command, names found in the PATH of the runner and
+// relative paths in Dir. Names that aren't found stay as they are.
+func (e Exec) resolve(name string) string {
+	if !strings.ContainsRune(name, '/') && !strings.ContainsRune(name, filepath.Separator) {
+		path, err := exec.LookPath(name)
+		if err != nil {
+			return name
+		}
+		name = path
+	} else if !filepath.IsAbs(name) {
+		name = filepath.Join(e.Dir, name)
+	}
+	if abs, err := filepath.Abs(name); err == nil {
+		return abs
+	}
+	return name
+}
+
+// commandEnv gets the environment of a command, base or that of the runner when nil, with
+// the env of its task set over it
+func commandEnv(base []string, env map[string]string) []string {
+	if base == nil {
+		base = os.Environ()
+	}
+	base = slices.Clip(base) // Tasks don't write over each other
+	for _, k := range slices.Sorted(maps.Keys(env)) {
+		base = append(base, k+"="+env[k])
+	}
+	return base
+}
+
+func (e Exec) run(args *tasks.TaskArgs, p execParams) tasks.Result {
+	path, dir, env, err := e.command(p.Command, p.Dir, p.Env)
+	if err != nil {
+		return tasks.Result{Error: err}
+	}
+	timeout := e.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	if d, _ := time.ParseDuration(p.Timeout); d > 0 && d < timeout {
+		timeout = d
+	}
+	ctx, cancel := taskContext(args.Task, timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, path, p.Args...)
+	cmd.Dir, cmd.Env = dir, env
+	cmd.Stdin = strings.NewReader(p.Stdin)
+	stdout, stderr := newCapped(e.MaxOutput), newCapped(e.MaxOutput)
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+	cmd.WaitDelay = time.Second
+	start := time.Now()
+	err = cmd.Run()
+	ms := float64(time.Since(start).Microseconds()) / 1000
+	if args.Task.CTX != nil && args.Task.CTX.Err() != nil {
+		return tasks.Result{Cancelled: true}
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return tasks.Result{Error: fmt.Errorf("%s: timed out after %s", p.Command, timeout), Spark: spark(args.Task, ms)}
+	}
+	var exit *exec.ExitError
+	if err != nil && !errors.As(err, &exit) {
+		return tasks.Result{Error: err}
+	}
+	code := cmd.ProcessState.ExitCode()
+	ok := p.OKCodes
+	if len(ok) == 0 {
+		ok = []int{0}
+	}
+	return tasks.Result{
+		Update: map[string]interface{}{
+			"exit_code": code,
+			"stdout":    stdout.String(),
+			"stderr":    stderr.String(),
+			"ms":        ms,
+			"truncated": stdout.truncated || stderr.truncated,
+		},
+		Warn:  !slices.Contains(ok, code),
+		Spark: spark(args.Task, ms),
+	}
+}
@@ -0,0 +1,77 @@
+package tasktypes
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"pkg.goda.sh/tasks"
+)
+
+// allowedDir creates the Dir of an Exec allowing ./check.sh, with a sub dir holding another
+// check.sh
+func allowedDir(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	for path, out := range map[string]string{"check.sh": "allowed", "sub/check.sh": "task"} {
+		script := "#!/bin/sh\necho " + out + " $NAME $(pwd)\n"
+		if err := os.WriteFile(filepath.Join(dir, path), []byte(script), 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestExecAllowChecksEnvAndDir(t *testing.T) {
+	dir := allowedDir(t)
+	e := Exec{Allow: []string{"./check.sh"}, AllowEnv: []string{"NAME"}, Dir: dir}
+	for _, c := range []struct {
+		name string
+		p    execParams
+		want string // In stdout, or empty when not allowed
+	}{
+		{"allowed", execParams{Command: "./check.sh"}, "allowed " + dir},
+		{"allowed env", execParams{Command: "./check.sh", Env: map[string]string{"NAME": "gateway"}}, "allowed gateway " + dir},
+		{"env", execParams{Command: "./check.sh", Env: map[string]string{"LD_PRELOAD": "/tmp/evil.so"}}, ""},
+		{"sub dir", execParams{Command: "./check.sh", Dir: "sub"}, "allowed " + filepath.Join(dir, "sub")},
+		{"absolute dir", execParams{Command: "./check.sh", Dir: "/"}, ""},
+		{"dir outside", execParams{Command: "./check.sh", Dir: "../"}, ""},
+		{"command", execParams{Command: "sh", Args: []string{"-c", "echo task"}}, ""},
+		{"absolute command", execParams{Command: filepath.Join(dir, "check.sh")}, "allowed " + dir},
+	} {
+		result := e.run(&tasks.TaskArgs{Task: tasks.Task{Label: c.name, CTX: context.Background()}}, c.p)
+		if c.want == "" {
+			if !errors.Is(result.Error, ErrNotAllowed) {
+				t.Errorf("%s: got %+v, want ErrNotAllowed", c.name, result)
+			}
+			continue
+		}
+		if result.Error != nil {
+			t.Errorf("%s: %v", c.name, result.Error)
+			continue
+		}
+		if stdout := result.Update.(map[string]interface{})["stdout"].(string); strings.TrimSpace(stdout) != c.want {
+			t.Errorf("%s: got %q, want %q", c.name, stdout, c.want)
+		}
+	}
+}
+
+func TestSuperviseAllowChecksEnvAndDir(t *testing.T) {
+	dir := allowedDir(t)
+	s := Supervise{Allow: []string{"./check.sh"}, Dir: dir}
+	for _, p := range []superviseParams{
+		{Command: "./check.sh", Env: map[string]string{"LD_PRELOAD": "/tmp/evil.so"}},
+		{Command: "./check.sh", Dir: "/"},
+		{Command: "sh"},
+	} {
+		if result := s.run(&tasks.TaskArgs{Task: tasks.Task{CTX: context.Background()}}, p); !errors.Is(result.Error, ErrNotAllowed) {
+			t.Errorf("%+v: got %+v, want ErrNotAllowed", p, result)
+		}
+	}
+}
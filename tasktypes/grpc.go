@@ -0,0 +1,178 @@
+package tasktypes
+
+import (
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+	"pkg.goda.sh/runner/v2"
+	"pkg.goda.sh/tasks"
+)
+
+// GRPCType is the task type of GRPC
+const GRPCType = "grpc"
+
+// healthCheck is the method of the standard gRPC health checking protocol
+const healthCheck = "/grpc.health.v1.Health/Check"
+
+// healthStatuses are the names of the statuses of a HealthCheckResponse
+var healthStatuses = []string{"UNKNOWN", "SERVING", "NOT_SERVING", "SERVICE_UNKNOWN"}
+
+// GRPC checks the health of the gRPC target of tasks, a host:port, with the standard health
+// checking protocol, grpc.health.v1.Health/Check:
+//
+//	{"target": "orders.internal:9000", "service": "orders.v1.Orders", "status": "SERVING", "ms": 2.3}
+//
+// The service param names the service checked, the whole server when empty. Connections
+// are in plain text unless the task has a tls param, see HTTP. Tasks warn when the status
+// isn't SERVING, servers not knowing the service report SERVICE_UNKNOWN. Servers that can't
+// be reached or don't implement the protocol fail the task. RTTs are kept in Spark.
+type GRPC struct {
+	Timeout time.Duration // DefaultTimeout when 0
+}
+
+// grpcParams are the params of GRPC tasks
+type grpcParams struct {
+	Target  string     `json:"target"`
+	Service string     `json:"service"`
+	TLS     *tlsParams `json:"tls"`
+}
+
+func (p *grpcParams) Validate() error {
+	if p.Target == "" {
+		return errors.New("no target")
+	}
+	return nil
+}
+
+// Register adds the GRPC task type to r
+func (g GRPC) Register(r *runner.Runner) error {
+	return r.Register(GRPCType, runner.Typed(g.run), runner.TaskType{Params: runner.ParamSchema{
+		"target":  {Kind: runner.ParamString, Required: true},
+		"service": {Kind: runner.ParamString},
+		"tls":     {Kind: runner.ParamObject},
+	}})
+}
+
+func (g GRPC) run(args *tasks.TaskArgs, p grpcParams) tasks.Result {
+	creds := grpc.WithInsecure()
+	if p.TLS != nil {
+		config := &tls.Config{}
+		if err := p.TLS.apply(config); err != nil {
+			return tasks.Result{Error: err}
+		}
+		creds = grpc.WithTransportCredentials(credentials.NewTLS(config))
+	}
+	ctx, cancel := taskContext(args.Task, g.Timeout)
+	defer cancel()
+	conn, err := grpc.DialContext(ctx, p.Target, creds, grpc.WithBlock())
+	if args.Task.CTX != nil && args.Task.CTX.Err() != nil {
+		return tasks.Result{Cancelled: true}
+	}
+	if err != nil {
+		return tasks.Result{Error: fmt.Errorf("%s: %w", p.Target, err)}
+	}
+	defer conn.Close()
+
+	update := map[string]interface{}{"target": p.Target, "service": p.Service}
+	res := &healthResponse{}
+	start := time.Now()
+	err = conn.Invoke(ctx, healthCheck, &healthRequest{service: p.Service}, res, grpc.ForceCodec(healthCodec{}))
+	ms := float64(time.Since(start).Microseconds()) / 1000
+	if args.Task.CTX != nil && args.Task.CTX.Err() != nil {
+		return tasks.Result{Cancelled: true}
+	}
+	switch status.Code(err) {
+	case codes.OK:
+	case codes.NotFound:
+		res.status = 3 // SERVICE_UNKNOWN
+	default:
+		return tasks.Result{Error: fmt.Errorf("%s: %w", p.Target, err), Spark: spark(args.Task, ms)}
+	}
+	name := fmt.Sprint(res.status)
+	if int(res.status) < len(healthStatuses) {
+		name = healthStatuses[res.status]
+	}
+	update["status"], update["ms"] = name, ms
+	return tasks.Result{Update: update, Warn: name != "SERVING", Spark: spark(args.Task, ms)}
+}
+
+// healthRequest is a grpc.health.v1.HealthCheckRequest
+type healthRequest struct {
+	service string // Field 1
+}
+
+// healthResponse is a grpc.health.v1.HealthCheckResponse
+type healthResponse struct {
+	status uint64 // Field 1, see healthStatuses
+}
+
+// healthCodec encodes the messages of the health protocol in the protobuf wire format, the
+// module doesn't depend on protobuf for two messages of a field each. It's named proto for
+// the content type of calls, but isn't registered.
+type healthCodec struct{}
+
+func (healthCodec) Name() string { return "proto" }
+
+func (healthCodec) Marshal(v interface{}) ([]byte, error) {
+	req, ok := v.(*healthRequest)
+	if !ok {
+		return nil, fmt.Errorf("health: can't marshal %T", v)
+	}
+	if req.service == "" {
+		return nil, nil
+	}
+	data := []byte{1<<3 | 2} // Field 1, length delimited
+	data = binary.AppendUvarint(data, uint64(len(req.service)))
+	return append(data, req.service...), nil
+}
+
+func (healthCodec) Unmarshal(data []byte, v interface{}) error {
+	res, ok := v.(*healthResponse)
+	if !ok {
+		return fmt.Errorf("health: can't unmarshal into %T", v)
+	}
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 {
+			return errors.New("health: bad field key")
+		}
+		data = data[n:]
+		switch key & 7 { // Wire type
+		case 0: // Varint
+			value, n := binary.Uvarint(data)
+			if n <= 0 {
+				return errors.New("health: bad varint")
+			}
+			if key>>3 == 1 {
+				res.status = value
+			}
+			data = data[n:]
+		case 1: // 64-bit
+			if len(data) < 8 {
+				return errors.New("health: short field")
+			}
+			data = data[8:]
+		case 2: // Length delimited
+			size, n := binary.Uvarint(data)
+			if n <= 0 || uint64(len(data)-n) < size {
+				return errors.New("health: short field")
+			}
+			data = data[n+int(size):]
+		case 5: // 32-bit
+			if len(data) < 4 {
+				return errors.New("health: short field")
+			}
+			data = data[4:]
+		default:
+			return fmt.Errorf("health: wire type %d", key&7)
+		}
+	}
+	return nil
+}
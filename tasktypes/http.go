@@ -0,0 +1,216 @@
+package tasktypes
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"pkg.goda.sh/runner/v2"
+	"pkg.goda.sh/tasks"
+)
+
+// HTTPType is the task type of HTTP
+const HTTPType = "http"
+
+// HTTP probes the URL of tasks, reporting the status and latency of the reply:
+//
+//	{"status": 200, "ms": 41.2, "bytes": 512, "matched": true}
+//
+// Tasks warn when the status isn't one of their expect_status, which defaults to any under
+// 400, or when the body doesn't match their expect_body regular expression. Requests that
+// get no reply fail. Latencies are kept in Spark. Tasks setting keep_body get the body in
+// the update too, decoded when it's JSON, for the steps of a Pipeline to use.
+//
+// The tls param of tasks sets insecure, server_name and ca_file, a PEM bundle replacing the
+// system roots.
+type HTTP struct {
+	Client  *http.Client  // Its Transport is cloned for tasks with tls settings, http.DefaultClient when nil
+	Timeout time.Duration // DefaultTimeout when 0
+	MaxBody int           // Bytes of the body read, DefaultMaxOutput when 0
+}
+
+// httpParams are the params of HTTP tasks
+type httpParams struct {
+	URL             string            `json:"url"`
+	Method          string            `json:"method"`
+	Headers         map[string]string `json:"headers"`
+	Body            string            `json:"body"`
+	ExpectStatus    codeList          `json:"expect_status"`
+	ExpectBody      string            `json:"expect_body"`
+	FollowRedirects *bool             `json:"follow_redirects"` // true when unset
+	KeepBody        bool              `json:"keep_body"`
+	TLS             *tlsParams        `json:"tls"`
+
+	expectBody *regexp.Regexp
+}
+
+// tlsParams are the TLS settings of a task
+type tlsParams struct {
+	Insecure   bool   `json:"insecure"`
+	ServerName string `json:"server_name"`
+	CAFile     string `json:"ca_file"`
+}
+
+func (p *httpParams) Validate() (err error) {
+	if !strings.HasPrefix(p.URL, "http://") && !strings.HasPrefix(p.URL, "https://") {
+		return fmt.Errorf("url %q isn't http or https", p.URL)
+	}
+	if p.ExpectBody != "" {
+		if p.expectBody, err = regexp.Compile(p.ExpectBody); err != nil {
+			return fmt.Errorf("expect_body: %v", err)
+		}
+	}
+	return nil
+}
+
+// codeList are status or exit codes, a single one or a list
+type codeList []int
+
+func (c *codeList) UnmarshalJSON(data []byte) error {
+	var one int
+	if err := json.Unmarshal(data, &one); err == nil {
+		*c = codeList{one}
+		return nil
+	}
+	return json.Unmarshal(data, (*[]int)(c))
+}
+
+// Register adds the HTTP task type to r
+func (h HTTP) Register(r *runner.Runner) error {
+	return r.Register(HTTPType, runner.Typed(h.run), runner.TaskType{Params: runner.ParamSchema{
+		"url":              {Kind: runner.ParamString, Required: true},
+		"method":           {Kind: runner.ParamString},
+		"headers":          {Kind: runner.ParamObject},
+		"body":             {Kind: runner.ParamString},
+		"expect_status":    {Kind: runner.ParamAny},
+		"expect_body":      {Kind: runner.ParamString},
+		"follow_redirects": {Kind: runner.ParamBool},
+		"keep_body":        {Kind: runner.ParamBool},
+		"tls":              {Kind: runner.ParamObject},
+	}})
+}
+
+func (h HTTP) run(args *tasks.TaskArgs, p httpParams) tasks.Result {
+	client, err := h.client(p)
+	if err != nil {
+		return tasks.Result{Error: err}
+	}
+	ctx, cancel := taskContext(args.Task, h.Timeout)
+	defer cancel()
+	method := strings.ToUpper(p.Method)
+	if method == "" {
+		method = http.MethodGet
+	}
+	req, err := http.NewRequestWithContext(ctx, method, p.URL, strings.NewReader(p.Body))
+	if err != nil {
+		return tasks.Result{Error: err}
+	}
+	for k, v := range p.Headers {
+		req.Header.Set(k, v)
+	}
+	if host := req.Header.Get("Host"); host != "" {
+		req.Host = host
+	}
+	start := time.Now()
+	res, err := client.Do(req)
+	if err != nil {
+		if args.Task.CTX != nil && args.Task.CTX.Err() != nil {
+			return tasks.Result{Cancelled: true}
+		}
+		return tasks.Result{Error: err, Spark: spark(args.Task, float64(time.Since(start).Microseconds())/1000)}
+	}
+	defer res.Body.Close()
+	max := h.MaxBody
+	if max <= 0 {
+		max = DefaultMaxOutput
+	}
+	body, err := io.ReadAll(io.LimitReader(res.Body, int64(max)))
+	ms := float64(time.Since(start).Microseconds()) / 1000
+	if err != nil && !errors.Is(err, context.DeadlineExceeded) {
+		return tasks.Result{Error: err}
+	}
+	update := map[string]interface{}{"status": res.StatusCode, "ms": ms, "bytes": len(body)}
+	warn := res.StatusCode >= 400
+	if len(p.ExpectStatus) > 0 {
+		warn = !slices.Contains(p.ExpectStatus, res.StatusCode)
+	}
+	if p.expectBody != nil {
+		matched := p.expectBody.Match(body)
+		update["matched"] = matched
+		warn = warn || !matched
+	}
+	if p.KeepBody {
+		var decoded interface{}
+		if json.Unmarshal(body, &decoded) == nil {
+			update["body"] = decoded
+		} else {
+			update["body"] = string(body)
+		}
+	}
+	return tasks.Result{Update: update, Warn: warn, Spark: spark(args.Task, ms)}
+}
+
+// client gets the client of a task, with its TLS and redirect settings
+func (h HTTP) client(p httpParams) (*http.Client, error) {
+	client := http.DefaultClient
+	if h.Client != nil {
+		client = h.Client
+	}
+	follow := p.FollowRedirects == nil || *p.FollowRedirects
+	if p.TLS == nil && follow {
+		return client, nil
+	}
+	c := *client
+	if !follow {
+		c.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	}
+	if p.TLS != nil {
+		base, ok := c.Transport.(*http.Transport)
+		if c.Transport == nil {
+			base, ok = http.DefaultTransport.(*http.Transport), true
+		}
+		if !ok {
+			return nil, errors.New("tls settings need an *http.Transport")
+		}
+		t := base.Clone()
+		t.DisableKeepAlives = true // The transport only lives for a run
+		if t.TLSClientConfig == nil {
+			t.TLSClientConfig = &tls.Config{}
+		}
+		if err := p.TLS.apply(t.TLSClientConfig); err != nil {
+			return nil, err
+		}
+		c.Transport = t
+	}
+	return &c, nil
+}
+
+// apply sets the settings of a task on c
+func (p *tlsParams) apply(c *tls.Config) error {
+	c.InsecureSkipVerify = p.Insecure
+	if p.ServerName != "" {
+		c.ServerName = p.ServerName
+	}
+	if p.CAFile != "" {
+		pem, err := os.ReadFile(p.CAFile)
+		if err != nil {
+			return err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates in %s", p.CAFile)
+		}
+		c.RootCAs = pool
+	}
+	return nil
+}
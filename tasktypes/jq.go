@@ -0,0 +1,151 @@
+package tasktypes
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"math/big"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/itchyny/gojq"
+)
+
+// Bounds of evaluations, expressions can loop or output values forever
+const (
+	jqTimeout    = time.Second
+	jqMaxOutputs = 10_000
+)
+
+// jq is an expression of jq, run with gojq, tasks use to get values out of updates and test
+// them. Expressions see the variables of a run as $name but not the environment of the
+// runner. Inputs are values decoded from JSON, see plain, and so are outputs.
+type jq struct {
+	src   string
+	query *gojq.Query
+
+	mu    sync.Mutex
+	codes map[string]*gojq.Code // By the names of the variables they're compiled with
+}
+
+// compileJQ parses an expression, it's compiled once the variables of its runs are known
+func compileJQ(src string) (*jq, error) {
+	query, err := gojq.Parse(src)
+	if err != nil {
+		return nil, fmt.Errorf("jq %q: %v", src, err)
+	}
+	return &jq{src: src, query: query, codes: map[string]*gojq.Code{}}, nil
+}
+
+// code gets the expression compiled with the variables names
+func (q *jq) code(names []string) (*gojq.Code, error) {
+	key := strings.Join(names, " ")
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if code, ok := q.codes[key]; ok {
+		return code, nil
+	}
+	vars := make([]string, len(names))
+	for i, name := range names {
+		vars[i] = "$" + name
+	}
+	code, err := gojq.Compile(q.query, gojq.WithVariables(vars), gojq.WithEnvironLoader(func() []string { return nil }))
+	if err != nil {
+		return nil, err
+	}
+	q.codes[key] = code
+	return code, nil
+}
+
+// run evaluates the expression on in, giving its output, a list of them when there are
+// several and nil when there's none
+func (q *jq) run(in interface{}, vars map[string]interface{}) (interface{}, error) {
+	outs, err := q.eval(in, vars)
+	if err != nil {
+		return nil, fmt.Errorf("jq %q: %v", q.src, err)
+	}
+	switch len(outs) {
+	case 0:
+		return nil, nil
+	case 1:
+		return outs[0], nil
+	}
+	return outs, nil
+}
+
+func (q *jq) eval(in interface{}, vars map[string]interface{}) ([]interface{}, error) {
+	names := slices.Sorted(maps.Keys(vars))
+	code, err := q.code(names)
+	if err != nil {
+		return nil, err
+	}
+	values := make([]interface{}, len(names))
+	for i, name := range names {
+		values[i] = vars[name]
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), jqTimeout)
+	defer cancel()
+	var outs []interface{}
+	iter := code.RunWithContext(ctx, in, values...)
+	for {
+		v, ok := iter.Next()
+		if !ok {
+			return outs, nil
+		}
+		if err, ok := v.(error); ok {
+			var halt *gojq.HaltError
+			if errors.As(err, &halt) && halt.Value() == nil {
+				return outs, nil
+			}
+			return nil, err
+		}
+		if len(outs) == jqMaxOutputs {
+			return nil, fmt.Errorf("over %d outputs", jqMaxOutputs)
+		}
+		outs = append(outs, jqPlain(v))
+	}
+}
+
+// jqPlain converts the numbers of gojq outputs to float64, the numbers decoded from JSON
+func jqPlain(v interface{}) interface{} {
+	switch v := v.(type) {
+	case int:
+		return float64(v)
+	case *big.Int:
+		f, _ := new(big.Float).SetInt(v).Float64()
+		return f
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			out[i] = jqPlain(item)
+		}
+		return out
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			out[k] = jqPlain(item)
+		}
+		return out
+	}
+	return v
+}
+
+// plain converts a value to what decoding it from JSON gives, numbers become float64 and
+// structs maps, as expressions expect
+func plain(v interface{}) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var out interface{}
+	return out, json.Unmarshal(data, &out)
+}
+
+// jqTrue reports whether a value is true for conditions, all are but false and null
+func jqTrue(v interface{}) bool {
+	return v != nil && v != false
+}
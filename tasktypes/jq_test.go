@@ -0,0 +1,75 @@
+package tasktypes
+
+import (
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestJQ(t *testing.T) {
+	in, err := plain(map[string]interface{}{
+		"status": 200,
+		"checks": []map[string]interface{}{{"name": "db", "ms": 12}, {"name": "cache", "ms": 250}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	vars := map[string]interface{}{"limit": 100.0}
+	for _, c := range []struct {
+		src  string
+		want interface{}
+	}{
+		{".status", 200.0},
+		{".checks | length", 2.0},
+		{".checks[-1].name", "cache"},
+		{".checks[] | select(.ms > $limit) | .name", "cache"},
+		{"[.checks[].ms] | add / length", 131.0},
+		{".checks | map(.name)", []interface{}{"db", "cache"}},
+		{".checks[].name", []interface{}{"db", "cache"}},
+		{".missing // \"none\"", "none"},
+		{"empty", nil},
+	} {
+		q, err := compileJQ(c.src)
+		if err != nil {
+			t.Errorf("%s: %v", c.src, err)
+			continue
+		}
+		if got, err := q.run(in, vars); err != nil || !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: got %#v, %v, want %#v", c.src, got, err, c.want)
+		}
+	}
+}
+
+func TestJQErrors(t *testing.T) {
+	if _, err := compileJQ(".a |"); err == nil {
+		t.Error("compiled a bad expression")
+	}
+	q, _ := compileJQ("$missing")
+	if _, err := q.run(nil, nil); err == nil {
+		t.Error("ran an expression with an undefined variable")
+	}
+}
+
+func TestJQSandbox(t *testing.T) {
+	t.Setenv("RUNNER_JQ_SECRET", "secret")
+	for _, src := range []string{`$ENV.RUNNER_JQ_SECRET`, `env.RUNNER_JQ_SECRET`} {
+		q, err := compileJQ(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := q.run(nil, nil); got == os.Getenv("RUNNER_JQ_SECRET") {
+			t.Errorf("%s: got the environment of the runner", src)
+		}
+	}
+	start := time.Now()
+	for _, src := range []string{`def f: f; f`, `repeat(1)`} {
+		q, _ := compileJQ(src)
+		if _, err := q.run(nil, nil); err == nil {
+			t.Errorf("%s: got no error, want it stopped", src)
+		}
+	}
+	if d := time.Since(start); d > 10*jqTimeout {
+		t.Errorf("endless expressions ran %v", d)
+	}
+}
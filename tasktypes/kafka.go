@@ -0,0 +1,594 @@
+package tasktypes
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"strconv"
+	"time"
+
+	"pkg.goda.sh/runner/v2"
+	"pkg.goda.sh/tasks"
+)
+
+// KafkaType is the task type of Kafka
+const KafkaType = "kafka"
+
+// Kafka reports the lag of the consumer group of tasks, the messages of the partitions of
+// its topics past the offsets it committed:
+//
+//	{"group": "billing", "lag": 1520, "topics": {"invoices": {"lag": 1520, "partitions": [
+//	 {"partition": 0, "committed": 88210, "end": 89730, "lag": 1520},
+//	 {"partition": 1, "committed": 90112, "end": 90112, "lag": 0}]}}}
+//
+// Tasks name bootstrap brokers, tried in turn, and the topics checked, those the group
+// committed offsets for by default. Partitions without a committed offset have a null lag.
+// Tasks warn when the lag of the group is over their warn_lag or that of a partition over
+// their warn_partition_lag, and fail when the group has no offsets to check. The lag of the
+// group is kept in Spark.
+//
+// Connections use TLS when tasks have a tls param, see HTTP, and authenticate with SASL PLAIN
+// when they have a username. The requests sent are supported from Kafka 1.0 on, the module
+// doesn't depend on a Kafka client for them.
+type Kafka struct {
+	Timeout time.Duration // DefaultTimeout when 0
+}
+
+// kafkaParams are the params of Kafka tasks
+type kafkaParams struct {
+	Brokers          words      `json:"brokers"`
+	Group            string     `json:"group"`
+	Topics           words      `json:"topics"`
+	WarnLag          *float64   `json:"warn_lag"`
+	WarnPartitionLag *float64   `json:"warn_partition_lag"`
+	TLS              *tlsParams `json:"tls"`
+	Username         string     `json:"username"`
+	Password         string     `json:"password"`
+}
+
+func (p *kafkaParams) Validate() error {
+	if len(p.Brokers) == 0 {
+		return errors.New("no brokers")
+	}
+	for i, b := range p.Brokers {
+		if _, _, err := net.SplitHostPort(b); err != nil {
+			p.Brokers[i] = net.JoinHostPort(b, "9092")
+		}
+	}
+	if p.Group == "" {
+		return errors.New("no group")
+	}
+	return nil
+}
+
+// Register adds the Kafka task type to r
+func (k Kafka) Register(r *runner.Runner) error {
+	return r.Register(KafkaType, runner.Typed(k.run), runner.TaskType{Params: runner.ParamSchema{
+		"brokers":            {Kind: runner.ParamAny, Required: true},
+		"group":              {Kind: runner.ParamString, Required: true},
+		"topics":             {Kind: runner.ParamAny},
+		"warn_lag":           {Kind: runner.ParamNumber},
+		"warn_partition_lag": {Kind: runner.ParamNumber},
+		"tls":                {Kind: runner.ParamObject},
+		"username":           {Kind: runner.ParamString},
+		"password":           {Kind: runner.ParamString},
+	}})
+}
+
+func (k Kafka) run(args *tasks.TaskArgs, p kafkaParams) tasks.Result {
+	ctx, cancel := taskContext(args.Task, k.Timeout)
+	defer cancel()
+	pool := &kafkaPool{ctx: ctx, params: p, conns: make(map[string]*kafkaConn)}
+	defer pool.close()
+	update, total, warn, err := pool.lag()
+	if args.Task.CTX != nil && args.Task.CTX.Err() != nil {
+		return tasks.Result{Cancelled: true}
+	}
+	if err != nil {
+		return tasks.Result{Error: err}
+	}
+	warn = warn || (p.WarnLag != nil && float64(total) > *p.WarnLag)
+	return tasks.Result{Update: update, Warn: warn, Spark: spark(args.Task, float64(total))}
+}
+
+// kafkaPool holds the connections of a run, by broker address
+type kafkaPool struct {
+	ctx    context.Context
+	params kafkaParams
+	conns  map[string]*kafkaConn
+}
+
+// kafkaPartition is a partition of a topic with its leader
+type kafkaPartition struct {
+	index  int32
+	leader string // Address
+	err    error
+}
+
+// lag gets the lag of the group of the run, the update reporting it, its total and whether
+// a partition is over warn_partition_lag
+func (pool *kafkaPool) lag() (map[string]interface{}, int64, bool, error) {
+	p := pool.params
+	boot, err := pool.bootstrap()
+	if err != nil {
+		return nil, 0, false, err
+	}
+	coordinator, err := boot.findCoordinator(p.Group)
+	if err != nil {
+		return nil, 0, false, err
+	}
+	coord, err := pool.conn(coordinator)
+	if err != nil {
+		return nil, 0, false, err
+	}
+	committed, err := coord.offsetFetch(p.Group)
+	if err != nil {
+		return nil, 0, false, err
+	}
+	topics := []string(p.Topics)
+	if len(topics) == 0 {
+		for topic := range committed {
+			topics = append(topics, topic)
+		}
+		slices.Sort(topics)
+	}
+	if len(topics) == 0 {
+		return nil, 0, false, fmt.Errorf("group %s has no committed offsets", p.Group)
+	}
+	partitions, err := boot.metadata(topics)
+	if err != nil {
+		return nil, 0, false, err
+	}
+
+	byLeader := make(map[string]map[string][]int32)
+	for topic, parts := range partitions {
+		for _, part := range parts {
+			if part.err == nil {
+				if byLeader[part.leader] == nil {
+					byLeader[part.leader] = make(map[string][]int32)
+				}
+				byLeader[part.leader][topic] = append(byLeader[part.leader][topic], part.index)
+			}
+		}
+	}
+	ends := make(map[string]map[int32]int64)
+	for leader, topics := range byLeader {
+		c, err := pool.conn(leader)
+		if err != nil {
+			return nil, 0, false, err
+		}
+		if err := c.listOffsets(topics, ends); err != nil {
+			return nil, 0, false, err
+		}
+	}
+
+	var total int64
+	warn := false
+	report := make(map[string]interface{}, len(topics))
+	for _, topic := range topics {
+		var topicLag int64
+		list := make([]interface{}, 0, len(partitions[topic]))
+		for _, part := range partitions[topic] {
+			entry := map[string]interface{}{"partition": part.index, "committed": nil, "end": nil, "lag": nil}
+			if part.err != nil {
+				entry["error"] = part.err.Error()
+				list = append(list, entry)
+				continue
+			}
+			end, hasEnd := ends[topic][part.index]
+			if hasEnd {
+				entry["end"] = end
+			}
+			offset, ok := committed[topic][part.index]
+			if ok && offset >= 0 {
+				entry["committed"] = offset
+				if hasEnd {
+					lag := max(end-offset, 0)
+					entry["lag"] = lag
+					topicLag += lag
+					warn = warn || (p.WarnPartitionLag != nil && float64(lag) > *p.WarnPartitionLag)
+				}
+			}
+			list = append(list, entry)
+		}
+		report[topic] = map[string]interface{}{"lag": topicLag, "partitions": list}
+		total += topicLag
+	}
+	return map[string]interface{}{"group": p.Group, "lag": total, "topics": report}, total, warn, nil
+}
+
+// bootstrap connects to the first broker of the run that can be reached
+func (pool *kafkaPool) bootstrap() (*kafkaConn, error) {
+	var errs []error
+	for _, addr := range pool.params.Brokers {
+		c, err := pool.conn(addr)
+		if err == nil {
+			return c, nil
+		}
+		errs = append(errs, err)
+		if pool.ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, errors.Join(errs...)
+}
+
+// conn gets the connection to a broker, connecting and authenticating the first time
+func (pool *kafkaPool) conn(addr string) (*kafkaConn, error) {
+	if c, ok := pool.conns[addr]; ok {
+		return c, nil
+	}
+	var conn net.Conn
+	var err error
+	if pool.params.TLS != nil {
+		host, _, _ := net.SplitHostPort(addr)
+		config := &tls.Config{ServerName: host}
+		if err := pool.params.TLS.apply(config); err != nil {
+			return nil, err
+		}
+		conn, err = (&tls.Dialer{Config: config}).DialContext(pool.ctx, "tcp", addr)
+	} else {
+		conn, err = (&net.Dialer{}).DialContext(pool.ctx, "tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := pool.ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	c := &kafkaConn{conn: conn, addr: addr, stop: context.AfterFunc(pool.ctx, func() { conn.Close() })}
+	if pool.params.Username != "" {
+		if err := c.authenticate(pool.params.Username, pool.params.Password); err != nil {
+			c.close()
+			return nil, err
+		}
+	}
+	pool.conns[addr] = c
+	return c, nil
+}
+
+func (pool *kafkaPool) close() {
+	for _, c := range pool.conns {
+		c.close()
+	}
+}
+
+// kafkaConn is a connection to a broker
+type kafkaConn struct {
+	conn        net.Conn
+	addr        string
+	stop        func() bool
+	correlation int32
+}
+
+func (c *kafkaConn) close() {
+	c.stop()
+	c.conn.Close()
+}
+
+// Keys of the requests sent, with the versions used
+const (
+	kafkaListOffsets     = 2  // v2
+	kafkaMetadata        = 3  // v4
+	kafkaOffsetFetch     = 9  // v3
+	kafkaFindCoordinator = 10 // v1
+	kafkaSASLHandshake   = 17 // v1
+	kafkaSASLAuth        = 36 // v0
+)
+
+// kafkaMaxResponse bounds the size of the responses read
+const kafkaMaxResponse = 64 << 20
+
+// request sends a request and reads its response, after the correlation ID
+func (c *kafkaConn) request(key, version int16, body *kafkaEncoder) (*kafkaDecoder, error) {
+	c.correlation++
+	head := &kafkaEncoder{}
+	head.i16(key)
+	head.i16(version)
+	head.i32(c.correlation)
+	head.str("runner") // Client ID
+	msg := append(head.b, body.b...)
+	if _, err := c.conn.Write(append(binary.BigEndian.AppendUint32(nil, uint32(len(msg))), msg...)); err != nil {
+		return nil, fmt.Errorf("kafka %s: %w", c.addr, err)
+	}
+	var size [4]byte
+	if _, err := io.ReadFull(c.conn, size[:]); err != nil {
+		return nil, fmt.Errorf("kafka %s: %w", c.addr, err)
+	}
+	n := binary.BigEndian.Uint32(size[:])
+	if n < 4 || n > kafkaMaxResponse {
+		return nil, fmt.Errorf("kafka %s: response of %d bytes", c.addr, n)
+	}
+	res := make([]byte, n)
+	if _, err := io.ReadFull(c.conn, res); err != nil {
+		return nil, fmt.Errorf("kafka %s: %w", c.addr, err)
+	}
+	if id := int32(binary.BigEndian.Uint32(res)); id != c.correlation {
+		return nil, fmt.Errorf("kafka %s: response %d to request %d", c.addr, id, c.correlation)
+	}
+	return &kafkaDecoder{b: res[4:]}, nil
+}
+
+// authenticate authenticates with SASL PLAIN
+func (c *kafkaConn) authenticate(username, password string) error {
+	req := &kafkaEncoder{}
+	req.str("PLAIN")
+	res, err := c.request(kafkaSASLHandshake, 1, req)
+	if err != nil {
+		return err
+	}
+	if code := res.i16(); code != 0 {
+		return kafkaError(code)
+	}
+	req = &kafkaEncoder{}
+	req.bytes([]byte("\x00" + username + "\x00" + password))
+	if res, err = c.request(kafkaSASLAuth, 0, req); err != nil {
+		return err
+	}
+	if code, msg := res.i16(), res.str(); code != 0 {
+		return fmt.Errorf("%w: %s", kafkaError(code), msg)
+	}
+	return res.err
+}
+
+// findCoordinator gets the address of the coordinator of a group
+func (c *kafkaConn) findCoordinator(group string) (string, error) {
+	req := &kafkaEncoder{}
+	req.str(group)
+	req.i8(0) // Group
+	res, err := c.request(kafkaFindCoordinator, 1, req)
+	if err != nil {
+		return "", err
+	}
+	res.i32() // Throttle time
+	code, msg := res.i16(), res.str()
+	res.i32() // Node ID
+	host, port := res.str(), res.i32()
+	if res.err != nil {
+		return "", res.err
+	}
+	if code != 0 {
+		return "", fmt.Errorf("coordinator of %s: %w %s", group, kafkaError(code), msg)
+	}
+	return net.JoinHostPort(host, strconv.Itoa(int(port))), nil
+}
+
+// offsetFetch gets the offsets a group committed, by topic and partition
+func (c *kafkaConn) offsetFetch(group string) (map[string]map[int32]int64, error) {
+	req := &kafkaEncoder{}
+	req.str(group)
+	req.i32(-1) // All the topics
+	res, err := c.request(kafkaOffsetFetch, 3, req)
+	if err != nil {
+		return nil, err
+	}
+	res.i32() // Throttle time
+	offsets := make(map[string]map[int32]int64)
+	for n := res.array(); n > 0; n-- {
+		topic := res.str()
+		offsets[topic] = make(map[int32]int64)
+		for m := res.array(); m > 0; m-- {
+			index, offset := res.i32(), res.i64()
+			res.str() // Metadata
+			if res.i16() == 0 {
+				offsets[topic][index] = offset
+			}
+		}
+	}
+	if code := res.i16(); code != 0 {
+		return nil, fmt.Errorf("offsets of %s: %w", group, kafkaError(code))
+	}
+	return offsets, res.err
+}
+
+// metadata gets the partitions of topics
+func (c *kafkaConn) metadata(topics []string) (map[string][]kafkaPartition, error) {
+	req := &kafkaEncoder{}
+	req.array(len(topics))
+	for _, topic := range topics {
+		req.str(topic)
+	}
+	req.i8(0) // Don't create topics
+	res, err := c.request(kafkaMetadata, 4, req)
+	if err != nil {
+		return nil, err
+	}
+	res.i32() // Throttle time
+	brokers := make(map[int32]string)
+	for n := res.array(); n > 0; n-- {
+		id, host, port := res.i32(), res.str(), res.i32()
+		res.str() // Rack
+		brokers[id] = net.JoinHostPort(host, strconv.Itoa(int(port)))
+	}
+	res.str() // Cluster ID
+	res.i32() // Controller ID
+	partitions := make(map[string][]kafkaPartition, len(topics))
+	for n := res.array(); n > 0; n-- {
+		code, topic := res.i16(), res.str()
+		res.i8() // Internal
+		for m := res.array(); m > 0; m-- {
+			part := kafkaPartition{}
+			pcode := res.i16()
+			part.index = res.i32()
+			leader, ok := brokers[res.i32()]
+			for r := res.array(); r > 0; r-- { // Replicas
+				res.i32()
+			}
+			for r := res.array(); r > 0; r-- { // In sync replicas
+				res.i32()
+			}
+			switch {
+			case pcode != 0:
+				part.err = kafkaError(pcode)
+			case !ok:
+				part.err = errors.New("no leader")
+			}
+			part.leader = leader
+			partitions[topic] = append(partitions[topic], part)
+		}
+		if code != 0 && res.err == nil {
+			return nil, fmt.Errorf("topic %s: %w", topic, kafkaError(code))
+		}
+		slices.SortFunc(partitions[topic], func(a, b kafkaPartition) int { return int(a.index - b.index) })
+	}
+	return partitions, res.err
+}
+
+// listOffsets gets the end offsets of partitions led by the broker into ends
+func (c *kafkaConn) listOffsets(topics map[string][]int32, ends map[string]map[int32]int64) error {
+	req := &kafkaEncoder{}
+	req.i32(-1) // Replica ID of consumers
+	req.i8(0)   // Read uncommitted, up to the high watermark
+	req.array(len(topics))
+	for topic, parts := range topics {
+		req.str(topic)
+		req.array(len(parts))
+		for _, index := range parts {
+			req.i32(index)
+			req.i64(-1) // Latest
+		}
+	}
+	res, err := c.request(kafkaListOffsets, 2, req)
+	if err != nil {
+		return err
+	}
+	res.i32() // Throttle time
+	for n := res.array(); n > 0; n-- {
+		topic := res.str()
+		if ends[topic] == nil {
+			ends[topic] = make(map[int32]int64)
+		}
+		for m := res.array(); m > 0; m-- {
+			index, code := res.i32(), res.i16()
+			res.i64() // Timestamp
+			offset := res.i64()
+			if code == 0 {
+				ends[topic][index] = offset
+			}
+		}
+	}
+	return res.err
+}
+
+// kafkaError is an error code of the Kafka protocol
+type kafkaError int16
+
+// kafkaErrors name the error codes likely in the responses read
+var kafkaErrors = map[kafkaError]string{
+	3:  "unknown topic or partition",
+	5:  "leader not available",
+	6:  "not leader for partition",
+	14: "coordinator load in progress",
+	15: "coordinator not available",
+	16: "not coordinator",
+	29: "topic authorization failed",
+	30: "group authorization failed",
+	31: "cluster authorization failed",
+	33: "unsupported SASL mechanism",
+	34: "illegal SASL state",
+	35: "unsupported version",
+	58: "SASL authentication failed",
+	69: "group ID not found",
+}
+
+func (e kafkaError) Error() string {
+	if name, ok := kafkaErrors[e]; ok {
+		return "kafka: " + name
+	}
+	return fmt.Sprintf("kafka: error code %d", int16(e))
+}
+
+// kafkaEncoder builds the body of a request
+type kafkaEncoder struct {
+	b []byte
+}
+
+func (e *kafkaEncoder) i8(v int8)   { e.b = append(e.b, byte(v)) }
+func (e *kafkaEncoder) i16(v int16) { e.b = binary.BigEndian.AppendUint16(e.b, uint16(v)) }
+func (e *kafkaEncoder) i32(v int32) { e.b = binary.BigEndian.AppendUint32(e.b, uint32(v)) }
+func (e *kafkaEncoder) i64(v int64) { e.b = binary.BigEndian.AppendUint64(e.b, uint64(v)) }
+
+func (e *kafkaEncoder) array(n int) { e.i32(int32(n)) }
+
+func (e *kafkaEncoder) str(s string) {
+	e.i16(int16(len(s)))
+	e.b = append(e.b, s...)
+}
+
+func (e *kafkaEncoder) bytes(b []byte) {
+	e.i32(int32(len(b)))
+	e.b = append(e.b, b...)
+}
+
+// kafkaDecoder reads a response, keeping the first error, after which it reads zeros
+type kafkaDecoder struct {
+	b   []byte
+	err error
+}
+
+func (d *kafkaDecoder) take(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || len(d.b) < n {
+		d.err = errors.New("kafka: short response")
+		return nil
+	}
+	b := d.b[:n]
+	d.b = d.b[n:]
+	return b
+}
+
+func (d *kafkaDecoder) i8() int8 {
+	if b := d.take(1); b != nil {
+		return int8(b[0])
+	}
+	return 0
+}
+
+func (d *kafkaDecoder) i16() int16 {
+	if b := d.take(2); b != nil {
+		return int16(binary.BigEndian.Uint16(b))
+	}
+	return 0
+}
+
+func (d *kafkaDecoder) i32() int32 {
+	if b := d.take(4); b != nil {
+		return int32(binary.BigEndian.Uint32(b))
+	}
+	return 0
+}
+
+func (d *kafkaDecoder) i64() int64 {
+	if b := d.take(8); b != nil {
+		return int64(binary.BigEndian.Uint64(b))
+	}
+	return 0
+}
+
+// str reads a string, empty when null
+func (d *kafkaDecoder) str() string {
+	n := d.i16()
+	if n < 0 {
+		return ""
+	}
+	return string(d.take(int(n)))
+}
+
+// array reads the length of an array, 0 when null
+func (d *kafkaDecoder) array() int {
+	n := int(d.i32())
+	if n > len(d.b) { // Elements take a byte at least
+		d.err = errors.New("kafka: short response")
+	}
+	if d.err != nil || n < 0 {
+		return 0
+	}
+	return n
+}
@@ -0,0 +1,216 @@
+package tasktypes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// maxLuaDepth bounds the nesting of the tables converted to Go, tables containing themselves
+// convert to nil past it
+const maxLuaDepth = 100
+
+// Bounds of the stacks of scripts, gopher-lua gives no way to bound the memory they use
+// otherwise. Calls nested deeper and values on the stack past the registry raise errors.
+const (
+	luaCallStackSize   = 200
+	luaRegistrySize    = 1024 * 4
+	luaRegistryMaxSize = 1024 * 256
+)
+
+// luaErrorType is the type of the userdata holding Go errors raised in scripts
+const luaErrorType = "error"
+
+// newLua creates a Lua state with the base, string, table and math libraries, os.time,
+// os.clock, os.date and os.difftime and a json library. Scripts get no files, processes,
+// modules or network besides the functions added to the state. print writes to out.
+func newLua(ctx context.Context, out io.Writer) *lua.LState {
+	L := lua.NewState(lua.Options{
+		SkipOpenLibs:     true,
+		CallStackSize:    luaCallStackSize,
+		RegistrySize:     luaRegistrySize,
+		RegistryMaxSize:  luaRegistryMaxSize,
+		RegistryGrowStep: luaRegistrySize, // Growing by the default 32 values copies the registry for every 32
+	})
+	for _, lib := range []struct {
+		name string
+		open lua.LGFunction
+	}{
+		{lua.BaseLibName, lua.OpenBase},
+		{lua.TabLibName, lua.OpenTable},
+		{lua.StringLibName, lua.OpenString},
+		{lua.MathLibName, lua.OpenMath},
+		{lua.OsLibName, lua.OpenOs},
+	} {
+		L.Push(L.NewFunction(lib.open))
+		L.Push(lua.LString(lib.name))
+		L.Call(1, 0)
+	}
+	for _, name := range []string{"collectgarbage", "dofile", "getfenv", "load", "loadfile", "loadstring", "module", "newproxy", "require", "setfenv", "_printregs"} {
+		L.SetGlobal(name, lua.LNil)
+	}
+	os := L.NewTable()
+	for _, name := range []string{"clock", "date", "difftime", "time"} {
+		os.RawSetString(name, L.GetField(L.GetGlobal("os"), name))
+	}
+	L.SetGlobal("os", os)
+
+	// string.rep is the one library function building strings of any size at once
+	rep := L.GetField(L.GetGlobal("string"), "rep").(*lua.LFunction)
+	L.SetField(L.GetGlobal("string"), "rep", L.NewFunction(func(L *lua.LState) int {
+		if n := L.CheckInt(2); n > 0 && len(L.CheckString(1))*n > DefaultMaxOutput {
+			L.RaiseError("string.rep result over %d bytes", DefaultMaxOutput)
+		}
+		L.Push(rep)
+		L.Push(L.Get(1))
+		L.Push(L.Get(2))
+		L.Call(2, 1)
+		return 1
+	}))
+	L.SetGlobal("print", L.NewFunction(func(L *lua.LState) int {
+		values := make([]string, L.GetTop())
+		for i := range values {
+			values[i] = L.ToStringMeta(L.Get(i + 1)).String()
+		}
+		fmt.Fprintln(out, strings.Join(values, "\t"))
+		return 0
+	}))
+
+	js := L.NewTable()
+	L.SetField(js, "encode", L.NewFunction(func(L *lua.LState) int {
+		data, err := json.Marshal(fromLua(L.CheckAny(1), 0))
+		if err != nil {
+			return raise(L, err)
+		}
+		L.Push(lua.LString(data))
+		return 1
+	}))
+	L.SetField(js, "decode", L.NewFunction(func(L *lua.LState) int {
+		var v interface{}
+		if err := json.Unmarshal([]byte(L.CheckString(1)), &v); err != nil {
+			return raise(L, err)
+		}
+		L.Push(toLua(L, v))
+		return 1
+	}))
+	L.SetGlobal("json", js)
+
+	meta := L.NewTypeMetatable(luaErrorType)
+	L.SetField(meta, "__tostring", L.NewFunction(func(L *lua.LState) int {
+		L.Push(lua.LString(L.CheckUserData(1).Value.(error).Error()))
+		return 1
+	}))
+	L.SetContext(ctx)
+	return L
+}
+
+// raise raises err in a script, scripts can catch it with pcall and the run gets err back
+// otherwise, see luaError
+func raise(L *lua.LState, err error) int {
+	ud := L.NewUserData()
+	ud.Value = err
+	L.SetMetatable(ud, L.GetTypeMetatable(luaErrorType))
+	L.Error(ud, 1)
+	return 0
+}
+
+// luaError gets the error a script stopped with
+func luaError(err error) error {
+	apiErr, ok := err.(*lua.ApiError)
+	if !ok {
+		return err
+	}
+	if ud, ok := apiErr.Object.(*lua.LUserData); ok {
+		if err, ok := ud.Value.(error); ok {
+			return err
+		}
+	}
+	return fmt.Errorf("script: %s", apiErr.Object.String())
+}
+
+// fromLua converts a Lua value to Go, tables with keys 1 to n to slices and other tables to
+// maps. Functions and userdata convert to nil.
+func fromLua(v lua.LValue, depth int) interface{} {
+	switch v := v.(type) {
+	case lua.LBool:
+		return bool(v)
+	case lua.LNumber:
+		return float64(v)
+	case lua.LString:
+		return string(v)
+	case *lua.LTable:
+		if depth > maxLuaDepth {
+			return nil
+		}
+		n := 0
+		v.ForEach(func(lua.LValue, lua.LValue) { n++ })
+		if n > 0 && n == v.Len() {
+			list := make([]interface{}, n)
+			for i := range list {
+				list[i] = fromLua(v.RawGetInt(i+1), depth+1)
+			}
+			return list
+		}
+		m := make(map[string]interface{}, n)
+		v.ForEach(func(k, item lua.LValue) { m[k.String()] = fromLua(item, depth+1) })
+		return m
+	}
+	return nil
+}
+
+// toLua converts a value decoded by encoding/json, or made of Go numbers, strings, bools,
+// slices and maps, to Lua
+func toLua(L *lua.LState, v interface{}) lua.LValue {
+	switch v := v.(type) {
+	case nil:
+		return lua.LNil
+	case bool:
+		return lua.LBool(v)
+	case string:
+		return lua.LString(v)
+	case float64:
+		return lua.LNumber(v)
+	case float32:
+		return lua.LNumber(v)
+	case int:
+		return lua.LNumber(v)
+	case int64:
+		return lua.LNumber(v)
+	case json.Number:
+		f, _ := v.Float64()
+		return lua.LNumber(f)
+	case []interface{}:
+		t := L.CreateTable(len(v), 0)
+		for i, item := range v {
+			t.RawSetInt(i+1, toLua(L, item))
+		}
+		return t
+	case map[string]interface{}:
+		t := L.CreateTable(0, len(v))
+		for _, k := range slices.Sorted(maps.Keys(v)) { // Maps have no order, key order is made stable
+			t.RawSetString(k, toLua(L, v[k]))
+		}
+		return t
+	case map[interface{}]interface{}: // Decoded by yaml.v2
+		t := L.CreateTable(0, len(v))
+		for k, item := range v {
+			t.RawSetString(fmt.Sprint(k), toLua(L, item))
+		}
+		return t
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return lua.LNil
+	}
+	var decoded interface{}
+	if json.Unmarshal(data, &decoded) != nil {
+		return lua.LNil
+	}
+	return toLua(L, decoded)
+}
@@ -0,0 +1,440 @@
+package tasktypes
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+
+	"pkg.goda.sh/runner/v2"
+	"pkg.goda.sh/tasks"
+)
+
+// MQTTType is the task type of MQTT
+const MQTTType = "mqtt"
+
+// Defaults of MQTT tasks
+const (
+	DefaultMQTTRate      = time.Second
+	DefaultMQTTMessages  = 100
+	DefaultMQTTKeepAlive = time.Minute
+)
+
+// MQTT subscribes to the topics of tasks on their broker and turns the messages received
+// into results, bringing telemetry into the results of the runner:
+//
+//	{"received": 2, "messages": [{"topic": "plant/line1/temp", "payload": {"celsius": 71.5},
+//	 "retained": false}, {"topic": "plant/line2/temp", "payload": 68, "retained": true}]}
+//
+// MQTT tasks are timerless: they stay subscribed while in the task list and report at most
+// a result every Rate, with the messages received since the one before, the latest
+// MaxMessages of them. Payloads are decoded when they're JSON. The warn param is a jq
+// expression, see jq, tasks warn when it holds for a message of a result. The value param
+// is one getting a number out of messages, the latest of a result is kept in Spark, the
+// number of messages of results is otherwise.
+//
+// Brokers are tcp://, mqtt://, ssl:// or mqtts:// URLs, the last two over TLS with the tls
+// param of tasks, see HTTP. Connections speak MQTT 3.1.1 with a clean session; a lost one
+// is reported as a failed result and retried with a backoff. Messages are received at the
+// qos of tasks, 0 or 1.
+type MQTT struct {
+	Rate        time.Duration // Between the results of a task, DefaultMQTTRate when 0
+	MaxMessages int           // Kept per result, DefaultMQTTMessages when 0
+	Timeout     time.Duration // Of connecting and subscribing, DefaultTimeout when 0
+
+	logger *slog.Logger // Of the Runner it's registered to
+}
+
+// mqttParams are the params of MQTT tasks
+type mqttParams struct {
+	Broker   string     `json:"broker"`
+	Topics   words      `json:"topics"` // Filters, with the + and # wildcards
+	QoS      int        `json:"qos"`
+	ClientID string     `json:"client_id"` // Random when empty
+	Username string     `json:"username"`
+	Password string     `json:"password"`
+	TLS      *tlsParams `json:"tls"`
+	Warn     string     `json:"warn"`
+	Value    string     `json:"value"`
+
+	addr        string
+	secure      bool
+	warn, value *jq
+}
+
+func (p *mqttParams) Validate() (err error) {
+	u, err := url.Parse(p.Broker)
+	if err != nil || u.Hostname() == "" {
+		return fmt.Errorf("bad broker %q", p.Broker)
+	}
+	port := "1883"
+	switch u.Scheme {
+	case "tcp", "mqtt":
+	case "ssl", "mqtts":
+		p.secure, port = true, "8883"
+	default:
+		return fmt.Errorf("broker %q isn't tcp, mqtt, ssl or mqtts", p.Broker)
+	}
+	if u.Port() != "" {
+		port = u.Port()
+	}
+	p.addr = net.JoinHostPort(u.Hostname(), port)
+	if len(p.Topics) == 0 {
+		return errors.New("no topics")
+	}
+	if p.QoS != 0 && p.QoS != 1 {
+		return fmt.Errorf("qos %d isn't 0 or 1", p.QoS)
+	}
+	if p.Password != "" && p.Username == "" {
+		return errors.New("password without a username")
+	}
+	if p.Warn != "" {
+		if p.warn, err = compileJQ(p.Warn); err != nil {
+			return fmt.Errorf("warn: %v", err)
+		}
+	}
+	if p.Value != "" {
+		if p.value, err = compileJQ(p.Value); err != nil {
+			return fmt.Errorf("value: %v", err)
+		}
+	}
+	return nil
+}
+
+// Register adds the MQTT task type to r
+func (m MQTT) Register(r *runner.Runner) error {
+	m.logger = r.Logger()
+	return r.Register(MQTTType, runner.Typed(m.run), runner.TaskType{
+		Params: runner.ParamSchema{
+			"broker":    {Kind: runner.ParamString, Required: true},
+			"topics":    {Kind: runner.ParamAny, Required: true},
+			"qos":       {Kind: runner.ParamNumber},
+			"client_id": {Kind: runner.ParamString},
+			"username":  {Kind: runner.ParamString},
+			"password":  {Kind: runner.ParamString},
+			"tls":       {Kind: runner.ParamObject},
+			"warn":      {Kind: runner.ParamString},
+			"value":     {Kind: runner.ParamString},
+		},
+		Timerless: true,
+	})
+}
+
+func (m MQTT) run(args *tasks.TaskArgs, p mqttParams) tasks.Result {
+	if p.ClientID == "" {
+		id := make([]byte, 8)
+		rand.Read(id)
+		p.ClientID = "runner-" + hex.EncodeToString(id)
+	}
+	go m.subscribe(args, p)
+	return tasks.Result{}
+}
+
+// subscribe keeps a task subscribed until it's cancelled
+func (m MQTT) subscribe(args *tasks.TaskArgs, p mqttParams) {
+	task := args.Task
+	emit := func(update map[string]interface{}, warn bool, v *float64) {
+		result := tasks.Result{Update: update, Warn: warn, Spark: task.Spark}
+		if v != nil {
+			result.Spark = spark(task, *v)
+		}
+		task.Spark = result.Spark
+		args.Callback(result)
+	}
+	backoff := time.Second
+	for {
+		connected, err := m.session(task, p, emit)
+		if task.CTX.Err() != nil {
+			return
+		}
+		if connected {
+			backoff = time.Second
+		}
+		args.Callback(tasks.Result{Error: fmt.Errorf("%s: %w", p.Broker, err), Spark: task.Spark})
+		select {
+		case <-task.CTX.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, time.Minute)
+	}
+}
+
+// session connects to the broker of a task and reports its messages until the connection
+// is lost or the task cancelled
+func (m MQTT) session(task tasks.Task, p mqttParams, emit func(map[string]interface{}, bool, *float64)) (connected bool, err error) {
+	timeout := m.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(task.CTX, timeout)
+	defer cancel()
+	var conn net.Conn
+	if p.secure {
+		config := &tls.Config{}
+		if p.TLS != nil {
+			if err := p.TLS.apply(config); err != nil {
+				return false, err
+			}
+		}
+		conn, err = (&tls.Dialer{Config: config}).DialContext(ctx, "tcp", p.addr)
+	} else {
+		conn, err = (&net.Dialer{}).DialContext(ctx, "tcp", p.addr)
+	}
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+	defer context.AfterFunc(task.CTX, func() { conn.Close() })()
+	c := &mqttConn{conn: conn, r: bufio.NewReader(conn)}
+	conn.SetDeadline(time.Now().Add(timeout))
+	if err := c.connect(p); err != nil {
+		return false, err
+	}
+	conn.SetDeadline(time.Time{})
+
+	rate, max := m.Rate, m.MaxMessages
+	if rate <= 0 {
+		rate = DefaultMQTTRate
+	}
+	if max <= 0 {
+		max = DefaultMQTTMessages
+	}
+	messages := make(chan map[string]interface{}, max)
+	lost := make(chan error, 1)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			msg, err := c.receive()
+			if err != nil {
+				lost <- err
+				return
+			}
+			if msg != nil {
+				select {
+				case messages <- msg:
+				case <-done:
+					return
+				}
+			}
+		}
+	}()
+
+	ping := time.NewTicker(DefaultMQTTKeepAlive / 2)
+	defer ping.Stop()
+	var batch []interface{}
+	var flush <-chan time.Time
+	var last time.Time
+	received, warn := 0, false
+	var value *float64 // Of the latest message having one
+	for {
+		select {
+		case <-task.CTX.Done(): // The connection is closed already
+			return true, task.CTX.Err()
+		case err := <-lost:
+			return true, err
+		case <-ping.C:
+			if err := c.write(0xc0, nil); err != nil { // PINGREQ
+				return true, err
+			}
+		case msg := <-messages:
+			received++
+			batch = append(batch, msg)
+			if len(batch) > max {
+				batch = batch[1:]
+			}
+			if p.warn != nil {
+				v, err := p.warn.run(msg, nil)
+				if err != nil {
+					m.logger.Warn(fmt.Sprintf("MQTT %q: warn: %v", task.Label, err))
+				}
+				warn = warn || jqTrue(v)
+			}
+			if p.value != nil {
+				v, err := p.value.run(msg, nil)
+				if err != nil {
+					m.logger.Warn(fmt.Sprintf("MQTT %q: value: %v", task.Label, err))
+				}
+				if n, ok := v.(float64); ok {
+					value = &n
+				}
+			}
+			if flush == nil {
+				flush = time.After(time.Until(last.Add(rate)))
+			}
+		case <-flush:
+			if p.value == nil {
+				n := float64(received)
+				value = &n
+			}
+			emit(map[string]interface{}{"received": received, "messages": batch}, warn, value)
+			batch, flush, last = nil, nil, time.Now()
+			received, warn, value = 0, false, nil
+		}
+	}
+}
+
+// mqttConn is the client side of an MQTT 3.1.1 connection, writes may come from the
+// goroutines receiving and keeping the connection alive
+type mqttConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+	mu   sync.Mutex
+}
+
+// mqttRefusals are the reasons of the return codes of CONNACK packets
+var mqttRefusals = []string{
+	"", "unacceptable protocol version", "client identifier rejected", "server unavailable",
+	"bad user name or password", "not authorized",
+}
+
+// connect sends CONNECT and SUBSCRIBE, and waits for their acknowledgements
+func (c *mqttConn) connect(p mqttParams) error {
+	flags := byte(0x02) // Clean session
+	if p.Username != "" {
+		flags |= 0x80
+	}
+	if p.Password != "" {
+		flags |= 0x40
+	}
+	body := append(mqttString(nil, "MQTT"), 4, flags) // Protocol level 4 is 3.1.1
+	body = binary.BigEndian.AppendUint16(body, uint16(DefaultMQTTKeepAlive/time.Second))
+	body = mqttString(body, p.ClientID)
+	if p.Username != "" {
+		body = mqttString(body, p.Username)
+	}
+	if p.Password != "" {
+		body = mqttString(body, p.Password)
+	}
+	if err := c.write(0x10, body); err != nil {
+		return err
+	}
+	kind, ack, err := c.read()
+	if err != nil {
+		return err
+	}
+	if kind>>4 != 2 || len(ack) != 2 {
+		return fmt.Errorf("mqtt: expected CONNACK, got packet type %d", kind>>4)
+	}
+	if code := int(ack[1]); code != 0 {
+		if code < len(mqttRefusals) {
+			return fmt.Errorf("mqtt: connection refused: %s", mqttRefusals[code])
+		}
+		return fmt.Errorf("mqtt: connection refused with code %d", code)
+	}
+
+	body = binary.BigEndian.AppendUint16(nil, 1) // Packet identifier
+	for _, topic := range p.Topics {
+		body = append(mqttString(body, topic), byte(p.QoS))
+	}
+	if err := c.write(0x82, body); err != nil {
+		return err
+	}
+	kind, ack, err = c.read()
+	if err != nil {
+		return err
+	}
+	if kind>>4 != 9 || len(ack) != 2+len(p.Topics) {
+		return fmt.Errorf("mqtt: expected SUBACK, got packet type %d", kind>>4)
+	}
+	for i, code := range ack[2:] {
+		if code == 0x80 {
+			return fmt.Errorf("mqtt: subscription to %s refused", p.Topics[i])
+		}
+	}
+	return nil
+}
+
+// receive reads the next packet, giving the message of PUBLISH packets, which it
+// acknowledges, and nil for the others
+func (c *mqttConn) receive() (map[string]interface{}, error) {
+	c.conn.SetReadDeadline(time.Now().Add(DefaultMQTTKeepAlive * 3 / 2))
+	kind, body, err := c.read()
+	if err != nil || kind>>4 != 3 {
+		return nil, err
+	}
+	qos := kind >> 1 & 3
+	if len(body) < 2 {
+		return nil, errors.New("mqtt: short PUBLISH")
+	}
+	size := int(binary.BigEndian.Uint16(body))
+	if len(body) < 2+size {
+		return nil, errors.New("mqtt: short PUBLISH")
+	}
+	topic, payload := string(body[2:2+size]), body[2+size:]
+	if qos > 0 {
+		if len(payload) < 2 {
+			return nil, errors.New("mqtt: short PUBLISH")
+		}
+		if err := c.write(0x40, payload[:2]); err != nil { // PUBACK
+			return nil, err
+		}
+		payload = payload[2:]
+	}
+	var decoded interface{}
+	if json.Unmarshal(payload, &decoded) != nil {
+		decoded = string(payload)
+	}
+	return map[string]interface{}{"topic": topic, "payload": decoded, "retained": kind&1 == 1}, nil
+}
+
+// write sends a packet, kind is its type and flags
+func (c *mqttConn) write(kind byte, body []byte) error {
+	packet := []byte{kind}
+	for n := len(body); ; {
+		b := byte(n % 128)
+		if n /= 128; n > 0 {
+			b |= 0x80
+		}
+		packet = append(packet, b)
+		if n == 0 {
+			break
+		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, err := c.conn.Write(append(packet, body...))
+	return err
+}
+
+// read reads a packet, giving its type and flags and its body
+func (c *mqttConn) read() (byte, []byte, error) {
+	kind, err := c.r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	size := 0
+	for i := 0; ; i++ {
+		if i == 4 {
+			return 0, nil, errors.New("mqtt: bad remaining length")
+		}
+		b, err := c.r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		size |= int(b&0x7f) << (7 * i)
+		if b&0x80 == 0 {
+			break
+		}
+	}
+	body := make([]byte, size)
+	_, err = io.ReadFull(c.r, body)
+	return kind, body, err
+}
+
+// mqttString appends a length prefixed string
+func mqttString(b []byte, s string) []byte {
+	return append(binary.BigEndian.AppendUint16(b, uint16(len(s))), s...)
+}
@@ -0,0 +1,266 @@
+package tasktypes
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"net"
+	"slices"
+	"time"
+
+	"pkg.goda.sh/runner/v2"
+	"pkg.goda.sh/tasks"
+)
+
+// PingType is the task type of Ping
+const PingType = "ping"
+
+// Defaults of Ping tasks
+const (
+	DefaultPingCount    = 5
+	DefaultPingInterval = 200 * time.Millisecond
+	DefaultPingWait     = time.Second
+)
+
+// Ping sends ICMP echo requests to the host of tasks and reports the packet loss and RTT
+// percentiles of a run, in ms:
+//
+//	{"host": "gw.internal", "address": "10.0.0.1", "mode": "raw", "sent": 5, "received": 5,
+//	 "loss_percent": 0, "min": 0.4, "avg": 0.6, "max": 1.1, "p50": 0.5, "p90": 1.1, "p99": 1.1}
+//
+// Tasks send count requests, DefaultPingCount by default, every interval and wait for
+// replies up to wait after the last one. They warn when the loss is over their warn_loss
+// percent, 0 by default, or the p90 over their warn_rtt. The p50 of runs is kept in Spark,
+// for graphs of the network quality seen from each Location.
+//
+// Raw ICMP sockets need privileges, CAP_NET_RAW on Linux. Without them, the unprivileged
+// datagram ICMP sockets of Linux, see net.ipv4.ping_group_range, and macOS are used, the
+// mode of results says which.
+type Ping struct {
+	Timeout time.Duration // Of runs, DefaultTimeout when 0
+}
+
+// pingParams are the params of Ping tasks
+type pingParams struct {
+	Host     string  `json:"host"`
+	Count    int     `json:"count"`
+	Interval string  `json:"interval"`
+	Wait     string  `json:"wait"`
+	Size     int     `json:"size"` // Of the payload, 56 bytes by default
+	WarnLoss float64 `json:"warn_loss"`
+	WarnRTT  float64 `json:"warn_rtt"`
+
+	interval, wait time.Duration
+}
+
+func (p *pingParams) Validate() (err error) {
+	if p.Host == "" {
+		return errors.New("no host")
+	}
+	if p.Count == 0 {
+		p.Count = DefaultPingCount
+	}
+	if p.Count < 0 || p.Count > 100 {
+		return fmt.Errorf("count %d isn't between 1 and 100", p.Count)
+	}
+	if p.Size == 0 {
+		p.Size = 56
+	}
+	if p.Size < 16 || p.Size > 1472 {
+		return fmt.Errorf("size %d isn't between 16 and 1472", p.Size)
+	}
+	p.interval, p.wait = DefaultPingInterval, DefaultPingWait
+	if p.Interval != "" {
+		if p.interval, err = time.ParseDuration(p.Interval); err != nil || p.interval <= 0 {
+			return fmt.Errorf("bad interval %q", p.Interval)
+		}
+	}
+	if p.Wait != "" {
+		if p.wait, err = time.ParseDuration(p.Wait); err != nil || p.wait <= 0 {
+			return fmt.Errorf("bad wait %q", p.Wait)
+		}
+	}
+	return nil
+}
+
+// Register adds the Ping task type to r
+func (pg Ping) Register(r *runner.Runner) error {
+	return r.Register(PingType, runner.Typed(pg.run), runner.TaskType{Params: runner.ParamSchema{
+		"host":      {Kind: runner.ParamString, Required: true},
+		"count":     {Kind: runner.ParamNumber},
+		"interval":  {Kind: runner.ParamString},
+		"wait":      {Kind: runner.ParamString},
+		"size":      {Kind: runner.ParamNumber},
+		"warn_loss": {Kind: runner.ParamNumber},
+		"warn_rtt":  {Kind: runner.ParamNumber},
+	}})
+}
+
+func (pg Ping) run(args *tasks.TaskArgs, p pingParams) tasks.Result {
+	ctx, cancel := taskContext(args.Task, pg.Timeout)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, p.Host)
+	if err != nil {
+		return tasks.Result{Error: err}
+	}
+	ip := addrs[0].IP
+	for _, a := range addrs {
+		if a.IP.To4() != nil {
+			ip = a.IP // Preferred, IPv6 is often not routed
+			break
+		}
+	}
+	conn, mode, err := listenICMP(ip.To4() == nil)
+	if err != nil {
+		return tasks.Result{Error: err}
+	}
+	defer conn.Close()
+	dst := net.Addr(&net.IPAddr{IP: ip})
+	if mode == "unprivileged" {
+		dst = &net.UDPAddr{IP: ip}
+	}
+
+	token := make([]byte, 8) // Starts the payloads, the ID of requests isn't kept by datagram sockets
+	rand.Read(token)
+	type reply struct {
+		seq int
+		at  time.Time
+	}
+	replies := make(chan reply, p.Count)
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, _, err := conn.ReadFrom(buf)
+			if err != nil {
+				return // Closed
+			}
+			if seq, ok := echoReply(buf[:n], token); ok && seq < p.Count {
+				select {
+				case replies <- reply{seq, time.Now()}:
+				default: // Duplicates
+				}
+			}
+		}
+	}()
+
+	sent := make([]time.Time, p.Count)
+	rtts := make(map[int]float64, p.Count)
+	receive := func(r reply) {
+		if _, dup := rtts[r.seq]; !dup && !sent[r.seq].IsZero() {
+			rtts[r.seq] = float64(r.at.Sub(sent[r.seq]).Microseconds()) / 1000
+		}
+	}
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for seq := 0; seq < p.Count; seq++ {
+		sent[seq] = time.Now()
+		if _, err := conn.WriteTo(echoRequest(ip.To4() == nil, seq, token, p.Size), dst); err != nil {
+			return tasks.Result{Error: err}
+		}
+		for waiting := seq < p.Count-1; waiting; {
+			select {
+			case <-ctx.Done():
+				return pg.cancelled(args, ctx)
+			case r := <-replies:
+				receive(r)
+			case <-ticker.C:
+				waiting = false
+			}
+		}
+	}
+	wait := time.NewTimer(p.wait)
+	defer wait.Stop()
+	for len(rtts) < p.Count {
+		select {
+		case <-ctx.Done():
+			return pg.cancelled(args, ctx)
+		case r := <-replies:
+			receive(r)
+		case <-wait.C:
+			return pg.result(args, p, ip, mode, slices.Collect(maps.Values(rtts)))
+		}
+	}
+	return pg.result(args, p, ip, mode, slices.Collect(maps.Values(rtts)))
+}
+
+func (pg Ping) cancelled(args *tasks.TaskArgs, ctx context.Context) tasks.Result {
+	if args.Task.CTX != nil && args.Task.CTX.Err() != nil {
+		return tasks.Result{Cancelled: true}
+	}
+	return tasks.Result{Error: fmt.Errorf("ping: %w", ctx.Err())}
+}
+
+func (pg Ping) result(args *tasks.TaskArgs, p pingParams, ip net.IP, mode string, rtts []float64) tasks.Result {
+	loss := round(float64(p.Count-len(rtts)) / float64(p.Count) * 100)
+	update := map[string]interface{}{
+		"host":         p.Host,
+		"address":      ip.String(),
+		"mode":         mode,
+		"sent":         p.Count,
+		"received":     len(rtts),
+		"loss_percent": loss,
+	}
+	warn := loss > p.WarnLoss
+	if len(rtts) == 0 {
+		return tasks.Result{Update: update, Warn: true, Spark: args.Task.Spark}
+	}
+	slices.Sort(rtts)
+	sum := 0.0
+	for _, rtt := range rtts {
+		sum += rtt
+	}
+	percentile := func(p float64) float64 {
+		return rtts[max(int(math.Ceil(p/100*float64(len(rtts))))-1, 0)]
+	}
+	update["min"], update["avg"], update["max"] = rtts[0], math.Round(sum/float64(len(rtts))*1000)/1000, rtts[len(rtts)-1]
+	update["p50"], update["p90"], update["p99"] = percentile(50), percentile(90), percentile(99)
+	warn = warn || (p.WarnRTT > 0 && percentile(90) > p.WarnRTT)
+	return tasks.Result{Update: update, Warn: warn, Spark: spark(args.Task, percentile(50))}
+}
+
+// echoRequest builds an ICMP echo request, its payload is token, seq and padding
+func echoRequest(v6 bool, seq int, token []byte, size int) []byte {
+	msg := make([]byte, 8+size)
+	msg[0] = 8 // Echo request
+	if v6 {
+		msg[0] = 128
+	}
+	binary.BigEndian.PutUint16(msg[6:], uint16(seq))
+	copy(msg[8:], token)
+	binary.BigEndian.PutUint32(msg[16:], uint32(seq))
+	if !v6 { // The kernel sums ICMPv6
+		binary.BigEndian.PutUint16(msg[2:], checksum(msg))
+	}
+	return msg
+}
+
+// echoReply gets the seq of an echo reply to a request carrying token
+func echoReply(msg []byte, token []byte) (int, bool) {
+	if len(msg) > 20 && msg[0]>>4 == 4 { // Datagram sockets of macOS keep the IPv4 header
+		msg = msg[int(msg[0]&0x0f)*4:]
+	}
+	if len(msg) < 20 || (msg[0] != 0 && msg[0] != 129) || !bytes.Equal(msg[8:16], token) {
+		return 0, false
+	}
+	return int(binary.BigEndian.Uint32(msg[16:])), true
+}
+
+// checksum is the Internet checksum of RFC 1071
+func checksum(b []byte) uint16 {
+	var sum uint32
+	for i := 0; i+1 < len(b); i += 2 {
+		sum += uint32(b[i])<<8 | uint32(b[i+1])
+	}
+	if len(b)%2 == 1 {
+		sum += uint32(b[len(b)-1]) << 8
+	}
+	for sum>>16 != 0 {
+		sum = sum&0xffff + sum>>16
+	}
+	return ^uint16(sum)
+}
@@ -0,0 +1,15 @@
+//go:build !linux && !darwin
+
+package tasktypes
+
+import "net"
+
+// listenICMP opens a raw ICMP socket, which needs the privileges of an administrator
+func listenICMP(v6 bool) (net.PacketConn, string, error) {
+	network := "ip4:icmp"
+	if v6 {
+		network = "ip6:ipv6-icmp"
+	}
+	conn, err := net.ListenPacket(network, "")
+	return conn, "raw", err
+}
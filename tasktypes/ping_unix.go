@@ -0,0 +1,31 @@
+//go:build linux || darwin
+
+package tasktypes
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+)
+
+// listenICMP opens a raw ICMP socket, or an unprivileged datagram one without the privileges
+func listenICMP(v6 bool) (net.PacketConn, string, error) {
+	network, family, proto := "ip4:icmp", syscall.AF_INET, syscall.IPPROTO_ICMP
+	if v6 {
+		network, family, proto = "ip6:ipv6-icmp", syscall.AF_INET6, syscall.IPPROTO_ICMPV6
+	}
+	conn, err := net.ListenPacket(network, "")
+	if err == nil || !errors.Is(err, os.ErrPermission) {
+		return conn, "raw", err
+	}
+	fd, err := syscall.Socket(family, syscall.SOCK_DGRAM, proto)
+	if err != nil {
+		return nil, "", fmt.Errorf("no privileges for raw ICMP and datagram ICMP sockets denied, see net.ipv4.ping_group_range: %w", err)
+	}
+	f := os.NewFile(uintptr(fd), "icmp")
+	defer f.Close() // FilePacketConn dups it
+	conn, err = net.FilePacketConn(f)
+	return conn, "unprivileged", err
+}
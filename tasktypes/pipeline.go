@@ -0,0 +1,199 @@
+package tasktypes
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"pkg.goda.sh/runner/v2"
+	"pkg.goda.sh/tasks"
+)
+
+// PipelineType is the task type of Pipeline
+const PipelineType = "pipeline"
+
+// Pipeline runs the steps of tasks one after the other, child tasks of any type the Runner
+// has, each using values of the updates of those before, so flows like getting a token,
+// calling an API with it and checking a value of the reply are declared rather than coded:
+//
+//	{"steps": [
+//	 {"name": "login", "task": "http", "params": {"url": "https://auth.internal/token",
+//	  "method": "POST", "body": "secret://api-login", "keep_body": true}},
+//	 {"task": "http", "params": {"url": "https://api.internal/jobs?state={{ $login.body.scope }}",
+//	  "headers": {"Authorization": "Bearer {{ $login.body.access_token }}"}}}]}
+//
+// The strings of the params of steps may hold jq expressions between {{ and }}, see jq, where
+// . is the update of the step before and $name that of the step named name. A string being a
+// single expression is replaced by its value, keeping numbers and objects, others get the
+// text of the values, in JSON when they aren't strings.
+//
+// The update of a task is that of its last step, those of the others often hold tokens and
+// aren't reported. Tasks fail at the first step failing, naming it, and warn when a step
+// warns. The Spark of tasks is that of their last step.
+type Pipeline struct {
+	Timeout time.Duration // Of runs, steps included, DefaultTimeout when 0
+}
+
+// pipelineParams are the params of Pipeline tasks
+type pipelineParams struct {
+	Steps []pipelineStep `json:"steps"`
+}
+
+// pipelineStep is a child task of a Pipeline task
+type pipelineStep struct {
+	Name   string                 `json:"name"` // Of the variable of its update, none when empty
+	Task   string                 `json:"task"`
+	Params map[string]interface{} `json:"params"`
+}
+
+func (p *pipelineParams) Validate() error {
+	if len(p.Steps) == 0 {
+		return errors.New("no steps")
+	}
+	seen := make(map[string]bool, len(p.Steps))
+	for i, s := range p.Steps {
+		if s.Task == "" {
+			return fmt.Errorf("step %d has no task", i)
+		}
+		if s.Name != "" && seen[s.Name] {
+			return fmt.Errorf("steps named %q twice", s.Name)
+		}
+		seen[s.Name] = true
+		if _, err := expandTemplates(s.Params, nil, nil, false); err != nil {
+			return fmt.Errorf("step %s: %v", s.label(i), err)
+		}
+	}
+	return nil
+}
+
+// label names a step in errors
+func (s pipelineStep) label(i int) string {
+	if s.Name != "" {
+		return s.Name
+	}
+	return fmt.Sprintf("%d (%s)", i, s.Task)
+}
+
+// Register adds the Pipeline task type to r, steps run the task types of r
+func (pl Pipeline) Register(r *runner.Runner) error {
+	return r.Register(PipelineType, runner.Typed(func(args *tasks.TaskArgs, p pipelineParams) tasks.Result {
+		return pl.run(r, args, p)
+	}), runner.TaskType{Params: runner.ParamSchema{
+		"steps": {Kind: runner.ParamArray, Required: true},
+	}})
+}
+
+func (pl Pipeline) run(r *runner.Runner, args *tasks.TaskArgs, p pipelineParams) tasks.Result {
+	ctx, cancel := taskContext(args.Task, pl.Timeout)
+	defer cancel()
+	vars := make(map[string]interface{}, len(p.Steps))
+	var in interface{}
+	var res tasks.Result
+	warn := false
+	for i, s := range p.Steps {
+		expanded, err := expandTemplates(s.Params, in, vars, true)
+		if err != nil {
+			return tasks.Result{Error: fmt.Errorf("step %s: %w", s.label(i), err)}
+		}
+		child := args.Task
+		child.CTX, child.Label, child.Spark = ctx, args.Task.Label+"/"+s.label(i), nil
+		if i == len(p.Steps)-1 {
+			child.Spark = args.Task.Spark
+		}
+		params, _ := expanded.(map[string]interface{}) // nil for steps without params
+		res = r.RunType(child, s.Task, params)
+		if args.Task.CTX != nil && args.Task.CTX.Err() != nil {
+			return tasks.Result{Cancelled: true}
+		}
+		if res.Cancelled { // By the timeout of the run
+			res.Error = fmt.Errorf("pipeline: %w", ctx.Err())
+		}
+		if res.Error != nil {
+			return tasks.Result{Error: fmt.Errorf("step %s: %w", s.label(i), res.Error)}
+		}
+		warn = warn || res.Warn
+		if in, err = plain(res.Update); err != nil {
+			return tasks.Result{Error: fmt.Errorf("step %s: %w", s.label(i), err)}
+		}
+		if s.Name != "" {
+			vars[s.Name] = in
+		}
+	}
+	return tasks.Result{Update: res.Update, Warn: warn, Spark: res.Spark}
+}
+
+// expandTemplates replaces the {{ }} expressions of the strings of v by their values for
+// the input in, only compiling them unless eval
+func expandTemplates(v interface{}, in interface{}, vars map[string]interface{}, eval bool) (interface{}, error) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			expanded, err := expandTemplates(item, in, vars, eval)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", k, err)
+			}
+			out[k] = expanded
+		}
+		return out, nil
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			expanded, err := expandTemplates(item, in, vars, eval)
+			if err != nil {
+				return nil, fmt.Errorf("%d: %w", i, err)
+			}
+			out[i] = expanded
+		}
+		return out, nil
+	case string:
+		return expandTemplate(v, in, vars, eval)
+	}
+	return v, nil
+}
+
+func expandTemplate(s string, in interface{}, vars map[string]interface{}, eval bool) (interface{}, error) {
+	var text []string
+	var exprs []*jq
+	for rest := s; ; {
+		start := strings.Index(rest, "{{")
+		if start < 0 {
+			text = append(text, rest)
+			break
+		}
+		end := strings.Index(rest[start:], "}}")
+		if end < 0 {
+			return nil, errors.New("{{ without }}")
+		}
+		q, err := compileJQ(strings.TrimSpace(rest[start+2 : start+end]))
+		if err != nil {
+			return nil, err
+		}
+		text, exprs = append(text, rest[:start]), append(exprs, q)
+		rest = rest[start+end+2:]
+	}
+	if len(exprs) == 0 || !eval {
+		return s, nil
+	}
+	if len(exprs) == 1 && text[0] == "" && text[1] == "" {
+		return exprs[0].run(in, vars)
+	}
+	var b strings.Builder
+	for i, q := range exprs {
+		b.WriteString(text[i])
+		v, err := q.run(in, vars)
+		if err != nil {
+			return nil, err
+		}
+		if str, ok := v.(string); ok {
+			b.WriteString(str)
+		} else {
+			data, _ := json.Marshal(v)
+			b.Write(data)
+		}
+	}
+	b.WriteString(text[len(exprs)])
+	return b.String(), nil
+}
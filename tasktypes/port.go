@@ -0,0 +1,159 @@
+package tasktypes
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"pkg.goda.sh/runner/v2"
+	"pkg.goda.sh/tasks"
+)
+
+// PortType is the task type of Port
+const PortType = "port"
+
+// Port checks that the port of tasks is reachable, for services that don't speak HTTP:
+//
+//	{"address": "10.0.0.7:5432", "reachable": true, "ms": 0.8}
+//
+// TCP tasks connect, a refused or timed out connection is unreachable. UDP has no
+// handshake, so UDP tasks send their send param, an empty datagram by default, and wait for
+// a reply: a port answering with ICMP port unreachable is unreachable, one that stays silent
+// is reachable unless the task sets expect_reply. With an expect regular expression, the
+// first reply, or the banner of TCP servers, must match.
+//
+// Tasks warn when the port is unreachable or the reply doesn't match. The latency of
+// connects, or of replies, is kept in Spark.
+type Port struct {
+	Timeout time.Duration // Of connects and replies, DefaultTimeout when 0
+}
+
+// portParams are the params of Port tasks
+type portParams struct {
+	Host        string `json:"host"`
+	Port        int    `json:"port"`
+	Protocol    string `json:"protocol"` // tcp by default
+	Timeout     string `json:"timeout"`
+	Send        string `json:"send"`
+	Expect      string `json:"expect"`
+	ExpectReply bool   `json:"expect_reply"`
+
+	expect *regexp.Regexp
+}
+
+func (p *portParams) Validate() (err error) {
+	if p.Host == "" {
+		return errors.New("no host")
+	}
+	if p.Port <= 0 || p.Port > 65535 {
+		return fmt.Errorf("port %d out of range", p.Port)
+	}
+	switch p.Protocol = strings.ToLower(p.Protocol); p.Protocol {
+	case "":
+		p.Protocol = "tcp"
+	case "tcp", "udp":
+	default:
+		return fmt.Errorf("protocol %q isn't tcp or udp", p.Protocol)
+	}
+	if p.Timeout != "" {
+		if _, err := time.ParseDuration(p.Timeout); err != nil {
+			return fmt.Errorf("timeout: %v", err)
+		}
+	}
+	if p.Expect != "" {
+		if p.expect, err = regexp.Compile(p.Expect); err != nil {
+			return fmt.Errorf("expect: %v", err)
+		}
+	}
+	return nil
+}
+
+// Register adds the Port task type to r
+func (pt Port) Register(r *runner.Runner) error {
+	return r.Register(PortType, runner.Typed(pt.run), runner.TaskType{Params: runner.ParamSchema{
+		"host":         {Kind: runner.ParamString, Required: true},
+		"port":         {Kind: runner.ParamNumber, Required: true},
+		"protocol":     {Kind: runner.ParamString},
+		"timeout":      {Kind: runner.ParamString},
+		"send":         {Kind: runner.ParamString},
+		"expect":       {Kind: runner.ParamString},
+		"expect_reply": {Kind: runner.ParamBool},
+	}})
+}
+
+func (pt Port) run(args *tasks.TaskArgs, p portParams) tasks.Result {
+	timeout := pt.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	if d, _ := time.ParseDuration(p.Timeout); d > 0 && d < timeout {
+		timeout = d
+	}
+	ctx, cancel := taskContext(args.Task, timeout)
+	defer cancel()
+	address := net.JoinHostPort(p.Host, strconv.Itoa(p.Port))
+	update := map[string]interface{}{"address": address, "reachable": false}
+	unreachable := func(err error) tasks.Result {
+		update["error"] = err.Error()
+		return tasks.Result{Update: update, Warn: true, Spark: args.Task.Spark}
+	}
+
+	start := time.Now()
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, p.Protocol, address)
+	if args.Task.CTX != nil && args.Task.CTX.Err() != nil {
+		return tasks.Result{Cancelled: true}
+	}
+	if err != nil {
+		var dns *net.DNSError
+		if errors.As(err, &dns) {
+			return tasks.Result{Error: err}
+		}
+		return unreachable(err)
+	}
+	defer conn.Close()
+	ms := float64(time.Since(start).Microseconds()) / 1000
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	if p.Protocol == "udp" || p.Send != "" {
+		if _, err := conn.Write([]byte(p.Send)); err != nil {
+			return unreachable(err)
+		}
+	}
+	if p.Protocol == "tcp" && p.expect == nil {
+		update["reachable"], update["ms"] = true, ms
+		return tasks.Result{Update: update, Spark: spark(args.Task, ms)}
+	}
+
+	buf := make([]byte, 4096)
+	n, err := conn.Read(buf)
+	if args.Task.CTX != nil && args.Task.CTX.Err() != nil {
+		return tasks.Result{Cancelled: true}
+	}
+	if p.Protocol == "udp" {
+		var ne net.Error
+		silent := errors.As(err, &ne) && ne.Timeout()
+		switch {
+		case err == nil:
+			ms = float64(time.Since(start).Microseconds()) / 1000
+		case !silent:
+			return unreachable(err) // ICMP port unreachable, as ECONNREFUSED
+		case p.ExpectReply || p.expect != nil:
+			return unreachable(errors.New("no reply"))
+		}
+		update["reply"] = err == nil
+	}
+	update["reachable"], update["ms"] = true, ms
+	warn := false
+	if p.expect != nil {
+		matched := p.expect.Match(buf[:n])
+		update["matched"] = matched
+		warn = !matched
+	}
+	return tasks.Result{Update: update, Warn: warn, Spark: spark(args.Task, ms)}
+}
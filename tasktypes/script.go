@@ -0,0 +1,268 @@
+package tasktypes
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+	"pkg.goda.sh/runner/v2"
+	"pkg.goda.sh/tasks"
+)
+
+// ScriptType is the task type of Script
+const ScriptType = "script"
+
+// ErrHostNotAllowed is returned when a script calls a host missing from AllowHosts
+var ErrHostNotAllowed = errors.New("tasktypes: host not allowed")
+
+// Script runs tasks written as Lua scripts, so simple custom checks don't need a Go release.
+// The source param holds a Lua 5.1 script, run by gopher-lua, which sees the params of the
+// task in params and can call:
+//
+//	http.get(url [, headers])             {status =, body =, headers =, ms =}
+//	http.post(url, body [, headers])      same
+//	http.request{method =, url =, body =, headers =}
+//	emit(update [, warn])                 sets the update of the result
+//	spark(value)                          adds a value to the spark of the task, see SparkLen
+//
+// and the json library, plus the base, string, table and math libraries of Lua and os.time,
+// os.clock, os.date and os.difftime. Scripts have no access to files, processes or modules,
+// and call only the hosts in AllowHosts.
+// Without emit, the values the script returns are the update and warn of the result,
+// errors it raises the error. print writes to the logger of the Runner.
+//
+//	tasks:
+//	  - label: queue depth
+//	    task: script
+//	    params:
+//	      url: https://jobs.internal/stats
+//	      source: |
+//	        local res = http.get(params.url)
+//	        local stats = json.decode(res.body)
+//	        spark(res.ms)
+//	        emit({queued = stats.queued}, stats.queued > 100)
+//
+// Runs are bounded by Timeout, scripts can't catch it. Only the lua lang is supported, other
+// ones are rejected when tasks run.
+type Script struct {
+	Client     *http.Client  // http.DefaultClient when nil
+	AllowHosts []string      // Hosts scripts may call, a leading *. matches subdomains and * all, none when empty
+	Timeout    time.Duration // DefaultTimeout when 0
+	MaxBody    int           // Bytes of response bodies read, DefaultMaxOutput when 0
+
+	logger *slog.Logger // Of the Runner it's registered to
+}
+
+// scriptParams are the params of Script tasks
+type scriptParams struct {
+	Source string `json:"source"`
+	Lang   string `json:"lang"`
+}
+
+func (p *scriptParams) Validate() error {
+	if lang := strings.ToLower(p.Lang); lang != "" && lang != "lua" {
+		return fmt.Errorf("lang %q isn't supported, scripts are lua", p.Lang)
+	}
+	return nil
+}
+
+// Register adds the Script task type to r
+func (sc Script) Register(r *runner.Runner) error {
+	sc.logger = r.Logger()
+	return r.Register(ScriptType, runner.Typed(sc.run), runner.TaskType{Params: runner.ParamSchema{
+		"source": {Kind: runner.ParamString, Required: true},
+		"lang":   {Kind: runner.ParamString},
+	}})
+}
+
+func (sc Script) run(args *tasks.TaskArgs, p scriptParams) tasks.Result {
+	ctx, cancel := taskContext(args.Task, sc.Timeout)
+	defer cancel()
+	L := newLua(ctx, logWriter{sc.logger, args.Task.Label})
+	defer L.Close()
+	chunk, err := L.Load(strings.NewReader(p.Source), args.Task.Label)
+	if err != nil {
+		return tasks.Result{Error: luaError(err)}
+	}
+	params := runner.ParamsFrom(args.Task.CTX)
+	delete(params, "source")
+	delete(params, "lang")
+	L.SetGlobal("params", toLua(L, params))
+
+	result := tasks.Result{Spark: args.Task.Spark}
+	emitted := false
+	L.SetGlobal("emit", L.NewFunction(func(L *lua.LState) int {
+		result.Update, result.Warn, emitted = fromLua(L.Get(1), 0), lua.LVAsBool(L.Get(2)), true
+		return 0
+	}))
+	L.SetGlobal("spark", L.NewFunction(func(L *lua.LState) int {
+		args.Task.Spark = spark(args.Task, float64(L.CheckNumber(1)))
+		result.Spark = args.Task.Spark
+		return 0
+	}))
+	client := &scriptHTTP{ctx: ctx, sc: sc}
+	lib := L.NewTable()
+	L.SetField(lib, "get", L.NewFunction(client.get))
+	L.SetField(lib, "post", L.NewFunction(client.post))
+	L.SetField(lib, "request", L.NewFunction(client.request))
+	L.SetGlobal("http", lib)
+
+	L.Push(chunk)
+	err = L.PCall(0, lua.MultRet, nil)
+	if args.Task.CTX != nil && args.Task.CTX.Err() != nil {
+		return tasks.Result{Cancelled: true}
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return tasks.Result{Error: fmt.Errorf("%s: %w", args.Task.Label, ctx.Err()), Spark: result.Spark}
+	}
+	if err != nil {
+		return tasks.Result{Error: luaError(err), Spark: result.Spark}
+	}
+	if !emitted && L.GetTop() > 0 {
+		result.Update, result.Warn = fromLua(L.Get(1), 0), lua.LVAsBool(L.Get(2))
+	}
+	return result
+}
+
+// scriptHTTP is the http library of scripts
+type scriptHTTP struct {
+	ctx context.Context // Of the run
+	sc  Script
+}
+
+func (h *scriptHTTP) get(L *lua.LState) int {
+	return h.do(L, http.MethodGet, L.CheckString(1), nil, "", L.OptTable(2, nil))
+}
+
+func (h *scriptHTTP) post(L *lua.LState) int {
+	body, ctype, err := bodyOf(L.Get(2))
+	if err != nil {
+		return raise(L, err)
+	}
+	return h.do(L, http.MethodPost, L.CheckString(1), body, ctype, L.OptTable(3, nil))
+}
+
+func (h *scriptHTTP) request(L *lua.LState) int {
+	req := L.CheckTable(1)
+	method := lua.LVAsString(req.RawGetString("method"))
+	if method == "" {
+		method = http.MethodGet
+	}
+	body, ctype, err := bodyOf(req.RawGetString("body"))
+	if err != nil {
+		return raise(L, err)
+	}
+	headers, _ := req.RawGetString("headers").(*lua.LTable)
+	return h.do(L, strings.ToUpper(method), lua.LVAsString(req.RawGetString("url")), body, ctype, headers)
+}
+
+// bodyOf gets the body of a request, tables are sent as JSON
+func bodyOf(v lua.LValue) ([]byte, string, error) {
+	switch b := v.(type) {
+	case lua.LString:
+		return []byte(b), "", nil
+	case *lua.LTable:
+		data, err := json.Marshal(fromLua(b, 0))
+		return data, "application/json", err
+	}
+	return nil, "", nil
+}
+
+func (h *scriptHTTP) do(L *lua.LState, method, rawURL string, body []byte, ctype string, headers *lua.LTable) int {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return raise(L, fmt.Errorf("bad URL %q", rawURL))
+	}
+	if !h.sc.allowed(u.Hostname()) {
+		return raise(L, fmt.Errorf("%w: %s", ErrHostNotAllowed, u.Hostname()))
+	}
+	req, err := http.NewRequestWithContext(h.ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return raise(L, err)
+	}
+	if ctype != "" {
+		req.Header.Set("Content-Type", ctype)
+	}
+	if headers != nil {
+		headers.ForEach(func(k, v lua.LValue) { req.Header.Set(k.String(), v.String()) })
+	}
+	client := http.DefaultClient
+	if h.sc.Client != nil {
+		client = h.sc.Client
+	}
+	c := *client
+	c.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if !h.sc.allowed(req.URL.Hostname()) {
+			return fmt.Errorf("%w: %s", ErrHostNotAllowed, req.URL.Hostname())
+		}
+		if client.CheckRedirect != nil {
+			return client.CheckRedirect(req, via)
+		}
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		return nil
+	}
+	client = &c
+	start := time.Now()
+	res, err := client.Do(req)
+	if err != nil {
+		return raise(L, err)
+	}
+	defer res.Body.Close()
+	max := h.sc.MaxBody
+	if max <= 0 {
+		max = DefaultMaxOutput
+	}
+	data, err := io.ReadAll(io.LimitReader(res.Body, int64(max)))
+	if err != nil {
+		return raise(L, err)
+	}
+	ms := float64(time.Since(start).Microseconds()) / 1000
+	reply := L.NewTable()
+	reply.RawSetString("status", lua.LNumber(res.StatusCode))
+	reply.RawSetString("body", lua.LString(data))
+	reply.RawSetString("ms", lua.LNumber(ms))
+	hdrs := L.NewTable()
+	for _, name := range slices.Sorted(maps.Keys(res.Header)) {
+		hdrs.RawSetString(strings.ToLower(name), lua.LString(res.Header.Get(name)))
+	}
+	reply.RawSetString("headers", hdrs)
+	L.Push(reply)
+	return 1
+}
+
+// allowed reports whether scripts may call host, "*" allows every host
+func (sc Script) allowed(host string) bool {
+	for _, h := range sc.AllowHosts {
+		if strings.EqualFold(h, host) {
+			return true
+		}
+		if suffix, ok := strings.CutPrefix(h, "*"); ok && strings.HasSuffix(strings.ToLower(host), strings.ToLower(suffix)) {
+			return true
+		}
+	}
+	return false
+}
+
+// logWriter writes the lines of print to the logger of the Runner
+type logWriter struct {
+	logger *slog.Logger
+	label  string
+}
+
+func (w logWriter) Write(p []byte) (int, error) {
+	w.logger.Info(fmt.Sprintf("Script %q: %s", w.label, bytes.TrimSuffix(p, []byte("\n"))))
+	return len(p), nil
+}
@@ -0,0 +1,100 @@
+package tasktypes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"pkg.goda.sh/runner/v2"
+	"pkg.goda.sh/tasks"
+)
+
+func runScript(sc Script, src string, params map[string]interface{}) tasks.Result {
+	if sc.logger == nil {
+		sc.logger = slog.Default()
+	}
+	ctx := runner.ContextWithParams(context.Background(), params)
+	return sc.run(&tasks.TaskArgs{Task: tasks.Task{Label: "check", CTX: ctx}}, scriptParams{Source: src})
+}
+
+func TestScriptCallsTheHTTPLibraryAndEmits(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		fmt.Fprintf(w, `{"queued": 120, "path": %q}`, req.URL.Path)
+	}))
+	defer srv.Close()
+	result := runScript(Script{AllowHosts: []string{"127.0.0.1"}}, `
+		local res = http.get(params.url .. "/stats")
+		local stats = json.decode(res.body)
+		spark(res.status)
+		emit({queued = stats.queued, path = stats.path, tags = {"a", "b"}}, stats.queued > 100)
+	`, map[string]interface{}{"url": srv.URL})
+	if result.Error != nil {
+		t.Fatal(result.Error)
+	}
+	want := map[string]interface{}{"queued": 120.0, "path": "/stats", "tags": []interface{}{"a", "b"}}
+	if !reflect.DeepEqual(result.Update, want) || !result.Warn || !reflect.DeepEqual(result.Spark, []float64{200}) {
+		t.Errorf("got %+v, want update %v, a warning and a spark of the status", result, want)
+	}
+}
+
+func TestScriptReturnsAreTheResult(t *testing.T) {
+	if result := runScript(Script{}, `return #"hello" > params.threshold, true`, map[string]interface{}{"threshold": 3}); result.Error != nil || result.Update != true || !result.Warn {
+		t.Errorf("got %+v, want update true and a warning", result)
+	}
+	if result := runScript(Script{}, `error("down")`, nil); result.Error == nil || !strings.Contains(result.Error.Error(), "down") {
+		t.Errorf("got %+v, want the error raised", result)
+	}
+}
+
+func TestScriptSandbox(t *testing.T) {
+	for _, src := range []string{
+		`return io.open("/etc/passwd")`,
+		`return os.execute("true")`,
+		`return require("os")`,
+		`return dofile("/etc/passwd")`,
+		`return loadstring("return 1")()`,
+		`return string.rep("x", 1e9)`,
+		`local function f(n) return 1 + f(n + 1) end return f(1)`,
+		`local t = {} for i = 1, 300000 do t[i] = i end return select("#", unpack(t))`,
+	} {
+		if result := runScript(Script{}, src, nil); result.Error == nil {
+			t.Errorf("%s: got %+v, want an error", src, result)
+		}
+	}
+}
+
+func TestScriptHostsNotAllowed(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+	for _, hosts := range [][]string{nil, {"*.internal"}} {
+		result := runScript(Script{AllowHosts: hosts}, `http.get(params.url)`, map[string]interface{}{"url": srv.URL})
+		if !errors.Is(result.Error, ErrHostNotAllowed) {
+			t.Errorf("%v: got %+v calling %s, want ErrHostNotAllowed", hosts, result, u.Hostname())
+		}
+	}
+	if result := runScript(Script{AllowHosts: []string{"*"}}, `http.get(params.url)`, map[string]interface{}{"url": srv.URL}); result.Error != nil {
+		t.Errorf("got %+v, want every host allowed by *", result)
+	}
+	sc := Script{AllowHosts: []string{"*.internal"}}
+	caught := runScript(sc, `local ok, err = pcall(http.get, params.url) return tostring(err)`, map[string]interface{}{"url": srv.URL})
+	if update, _ := caught.Update.(string); !strings.Contains(update, ErrHostNotAllowed.Error()) {
+		t.Errorf("got %+v, want the error caught by pcall", caught)
+	}
+}
+
+func TestScriptTimeout(t *testing.T) {
+	start := time.Now()
+	result := runScript(Script{Timeout: 100 * time.Millisecond}, `local ok = pcall(function() while true do end end)`, nil)
+	if !errors.Is(result.Error, context.DeadlineExceeded) || time.Since(start) > 5*time.Second {
+		t.Errorf("got %+v after %v, want the script stopped at its timeout", result, time.Since(start))
+	}
+}
@@ -0,0 +1,207 @@
+package tasktypes
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"pkg.goda.sh/runner/v2"
+	"pkg.goda.sh/tasks"
+)
+
+// SQLType is the task type of SQL
+const SQLType = "sql"
+
+// DefaultMaxRows is the MaxRows of a SQL of 0
+const DefaultMaxRows = 100
+
+// SQL runs the query of tasks on their database, for simple health checks and business
+// metrics, and reports the rows returned:
+//
+//	{"columns": ["pending"], "rows": [{"pending": 12}], "value": 12, "ms": 3.2}
+//
+// Tasks name a driver registered with database/sql, which the program embedding the runner
+// imports, and its dsn, best given as a secret reference, see runner.WithSecrets. Queries
+// take the args of the task as parameters and run in a read only transaction, only those
+// starting with SELECT, WITH, SHOW, EXPLAIN or VALUES are accepted, so a task can't write,
+// whatever the grants of its user.
+//
+// value is the first column of the first row. Tasks warn when it's over their warn_above or
+// under their warn_below, and fail when it isn't a number then, or when there's no row.
+// Numeric values are kept in Spark. Connections are pooled by driver and DSN.
+type SQL struct {
+	Drivers []string      // Tasks may use, all those registered when nil
+	MaxRows int           // Reported, DefaultMaxRows when 0
+	Timeout time.Duration // DefaultTimeout when 0
+}
+
+// sqlParams are the params of SQL tasks
+type sqlParams struct {
+	Driver    string        `json:"driver"`
+	DSN       string        `json:"dsn"`
+	Query     string        `json:"query"`
+	Args      []interface{} `json:"args"`
+	WarnAbove *float64      `json:"warn_above"`
+	WarnBelow *float64      `json:"warn_below"`
+}
+
+// sqlReads are the first words of the queries SQL tasks may run
+var sqlReads = []string{"SELECT", "WITH", "SHOW", "EXPLAIN", "VALUES"}
+
+func (p *sqlParams) Validate() error {
+	if p.Driver == "" || p.DSN == "" {
+		return errors.New("no driver or dsn")
+	}
+	if !slices.Contains(sql.Drivers(), p.Driver) {
+		return fmt.Errorf("driver %q isn't registered, have %s", p.Driver, strings.Join(sql.Drivers(), ", "))
+	}
+	words := strings.Fields(p.Query)
+	if len(words) == 0 {
+		return errors.New("no query")
+	}
+	if !slices.Contains(sqlReads, strings.ToUpper(strings.TrimLeft(words[0], "("))) {
+		return fmt.Errorf("query starts with %s, not one of %s", words[0], strings.Join(sqlReads, ", "))
+	}
+	return nil
+}
+
+// sqlPool holds the databases of the tasks of a type
+type sqlPool struct {
+	mu  sync.Mutex
+	dbs map[string]*sql.DB // By driver and DSN
+}
+
+func (p *sqlPool) get(driver, dsn string) (*sql.DB, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	key := driver + "\x00" + dsn
+	if db, ok := p.dbs[key]; ok {
+		return db, nil
+	}
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(2)
+	db.SetConnMaxIdleTime(5 * time.Minute)
+	if p.dbs == nil {
+		p.dbs = make(map[string]*sql.DB)
+	}
+	p.dbs[key] = db
+	return db, nil
+}
+
+// Register adds the SQL task type to r
+func (q SQL) Register(r *runner.Runner) error {
+	pool := &sqlPool{}
+	return r.Register(SQLType, runner.Typed(func(args *tasks.TaskArgs, p sqlParams) tasks.Result {
+		return q.run(args, p, pool)
+	}), runner.TaskType{Params: runner.ParamSchema{
+		"driver":     {Kind: runner.ParamString, Required: true},
+		"dsn":        {Kind: runner.ParamString, Required: true},
+		"query":      {Kind: runner.ParamString, Required: true},
+		"args":       {Kind: runner.ParamArray},
+		"warn_above": {Kind: runner.ParamNumber},
+		"warn_below": {Kind: runner.ParamNumber},
+	}})
+}
+
+func (q SQL) run(args *tasks.TaskArgs, p sqlParams, pool *sqlPool) tasks.Result {
+	if q.Drivers != nil && !slices.Contains(q.Drivers, p.Driver) {
+		return tasks.Result{Error: fmt.Errorf("%w: driver %s", ErrNotAllowed, p.Driver)}
+	}
+	db, err := pool.get(p.Driver, p.DSN)
+	if err != nil {
+		return tasks.Result{Error: err}
+	}
+	ctx, cancel := taskContext(args.Task, q.Timeout)
+	defer cancel()
+	max := q.MaxRows
+	if max <= 0 {
+		max = DefaultMaxRows
+	}
+	start := time.Now()
+	columns, rows, err := query(ctx, db, p.Query, p.Args, max)
+	ms := float64(time.Since(start).Microseconds()) / 1000
+	if args.Task.CTX != nil && args.Task.CTX.Err() != nil {
+		return tasks.Result{Cancelled: true}
+	}
+	if err != nil {
+		return tasks.Result{Error: err}
+	}
+	update := map[string]interface{}{"columns": columns, "rows": rows, "ms": ms}
+	var value interface{}
+	if len(rows) > 0 && len(columns) > 0 {
+		value = rows[0].(map[string]interface{})[columns[0]]
+		update["value"] = value
+	}
+	n, numeric := value.(float64)
+	if !numeric {
+		if p.WarnAbove != nil || p.WarnBelow != nil {
+			return tasks.Result{Error: fmt.Errorf("value %v isn't a number", value)}
+		}
+		return tasks.Result{Update: update, Spark: args.Task.Spark}
+	}
+	warn := (p.WarnAbove != nil && n > *p.WarnAbove) || (p.WarnBelow != nil && n < *p.WarnBelow)
+	return tasks.Result{Update: update, Warn: warn, Spark: spark(args.Task, n)}
+}
+
+// query runs a query in a read only transaction, returning at most max rows
+func query(ctx context.Context, db *sql.DB, query string, args []interface{}, max int) (columns []string, rows []interface{}, err error) {
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+	res, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer res.Close()
+	if columns, err = res.Columns(); err != nil {
+		return nil, nil, err
+	}
+	rows = []interface{}{}
+	values := make([]interface{}, len(columns))
+	scan := make([]interface{}, len(columns))
+	for i := range values {
+		scan[i] = &values[i]
+	}
+	for len(rows) < max && res.Next() {
+		if err := res.Scan(scan...); err != nil {
+			return nil, nil, err
+		}
+		row := make(map[string]interface{}, len(columns))
+		for i, name := range columns {
+			row[name] = sqlValue(values[i])
+		}
+		rows = append(rows, row)
+	}
+	return columns, rows, res.Err()
+}
+
+// sqlValue converts a column, numbers and numeric text become float64
+func sqlValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case int64:
+		return float64(v)
+	case float32:
+		return float64(v)
+	case []byte:
+		return sqlValue(string(v))
+	case string:
+		if n, err := strconv.ParseFloat(v, 64); err == nil {
+			return n
+		}
+		return v
+	case time.Time:
+		return v.UTC().Format(time.RFC3339Nano)
+	}
+	return v
+}
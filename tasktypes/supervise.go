@@ -0,0 +1,247 @@
+package tasktypes
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+
+	"pkg.goda.sh/runner/v2"
+	"pkg.goda.sh/tasks"
+)
+
+// SuperviseType is the task type of Supervise
+const SuperviseType = "supervise"
+
+// Defaults of Supervise tasks
+const (
+	DefaultSuperviseBackoff    = time.Second
+	DefaultSuperviseMaxBackoff = time.Minute
+	DefaultSuperviseResetAfter = 10 * time.Second
+	DefaultSuperviseStop       = 10 * time.Second
+	DefaultSuperviseOutput     = 4 << 10
+)
+
+// Supervise keeps the command of tasks running, restarting it with a backoff when it exits,
+// a lightweight supervisord made of the task list:
+//
+//	{"state": "backoff", "pid": 4242, "exit_code": 1, "uptime": 2.5, "restarts": 3,
+//	 "retry_in": 8, "stdout": "...", "stderr": "panic: ..."}
+//
+// Supervise tasks are timerless: they start their command, with the args, env and dir params
+// of Exec tasks, and report a result when it starts, in state running, and a warning when it
+// exits, in state backoff with the end of its output. It's then started again after the
+// backoff of the task, doubling up to max_backoff, back to backoff once a run lasted
+// reset_after. Tasks with restart set to on-failure end once the command exits with 0, in
+// state exited, and tasks with max_restarts fail once it exits more times in a row. The
+// restarts of tasks are kept in Spark.
+//
+// Removed or cancelled tasks stop their command with SIGTERM, killing it if it didn't exit
+// after StopTimeout.
+type Supervise struct {
+	Allow       []string      // Commands tasks may run, as with Exec, any when empty
+	AllowEnv    []string      // Env variables tasks may set when Allow is set, as with Exec
+	Dir         string        // Of commands, tasks can only name dirs inside it when Allow is set
+	Env         []string      // KEY=value set for every command, the environment of the runner when nil
+	StopTimeout time.Duration // Between SIGTERM and killing commands, DefaultSuperviseStop when 0
+	MaxOutput   int           // Bytes of the end of stdout and of stderr reported, DefaultSuperviseOutput when 0
+}
+
+// superviseParams are the params of Supervise tasks
+type superviseParams struct {
+	Command     string            `json:"command"`
+	Args        []string          `json:"args"`
+	Env         map[string]string `json:"env"`
+	Dir         string            `json:"dir"`
+	Restart     string            `json:"restart"` // always or on-failure, always when empty
+	Backoff     string            `json:"backoff"`
+	MaxBackoff  string            `json:"max_backoff"`
+	ResetAfter  string            `json:"reset_after"`
+	MaxRestarts int               `json:"max_restarts"` // In a row, unlimited when 0
+
+	backoff, maxBackoff, resetAfter time.Duration
+}
+
+func (p *superviseParams) Validate() error {
+	if p.Command == "" {
+		return errors.New("no command")
+	}
+	switch p.Restart {
+	case "":
+		p.Restart = "always"
+	case "always", "on-failure":
+	default:
+		return fmt.Errorf("restart %q isn't always or on-failure", p.Restart)
+	}
+	for _, d := range []struct {
+		name, value string
+		to          *time.Duration
+		def         time.Duration
+	}{
+		{"backoff", p.Backoff, &p.backoff, DefaultSuperviseBackoff},
+		{"max_backoff", p.MaxBackoff, &p.maxBackoff, DefaultSuperviseMaxBackoff},
+		{"reset_after", p.ResetAfter, &p.resetAfter, DefaultSuperviseResetAfter},
+	} {
+		*d.to = d.def
+		if d.value == "" {
+			continue
+		}
+		v, err := time.ParseDuration(d.value)
+		if err != nil {
+			return fmt.Errorf("%s: %v", d.name, err)
+		}
+		if v <= 0 {
+			return fmt.Errorf("%s %s isn't positive", d.name, d.value)
+		}
+		*d.to = v
+	}
+	p.maxBackoff = max(p.maxBackoff, p.backoff)
+	if p.MaxRestarts < 0 {
+		return fmt.Errorf("max_restarts %d is negative", p.MaxRestarts)
+	}
+	return nil
+}
+
+// Register adds the Supervise task type to r
+func (s Supervise) Register(r *runner.Runner) error {
+	return r.Register(SuperviseType, runner.Typed(s.run), runner.TaskType{
+		Params: runner.ParamSchema{
+			"command":      {Kind: runner.ParamString, Required: true},
+			"args":         {Kind: runner.ParamArray},
+			"env":          {Kind: runner.ParamObject},
+			"dir":          {Kind: runner.ParamString},
+			"restart":      {Kind: runner.ParamString},
+			"backoff":      {Kind: runner.ParamString},
+			"max_backoff":  {Kind: runner.ParamString},
+			"reset_after":  {Kind: runner.ParamString},
+			"max_restarts": {Kind: runner.ParamNumber},
+		},
+		Timerless: true,
+	})
+}
+
+func (s Supervise) run(args *tasks.TaskArgs, p superviseParams) tasks.Result {
+	if _, _, _, err := s.exec().command(p.Command, p.Dir, p.Env); err != nil {
+		return tasks.Result{Error: err}
+	}
+	go s.supervise(args, p)
+	return tasks.Result{}
+}
+
+// exec is the Exec checking the commands of tasks like those of Supervise
+func (s Supervise) exec() Exec {
+	return Exec{Allow: s.Allow, AllowEnv: s.AllowEnv, Dir: s.Dir, Env: s.Env}
+}
+
+// supervise runs the command of a task until the task is cancelled or gives up on it
+func (s Supervise) supervise(args *tasks.TaskArgs, p superviseParams) {
+	task := args.Task
+	restarts, failures, backoff := 0, 0, p.backoff
+	emit := func(result tasks.Result) {
+		result.Spark = spark(task, float64(restarts))
+		task.Spark = result.Spark
+		args.Callback(result)
+	}
+	for {
+		update, err := s.once(task, p, restarts, func(pid int) {
+			emit(tasks.Result{Update: map[string]interface{}{"state": "running", "pid": pid, "restarts": restarts}})
+		})
+		if task.CTX.Err() != nil {
+			return
+		}
+		if err == nil && update["uptime"].(float64) >= p.resetAfter.Seconds() {
+			failures, backoff = 0, p.backoff
+		}
+		if err == nil && update["exit_code"] == 0 && p.Restart == "on-failure" {
+			update["state"] = "exited"
+			emit(tasks.Result{Update: update})
+			return
+		}
+		failures++
+		if p.MaxRestarts > 0 && failures > p.MaxRestarts {
+			if err == nil {
+				err = fmt.Errorf("exited with %v", update["exit_code"])
+			}
+			emit(tasks.Result{Error: fmt.Errorf("%s: %w, gave up after %d restarts in a row", p.Command, err, p.MaxRestarts)})
+			return
+		}
+		if err != nil {
+			emit(tasks.Result{Error: fmt.Errorf("%s: %w", p.Command, err)})
+		} else {
+			update["state"], update["retry_in"] = "backoff", backoff.Seconds()
+			emit(tasks.Result{Update: update, Warn: true})
+		}
+		select {
+		case <-task.CTX.Done():
+			return
+		case <-time.After(backoff):
+		}
+		restarts++
+		backoff = min(2*backoff, p.maxBackoff)
+	}
+}
+
+// once runs the command of a task until it exits, calling started once it's started, and
+// gets the update reporting its exit
+func (s Supervise) once(task tasks.Task, p superviseParams, restarts int, started func(pid int)) (map[string]interface{}, error) {
+	path, dir, env, err := s.exec().command(p.Command, p.Dir, p.Env)
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.CommandContext(task.CTX, path, p.Args...)
+	cmd.Dir, cmd.Env = dir, env
+	output := s.MaxOutput
+	if output <= 0 {
+		output = DefaultSuperviseOutput
+	}
+	stdout, stderr := &tail{max: output}, &tail{max: output}
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+	cmd.Cancel = func() error {
+		if err := cmd.Process.Signal(syscall.SIGTERM); err != nil && !errors.Is(err, os.ErrProcessDone) {
+			return cmd.Process.Kill() // Windows can't signal processes
+		}
+		return nil
+	}
+	cmd.WaitDelay = s.StopTimeout
+	if cmd.WaitDelay <= 0 {
+		cmd.WaitDelay = DefaultSuperviseStop
+	}
+	start := time.Now()
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	started(cmd.Process.Pid)
+	err = cmd.Wait()
+	var exit *exec.ExitError
+	if err != nil && !errors.As(err, &exit) {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"pid":       cmd.Process.Pid,
+		"exit_code": cmd.ProcessState.ExitCode(), // -1 when killed by a signal
+		"uptime":    round(time.Since(start).Seconds()),
+		"restarts":  restarts,
+		"stdout":    stdout.String(),
+		"stderr":    stderr.String(),
+	}, nil
+}
+
+// tail is a buffer keeping the last max bytes written
+type tail struct {
+	b   []byte
+	max int
+}
+
+func (t *tail) Write(p []byte) (int, error) {
+	t.b = append(t.b, p...)
+	if len(t.b) > 2*t.max {
+		t.b = append(t.b[:0], t.b[len(t.b)-t.max:]...)
+	}
+	return len(p), nil
+}
+
+func (t *tail) String() string {
+	return string(t.b[max(len(t.b)-t.max, 0):])
+}
@@ -0,0 +1,193 @@
+package tasktypes
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/shirou/gopsutil/v4/common"
+	"github.com/shirou/gopsutil/v4/cpu"
+	"github.com/shirou/gopsutil/v4/disk"
+	"github.com/shirou/gopsutil/v4/host"
+	"github.com/shirou/gopsutil/v4/load"
+	"github.com/shirou/gopsutil/v4/mem"
+	"pkg.goda.sh/runner/v2"
+	"pkg.goda.sh/tasks"
+)
+
+// SystemType is the task type of System
+const SystemType = "system"
+
+// DefaultSample is the CPU sample of a System of 0
+const DefaultSample = 250 * time.Millisecond
+
+// System reports the health of the host of the runner, so runners report on themselves
+// through the same results as their checks:
+//
+//	{"cpu_percent": 12.5, "cpus": 8, "load1": 0.4, "load5": 0.3, "load15": 0.2,
+//	 "memory_percent": 41.2, "memory_total": 16777216000, "memory_available": 9865000000,
+//	 "swap_percent": 0, "uptime": 86400, "disks": {"/": {"percent": 63.1, "free": 1.2e10, "total": 3.2e10}}}
+//
+// The CPU is sampled for Sample, the disks are those of the disks param of tasks, / by
+// default. Tasks warn when a percent goes over their cpu_warn, memory_warn or disk_warn, or
+// the load of the last minute per CPU over load_warn, those that are set. The CPU percent is
+// kept in Spark.
+//
+// Metrics are read with gopsutil, systems it doesn't support fail tasks.
+type System struct {
+	Proc   string        // Where proc is mounted on Linux, ex. the one of the host in a container, /proc when empty
+	Sample time.Duration // DefaultSample when 0
+}
+
+// systemParams are the params of System tasks
+type systemParams struct {
+	Disks      []string `json:"disks"`
+	CPUWarn    float64  `json:"cpu_warn"`
+	MemoryWarn float64  `json:"memory_warn"`
+	DiskWarn   float64  `json:"disk_warn"`
+	LoadWarn   float64  `json:"load_warn"`
+}
+
+func (p *systemParams) Validate() error {
+	for name, v := range map[string]float64{"cpu_warn": p.CPUWarn, "memory_warn": p.MemoryWarn, "disk_warn": p.DiskWarn} {
+		if v < 0 || v > 100 {
+			return fmt.Errorf("%s %v isn't a percent", name, v)
+		}
+	}
+	if p.LoadWarn < 0 {
+		return fmt.Errorf("load_warn %v is negative", p.LoadWarn)
+	}
+	if len(p.Disks) == 0 {
+		p.Disks = []string{"/"}
+	}
+	return nil
+}
+
+// Register adds the System task type to r
+func (sy System) Register(r *runner.Runner) error {
+	return r.Register(SystemType, runner.Typed(sy.run), runner.TaskType{Params: runner.ParamSchema{
+		"disks":       {Kind: runner.ParamArray},
+		"cpu_warn":    {Kind: runner.ParamNumber},
+		"memory_warn": {Kind: runner.ParamNumber},
+		"disk_warn":   {Kind: runner.ParamNumber},
+		"load_warn":   {Kind: runner.ParamNumber},
+	}})
+}
+
+// systemStats are the metrics of a host
+type systemStats struct {
+	cpuPercent             float64
+	cpus                   int
+	load1, load5, load15   float64
+	memTotal, memAvailable uint64
+	swapTotal, swapFree    uint64
+	uptime                 float64
+	disks                  map[string]diskStats
+}
+
+// diskStats are the metrics of a file system
+type diskStats struct {
+	total, free uint64
+}
+
+func (sy System) run(args *tasks.TaskArgs, p systemParams) tasks.Result {
+	sample := sy.Sample
+	if sample <= 0 {
+		sample = DefaultSample
+	}
+	ctx, cancel := taskContext(args.Task, 0)
+	defer cancel()
+	if sy.Proc != "" {
+		ctx = context.WithValue(ctx, common.EnvKey, common.EnvMap{common.HostProcEnvKey: sy.Proc})
+	}
+	stats, err := readSystem(ctx, p.Disks, sample)
+	if args.Task.CTX != nil && args.Task.CTX.Err() != nil {
+		return tasks.Result{Cancelled: true}
+	}
+	if err != nil {
+		return tasks.Result{Error: err}
+	}
+
+	memory := percent(stats.memTotal-stats.memAvailable, stats.memTotal)
+	update := map[string]interface{}{
+		"cpu_percent":      round(stats.cpuPercent),
+		"cpus":             stats.cpus,
+		"load1":            stats.load1,
+		"load5":            stats.load5,
+		"load15":           stats.load15,
+		"memory_percent":   memory,
+		"memory_total":     stats.memTotal,
+		"memory_available": stats.memAvailable,
+		"swap_percent":     percent(stats.swapTotal-stats.swapFree, stats.swapTotal),
+		"uptime":           stats.uptime,
+	}
+	warn := (p.CPUWarn > 0 && stats.cpuPercent > p.CPUWarn) ||
+		(p.MemoryWarn > 0 && memory > p.MemoryWarn) ||
+		(p.LoadWarn > 0 && stats.load1/float64(max(stats.cpus, 1)) > p.LoadWarn)
+	disks := make(map[string]interface{}, len(stats.disks))
+	for path, d := range stats.disks {
+		used := percent(d.total-d.free, d.total)
+		disks[path] = map[string]interface{}{"percent": used, "free": d.free, "total": d.total}
+		warn = warn || (p.DiskWarn > 0 && used > p.DiskWarn)
+	}
+	update["disks"] = disks
+	return tasks.Result{Update: update, Warn: warn, Spark: spark(args.Task, round(stats.cpuPercent))}
+}
+
+// readSystem reads the metrics of the host, sampling the CPU for sample
+func readSystem(ctx context.Context, disks []string, sample time.Duration) (systemStats, error) {
+	var s systemStats
+	busy, err := cpu.PercentWithContext(ctx, sample, false)
+	if err != nil {
+		return s, fmt.Errorf("cpu: %w", err)
+	}
+	if len(busy) > 0 {
+		s.cpuPercent = busy[0]
+	}
+	if s.cpus, err = cpu.CountsWithContext(ctx, true); err != nil {
+		return s, fmt.Errorf("cpu: %w", err)
+	}
+	avg, err := load.AvgWithContext(ctx)
+	if err != nil {
+		return s, fmt.Errorf("load: %w", err)
+	}
+	s.load1, s.load5, s.load15 = avg.Load1, avg.Load5, avg.Load15
+	uptime, err := host.UptimeWithContext(ctx)
+	if err != nil {
+		return s, fmt.Errorf("uptime: %w", err)
+	}
+	s.uptime = float64(uptime)
+	memory, err := mem.VirtualMemoryWithContext(ctx)
+	if err != nil {
+		return s, fmt.Errorf("memory: %w", err)
+	}
+	s.memTotal, s.memAvailable = memory.Total, memory.Available
+	swap, err := mem.SwapMemoryWithContext(ctx)
+	if err != nil {
+		return s, fmt.Errorf("swap: %w", err)
+	}
+	s.swapTotal, s.swapFree = swap.Total, swap.Free
+
+	s.disks = make(map[string]diskStats, len(disks))
+	for _, path := range disks {
+		usage, err := disk.UsageWithContext(ctx, path)
+		if err != nil {
+			return s, fmt.Errorf("disk %s: %w", path, err)
+		}
+		s.disks[path] = diskStats{total: usage.Total, free: usage.Free}
+	}
+	return s, nil
+}
+
+// percent is the percent of part in total with a decimal, 0 when total is
+func percent(part, total uint64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return round(float64(part) / float64(total) * 100)
+}
+
+func round(v float64) float64 {
+	return math.Round(v*10) / 10
+}
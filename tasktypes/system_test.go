@@ -0,0 +1,31 @@
+package tasktypes
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"pkg.goda.sh/tasks"
+)
+
+func TestSystemReportsTheHost(t *testing.T) {
+	sy := System{Sample: 50 * time.Millisecond}
+	p := systemParams{MemoryWarn: 100}
+	if err := p.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	result := sy.run(&tasks.TaskArgs{Task: tasks.Task{CTX: context.Background()}}, p)
+	if result.Error != nil {
+		t.Fatal(result.Error)
+	}
+	update := result.Update.(map[string]interface{})
+	if update["cpus"].(int) < 1 || update["memory_total"].(uint64) == 0 || update["uptime"].(float64) <= 0 {
+		t.Errorf("got %v, want the CPUs, memory and uptime of the host", update)
+	}
+	if disk, ok := update["disks"].(map[string]interface{})["/"].(map[string]interface{}); !ok || disk["total"].(uint64) == 0 {
+		t.Errorf("got disks %v, want /", update["disks"])
+	}
+	if result.Warn || len(result.Spark) != 1 {
+		t.Errorf("got %+v, want no warning and the CPU percent in Spark", result)
+	}
+}
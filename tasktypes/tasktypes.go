@@ -0,0 +1,89 @@
+// Package tasktypes holds first-party task types. Each is a struct configuring it for a
+// deployment, registered on the Runners that run it:
+//
+//	err := tasktypes.Wasm{Dir: "/var/lib/runner/wasm"}.Register(r)
+//
+// Tasks then name the type, ex. task: wasm, and pass their settings as params.
+package tasktypes
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"pkg.goda.sh/tasks"
+)
+
+// DefaultTimeout bounds a single run of the task types with a Timeout setting
+const DefaultTimeout = 30 * time.Second
+
+// DefaultMaxOutput is how many bytes of output the task types running programs keep
+const DefaultMaxOutput = 1 << 20
+
+// SparkLen is how many values the task types keep in the Spark of their tasks
+const SparkLen = 30
+
+// spark adds a value to the Spark of a task, a result replaces the previous one
+func spark(t tasks.Task, v float64) []float64 {
+	values := append(slices.Clone(t.Spark), v)
+	return values[max(len(values)-SparkLen, 0):]
+}
+
+// taskContext gets the context of a run, cancelled with its task, bounded by timeout
+func taskContext(t tasks.Task, timeout time.Duration) (context.Context, context.CancelFunc) {
+	ctx := t.CTX
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// words are a list of arguments, a string split on spaces or a list
+type words []string
+
+func (w *words) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*w = strings.Fields(s)
+		return nil
+	}
+	var list []interface{}
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*w = make(words, len(list))
+	for i, v := range list {
+		(*w)[i] = fmt.Sprint(v)
+	}
+	return nil
+}
+
+// capped is a buffer dropping what is written past max bytes
+type capped struct {
+	bytes.Buffer
+	max       int
+	truncated bool
+}
+
+func newCapped(max int) *capped {
+	if max <= 0 {
+		max = DefaultMaxOutput
+	}
+	return &capped{max: max}
+}
+
+func (c *capped) Write(p []byte) (int, error) {
+	n := len(p)
+	if room := c.max - c.Len(); n > room {
+		p, c.truncated = p[:max(room, 0)], true
+	}
+	c.Buffer.Write(p)
+	return n, nil // Programs writing more aren't stopped
+}
@@ -0,0 +1,146 @@
+package tasktypes
+
+import (
+	"errors"
+	"fmt"
+
+	"pkg.goda.sh/runner/v2"
+	"pkg.goda.sh/tasks"
+)
+
+// TransformType is the task type of Transform
+const TransformType = "transform"
+
+// Transform runs a child task of any type the Runner has and derives the result of tasks
+// from its update with jq expressions, see jq, so warn states and values come from raw
+// data without new task types:
+//
+//	{"task": "http", "params": {"url": "https://api.internal/queue", "keep_body": true},
+//	 "update": {"depth": ".body.depth", "oldest": ".body.jobs | map(.age) | max"},
+//	 "warn": "$update.depth > 100 or .status != 200", "spark": ".body.depth"}
+//
+// update is an expression or an object of them giving the update of tasks, that of the
+// child when unset. warn is a condition, tasks warn when it isn't false or null, or when the
+// child warns when unset. spark is a number kept in Spark, the child keeps its own when
+// unset, a null leaves it as it is. Expressions get the update of the child as input and the
+// one derived from it as $update. Tasks fail when the child does or an expression fails.
+type Transform struct{}
+
+// transformParams are the params of Transform tasks
+type transformParams struct {
+	Task   string                 `json:"task"`
+	Params map[string]interface{} `json:"params"`
+	Update interface{}            `json:"update"` // An expression or an object of them
+	Warn   string                 `json:"warn"`
+	Spark  string                 `json:"spark"`
+
+	update      *jq
+	fields      map[string]*jq
+	warn, spark *jq
+}
+
+func (p *transformParams) Validate() (err error) {
+	if p.Task == "" {
+		return errors.New("no task")
+	}
+	switch u := p.Update.(type) {
+	case nil:
+	case string:
+		if p.update, err = compileJQ(u); err != nil {
+			return fmt.Errorf("update: %v", err)
+		}
+	case map[string]interface{}:
+		p.fields = make(map[string]*jq, len(u))
+		for name, v := range u {
+			src, ok := v.(string)
+			if !ok {
+				return fmt.Errorf("update %s isn't an expression", name)
+			}
+			if p.fields[name], err = compileJQ(src); err != nil {
+				return fmt.Errorf("update %s: %v", name, err)
+			}
+		}
+	default:
+		return errors.New("update isn't an expression or an object of them")
+	}
+	if p.Warn != "" {
+		if p.warn, err = compileJQ(p.Warn); err != nil {
+			return fmt.Errorf("warn: %v", err)
+		}
+	}
+	if p.Spark != "" {
+		if p.spark, err = compileJQ(p.Spark); err != nil {
+			return fmt.Errorf("spark: %v", err)
+		}
+	}
+	return nil
+}
+
+// Register adds the Transform task type to r, children run the task types of r
+func (tr Transform) Register(r *runner.Runner) error {
+	return r.Register(TransformType, runner.Typed(func(args *tasks.TaskArgs, p transformParams) tasks.Result {
+		return tr.run(r, args, p)
+	}), runner.TaskType{Params: runner.ParamSchema{
+		"task":   {Kind: runner.ParamString, Required: true},
+		"params": {Kind: runner.ParamObject},
+		"update": {Kind: runner.ParamAny},
+		"warn":   {Kind: runner.ParamString},
+		"spark":  {Kind: runner.ParamString},
+	}})
+}
+
+func (tr Transform) run(r *runner.Runner, args *tasks.TaskArgs, p transformParams) tasks.Result {
+	child := args.Task
+	child.Label = args.Task.Label + "/" + p.Task
+	res := r.RunType(child, p.Task, p.Params)
+	if res.Cancelled || res.Error != nil {
+		return res
+	}
+	in, err := plain(res.Update)
+	if err != nil {
+		return tasks.Result{Error: err}
+	}
+	out := res.Update
+	switch {
+	case p.update != nil:
+		if out, err = p.update.run(in, nil); err != nil {
+			return tasks.Result{Error: fmt.Errorf("update: %w", err)}
+		}
+	case p.fields != nil:
+		fields := make(map[string]interface{}, len(p.fields))
+		for name, q := range p.fields {
+			if fields[name], err = q.run(in, nil); err != nil {
+				return tasks.Result{Error: fmt.Errorf("update %s: %w", name, err)}
+			}
+		}
+		out = fields
+	}
+	derived, err := plain(out)
+	if err != nil {
+		return tasks.Result{Error: err}
+	}
+	vars := map[string]interface{}{"update": derived}
+	result := tasks.Result{Update: out, Warn: res.Warn, Spark: res.Spark}
+	if p.warn != nil {
+		warn, err := p.warn.run(in, vars)
+		if err != nil {
+			return tasks.Result{Error: fmt.Errorf("warn: %w", err)}
+		}
+		result.Warn = jqTrue(warn)
+	}
+	if p.spark != nil {
+		v, err := p.spark.run(in, vars)
+		if err != nil {
+			return tasks.Result{Error: fmt.Errorf("spark: %w", err)}
+		}
+		switch n := v.(type) {
+		case nil:
+			result.Spark = args.Task.Spark
+		case float64:
+			result.Spark = spark(args.Task, n)
+		default:
+			return tasks.Result{Error: fmt.Errorf("spark %v isn't a number", v)}
+		}
+	}
+	return result
+}
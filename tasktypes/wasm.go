@@ -0,0 +1,143 @@
+package tasktypes
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+	"pkg.goda.sh/runner/v2"
+	"pkg.goda.sh/tasks"
+)
+
+// WasmType is the task type of Wasm
+const WasmType = "wasm"
+
+// DefaultWasmMemory is the memory of modules, in 64KiB pages, when Wasm.MaxMemory is 0
+const DefaultWasmMemory = 1024
+
+// ErrModuleChanged is returned when a module doesn't match the sha256 of its task
+var ErrModuleChanged = errors.New("tasktypes: module doesn't match its sha256")
+
+// Wasm runs tasks as WebAssembly modules, so checks contributed by users of a shared fleet
+// run sandboxed. Modules are WASI programs: they read the input param as JSON on stdin and
+// write their result on stdout, as JSON of the form
+//
+//	{"update": ..., "warn": false, "spark": [1, 2], "error": "..."}
+//
+// The params of a task are the module, a path relative to Dir, the args of the module, its
+// input and, optionally, the sha256 of the module in hex, so a module replaced on disk
+// isn't run by tasks written for the previous one.
+//
+// Modules run in the runner, with wazero, and get no files, environment variables or
+// sockets. Runs taking longer than Timeout are stopped.
+type Wasm struct {
+	Dir       string        // Holds the modules, tasks can't name modules outside of it
+	Timeout   time.Duration // DefaultTimeout when 0
+	MaxOutput int           // Bytes of stdout kept, DefaultMaxOutput when 0
+	MaxMemory uint32        // In 64KiB pages, DefaultWasmMemory when 0
+
+	cache wazero.CompilationCache // Of the modules run since Register
+}
+
+// wasmParams are the params of Wasm tasks
+type wasmParams struct {
+	Module string      `json:"module"`
+	SHA256 string      `json:"sha256"`
+	Args   []string    `json:"args"`
+	Input  interface{} `json:"input"`
+}
+
+func (p *wasmParams) Validate() error {
+	if !filepath.IsLocal(p.Module) || filepath.Ext(p.Module) != ".wasm" {
+		return fmt.Errorf("module %q isn't a relative path to a .wasm file", p.Module)
+	}
+	return nil
+}
+
+// wasmResult is what modules write on stdout
+type wasmResult struct {
+	Update interface{} `json:"update"`
+	Warn   bool        `json:"warn"`
+	Spark  []float64   `json:"spark"`
+	Error  string      `json:"error"`
+}
+
+// Register adds the Wasm task type to r
+func (w Wasm) Register(r *runner.Runner) error {
+	w.cache = wazero.NewCompilationCache()
+	return r.Register(WasmType, runner.Typed(w.run), runner.TaskType{Params: runner.ParamSchema{
+		"module": {Kind: runner.ParamString, Required: true},
+		"sha256": {Kind: runner.ParamString},
+		"args":   {Kind: runner.ParamArray},
+	}})
+}
+
+func (w Wasm) run(args *tasks.TaskArgs, p wasmParams) tasks.Result {
+	data, err := os.ReadFile(filepath.Join(w.Dir, p.Module))
+	if err != nil {
+		return tasks.Result{Error: err}
+	}
+	// The module run is the one hashed, it can't be swapped on disk in between
+	if sum := sha256.Sum256(data); p.SHA256 != "" && !strings.EqualFold(hex.EncodeToString(sum[:]), p.SHA256) {
+		return tasks.Result{Error: fmt.Errorf("%w: %s", ErrModuleChanged, p.Module)}
+	}
+	input, err := json.Marshal(p.Input)
+	if err != nil {
+		return tasks.Result{Error: err}
+	}
+	memory := w.MaxMemory
+	if memory == 0 {
+		memory = DefaultWasmMemory
+	}
+	ctx, cancel := taskContext(args.Task, w.Timeout)
+	defer cancel()
+	config := wazero.NewRuntimeConfig().WithCloseOnContextDone(true).WithMemoryLimitPages(memory)
+	if w.cache != nil {
+		config = config.WithCompilationCache(w.cache)
+	}
+	rt := wazero.NewRuntimeWithConfig(ctx, config)
+	defer rt.Close(context.Background())
+	wasi_snapshot_preview1.MustInstantiate(ctx, rt)
+
+	stdout, stderr := newCapped(w.MaxOutput), newCapped(4096)
+	_, err = rt.InstantiateWithConfig(ctx, data, wazero.NewModuleConfig().
+		WithName("").
+		WithArgs(append([]string{p.Module}, p.Args...)...).
+		WithStdin(bytes.NewReader(input)).
+		WithStdout(stdout).
+		WithStderr(stderr))
+	if args.Task.CTX != nil && args.Task.CTX.Err() != nil {
+		return tasks.Result{Cancelled: true}
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return tasks.Result{Error: fmt.Errorf("%s: %w", p.Module, ctx.Err())}
+	}
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			err = fmt.Errorf("%w: %s", err, msg)
+		}
+		return tasks.Result{Error: fmt.Errorf("%s: %w", p.Module, err)}
+	}
+	if stdout.truncated {
+		return tasks.Result{Error: fmt.Errorf("%s: output over %d bytes", p.Module, stdout.max)}
+	}
+	var out wasmResult
+	if err := json.Unmarshal(stdout.Bytes(), &out); err != nil {
+		return tasks.Result{Error: fmt.Errorf("%s: bad output: %w", p.Module, err)}
+	}
+	result := tasks.Result{Update: out.Update, Warn: out.Warn, Spark: out.Spark}
+	if out.Error != "" {
+		result.Error = errors.New(out.Error)
+	}
+	return result
+}
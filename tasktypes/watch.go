@@ -0,0 +1,248 @@
+package tasktypes
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"pkg.goda.sh/runner/v2"
+	"pkg.goda.sh/tasks"
+)
+
+// WatchType is the task type of Watch
+const WatchType = "watch"
+
+// DefaultWatchDelay is the Delay of a Watch of 0
+const DefaultWatchDelay = 100 * time.Millisecond
+
+// Watch watches the files of tasks, paths or glob patterns, and reports a result whenever
+// their content changes, bridging file system events into the results of the runner:
+//
+//	{"files": {"/etc/app/app.conf": {"sha256": "9f86d0...", "size": 1204}},
+//	 "changes": [{"path": "/etc/app/app.conf", "change": "modified", "sha256": "9f86d0...",
+//	 "size": 1204, "added_lines": 2, "removed_lines": 1}]}
+//
+// Watch tasks are timerless: they report the files they start with, then a result for each
+// change, added, removed or modified. Changes warn unless the task sets warn to false. The
+// lines added and removed are counted for files of up to MaxDiff bytes, ignoring their
+// order. The number of changes of results is kept in Spark.
+//
+// Directories are watched, not files, so files replaced by a rename are seen, but
+// directories created after the task are only watched once a change in another one is seen.
+type Watch struct {
+	Delay   time.Duration // Changes wait for, editors often write a file in several steps, DefaultWatchDelay when 0
+	MaxDiff int           // Bytes of the files kept to count the lines of changes, DefaultMaxOutput when 0
+
+	logger *slog.Logger // Of the Runner it's registered to
+}
+
+// watchParams are the params of Watch tasks
+type watchParams struct {
+	Paths []string `json:"paths"`
+	Warn  *bool    `json:"warn"` // true when unset
+}
+
+func (p *watchParams) Validate() error {
+	if len(p.Paths) == 0 {
+		return errors.New("no paths")
+	}
+	for _, path := range p.Paths {
+		if _, err := filepath.Match(path, ""); err != nil {
+			return fmt.Errorf("path %q: %v", path, err)
+		}
+	}
+	return nil
+}
+
+// Register adds the Watch task type to r
+func (w Watch) Register(r *runner.Runner) error {
+	w.logger = r.Logger()
+	return r.Register(WatchType, runner.Typed(w.run), runner.TaskType{
+		Params: runner.ParamSchema{
+			"paths": {Kind: runner.ParamArray, Required: true},
+			"warn":  {Kind: runner.ParamBool},
+		},
+		Timerless: true,
+	})
+}
+
+// watchedFile is the state of a file at a scan
+type watchedFile struct {
+	hash    string
+	size    int64
+	content []byte // When at most MaxDiff bytes
+}
+
+func (w Watch) run(args *tasks.TaskArgs, p watchParams) tasks.Result {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return tasks.Result{Error: err}
+	}
+	delay := w.Delay
+	if delay <= 0 {
+		delay = DefaultWatchDelay
+	}
+	task := args.Task
+	report := func(files map[string]watchedFile, changes []interface{}) {
+		result := tasks.Result{
+			Update: map[string]interface{}{"files": fileList(files), "changes": changes},
+			Warn:   len(changes) > 0 && (p.Warn == nil || *p.Warn),
+			Spark:  spark(task, float64(len(changes))),
+		}
+		task.Spark = result.Spark
+		args.Callback(result)
+	}
+	w.watchDirs(watcher, p.Paths)
+	files := w.scan(p.Paths)
+	report(files, []interface{}{})
+
+	go func() {
+		defer watcher.Close()
+		var settle <-chan time.Time
+		for {
+			select {
+			case <-task.CTX.Done():
+				return
+			case _, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				settle = time.After(delay)
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				w.logger.Warn(fmt.Sprintf("Watch %q: %v", task.Label, err))
+			case <-settle:
+				settle = nil
+				w.watchDirs(watcher, p.Paths)
+				next := w.scan(p.Paths)
+				if changes := diffFiles(files, next); len(changes) > 0 {
+					report(next, changes)
+				}
+				files = next
+			}
+		}
+	}()
+	return tasks.Result{}
+}
+
+// watchDirs watches the directories the files of patterns are in
+func (w Watch) watchDirs(watcher *fsnotify.Watcher, patterns []string) {
+	for _, pattern := range patterns {
+		dirs, _ := filepath.Glob(filepath.Dir(pattern))
+		for _, dir := range dirs {
+			if err := watcher.Add(dir); err != nil { // Again for those watched already
+				w.logger.Warn(fmt.Sprintf("Watch %s: %v", dir, err))
+			}
+		}
+	}
+}
+
+// scan reads the files matching patterns
+func (w Watch) scan(patterns []string) map[string]watchedFile {
+	max := w.MaxDiff
+	if max <= 0 {
+		max = DefaultMaxOutput
+	}
+	files := make(map[string]watchedFile)
+	for _, pattern := range patterns {
+		paths, _ := filepath.Glob(pattern)
+		for _, path := range paths {
+			if _, done := files[path]; done {
+				continue
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				continue // A directory, or a file gone since the glob
+			}
+			sum := sha256.Sum256(data)
+			f := watchedFile{hash: hex.EncodeToString(sum[:]), size: int64(len(data))}
+			if len(data) <= max {
+				f.content = data
+			}
+			files[path] = f
+		}
+	}
+	return files
+}
+
+// fileList is the files of a scan as reported
+func fileList(files map[string]watchedFile) map[string]interface{} {
+	list := make(map[string]interface{}, len(files))
+	for path, f := range files {
+		list[path] = map[string]interface{}{"sha256": f.hash, "size": f.size}
+	}
+	return list
+}
+
+// diffFiles gets the changes from one scan to the next, sorted by path
+func diffFiles(prev, next map[string]watchedFile) (changes []interface{}) {
+	paths := make([]string, 0, len(prev)+len(next))
+	for path := range prev {
+		paths = append(paths, path)
+	}
+	for path := range next {
+		if _, ok := prev[path]; !ok {
+			paths = append(paths, path)
+		}
+	}
+	slices.Sort(paths)
+	for _, path := range paths {
+		before, was := prev[path]
+		after, is := next[path]
+		change := map[string]interface{}{"path": path}
+		switch {
+		case !is:
+			change["change"] = "removed"
+		case !was:
+			change["change"] = "added"
+		case before.hash != after.hash:
+			change["change"] = "modified"
+			if before.content != nil && after.content != nil {
+				change["added_lines"], change["removed_lines"] = lineDiff(before.content, after.content)
+			}
+		default:
+			continue
+		}
+		if is {
+			change["sha256"], change["size"] = after.hash, after.size
+		}
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+// lineDiff counts the lines of b missing from a and those of a missing from b
+func lineDiff(a, b []byte) (added, removed int) {
+	counts := make(map[string]int)
+	for _, line := range lines(a) {
+		counts[line]++
+	}
+	for _, line := range lines(b) {
+		if counts[line] > 0 {
+			counts[line]--
+		} else {
+			added++
+		}
+	}
+	for _, n := range counts {
+		removed += n
+	}
+	return added, removed
+}
+
+func lines(data []byte) []string {
+	if len(data) == 0 {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+}
@@ -0,0 +1,161 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ErrUnknownTemplate is returned when instantiating a template that wasn't defined
+var ErrUnknownTemplate = errors.New("runner: unknown template")
+
+// placeholder matches the {{name}} parameters of a template
+var placeholder = regexp.MustCompile(`\{\{\s*(\w+)\s*\}\}`)
+
+// Template is a task defined once and instantiated with different parameters. The label,
+// interval, ID and string params of Spec may contain {{name}} placeholders; a param that is
+// only a placeholder takes the parameter value as is, keeping its type.
+type Template struct {
+	Name     string                 `json:"name"`
+	Spec     Spec                   `json:"spec"`
+	Defaults map[string]interface{} `json:"defaults,omitempty"` // Used for missing parameters
+}
+
+// Render substitutes the parameters into the template
+func (t Template) Render(params map[string]interface{}) (Spec, error) {
+	values := make(map[string]interface{}, len(t.Defaults)+len(params))
+	for name, v := range t.Defaults {
+		values[name] = v
+	}
+	for name, v := range params {
+		values[name] = v
+	}
+	var missing []string
+	expand := func(v interface{}) interface{} {
+		return substitute(v, values, &missing)
+	}
+	s := t.Spec
+	s.Label, _ = expand(s.Label).(string)
+	s.Interval, _ = expand(s.Interval).(string)
+	s.CleanTask.ID, _ = expand(s.CleanTask.ID).(string)
+	s.Params, _ = expand(s.Params).(map[string]interface{})
+	if t.Spec.Params == nil {
+		s.Params = nil
+	}
+	s.Template, s.TemplateParams = t.Name, params
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return s, fmt.Errorf("%w: template %q is missing %s", ErrInvalidTask, t.Name, strings.Join(missing, ", "))
+	}
+	return s, nil
+}
+
+// substitute expands the placeholders of strings within v, recording unknown names in missing
+func substitute(v interface{}, values map[string]interface{}, missing *[]string) interface{} {
+	switch v := v.(type) {
+	case string:
+		if m := placeholder.FindStringSubmatch(v); m != nil && m[0] == v {
+			if value, ok := values[m[1]]; ok {
+				return value
+			}
+		}
+		return placeholder.ReplaceAllStringFunc(v, func(p string) string {
+			name := placeholder.FindStringSubmatch(p)[1]
+			value, ok := values[name]
+			if !ok {
+				if !containsFold(*missing, name) {
+					*missing = append(*missing, name)
+				}
+				return p
+			}
+			return fmt.Sprint(value)
+		})
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			out[k] = substitute(item, values, missing)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			out[i] = substitute(item, values, missing)
+		}
+		return out
+	}
+	return v
+}
+
+// DefineTemplate adds a template, or replaces it and re-renders every one of its instances.
+// Templates aren't persisted, instances are and pick up the template once it is defined again.
+func (r *Runner) DefineTemplate(ctx context.Context, t Template) error {
+	if t.Name == "" {
+		return fmt.Errorf("%w: template without a name", ErrInvalidTask)
+	}
+	if _, ok := r.lookup(t.Spec.CleanTask.Task); !ok {
+		return fmt.Errorf("%w: unknown task type %q", ErrInvalidTask, t.Spec.CleanTask.Task)
+	}
+	r.mu.Lock()
+	if r.templates == nil {
+		r.templates = make(map[string]Template)
+	}
+	r.templates[t.Name] = t
+	r.mu.Unlock()
+	var errs TaskErrors
+	for _, id := range r.Instances(t.Name) {
+		spec, err := t.Render(r.spec(id).TemplateParams)
+		if err == nil {
+			_, err = r.replace(ctx, id, spec)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", id, err))
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// Templates gets every defined template, sorted by name
+func (r *Runner) Templates() []Template {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make([]Template, 0, len(r.templates))
+	for _, t := range r.templates {
+		out = append(out, t)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// Instantiate adds a task rendered from a template and returns its ID
+func (r *Runner) Instantiate(ctx context.Context, name string, params map[string]interface{}) (string, error) {
+	r.mu.RLock()
+	t, ok := r.templates[name]
+	r.mu.RUnlock()
+	if !ok {
+		return "", fmt.Errorf("%w: %q", ErrUnknownTemplate, name)
+	}
+	spec, err := t.Render(params)
+	if err != nil {
+		return "", err
+	}
+	if err := r.AddSpec(ctx, spec); err != nil {
+		return "", err
+	}
+	return r.Hash(spec.Task()), nil
+}
+
+// Instances gets the IDs of the tasks instantiated from a template
+func (r *Runner) Instances(name string) (ids []string) {
+	for id := range r.All() {
+		if r.spec(id).Template == name {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
@@ -0,0 +1,18 @@
+package runner
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrNoTransport is returned when a fleet feature is used without a Transport
+var ErrNoTransport = errors.New("runner: no transport configured")
+
+// Transport carries results, heartbeats and control messages between runners
+type Transport interface {
+	// Publish sends a payload to every subscriber of subject
+	Publish(ctx context.Context, subject string, payload []byte) error
+	// Subscribe calls fn for every message sent to subjects until ctx is done.
+	// It returns once the subscription is active.
+	Subscribe(ctx context.Context, fn func(subject string, payload []byte), subjects ...string) error
+}
@@ -0,0 +1,66 @@
+package runner
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// WithResultTTL expires stored results after ttl, or the TTL of their task type in byType.
+// Every Store stops returning a result once it has expired and deletes it when the task
+// next stores one.
+func WithResultTTL(ttl time.Duration, byType map[string]time.Duration) Option {
+	return func(r *Runner) {
+		r.resultTTL = make(map[string]time.Duration, len(byType)+1)
+		r.resultTTL[""] = ttl
+		for typ, d := range byType {
+			r.resultTTL[strings.ToLower(typ)] = d
+		}
+	}
+}
+
+// Expired reports whether a Record has outlived its TTL
+func (rec Record) Expired(now time.Time) bool {
+	return rec.Expires > 0 && rec.Expires <= now.UnixNano()/int64(time.Millisecond)
+}
+
+// expiry gets when a result of a task stored now expires, 0 for never
+func (r *Runner) expiry(id string, date int64) int64 {
+	if r.resultTTL == nil {
+		return 0
+	}
+	r.mu.RLock()
+	typ := strings.ToLower(r.specs[id].CleanTask.Task)
+	r.mu.RUnlock()
+	ttl, ok := r.resultTTL[typ]
+	if !ok {
+		ttl = r.resultTTL[""]
+	}
+	if ttl <= 0 {
+		return 0
+	}
+	return date + int64(ttl/time.Millisecond)
+}
+
+// addResultExpiry adds the expires column to SQL stores created before result TTLs. Runners
+// starting together may both run it, the column is only added when it's missing.
+func addResultExpiry(ctx context.Context, _ *Runner, s Store) error {
+	sql, ok := s.(*SQLStore)
+	if !ok {
+		return nil // Other stores keep the expiry in the record
+	}
+	if sql.numbered { // Postgres
+		_, err := sql.db.ExecContext(ctx, `ALTER TABLE runner_results ADD COLUMN IF NOT EXISTS expires BIGINT NOT NULL DEFAULT 0`)
+		return err
+	}
+	if exists, err := sql.hasColumn(ctx, "runner_results", "expires"); err != nil || exists {
+		return err
+	}
+	_, err := sql.db.ExecContext(ctx, `ALTER TABLE runner_results ADD COLUMN expires BIGINT NOT NULL DEFAULT 0`)
+	if err != nil {
+		if exists, _ := sql.hasColumn(ctx, "runner_results", "expires"); exists {
+			return nil // Added by another runner in the meantime
+		}
+	}
+	return err
+}
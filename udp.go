@@ -0,0 +1,160 @@
+package runner
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net"
+	"sync"
+)
+
+// maxDatagram is the largest message a UDPTransport can carry
+const maxDatagram = 65507
+
+// udpReadBuffer is the socket buffer a UDPTransport asks for, holding bursts of datagrams
+const udpReadBuffer = 4 << 20
+
+// ErrMessageTooLarge is returned when a payload does not fit in a single datagram
+var ErrMessageTooLarge = errors.New("runner: message too large for a datagram")
+
+// UDPTransport is a Transport sending messages directly to a static list of peers over UDP.
+// Delivery is best effort, and each message must fit in a single datagram.
+type UDPTransport struct {
+	conn     *net.UDPConn
+	key      []byte
+	peers    []*net.UDPAddr
+	handlers map[int]udpHandler
+	next     int
+	mu       sync.Mutex
+	logs
+}
+
+type udpHandler struct {
+	subjects map[string]bool
+	fn       func(subject string, payload []byte)
+}
+
+type datagram struct {
+	Subject string `json:"s"`
+	Payload []byte `json:"p"`
+	MAC     []byte `json:"m,omitempty"`
+}
+
+// sign gets the HMAC-SHA256 of a datagram with key
+func (d datagram) sign(key []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(d.Subject))
+	mac.Write([]byte{0})
+	mac.Write(d.Payload)
+	return mac.Sum(nil)
+}
+
+// NewUDPTransport listens on addr (ex. ":7946") and sends every published message to peers.
+// Datagrams are signed with an HMAC of key, shared by the fleet, and those without a valid
+// signature are dropped. A nil key sends them unsigned, so any host reaching addr can
+// publish to subscribers, only use it on trusted networks.
+func NewUDPTransport(addr string, key []byte, peers ...string) (*UDPTransport, error) {
+	local, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	t := &UDPTransport{key: key, handlers: make(map[int]udpHandler)}
+	for _, peer := range peers {
+		resolved, err := net.ResolveUDPAddr("udp", peer)
+		if err != nil {
+			return nil, err
+		}
+		t.peers = append(t.peers, resolved)
+	}
+	if t.conn, err = net.ListenUDP("udp", local); err != nil {
+		return nil, err
+	}
+	t.conn.SetReadBuffer(udpReadBuffer) // Best effort, the system may cap it
+	go t.read()
+	return t, nil
+}
+
+func (t *UDPTransport) read() {
+	buf := make([]byte, maxDatagram)
+	for {
+		n, _, err := t.conn.ReadFromUDP(buf)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				t.logf(slog.LevelError, "UDP transport stopped reading: %v\n", err)
+			}
+			return
+		}
+		var msg datagram
+		if err := json.Unmarshal(buf[:n], &msg); err != nil {
+			continue
+		}
+		if t.key != nil && !hmac.Equal(msg.MAC, msg.sign(t.key)) {
+			continue
+		}
+		t.mu.Lock()
+		matched := make([]func(string, []byte), 0, len(t.handlers))
+		for _, h := range t.handlers {
+			if h.subjects[msg.Subject] {
+				matched = append(matched, h.fn)
+			}
+		}
+		t.mu.Unlock()
+		for _, fn := range matched {
+			fn(msg.Subject, msg.Payload)
+		}
+	}
+}
+
+// Publish sends a payload to every peer
+func (t *UDPTransport) Publish(ctx context.Context, subject string, payload []byte) error {
+	msg := datagram{Subject: subject, Payload: payload}
+	if t.key != nil {
+		msg.MAC = msg.sign(t.key)
+	}
+	buf, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	if len(buf) > maxDatagram {
+		return ErrMessageTooLarge
+	}
+	for _, peer := range t.peers {
+		if _, werr := t.conn.WriteToUDP(buf, peer); werr != nil && err == nil {
+			err = werr // Keep sending to the remaining peers
+		}
+	}
+	return err
+}
+
+// Subscribe calls fn for datagrams sent to subjects until ctx is done
+func (t *UDPTransport) Subscribe(ctx context.Context, fn func(subject string, payload []byte), subjects ...string) error {
+	h := udpHandler{subjects: make(map[string]bool), fn: fn}
+	for _, subject := range subjects {
+		h.subjects[subject] = true
+	}
+	t.mu.Lock()
+	id := t.next
+	t.next++
+	t.handlers[id] = h
+	t.mu.Unlock()
+	go func() {
+		<-ctx.Done()
+		t.mu.Lock()
+		delete(t.handlers, id)
+		t.mu.Unlock()
+	}()
+	return nil
+}
+
+// Addr gets the local address datagrams are received on
+func (t *UDPTransport) Addr() net.Addr {
+	return t.conn.LocalAddr()
+}
+
+// Close stops listening for datagrams
+func (t *UDPTransport) Close() error {
+	return t.conn.Close()
+}
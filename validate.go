@@ -0,0 +1,152 @@
+package runner
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"pkg.goda.sh/tasks"
+)
+
+// ParamKind is the JSON type of a task parameter
+type ParamKind string
+
+// Parameter kinds, ParamAny accepts every value
+const (
+	ParamAny    ParamKind = ""
+	ParamString ParamKind = "string"
+	ParamNumber ParamKind = "number"
+	ParamBool   ParamKind = "bool"
+	ParamObject ParamKind = "object"
+	ParamArray  ParamKind = "array"
+)
+
+// ParamRule constrains a single task parameter
+type ParamRule struct {
+	Kind     ParamKind `json:"kind,omitempty"`
+	Required bool      `json:"required,omitempty"`
+}
+
+// ParamSchema declares the parameters a task type accepts by name
+type ParamSchema map[string]ParamRule
+
+// WithParamSchema checks the params of every task of a type against schema when it is added
+func WithParamSchema(typ string, schema ParamSchema) Option {
+	return func(r *Runner) {
+		r.types.Lock()
+		defer r.types.Unlock()
+		if r.schemas == nil {
+			r.schemas = make(map[string]ParamSchema)
+		}
+		r.schemas[strings.ToLower(typ)] = schema
+	}
+}
+
+// ParamSchema gets the schema the params of a task type are checked against, see WithParamSchema
+func (r *Runner) ParamSchema(typ string) (ParamSchema, bool) {
+	r.types.RLock()
+	defer r.types.RUnlock()
+	schema, ok := r.schemas[strings.ToLower(typ)]
+	return schema, ok
+}
+
+// Check gets an error for every parameter that is missing or of the wrong kind
+func (s ParamSchema) Check(params map[string]interface{}) (errs []error) {
+	names := make([]string, 0, len(s))
+	for name := range s {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		rule := s[name]
+		v, ok := params[name]
+		if !ok || v == nil {
+			if rule.Required {
+				errs = append(errs, fmt.Errorf("%w: missing param %q", ErrInvalidTask, name))
+			}
+			continue
+		}
+		if kind := kindOf(v); rule.Kind != ParamAny && kind != rule.Kind {
+			errs = append(errs, fmt.Errorf("%w: param %q is a %s, not a %s", ErrInvalidTask, name, kind, rule.Kind))
+		}
+	}
+	return errs
+}
+
+func kindOf(v interface{}) ParamKind {
+	switch reflect.ValueOf(v).Kind() {
+	case reflect.String:
+		return ParamString
+	case reflect.Bool:
+		return ParamBool
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return ParamNumber
+	case reflect.Slice, reflect.Array:
+		return ParamArray
+	}
+	return ParamObject
+}
+
+// Validate checks a task without adding it, see ValidateSpec
+func (r *Runner) Validate(t tasks.Task) []error {
+	return r.ValidateSpec(Spec{CleanTask: tasks.CleanTask(t)})
+}
+
+// ValidateSpec checks the type, interval and params of a task and that it isn't already in
+// the task list, returning every problem found. AddSpec fails on the same errors.
+func (r *Runner) ValidateSpec(s Spec) []error {
+	errs := r.check(s)
+	if len(errs) > 0 {
+		return errs
+	}
+	t := s.Task()
+	t.Interval = normalizeInterval(t.Interval)
+	if _, exists := r.TaskList.Get(r.Hash(t)); exists {
+		errs = append(errs, fmt.Errorf("%w: %q", ErrDuplicateTask, s.Label))
+	}
+	return errs
+}
+
+// ValidateSpecs checks a batch of definitions the way ValidateSpec does, and that no two of them
+// are the same task, returning every problem found. AddSpecs fails on the same errors.
+func (r *Runner) ValidateSpecs(specs []Spec) []error {
+	var errs []error
+	seen := make(map[string]bool, len(specs))
+	for _, s := range specs {
+		if found := r.ValidateSpec(s); len(found) > 0 {
+			errs = append(errs, found...)
+			continue
+		}
+		t := s.Task()
+		t.Location = r.Identity.Location // As AddSpec adds it
+		if id := r.Hash(t); seen[id] {
+			errs = append(errs, fmt.Errorf("%w: %q is in the batch twice", ErrDuplicateTask, s.Label))
+		} else {
+			seen[id] = true
+		}
+	}
+	return errs
+}
+
+// check gets every reason a definition can't be scheduled by this runner
+func (r *Runner) check(s Spec) (errs []error) {
+	if _, ok := r.lookup(s.CleanTask.Task); !ok {
+		return []error{fmt.Errorf("%w: unknown task type %q", ErrInvalidTask, s.CleanTask.Task)}
+	}
+	if !r.Timerless(s.CleanTask.Task) && s.Interval != "" && r.ParseDuration(s.Interval) <= 0 {
+		errs = append(errs, fmt.Errorf("%w: bad interval %q", ErrInvalidTask, s.Interval))
+	}
+	if !r.Timerless(s.CleanTask.Task) && s.Interval == "" && r.defaultInterval(s.CleanTask.Task) <= 0 {
+		errs = append(errs, fmt.Errorf("%w: missing interval", ErrInvalidTask))
+	}
+	if s.Quorum < 0 {
+		errs = append(errs, fmt.Errorf("%w: negative quorum", ErrInvalidTask))
+	}
+	if schema, ok := r.ParamSchema(s.CleanTask.Task); ok {
+		errs = append(errs, schema.Check(s.Params)...)
+	}
+	return errs
+}
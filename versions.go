@@ -0,0 +1,134 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"pkg.goda.sh/tasks"
+)
+
+// MaxVersions is the number of definitions kept per task, including the current one
+const MaxVersions = 10
+
+var (
+	// ErrUnknownVersion is returned by Rollback for a version that isn't kept anymore
+	ErrUnknownVersion = errors.New("runner: unknown task version")
+)
+
+// Version is a definition a task has had
+type Version struct {
+	Version int   `json:"version"`
+	Spec    Spec  `json:"spec"`
+	Updated int64 `json:"updated"`
+}
+
+// Versions gets the kept definitions of a task, oldest first. Versions carry over to the new
+// task ID when a task is updated.
+func (r *Runner) Versions(id string) []Version {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if list, ok := r.versions[id]; ok {
+		return append([]Version(nil), list...)
+	}
+	if spec, ok := r.specs[id]; ok {
+		return []Version{{Version: 1, Spec: spec}}
+	}
+	return nil
+}
+
+// Rollback replaces a task by one of its prior definitions and returns the new task ID. The
+// rollback is recorded as a new version.
+func (r *Runner) Rollback(ctx context.Context, id string, version int) (string, error) {
+	for _, v := range r.Versions(id) {
+		if v.Version == version {
+			return r.replace(ctx, id, v.Spec)
+		}
+	}
+	if _, ok := r.find(id); !ok {
+		return "", ErrUnknownTask
+	}
+	return "", ErrUnknownVersion
+}
+
+// replace swaps a task for a new definition and carries its versions over, along with its
+// last result and history when the task ID doesn't change. The new definition is checked
+// before the task is removed, and the task is added back if the new one can't be added.
+func (r *Runner) replace(ctx context.Context, id string, spec Spec) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	if err := r.validate(spec); err != nil {
+		return "", err
+	}
+	t := spec.Task()
+	t.Location, t.Interval = r.Identity.Location, normalizeInterval(t.Interval) // As hashed by add
+	next := r.Hash(t)
+	prior := r.Versions(id)
+	last, _ := r.find(id)
+	r.mu.RLock()
+	old, ok := r.specs[id]
+	_, taken := r.cancels[next]
+	history := r.history[id]
+	r.mu.RUnlock()
+	if !ok {
+		return "", ErrUnknownTask
+	}
+	if taken && next != id {
+		return "", fmt.Errorf("%w: %q (%s/%s)", ErrDuplicateTask, t.Label, t.Task, next)
+	}
+	if !r.remove(id) {
+		return "", ErrUnknownTask
+	}
+	spec.ID = ""
+	if err := r.AddSpec(ctx, spec); err != nil {
+		if restoreErr := r.AddSpec(r.ctx, old); restoreErr != nil {
+			r.logf(slog.LevelError, "Could not add %s back after failing to replace it: %v\n", id, restoreErr)
+		} else {
+			r.carry(id, last, history, prior)
+		}
+		return "", err
+	}
+	if next == id {
+		r.carry(id, last, history, nil)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, ok := r.specs[next]
+	if !ok {
+		return "", ErrInvalidTask
+	}
+	n := 1
+	if len(prior) > 0 {
+		n = prior[len(prior)-1].Version + 1
+	}
+	list := append(prior, Version{
+		Version: n,
+		Spec:    stored,
+		Updated: time.Now().UnixNano() / int64(time.Millisecond),
+	})
+	if len(list) > MaxVersions {
+		list = list[len(list)-MaxVersions:]
+	}
+	r.versions[next] = list
+	return next, nil
+}
+
+// carry restores the last result, history and versions of a task that was added again with
+// the same ID, nil ones are left as they are
+func (r *Runner) carry(id string, last tasks.Task, history []Record, versions []Version) {
+	if t, ok := r.TaskList.Get(id); ok {
+		t.Last, t.Warn, t.Spark, t.Date = last.Last, last.Warn, last.Spark, last.Date
+		r.TaskList.Update(id, t)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if history != nil {
+		r.history[id] = history
+	}
+	if versions != nil {
+		r.versions[id] = versions
+	}
+}
@@ -0,0 +1,54 @@
+package runner_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"pkg.goda.sh/runner/v2"
+	"pkg.goda.sh/runner/v2/runnertest"
+)
+
+func TestUpdateKeepsTheTaskWhenTheNewDefinitionCantBeAdded(t *testing.T) {
+	ctx := context.Background()
+	r, _ := runnertest.New(t, map[string]*runnertest.Script{"probe": runnertest.NewScript()})
+	gateway := r.NewTask("probe").Label("gateway").Interval("PT1M").MustBuild()
+	dns := r.NewTask("probe").Label("dns").Interval("PT1M").MustBuild()
+	for _, spec := range []runner.Spec{gateway, dns} {
+		if err := r.AddSpec(ctx, spec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var id string
+	for _, task := range r.Tasks("probe") {
+		if task.Label == "gateway" {
+			id = task.ID
+		}
+	}
+	runnertest.Trigger(t, r, id)
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+
+	for _, c := range []struct {
+		name string
+		ctx  context.Context
+		spec runner.Spec
+		want error
+	}{
+		{"duplicate", ctx, dns, runner.ErrDuplicateTask},
+		{"cancelled", cancelled, r.NewTask("probe").Label("gateway").Interval("PT5M").MustBuild(), context.Canceled},
+	} {
+		if _, err := r.UpdateSpec(c.ctx, id, c.spec); !errors.Is(err, c.want) {
+			t.Errorf("%s: got %v, want %v", c.name, err, c.want)
+		}
+		if spec, ok := r.Spec(id); !ok || spec.Interval != "PT1M" {
+			t.Fatalf("%s: task %s is gone or changed after a failed update: %v", c.name, id, spec)
+		}
+		if n := len(r.History(id)); n != 1 {
+			t.Errorf("%s: %d results in the history, want 1", c.name, n)
+		}
+	}
+	if n := len(r.Tasks("probe")); n != 2 {
+		t.Errorf("%d tasks, want 2", n)
+	}
+}
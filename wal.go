@@ -0,0 +1,259 @@
+package runner
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// WAL operations
+const (
+	WALAdd    = "add"
+	WALRemove = "remove"
+)
+
+// WALEntry is a single task mutation
+type WALEntry struct {
+	Op     string `json:"op"`
+	ID     string `json:"id"`
+	Spec   *Spec  `json:"spec,omitempty"`
+	Sealed []byte `json:"sealed,omitempty"` // Spec encrypted with WithEncryption
+	Time   int64  `json:"time"`
+}
+
+// WAL is an append-only log of task mutations
+type WAL interface {
+	Append(e WALEntry) error
+	// Replay calls fn for every entry in the order they were appended
+	Replay(fn func(WALEntry) error) error
+}
+
+// CompactingWAL is a WAL that can drop the entries of tasks that were removed since, so it
+// doesn't grow with every mutation. The Runner compacts it after replaying it and at every
+// checkpoint, see WithCheckpoint.
+type CompactingWAL interface {
+	WAL
+	Compact() error
+}
+
+// WithWAL logs every task added or removed after the Runner is created, and replays
+// the log on creation so dynamically added tasks survive restarts. The tasks passed to
+// NewRunner are not logged, as they are provided again on every start. Tasks removed when
+// the context they were added with is done are logged as removed, unless the Runner is
+// being stopped.
+func WithWAL(w WAL) Option {
+	return func(r *Runner) {
+		r.wal = w
+	}
+}
+
+// replay applies a WAL to the Runner without logging the mutations again
+func (r *Runner) replay() {
+	if r.wal == nil {
+		return
+	}
+	if err := r.wal.Replay(func(e WALEntry) error {
+		switch e.Op {
+		case WALAdd:
+			if e.Sealed != nil {
+				spec, err := r.unseal(e.Sealed)
+				if err != nil {
+					r.logf(slog.LevelError, "Could not decrypt logged task %s: %v\n", e.ID, err)
+					return nil
+				}
+				e.Spec = &spec
+			}
+			if e.Spec != nil {
+				if err := r.AddSpec(r.ctx, *e.Spec); err != nil && !errors.Is(err, ErrDuplicateTask) {
+					r.logf(slog.LevelError, "Could not replay logged task %s: %v\n", e.ID, err)
+				}
+			}
+		case WALRemove:
+			r.remove(e.ID)
+		}
+		return nil
+	}); err != nil {
+		r.logf(slog.LevelError, "Could not replay task log: %v\n", err)
+	}
+}
+
+// compactWAL compacts the WAL if it supports it
+func (r *Runner) compactWAL() {
+	w, ok := r.wal.(CompactingWAL)
+	if !ok {
+		return
+	}
+	if err := w.Compact(); err != nil {
+		r.logf(slog.LevelError, "Could not compact task log: %v\n", err)
+	}
+}
+
+// LiveEntries gets the indexes of the entries adding tasks that weren't removed afterwards,
+// those a CompactingWAL keeps
+func LiveEntries(entries []WALEntry) map[int]bool {
+	added := make(map[string]int)
+	for i, e := range entries {
+		switch e.Op {
+		case WALAdd:
+			added[e.ID] = i
+		case WALRemove:
+			delete(added, e.ID)
+		}
+	}
+	keep := make(map[int]bool, len(added))
+	for _, i := range added {
+		keep[i] = true
+	}
+	return keep
+}
+
+// logMutation appends a mutation to the WAL unless it is being replayed
+func (r *Runner) logMutation(op, id string, spec *Spec) {
+	if r.wal == nil || r.replaying {
+		return
+	}
+	e := WALEntry{Op: op, ID: id, Spec: spec, Time: time.Now().UnixNano() / int64(time.Millisecond)}
+	if r.cipher != nil && spec != nil {
+		sealed, err := r.seal(*spec)
+		if err != nil {
+			r.logf(slog.LevelError, "Could not encrypt %s of %s: %v\n", op, id, err)
+			return
+		}
+		e.Spec, e.Sealed = nil, sealed
+	}
+	if err := r.wal.Append(e); err != nil {
+		r.logf(slog.LevelError, "Could not log %s of %s: %v\n", op, id, err)
+	}
+}
+
+// FileWAL is a WAL stored as JSON lines in a local file
+type FileWAL struct {
+	path string
+	file *os.File
+	mu   sync.Mutex
+	logs
+}
+
+// OpenFileWAL opens or creates a file based WAL
+func OpenFileWAL(path string) (*FileWAL, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &FileWAL{path: path, file: file}, nil
+}
+
+// Append writes an entry and syncs it to disk
+func (w *FileWAL) Append(e WALEntry) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return os.ErrClosed
+	}
+	if _, err := w.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return w.file.Sync()
+}
+
+// Replay reads the file from the start, skipping a torn last line left by a crash
+func (w *FileWAL) Replay(fn func(WALEntry) error) error {
+	file, err := os.Open(w.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var e WALEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			w.logf(slog.LevelWarn, "Skipping corrupt task log entry: %v\n", err)
+			continue
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// Compact rewrites the file with the entries of the tasks that weren't removed, replacing
+// it atomically
+func (w *FileWAL) Compact() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return nil // Closed before the last checkpoint of its Runner
+	}
+	var entries []WALEntry
+	if err := w.Replay(func(e WALEntry) error {
+		entries = append(entries, e)
+		return nil
+	}); err != nil {
+		return err
+	}
+	keep := LiveEntries(entries)
+	if len(keep) == len(entries) {
+		return nil
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(w.path), filepath.Base(w.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	out := bufio.NewWriter(tmp)
+	for i, e := range entries {
+		if !keep[i] {
+			continue
+		}
+		line, err := json.Marshal(e)
+		if err != nil {
+			tmp.Close()
+			return err
+		}
+		out.Write(append(line, '\n'))
+	}
+	if err := out.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), w.path); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(w.path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	w.file.Close()
+	w.file = file
+	return nil
+}
+
+// Close closes the underlying file
+func (w *FileWAL) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return os.ErrClosed
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
@@ -0,0 +1,90 @@
+package runner_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"pkg.goda.sh/runner/v2"
+	"pkg.goda.sh/runner/v2/runnertest"
+)
+
+// restart opens the WAL at path and creates a Runner replaying it
+func restart(t *testing.T, path string, opts ...runner.Option) *runner.Runner {
+	t.Helper()
+	wal, err := runner.OpenFileWAL(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { wal.Close() })
+	r, _ := runnertest.New(t, map[string]*runnertest.Script{"probe": runnertest.NewScript()}, append(opts, runner.WithWAL(wal))...)
+	return r
+}
+
+func TestWALLogsTasksRemovedByTheirContext(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tasks.wal")
+	r := restart(t, path)
+	request, cancel := context.WithCancel(context.Background())
+	if err := r.AddSpec(request, r.NewTask("probe").Label("request").Interval("PT1M").MustBuild()); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.AddSpec(context.Background(), r.NewTask("probe").Label("kept").Interval("PT1M").MustBuild()); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	deadline := time.Now().Add(5 * time.Second)
+	for len(r.Tasks("probe")) != 1 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	r.Stop()
+
+	restored := restart(t, path).Tasks("probe")
+	if len(restored) != 1 || restored[0].Label != "kept" {
+		t.Fatalf("restored %v, want only the task whose context is still alive", restored)
+	}
+}
+
+func TestFileWALCompacts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tasks.wal")
+	r := restart(t, path, runner.WithCheckpoint(50*time.Millisecond))
+	ctx := context.Background()
+	for i := 0; i < 100; i++ {
+		spec := r.NewTask("probe").Label(fmt.Sprint("churn-", i)).Interval("PT1M").MustBuild()
+		if err := r.AddSpec(ctx, spec); err != nil {
+			t.Fatal(err)
+		}
+		r.Remove(ctx, r.Tasks("probe")[0].ID)
+	}
+	if err := r.AddSpec(ctx, r.NewTask("probe").Label("kept").Interval("PT1M").MustBuild()); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for lines(t, path) != 1 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := lines(t, path); n != 1 {
+		t.Fatalf("%d entries in the WAL after a checkpoint, want 1", n)
+	}
+	if err := r.AddSpec(ctx, r.NewTask("probe").Label("added").Interval("PT1M").MustBuild()); err != nil {
+		t.Fatal(err)
+	}
+	r.Stop()
+
+	restored := restart(t, path).Tasks("probe")
+	if len(restored) != 2 {
+		t.Fatalf("restored %v, want the 2 tasks added after compacting", restored)
+	}
+}
+
+func lines(t *testing.T, path string) int {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bytes.Count(data, []byte("\n"))
+}
@@ -0,0 +1,116 @@
+package runner
+
+import (
+	"context"
+	"time"
+
+	"pkg.goda.sh/tasks"
+)
+
+// WatchBuffer is the number of changes a watcher may fall behind before it is closed
+const WatchBuffer = 256
+
+// TaskEventType is the kind of change of a TaskEvent
+type TaskEventType string
+
+// Task event types
+const (
+	TaskAdded   TaskEventType = "added"
+	TaskUpdated TaskEventType = "updated" // The task has a new result
+	TaskRemoved TaskEventType = "removed" // Removed, or no longer matching the filter of Watch
+)
+
+// TaskEvent is a change to the task list
+type TaskEvent struct {
+	Type   TaskEventType   `json:"type"`
+	Task   tasks.CleanTask `json:"task"`
+	Result tasks.Result    `json:"-"` // Set for TaskUpdated
+}
+
+type watcher struct {
+	inbox  chan TaskEvent
+	cancel context.CancelFunc
+}
+
+// Watch gets the tasks matching filter along with a feed of the changes to them, until ctx is
+// done. Changes made while the snapshot is taken may be in both, so apply updates by task ID.
+// Updates are closed once ctx is done, or when the caller falls more than WatchBuffer changes
+// behind, in which case Watch again to resync.
+func (r *Runner) Watch(ctx context.Context, filter Query) ([]tasks.CleanTask, <-chan TaskEvent, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	w := &watcher{inbox: make(chan TaskEvent, WatchBuffer), cancel: cancel}
+	r.mu.Lock()
+	if r.watchers == nil {
+		r.watchers = make(map[*watcher]struct{})
+	}
+	r.watchers[w] = struct{}{}
+	r.mu.Unlock()
+	page := filter
+	page.Offset, page.Limit = 0, 0 // Updates can't be paginated
+	snapshot := r.Query(page).Tasks
+	seen := make(map[string]bool, len(snapshot))
+	for _, t := range snapshot {
+		seen[t.ID] = true
+	}
+	out := make(chan TaskEvent, WatchBuffer)
+	go func() {
+		defer close(out)
+		defer func() {
+			r.mu.Lock()
+			delete(r.watchers, w)
+			r.mu.Unlock()
+		}()
+		for {
+			var e TaskEvent
+			select {
+			case e = <-w.inbox:
+			case <-ctx.Done():
+				return
+			}
+			now := time.Now().UnixNano() / int64(time.Millisecond)
+			switch {
+			case e.Type == TaskRemoved && !seen[e.Task.ID]:
+				continue
+			case e.Type == TaskRemoved:
+				delete(seen, e.Task.ID)
+			case r.matches(filter, tasks.Task(e.Task), now):
+				seen[e.Task.ID] = true
+			case seen[e.Task.ID]:
+				delete(seen, e.Task.ID)
+				e = TaskEvent{Type: TaskRemoved, Task: e.Task}
+			default:
+				continue
+			}
+			e.Task, e.Result = tasks.CleanTask(copyTask(tasks.Task(e.Task))), copyResult(e.Result)
+			select {
+			case out <- e:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return snapshot, out, nil
+}
+
+// notify hands a change to every watcher, closing the ones that fell behind
+func (r *Runner) notify(typ TaskEventType, t tasks.Task, result tasks.Result) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if len(r.watchers) == 0 {
+		return
+	}
+	if t.Last == nil {
+		t.Last = struct{}{}
+	}
+	e := TaskEvent{Type: typ, Task: tasks.CleanTask(t), Result: result}
+	for w := range r.watchers {
+		select {
+		case w.inbox <- e:
+		default:
+			w.cancel()
+		}
+	}
+}
@@ -0,0 +1,184 @@
+// Package webhook provides an HTTP handler running the tasks of a Runner when external
+// systems, like CI or Alertmanager, call their webhook.
+//
+// The handler serves a route per hook relative to where it is mounted:
+//
+//	POST /{name}             run the task of the hook, replying 202
+//	POST /{name}?wait=true   run it and reply with its result
+//
+// Calls authenticate with the secret of their hook, as a bearer token, the password of basic
+// auth or the HMAC-SHA256 of the body in the X-Hub-Signature-256 header, as sent by GitHub.
+// Hooks without a secret refuse every call. The body is a JSON object, the fields named by
+// the Params of the hook are set over the params of the task for the run, see
+// Runner.RunNowWith, other fields are ignored. Runs without params are triggered like with
+// Runner.RunNow unless waited for.
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"pkg.goda.sh/runner/v2"
+)
+
+// maxBody is the largest request body accepted
+const maxBody = 1 << 20
+
+// Hook maps the calls of a webhook to a task
+type Hook struct {
+	Task   string   `json:"task"`   // ID or label of the task run
+	Secret string   `json:"secret"` // Calls authenticate with
+	Params []string `json:"params"` // Fields of the body set as params of the run
+	Body   string   `json:"body"`   // Param the whole body is set as, none when empty
+}
+
+type handler struct {
+	r     *runner.Runner
+	hooks map[string]Hook
+}
+
+// Handler creates an http.Handler serving hooks by name for r, mount it with
+// http.StripPrefix
+func Handler(r *runner.Runner, hooks map[string]Hook) http.Handler {
+	return &handler{r: r, hooks: hooks}
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	hook, ok := h.hooks[strings.Trim(req.URL.Path, "/")]
+	if !ok {
+		fail(w, http.StatusNotFound, errors.New("not found"))
+		return
+	}
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		fail(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(req.Body, maxBody))
+	if err != nil {
+		fail(w, http.StatusBadRequest, err)
+		return
+	}
+	if !authenticated(req, body, hook.Secret) {
+		fail(w, http.StatusUnauthorized, errors.New("unauthorized"))
+		return
+	}
+	params, err := hook.params(body)
+	if err != nil {
+		fail(w, http.StatusBadRequest, err)
+		return
+	}
+	id, ok := h.find(hook.Task)
+	if !ok {
+		fail(w, http.StatusNotFound, runner.ErrUnknownTask)
+		return
+	}
+	wait, _ := strconv.ParseBool(req.URL.Query().Get("wait"))
+	if len(params) == 0 && !wait {
+		h.done(w, h.r.RunNow(req.Context(), id))
+		return
+	}
+	results, err := h.r.RunNowWith(h.r.Context(), id, params) // Runs outlive the request
+	if err != nil || !wait {
+		h.done(w, err)
+		return
+	}
+	select {
+	case res := <-results:
+		out := map[string]interface{}{"update": res.Update, "warn": res.Warn}
+		if res.Error != nil {
+			out["error"] = res.Error.Error()
+		}
+		if res.Cancelled {
+			out["cancelled"] = true
+		}
+		reply(w, http.StatusOK, out)
+	case <-req.Context().Done():
+	}
+}
+
+// done replies to a call once its run is started
+func (h *handler) done(w http.ResponseWriter, err error) {
+	switch {
+	case err == nil:
+		w.WriteHeader(http.StatusAccepted)
+	case errors.Is(err, runner.ErrUnknownTask):
+		fail(w, http.StatusNotFound, err)
+	case errors.Is(err, runner.ErrInvalidTask):
+		fail(w, http.StatusBadRequest, err)
+	default:
+		fail(w, http.StatusConflict, err)
+	}
+}
+
+// find gets the ID of a task from its ID or label
+func (h *handler) find(task string) (string, bool) {
+	if _, ok := h.r.Task(task); ok {
+		return task, true
+	}
+	for id, t := range h.r.All() {
+		if t.Label == task {
+			return id, true
+		}
+	}
+	return "", false
+}
+
+// params gets the params of a run from the body of a call
+func (hook Hook) params(body []byte) (map[string]interface{}, error) {
+	if len(hook.Params) == 0 && hook.Body == "" {
+		return nil, nil
+	}
+	var payload map[string]interface{}
+	if len(strings.TrimSpace(string(body))) > 0 {
+		if err := json.Unmarshal(body, &payload); err != nil {
+			return nil, err
+		}
+	}
+	params := make(map[string]interface{}, len(hook.Params)+1)
+	for _, name := range hook.Params {
+		if v, ok := payload[name]; ok {
+			params[name] = v
+		}
+	}
+	if hook.Body != "" && payload != nil {
+		params[hook.Body] = payload
+	}
+	return params, nil
+}
+
+// authenticated checks the credentials of a call against secret
+func authenticated(req *http.Request, body []byte, secret string) bool {
+	if secret == "" {
+		return false
+	}
+	if sig, ok := strings.CutPrefix(req.Header.Get("X-Hub-Signature-256"), "sha256="); ok {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(body)
+		want := hex.EncodeToString(mac.Sum(nil))
+		return hmac.Equal([]byte(strings.ToLower(sig)), []byte(want))
+	}
+	if _, password, ok := req.BasicAuth(); ok {
+		return subtle.ConstantTimeCompare([]byte(password), []byte(secret)) == 1
+	}
+	token, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(token), []byte(secret)) == 1
+}
+
+func reply(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func fail(w http.ResponseWriter, code int, err error) {
+	reply(w, code, map[string]string{"error": err.Error()})
+}